@@ -58,23 +58,13 @@ func NewAPI(volplugin Volplugin, hostname string, client *config.Client, global
 	}
 }
 
-// RESTHTTPError returns a 500 status with the error.
-func RESTHTTPError(w http.ResponseWriter, err error) {
-	if err == nil {
-		err = errors.Unknown
-	}
-
-	logrus.Errorf("Returning HTTP error handling plugin negotiation: %s", err.Error())
-	http.Error(w, err.Error(), http.StatusInternalServerError)
-}
-
 // Action is a catchall for additional driver functions.
 func Action(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	logrus.Debugf("Unknown driver action at %q", r.URL.Path)
 	content, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		logrus.Debug("Error reading body for %q", r.URL.Path)
+		logrus.Debugf("Error reading body for %q", r.URL.Path)
 		RESTHTTPError(w, err)
 		return
 	}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+)
+
+// Error codes of HTTPError. They are stable, so scripts may rely on them.
+const (
+	CodeNotExists     = "not_exists"
+	CodeExists        = "exists"
+	CodeLocked        = "locked"
+	CodeConflict      = "conflict"
+	CodeInvalid       = "invalid"
+	CodeQuotaExceeded = "quota_exceeded"
+	CodeUnsupported   = "unsupported"
+	CodeUnavailable   = "unavailable"
+	CodeUnauthorized  = "unauthorized"
+	CodeForbidden     = "forbidden"
+	CodeInternal      = "internal"
+)
+
+type httpErrorMapping struct {
+	err    *errored.Error
+	code   string
+	status int
+}
+
+// httpErrors maps the sentinel errors to codes and statuses. The first
+// sentinel an error contains wins, so more specific ones come first.
+var httpErrors = []httpErrorMapping{
+	{errors.Unauthorized, CodeUnauthorized, http.StatusUnauthorized},
+	{errors.Forbidden, CodeForbidden, http.StatusForbidden},
+	{errors.NotExists, CodeNotExists, http.StatusNotFound},
+	{errors.Exists, CodeExists, http.StatusConflict},
+	{errors.LockFailed, CodeLocked, 423},
+	{errors.LockMismatch, CodeLocked, 423},
+	{errors.VolumeMounted, CodeConflict, http.StatusConflict},
+	{errors.QuotaExceeded, CodeQuotaExceeded, http.StatusForbidden},
+	{errors.ResizeUnsupported, CodeUnsupported, http.StatusNotImplemented},
+	{errors.SnapshotsUnsupported, CodeUnsupported, http.StatusNotImplemented},
+	{errors.ErrJSONValidation, CodeInvalid, http.StatusBadRequest},
+	{errors.InvalidVolume, CodeInvalid, http.StatusBadRequest},
+	{errors.CannotCopyVolume, CodeInvalid, http.StatusBadRequest},
+	{errors.InvalidGlobal, CodeInvalid, http.StatusBadRequest},
+	{errors.InvalidLabel, CodeInvalid, http.StatusBadRequest},
+	{errors.InvalidSelector, CodeInvalid, http.StatusBadRequest},
+	{errors.InvalidEventFilter, CodeInvalid, http.StatusBadRequest},
+	{errors.ReadBody, CodeInvalid, http.StatusBadRequest},
+	{errors.UnmarshalRequest, CodeInvalid, http.StatusBadRequest},
+	{errors.UnmarshalGlobal, CodeInvalid, http.StatusBadRequest},
+	{errors.UnmarshalPolicy, CodeInvalid, http.StatusBadRequest},
+	{errors.UnmarshalRuntime, CodeInvalid, http.StatusBadRequest},
+	{errors.ResizeShrink, CodeInvalid, http.StatusBadRequest},
+	{errors.MissingSizeOption, CodeInvalid, http.StatusBadRequest},
+	{errors.MissingSnapshot, CodeInvalid, http.StatusBadRequest},
+	{errors.NoSnapshotRetention, CodeInvalid, http.StatusBadRequest},
+	{errors.MissingSnapshotOption, CodeInvalid, http.StatusBadRequest},
+	{errors.MissingTargetOption, CodeInvalid, http.StatusBadRequest},
+}
+
+// HTTPError is the body of the error responses of the apiserver.
+type HTTPError struct {
+	// Status is the HTTP status of the response. It is not part of the body.
+	Status  int      `json:"-"`
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Causes  []string `json:"causes"`
+}
+
+func (e *HTTPError) Error() string {
+	return strings.Join(append([]string{e.Message}, e.Causes...), ": ")
+}
+
+// Contains returns true if the error was caused by the sentinel error, as
+// far as its code tells.
+func (e *HTTPError) Contains(sentinel *errored.Error) bool {
+	for _, mapping := range httpErrors {
+		if mapping.err == sentinel {
+			return mapping.code == e.Code
+		}
+	}
+
+	return false
+}
+
+// NewHTTPError converts an error into an HTTPError, working out its status
+// and code from the sentinel errors it contains.
+func NewHTTPError(err error) *HTTPError {
+	if err == nil {
+		err = errors.Unknown
+	}
+
+	herr := &HTTPError{
+		Status:  http.StatusInternalServerError,
+		Code:    CodeInternal,
+		Message: err.Error(),
+		Causes:  []string{},
+	}
+
+	erd, ok := err.(*errored.Error)
+	if !ok {
+		if unavailable(err) {
+			herr.Status, herr.Code = http.StatusServiceUnavailable, CodeUnavailable
+		}
+
+		return herr
+	}
+
+	all := []error{}
+	erd.ContainsFunc(func(cause error) bool {
+		all = append(all, cause)
+		return false
+	})
+
+	herr.Message = erd.String()
+	for _, cause := range all[1:] {
+		herr.Causes = append(herr.Causes, cause.Error())
+	}
+
+	for _, mapping := range httpErrors {
+		if erd.Contains(mapping.err) {
+			herr.Status, herr.Code = mapping.status, mapping.code
+			return herr
+		}
+	}
+
+	if erd.ContainsFunc(unavailable) {
+		herr.Status, herr.Code = http.StatusServiceUnavailable, CodeUnavailable
+	}
+
+	return herr
+}
+
+// unavailable returns true if the error means etcd could not be reached.
+func unavailable(err error) bool {
+	if _, ok := err.(*client.ClusterError); ok {
+		return true
+	}
+
+	return err == client.ErrClusterUnavailable
+}
+
+// RESTHTTPError writes the error as an HTTPError, with the status matching
+// its cause.
+func RESTHTTPError(w http.ResponseWriter, err error) {
+	herr := NewHTTPError(err)
+
+	logrus.Errorf("Returning HTTP error handling plugin negotiation: %s", herr.Error())
+
+	content, merr := json.Marshal(herr)
+	if merr != nil {
+		http.Error(w, herr.Error(), herr.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(herr.Status)
+	w.Write(content)
+}
+
+// DecodeHTTPError reads the error in the body of a failed response. Bodies
+// which are not an HTTPError, e.g. from proxies, become its message.
+func DecodeHTTPError(resp *http.Response) *HTTPError {
+	defer resp.Body.Close()
+
+	herr := &HTTPError{}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil || json.Unmarshal(content, herr) != nil || herr.Code == "" {
+		herr = &HTTPError{Code: CodeInternal, Message: strings.TrimSpace(string(content)), Causes: []string{}}
+		if herr.Message == "" {
+			herr.Message = resp.Status
+		}
+	}
+
+	herr.Status = resp.StatusCode
+	return herr
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	. "testing"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+
+	. "gopkg.in/check.v1"
+)
+
+type apiSuite struct{}
+
+var _ = Suite(&apiSuite{})
+
+func TestAPI(t *T) { TestingT(t) }
+
+func (s *apiSuite) TestNewHTTPError(c *C) {
+	statuses := map[error]int{
+		nil:                  http.StatusInternalServerError,
+		fmt.Errorf("broken"): http.StatusInternalServerError,
+		errors.PublishPolicy.Combine(errored.Errorf("no reason")):                          http.StatusInternalServerError,
+		errors.GetVolume.Combine(errors.NotExists):                                         http.StatusNotFound,
+		errors.PublishVolume.Combine(errors.Exists):                                        http.StatusConflict,
+		errors.RemoveVolume.Combine(errored.New("policy1/vol")).Combine(errors.LockFailed): 423,
+		errors.PublishPolicy.Combine(errors.ErrJSONValidation):                             http.StatusBadRequest,
+		errors.CreateVolume.Combine(errors.QuotaExceeded):                                  http.StatusForbidden,
+		errors.ListPolicy.Combine(&client.ClusterError{}):                                  http.StatusServiceUnavailable,
+		client.ErrClusterUnavailable:                                                       http.StatusServiceUnavailable,
+	}
+
+	for err, status := range statuses {
+		c.Assert(NewHTTPError(err).Status, Equals, status, Commentf("%v", err))
+	}
+
+	herr := NewHTTPError(errors.RemoveVolume.Combine(errored.New("policy1/vol")).Combine(errors.LockFailed))
+	c.Assert(herr.Code, Equals, CodeLocked)
+	c.Assert(herr.Message, Equals, errors.RemoveVolume.String())
+	c.Assert(herr.Causes, DeepEquals, []string{"policy1/vol", errors.LockFailed.String()})
+	c.Assert(herr.Contains(errors.LockFailed), Equals, true)
+	c.Assert(herr.Contains(errors.NotExists), Equals, false)
+	c.Assert(herr.Error(), Equals, errors.RemoveVolume.Combine(errored.New("policy1/vol")).Combine(errors.LockFailed).Error())
+}
+
+func (s *apiSuite) TestRESTHTTPError(c *C) {
+	w := httptest.NewRecorder()
+	RESTHTTPError(w, errors.GetVolume.Combine(errors.NotExists))
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+
+	herr := &HTTPError{}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), herr), IsNil)
+	c.Assert(herr, DeepEquals, &HTTPError{Code: CodeNotExists, Message: errors.GetVolume.String(), Causes: []string{errors.NotExists.String()}})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/proxy" {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+
+		RESTHTTPError(w, errors.PublishVolume.Combine(errors.Exists))
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	c.Assert(err, IsNil)
+	herr = DecodeHTTPError(resp)
+	c.Assert(herr.Status, Equals, http.StatusConflict)
+	c.Assert(herr.Contains(errors.Exists), Equals, true)
+
+	resp, err = http.Get(server.URL + "/proxy")
+	c.Assert(err, IsNil)
+	herr = DecodeHTTPError(resp)
+	c.Assert(herr.Status, Equals, http.StatusBadGateway)
+	c.Assert(herr.Code, Equals, CodeInternal)
+	c.Assert(herr.Message, Equals, "bad gateway")
+}
@@ -25,6 +25,10 @@ func (a *API) createVolume(w http.ResponseWriter, volume *config.VolumeRequest,
 
 		logrus.Debugf("Volume Create: %#v", *volConfig)
 
+		if err := a.Client.CheckQuota(policyObj, volConfig); err != nil {
+			return err
+		}
+
 		do, err := control.CreateVolume(policyObj, volConfig, global.Timeout)
 		if err == errors.NoActionTaken {
 			goto publish
@@ -94,7 +98,7 @@ func (a *API) Create(w http.ResponseWriter, r *http.Request) {
 	global := *a.Global
 
 	err = lock.NewDriver(a.Client).ExecuteWithMultiUseLock(
-		[]config.UseLocker{uc, snapUC},
+		config.QuotaLocks(policyObj, lock.ReasonCreate, uc, snapUC),
 		global.Timeout,
 		a.createVolume(w, volume, policyObj),
 	)
@@ -383,6 +387,10 @@ func (a *API) Unmount(w http.ResponseWriter, r *http.Request) {
 
 	a.MountCollection.Remove(volName)
 
+	if err := a.Client.RemoveMountStats(volConfig); err != nil {
+		logrus.Warnf("Could not remove mount stats for %q: %v", volName, err)
+	}
+
 	if !volConfig.Unlocked {
 		a.RemoveStopChan(volName)
 	}
@@ -0,0 +1,600 @@
+package csi
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
+	"github.com/contiv/volplugin/storage/control"
+	"github.com/docker/go-units"
+
+	spec "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// ControllerGetCapabilities implements Controller.ControllerGetCapabilities.
+func (s *Server) ControllerGetCapabilities(ctx context.Context, req *spec.ControllerGetCapabilitiesRequest) (*spec.ControllerGetCapabilitiesResponse, error) {
+	resp := &spec.ControllerGetCapabilitiesResponse{}
+
+	for _, rpc := range []spec.ControllerServiceCapability_RPC_Type{
+		spec.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+		spec.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+		spec.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+	} {
+		resp.Capabilities = append(resp.Capabilities, &spec.ControllerServiceCapability{
+			Type: &spec.ControllerServiceCapability_Rpc{
+				Rpc: &spec.ControllerServiceCapability_RPC{Type: rpc},
+			},
+		})
+	}
+
+	return resp, nil
+}
+
+// ControllerPublishVolume is not supported: volumes are attached by the node
+// staging them.
+func (s *Server) ControllerPublishVolume(ctx context.Context, req *spec.ControllerPublishVolumeRequest) (*spec.ControllerPublishVolumeResponse, error) {
+	return nil, statusf(codes.Unimplemented, "ControllerPublishVolume is not supported")
+}
+
+// ControllerUnpublishVolume is not supported, see ControllerPublishVolume.
+func (s *Server) ControllerUnpublishVolume(ctx context.Context, req *spec.ControllerUnpublishVolumeRequest) (*spec.ControllerUnpublishVolumeResponse, error) {
+	return nil, statusf(codes.Unimplemented, "ControllerUnpublishVolume is not supported")
+}
+
+// ListVolumes is not supported.
+func (s *Server) ListVolumes(ctx context.Context, req *spec.ListVolumesRequest) (*spec.ListVolumesResponse, error) {
+	return nil, statusf(codes.Unimplemented, "ListVolumes is not supported")
+}
+
+// GetCapacity is not supported.
+func (s *Server) GetCapacity(ctx context.Context, req *spec.GetCapacityRequest) (*spec.GetCapacityResponse, error) {
+	return nil, statusf(codes.Unimplemented, "GetCapacity is not supported")
+}
+
+// volumeOptions turns StorageClass parameters and the requested capacity into
+// volume options. Sizes are rounded up to whole megabytes, the unit the
+// storage drivers work in.
+func volumeOptions(req *spec.CreateVolumeRequest) map[string]string {
+	opts := map[string]string{}
+	for key, value := range req.Parameters {
+		if key != policyParameter {
+			opts[key] = value
+		}
+	}
+
+	if req.CapacityRange != nil && req.CapacityRange.RequiredBytes > 0 {
+		size := (req.CapacityRange.RequiredBytes + units.MiB - 1) / units.MiB
+		opts["size"] = fmt.Sprintf("%dMB", size)
+	}
+
+	return opts
+}
+
+func csiVolume(vc *config.Volume) (*spec.Volume, error) {
+	size, err := vc.CreateOptions.ActualSize()
+	if err != nil {
+		return nil, status(codes.Internal, err)
+	}
+
+	return &spec.Volume{
+		VolumeId:      vc.String(),
+		CapacityBytes: int64(size) * units.MiB,
+		VolumeContext: map[string]string{policyParameter: vc.PolicyName},
+	}, nil
+}
+
+// checkCapacity returns AlreadyExists if the volume does not fit the range.
+func checkCapacity(vol *spec.Volume, capRange *spec.CapacityRange) error {
+	if capRange == nil {
+		return nil
+	}
+
+	if vol.CapacityBytes < capRange.RequiredBytes || (capRange.LimitBytes > 0 && vol.CapacityBytes > capRange.LimitBytes) {
+		return statusf(codes.AlreadyExists, "volume %q has size %d, which is outside the requested range", vol.VolumeId, vol.CapacityBytes)
+	}
+
+	return nil
+}
+
+// CreateVolume implements Controller.CreateVolume. Creating a volume that
+// already exists with a compatible size succeeds, as the specification
+// requires.
+func (s *Server) CreateVolume(ctx context.Context, req *spec.CreateVolumeRequest) (*spec.CreateVolumeResponse, error) {
+	if req.Name == "" {
+		return nil, statusf(codes.InvalidArgument, "volume name is missing")
+	}
+
+	if len(req.VolumeCapabilities) == 0 {
+		return nil, statusf(codes.InvalidArgument, "volume capabilities are missing")
+	}
+
+	policyName := req.Parameters[policyParameter]
+	if policyName == "" {
+		return nil, statusf(codes.InvalidArgument, "the %q parameter is missing", policyParameter)
+	}
+
+	policy, err := s.Client.GetPolicy(policyName)
+	if err != nil {
+		return nil, statusf(codes.InvalidArgument, "%v", errors.GetPolicy.Combine(errored.New(policyName)).Combine(err))
+	}
+
+	if err := validateCapabilities(req.VolumeCapabilities, policy.Unlocked); err != nil {
+		return nil, err
+	}
+
+	if vc, err := s.Client.GetVolume(policyName, req.Name); err == nil {
+		vol, err := csiVolume(vc)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkCapacity(vol, req.CapacityRange); err != nil {
+			return nil, err
+		}
+
+		return &spec.CreateVolumeResponse{Volume: vol}, nil
+	}
+
+	volReq := &config.VolumeRequest{
+		Policy:  policyName,
+		Name:    req.Name,
+		Options: volumeOptions(req),
+	}
+
+	locks := []config.UseLocker{
+		&config.UseMount{
+			Volume:   volReq.String(),
+			Reason:   lock.ReasonCreate,
+			Hostname: s.Hostname,
+		},
+		&config.UseSnapshot{
+			Volume: volReq.String(),
+			Reason: lock.ReasonCreate,
+		},
+	}
+
+	var vol *spec.Volume
+
+	locks = config.QuotaLocks(policy, lock.ReasonCreate, locks...)
+
+	err = s.Lock.ExecuteWithMultiUseLock(locks, s.global().Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		vc, err := s.Client.CreateVolume(volReq)
+		if err != nil {
+			return err
+		}
+
+		if err := s.Client.CheckQuota(policy, vc); err != nil {
+			return err
+		}
+
+		if vol, err = csiVolume(vc); err != nil {
+			return err
+		}
+
+		if err := checkCapacity(vol, req.CapacityRange); err != nil {
+			return err
+		}
+
+		do, err := control.CreateVolume(policy, vc, s.global().Timeout)
+		if err == errors.NoActionTaken {
+			return s.Client.PublishVolume(vc)
+		}
+
+		if err != nil {
+			return errors.CreateVolume.Combine(err)
+		}
+
+		if err := control.FormatVolume(vc, do); err != nil {
+			if err := control.RemoveVolume(vc, s.global().Timeout); err != nil {
+				logrus.Errorf("Error during cleanup of failed format: %v", err)
+			}
+			return errors.FormatVolume.Combine(err)
+		}
+
+		return s.Client.PublishVolume(vc)
+	})
+
+	if err != nil {
+		return nil, status(codes.Internal, errors.CreateVolume.Combine(errored.New(volReq.String())).Combine(err))
+	}
+
+	return &spec.CreateVolumeResponse{Volume: vol}, nil
+}
+
+// DeleteVolume implements Controller.DeleteVolume. Deleting a volume that
+// does not exist succeeds. Mounted volumes cannot be deleted.
+func (s *Server) DeleteVolume(ctx context.Context, req *spec.DeleteVolumeRequest) (*spec.DeleteVolumeResponse, error) {
+	if req.VolumeId == "" {
+		return nil, statusf(codes.InvalidArgument, "volume ID is missing")
+	}
+
+	policy, name, err := splitVolumeID(req.VolumeId)
+	if err != nil {
+		// no volume can have this ID.
+		return &spec.DeleteVolumeResponse{}, nil
+	}
+
+	vc, err := s.Client.GetVolume(policy, name)
+	if er, ok := err.(*errored.Error); ok && er.Contains(errors.NotExists) {
+		return &spec.DeleteVolumeResponse{}, nil
+	} else if err != nil {
+		return nil, status(codes.Internal, errors.GetVolume.Combine(err))
+	}
+
+	locks := []config.UseLocker{
+		&config.UseMount{
+			Volume:   vc.String(),
+			Reason:   lock.ReasonRemove,
+			Hostname: s.Hostname,
+		},
+		&config.UseSnapshot{
+			Volume: vc.String(),
+			Reason: lock.ReasonRemove,
+		},
+	}
+
+	err = s.Lock.ExecuteWithMultiUseLock(locks, s.global().Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		if err := control.RemoveVolume(vc, s.global().Timeout); err != nil && err != errors.NoActionTaken {
+			return err
+		}
+
+		return s.Client.RemoveVolume(policy, name)
+	})
+
+	if er, ok := err.(*errored.Error); ok && er.Contains(errors.LockFailed) {
+		return nil, status(codes.FailedPrecondition, errors.RemoveVolume.Combine(errored.Errorf("volume %q is in use", vc)))
+	}
+
+	if err != nil {
+		return nil, status(codes.Internal, errors.RemoveVolume.Combine(errored.New(vc.String())).Combine(err))
+	}
+
+	return &spec.DeleteVolumeResponse{}, nil
+}
+
+// ValidateVolumeCapabilities implements
+// Controller.ValidateVolumeCapabilities.
+func (s *Server) ValidateVolumeCapabilities(ctx context.Context, req *spec.ValidateVolumeCapabilitiesRequest) (*spec.ValidateVolumeCapabilitiesResponse, error) {
+	if len(req.VolumeCapabilities) == 0 {
+		return nil, statusf(codes.InvalidArgument, "volume capabilities are missing")
+	}
+
+	vc, err := s.getVolume(req.VolumeId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateCapabilities(req.VolumeCapabilities, vc.Unlocked); err != nil {
+		return &spec.ValidateVolumeCapabilitiesResponse{Message: err.Error()}, nil
+	}
+
+	return &spec.ValidateVolumeCapabilitiesResponse{
+		Confirmed: &spec.ValidateVolumeCapabilitiesResponse_Confirmed{
+			VolumeContext:      req.VolumeContext,
+			VolumeCapabilities: req.VolumeCapabilities,
+			Parameters:         req.Parameters,
+		},
+	}, nil
+}
+
+func (s *Server) snapshotDriver(vc *config.Volume) (storage.SnapshotDriver, storage.DriverOptions, error) {
+	if vc.Backends.Snapshot == "" {
+		return nil, storage.DriverOptions{}, status(codes.InvalidArgument, errors.SnapshotsUnsupported.Combine(errored.New(vc.String())))
+	}
+
+	driver, err := backend.NewSnapshotDriver(vc.Backends.Snapshot)
+	if err != nil {
+		return nil, storage.DriverOptions{}, status(codes.Internal, errors.GetDriver.Combine(err))
+	}
+
+	do := storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   vc.String(),
+			Params: vc.DriverOptions,
+		},
+		Timeout: s.global().Timeout,
+	}
+
+	return driver, do, nil
+}
+
+func (s *Server) listSnapshots(vc *config.Volume) ([]*spec.Snapshot, error) {
+	driver, do, err := s.snapshotDriver(vc)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := driver.ListSnapshots(do)
+	if err != nil {
+		return nil, status(codes.Internal, errors.ListSnapshots.Combine(err))
+	}
+
+	vol, err := csiVolume(vc)
+	if err != nil {
+		return nil, err
+	}
+
+	snaps := []*spec.Snapshot{}
+	for _, name := range names {
+		snaps = append(snaps, &spec.Snapshot{
+			SnapshotId:     snapshotID(vc.String(), name),
+			SourceVolumeId: vc.String(),
+			SizeBytes:      vol.CapacityBytes,
+			ReadyToUse:     true,
+		})
+	}
+
+	return snaps, nil
+}
+
+// allSnapshots lists the snapshots of the volumes in volumeIDs, or of all
+// volumes if it is empty. Unknown volumes and volumes without snapshots are
+// skipped.
+func (s *Server) allSnapshots(volumeIDs []string) ([]*spec.Snapshot, error) {
+	if len(volumeIDs) == 0 {
+		all, err := s.Client.ListAllVolumes()
+		if err != nil {
+			return nil, status(codes.Internal, errors.ListVolume.Combine(err))
+		}
+		volumeIDs = all
+	}
+
+	entries := []*spec.Snapshot{}
+
+	for _, volumeID := range volumeIDs {
+		policy, name, err := splitVolumeID(volumeID)
+		if err != nil {
+			continue
+		}
+
+		vc, err := s.Client.GetVolume(policy, name)
+		if er, ok := err.(*errored.Error); ok && er.Contains(errors.NotExists) {
+			continue
+		} else if err != nil {
+			return nil, status(codes.Internal, errors.GetVolume.Combine(err))
+		}
+
+		if vc.Backends.Snapshot == "" {
+			continue
+		}
+
+		snaps, err := s.listSnapshots(vc)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, snaps...)
+	}
+
+	sort.Sort(snapshotsByID(entries))
+
+	return entries, nil
+}
+
+// CreateSnapshot implements Controller.CreateSnapshot. The CSI snapshot name
+// is used as the name of the snapshot in the storage backend. Snapshot names
+// are unique across volumes, as the specification requires.
+func (s *Server) CreateSnapshot(ctx context.Context, req *spec.CreateSnapshotRequest) (*spec.CreateSnapshotResponse, error) {
+	if req.Name == "" {
+		return nil, statusf(codes.InvalidArgument, "snapshot name is missing")
+	}
+
+	if req.SourceVolumeId == "" {
+		return nil, statusf(codes.InvalidArgument, "source volume ID is missing")
+	}
+
+	vc, err := s.getVolume(req.SourceVolumeId)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := s.allSnapshots(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	for _, snap := range all {
+		_, snapName, _ := splitSnapshotID(snap.SnapshotId)
+		if snapName == req.Name {
+			if snap.SourceVolumeId != vc.String() {
+				return nil, statusf(codes.AlreadyExists, "snapshot %q exists for volume %q", req.Name, snap.SourceVolumeId)
+			}
+
+			return &spec.CreateSnapshotResponse{Snapshot: snap}, nil
+		}
+
+		if snap.SourceVolumeId == vc.String() {
+			count++
+		}
+	}
+
+	pol, err := s.Client.GetPolicy(vc.PolicyName)
+	if err != nil {
+		return nil, status(codes.Internal, errors.GetPolicy.Combine(err))
+	}
+
+	if pol.Quota != nil {
+		if err := pol.Quota.CheckSnapshot(count); err != nil {
+			return nil, status(codes.ResourceExhausted, err)
+		}
+	}
+
+	driver, do, err := s.snapshotDriver(vc)
+	if err != nil {
+		return nil, err
+	}
+
+	uc := &config.UseSnapshot{
+		Volume: vc.String(),
+		Reason: lock.ReasonSnapshot,
+	}
+
+	err = s.Lock.ExecuteWithMultiUseLock([]config.UseLocker{uc}, s.global().Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		return driver.CreateSnapshot(req.Name, do)
+	})
+
+	if err != nil {
+		return nil, status(codes.Internal, errors.SnapshotFailed.Combine(errored.New(vc.String())).Combine(err))
+	}
+
+	vol, err := csiVolume(vc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &spec.CreateSnapshotResponse{
+		Snapshot: &spec.Snapshot{
+			SnapshotId:     snapshotID(vc.String(), req.Name),
+			SourceVolumeId: vc.String(),
+			SizeBytes:      vol.CapacityBytes,
+			CreationTime:   ptypes.TimestampNow(),
+			ReadyToUse:     true,
+		},
+	}, nil
+}
+
+// DeleteSnapshot implements Controller.DeleteSnapshot. Deleting a snapshot
+// that does not exist succeeds.
+func (s *Server) DeleteSnapshot(ctx context.Context, req *spec.DeleteSnapshotRequest) (*spec.DeleteSnapshotResponse, error) {
+	if req.SnapshotId == "" {
+		return nil, statusf(codes.InvalidArgument, "snapshot ID is missing")
+	}
+
+	volumeID, snapName, err := splitSnapshotID(req.SnapshotId)
+	if err != nil {
+		// no snapshot can have this ID.
+		return &spec.DeleteSnapshotResponse{}, nil
+	}
+
+	policy, name, err := splitVolumeID(volumeID)
+	if err != nil {
+		return nil, err
+	}
+
+	vc, err := s.Client.GetVolume(policy, name)
+	if er, ok := err.(*errored.Error); ok && er.Contains(errors.NotExists) {
+		return &spec.DeleteSnapshotResponse{}, nil
+	} else if err != nil {
+		return nil, status(codes.Internal, errors.GetVolume.Combine(err))
+	}
+
+	snaps, err := s.listSnapshots(vc)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	for _, snap := range snaps {
+		if snap.SnapshotId == req.SnapshotId {
+			found = true
+		}
+	}
+
+	if !found {
+		return &spec.DeleteSnapshotResponse{}, nil
+	}
+
+	driver, do, err := s.snapshotDriver(vc)
+	if err != nil {
+		return nil, err
+	}
+
+	uc := &config.UseSnapshot{
+		Volume: vc.String(),
+		Reason: lock.ReasonSnapshotPrune,
+	}
+
+	err = s.Lock.ExecuteWithMultiUseLock([]config.UseLocker{uc}, s.global().Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		return driver.RemoveSnapshot(snapName, do)
+	})
+
+	if err != nil {
+		return nil, status(codes.Internal, errored.Errorf("Removing snapshot %q", req.SnapshotId).Combine(err))
+	}
+
+	return &spec.DeleteSnapshotResponse{}, nil
+}
+
+// ListSnapshots implements Controller.ListSnapshots. Snapshots are sorted by
+// ID; the pagination token is the index of the next entry.
+func (s *Server) ListSnapshots(ctx context.Context, req *spec.ListSnapshotsRequest) (*spec.ListSnapshotsResponse, error) {
+	if req.MaxEntries < 0 {
+		return nil, statusf(codes.InvalidArgument, "max entries must not be negative")
+	}
+
+	volumeIDs := []string{}
+
+	switch {
+	case req.SnapshotId != "":
+		volumeID, _, err := splitSnapshotID(req.SnapshotId)
+		if err != nil {
+			// the specification asks for an empty result for unknown IDs.
+			return &spec.ListSnapshotsResponse{}, nil
+		}
+		volumeIDs = append(volumeIDs, volumeID)
+	case req.SourceVolumeId != "":
+		volumeIDs = append(volumeIDs, req.SourceVolumeId)
+	}
+
+	if len(volumeIDs) > 0 {
+		if _, _, err := splitVolumeID(volumeIDs[0]); err != nil {
+			return &spec.ListSnapshotsResponse{}, nil
+		}
+	}
+
+	snaps, err := s.allSnapshots(volumeIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*spec.Snapshot{}
+	for _, snap := range snaps {
+		if req.SnapshotId == "" || snap.SnapshotId == req.SnapshotId {
+			entries = append(entries, snap)
+		}
+	}
+
+	return paginate(entries, req.StartingToken, req.MaxEntries)
+}
+
+func paginate(entries []*spec.Snapshot, token string, max int32) (*spec.ListSnapshotsResponse, error) {
+	start := 0
+	if token != "" {
+		var err error
+		start, err = strconv.Atoi(token)
+		if err != nil || start < 0 || start > len(entries) {
+			return nil, statusf(codes.Aborted, "invalid starting token %q", token)
+		}
+	}
+
+	entries = entries[start:]
+
+	resp := &spec.ListSnapshotsResponse{}
+	if max > 0 && len(entries) > int(max) {
+		entries = entries[:max]
+		resp.NextToken = strconv.Itoa(start + int(max))
+	}
+
+	for _, snap := range entries {
+		resp.Entries = append(resp.Entries, &spec.ListSnapshotsResponse_Entry{Snapshot: snap})
+	}
+
+	return resp, nil
+}
+
+type snapshotsByID []*spec.Snapshot
+
+func (s snapshotsByID) Len() int           { return len(s) }
+func (s snapshotsByID) Less(i, j int) bool { return s[i].SnapshotId < s[j].SnapshotId }
+func (s snapshotsByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,258 @@
+// Package csi implements the Identity, Controller and Node services of the
+// Container Storage Interface on top of volplugin's configuration store,
+// locks and storage drivers.
+//
+// Volumes are identified as `policy/volume`, like everywhere else in
+// volplugin. The policy of a new volume is taken from the `policy` parameter
+// of the CSI StorageClass; every other parameter is passed on as a volume
+// option, as with `docker volume create --opt`.
+//
+// Server implements the gRPC services of version 1.0 of the specification;
+// Serve serves them on a unix socket, which volplugin does when started with
+// --csi-socket.
+package csi
+
+import (
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/api/internals/mount"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/storage"
+
+	spec "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// PluginName is the name volplugin reports to CSI orchestrators.
+const PluginName = "volplugin.contiv.io"
+
+// policyParameter is the StorageClass parameter holding the policy name.
+const policyParameter = "policy"
+
+// Server implements the CSI services.
+type Server struct {
+	Hostname string
+	Version  string
+	Client   *config.Client
+	Global   **config.Global // double pointer so we can track watch updates
+	Lock     *lock.Driver
+
+	// MountCollection tracks the volumes staged on this host.
+	MountCollection *mount.Collection
+
+	stopChanMutex sync.Mutex
+	stopChans     map[string]chan struct{}
+}
+
+// NewServer returns a *Server.
+func NewServer(hostname, version string, client *config.Client, global **config.Global) *Server {
+	return &Server{
+		Hostname:        hostname,
+		Version:         version,
+		Client:          client,
+		Global:          global,
+		Lock:            lock.NewDriver(client),
+		MountCollection: mount.NewCollection(),
+		stopChans:       map[string]chan struct{}{},
+	}
+}
+
+// Serve serves the Identity, Controller and Node services on the unix
+// socket at path, replacing a stale socket left there, until the listener
+// fails.
+func (s *Server) Serve(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	srv := grpc.NewServer(grpc.UnaryInterceptor(logErrors))
+	spec.RegisterIdentityServer(srv, s)
+	spec.RegisterControllerServer(srv, s)
+	spec.RegisterNodeServer(srv, s)
+
+	logrus.Infof("Serving CSI on %q", path)
+
+	return srv.Serve(l)
+}
+
+// logErrors logs the calls which fail.
+func logErrors(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		logrus.Errorf("CSI %s: %v", info.FullMethod, err)
+	}
+
+	return resp, err
+}
+
+// GetPluginInfo implements Identity.GetPluginInfo.
+func (s *Server) GetPluginInfo(ctx context.Context, req *spec.GetPluginInfoRequest) (*spec.GetPluginInfoResponse, error) {
+	return &spec.GetPluginInfoResponse{Name: PluginName, VendorVersion: s.Version}, nil
+}
+
+// GetPluginCapabilities implements Identity.GetPluginCapabilities.
+func (s *Server) GetPluginCapabilities(ctx context.Context, req *spec.GetPluginCapabilitiesRequest) (*spec.GetPluginCapabilitiesResponse, error) {
+	return &spec.GetPluginCapabilitiesResponse{
+		Capabilities: []*spec.PluginCapability{
+			{
+				Type: &spec.PluginCapability_Service_{
+					Service: &spec.PluginCapability_Service{Type: spec.PluginCapability_Service_CONTROLLER_SERVICE},
+				},
+			},
+		},
+	}, nil
+}
+
+// Probe implements Identity.Probe. The plugin is ready once it can read the
+// global configuration.
+func (s *Server) Probe(ctx context.Context, req *spec.ProbeRequest) (*spec.ProbeResponse, error) {
+	if _, err := s.Client.GetGlobal(); err != nil {
+		return nil, status(codes.FailedPrecondition, err)
+	}
+
+	return &spec.ProbeResponse{Ready: &wrappers.BoolValue{Value: true}}, nil
+}
+
+func (s *Server) global() *config.Global {
+	return *s.Global
+}
+
+// status wraps an error with a gRPC status code. errors.NotExists,
+// errors.Exists and errors.QuotaExceeded are mapped to NotFound,
+// AlreadyExists and ResourceExhausted regardless of the code passed. Errors
+// which already carry a status are returned as they are.
+func status(code codes.Code, err error) error {
+	if _, ok := grpcstatus.FromError(err); ok {
+		return err
+	}
+
+	if er, ok := err.(*errored.Error); ok {
+		switch {
+		case er.Contains(errors.NotExists):
+			code = codes.NotFound
+		case er.Contains(errors.Exists):
+			code = codes.AlreadyExists
+		case er.Contains(errors.QuotaExceeded):
+			code = codes.ResourceExhausted
+		}
+	}
+
+	if err == errors.NotExists {
+		code = codes.NotFound
+	}
+
+	return grpcstatus.Error(code, err.Error())
+}
+
+func statusf(code codes.Code, format string, args ...interface{}) error {
+	return grpcstatus.Errorf(code, format, args...)
+}
+
+// splitVolumeID splits a `policy/volume` ID.
+func splitVolumeID(id string) (string, string, error) {
+	policy, volume, err := storage.SplitName(id)
+	if err != nil {
+		return "", "", status(codes.InvalidArgument, err)
+	}
+
+	return policy, volume, nil
+}
+
+// getVolume returns the volume with the ID. Malformed IDs are reported as
+// NotFound, like unknown volumes, since no volume can have them.
+func (s *Server) getVolume(id string) (*config.Volume, error) {
+	if id == "" {
+		return nil, statusf(codes.InvalidArgument, "volume ID is missing")
+	}
+
+	policy, name, err := splitVolumeID(id)
+	if err != nil {
+		return nil, statusf(codes.NotFound, "volume %q does not exist", id)
+	}
+
+	vc, err := s.Client.GetVolume(policy, name)
+	if err != nil {
+		return nil, status(codes.Internal, errors.GetVolume.Combine(err))
+	}
+
+	return vc, nil
+}
+
+// splitSnapshotID splits a `policy/volume/snapshot` ID into the volume ID
+// and the snapshot name.
+func splitSnapshotID(id string) (string, string, error) {
+	idx := strings.LastIndex(id, "/")
+	if idx < 0 || idx == len(id)-1 {
+		return "", "", statusf(codes.InvalidArgument, "invalid snapshot ID %q", id)
+	}
+
+	if _, _, err := splitVolumeID(id[:idx]); err != nil {
+		return "", "", err
+	}
+
+	return id[:idx], id[idx+1:], nil
+}
+
+func snapshotID(volumeID, snapName string) string {
+	return volumeID + "/" + snapName
+}
+
+// validateCapabilities refuses block access, and access from several nodes
+// unless the volume is unlocked.
+func validateCapabilities(caps []*spec.VolumeCapability, unlocked bool) error {
+	for _, capability := range caps {
+		if capability == nil || capability.AccessMode == nil {
+			return statusf(codes.InvalidArgument, "volume capability is missing")
+		}
+
+		if capability.GetBlock() != nil {
+			return statusf(codes.InvalidArgument, "block access is not supported")
+		}
+
+		switch mode := capability.AccessMode.Mode; mode {
+		case spec.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, spec.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY:
+		case spec.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY, spec.VolumeCapability_AccessMode_MULTI_NODE_SINGLE_WRITER, spec.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER:
+			if !unlocked {
+				return statusf(codes.InvalidArgument, "access mode %v requires an unlocked policy", mode)
+			}
+		default:
+			return statusf(codes.InvalidArgument, "unknown access mode %v", mode)
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) addStopChan(name string, stopChan chan struct{}) {
+	s.stopChanMutex.Lock()
+	defer s.stopChanMutex.Unlock()
+	s.stopChans[name] = stopChan
+}
+
+func (s *Server) removeStopChan(name string) {
+	s.stopChanMutex.Lock()
+	defer s.stopChanMutex.Unlock()
+
+	if stopChan, ok := s.stopChans[name]; ok && stopChan != nil {
+		stopChan <- struct{}{}
+	}
+
+	delete(s.stopChans, name)
+}
@@ -0,0 +1,111 @@
+package csi
+
+import (
+	. "testing"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+
+	spec "github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+	. "gopkg.in/check.v1"
+)
+
+type csiSuite struct{}
+
+var _ = Suite(&csiSuite{})
+
+func TestCSI(t *T) { TestingT(t) }
+
+func code(err error) codes.Code {
+	return grpcstatus.Code(err)
+}
+
+func capability(mode spec.VolumeCapability_AccessMode_Mode) *spec.VolumeCapability {
+	return &spec.VolumeCapability{
+		AccessType: &spec.VolumeCapability_Mount{Mount: &spec.VolumeCapability_MountVolume{}},
+		AccessMode: &spec.VolumeCapability_AccessMode{Mode: mode},
+	}
+}
+
+func (s *csiSuite) TestSplitIDs(c *C) {
+	policy, volume, err := splitVolumeID("policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(policy, Equals, "policy1")
+	c.Assert(volume, Equals, "test")
+
+	_, _, err = splitVolumeID("test")
+	c.Assert(err, NotNil)
+	c.Assert(code(err), Equals, codes.InvalidArgument)
+
+	volumeID, snap, err := splitSnapshotID(snapshotID("policy1/test", "20170101"))
+	c.Assert(err, IsNil)
+	c.Assert(volumeID, Equals, "policy1/test")
+	c.Assert(snap, Equals, "20170101")
+
+	for _, id := range []string{"", "test", "policy1/test/", "policy1/20170101"} {
+		_, _, err := splitSnapshotID(id)
+		c.Assert(err, NotNil, Commentf("%q", id))
+		c.Assert(code(err), Equals, codes.InvalidArgument)
+	}
+}
+
+func (s *csiSuite) TestValidateCapabilities(c *C) {
+	single := capability(spec.VolumeCapability_AccessMode_SINGLE_NODE_WRITER)
+	multi := capability(spec.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER)
+	block := capability(spec.VolumeCapability_AccessMode_SINGLE_NODE_WRITER)
+	block.AccessType = &spec.VolumeCapability_Block{Block: &spec.VolumeCapability_BlockVolume{}}
+
+	c.Assert(validateCapabilities([]*spec.VolumeCapability{single}, false), IsNil)
+	c.Assert(validateCapabilities([]*spec.VolumeCapability{single, multi}, true), IsNil)
+	c.Assert(code(validateCapabilities([]*spec.VolumeCapability{single, multi}, false)), Equals, codes.InvalidArgument)
+	c.Assert(code(validateCapabilities([]*spec.VolumeCapability{block}, false)), Equals, codes.InvalidArgument)
+	c.Assert(code(validateCapabilities([]*spec.VolumeCapability{capability(spec.VolumeCapability_AccessMode_UNKNOWN)}, true)), Equals, codes.InvalidArgument)
+	c.Assert(code(validateCapabilities([]*spec.VolumeCapability{{}}, true)), Equals, codes.InvalidArgument)
+	c.Assert(code(validateCapabilities([]*spec.VolumeCapability{nil}, true)), Equals, codes.InvalidArgument)
+}
+
+func (s *csiSuite) TestStatus(c *C) {
+	c.Assert(code(status(codes.Internal, errors.GetVolume.Combine(errors.NotExists))), Equals, codes.NotFound)
+	c.Assert(code(status(codes.Internal, errors.NotExists)), Equals, codes.NotFound)
+	c.Assert(code(status(codes.Internal, errors.CreateVolume.Combine(errors.Exists))), Equals, codes.AlreadyExists)
+	c.Assert(code(status(codes.Internal, errors.CreateVolume.Combine(errors.QuotaExceeded))), Equals, codes.ResourceExhausted)
+	c.Assert(code(status(codes.Internal, errored.New("failure"))), Equals, codes.Internal)
+	c.Assert(grpcstatus.Convert(status(codes.Internal, errored.New("failure"))).Message(), Equals, "failure")
+
+	// errors which carry a status keep it.
+	c.Assert(code(status(codes.Internal, statusf(codes.FailedPrecondition, "in use"))), Equals, codes.FailedPrecondition)
+}
+
+func (s *csiSuite) TestCapacity(c *C) {
+	opts := volumeOptions(&spec.CreateVolumeRequest{
+		Parameters:    map[string]string{"policy": "policy1", "filesystem": "ext4"},
+		CapacityRange: &spec.CapacityRange{RequiredBytes: 1024*1024*10 + 1},
+	})
+	c.Assert(opts, DeepEquals, map[string]string{"filesystem": "ext4", "size": "11MB"})
+
+	vol := &spec.Volume{VolumeId: "policy1/test", CapacityBytes: 1024 * 1024 * 10}
+	c.Assert(checkCapacity(vol, nil), IsNil)
+	c.Assert(checkCapacity(vol, &spec.CapacityRange{RequiredBytes: 1024}), IsNil)
+	c.Assert(code(checkCapacity(vol, &spec.CapacityRange{RequiredBytes: 1024 * 1024 * 11})), Equals, codes.AlreadyExists)
+	c.Assert(code(checkCapacity(vol, &spec.CapacityRange{LimitBytes: 1024})), Equals, codes.AlreadyExists)
+}
+
+func (s *csiSuite) TestPaginate(c *C) {
+	entries := []*spec.Snapshot{{SnapshotId: "a/b/1"}, {SnapshotId: "a/b/2"}, {SnapshotId: "a/b/3"}}
+
+	resp, err := paginate(entries, "", 2)
+	c.Assert(err, IsNil)
+	c.Assert(len(resp.Entries), Equals, 2)
+	c.Assert(resp.NextToken, Equals, "2")
+
+	resp, err = paginate(entries, resp.NextToken, 2)
+	c.Assert(err, IsNil)
+	c.Assert(len(resp.Entries), Equals, 1)
+	c.Assert(resp.Entries[0].Snapshot.SnapshotId, Equals, "a/b/3")
+	c.Assert(resp.NextToken, Equals, "")
+
+	_, err = paginate(entries, "10", 2)
+	c.Assert(code(err), Equals, codes.Aborted)
+}
@@ -0,0 +1,289 @@
+package csi
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
+
+	spec "github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/codes"
+)
+
+// NodeGetInfo implements Node.NodeGetInfo. The node ID is the hostname, which
+// is also what volplugin records in mount locks.
+func (s *Server) NodeGetInfo(ctx context.Context, req *spec.NodeGetInfoRequest) (*spec.NodeGetInfoResponse, error) {
+	return &spec.NodeGetInfoResponse{NodeId: s.Hostname}, nil
+}
+
+// NodeGetCapabilities implements Node.NodeGetCapabilities.
+func (s *Server) NodeGetCapabilities(ctx context.Context, req *spec.NodeGetCapabilitiesRequest) (*spec.NodeGetCapabilitiesResponse, error) {
+	return &spec.NodeGetCapabilitiesResponse{
+		Capabilities: []*spec.NodeServiceCapability{
+			{
+				Type: &spec.NodeServiceCapability_Rpc{
+					Rpc: &spec.NodeServiceCapability_RPC{Type: spec.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME},
+				},
+			},
+		},
+	}, nil
+}
+
+// NodeGetVolumeStats is not supported.
+func (s *Server) NodeGetVolumeStats(ctx context.Context, req *spec.NodeGetVolumeStatsRequest) (*spec.NodeGetVolumeStatsResponse, error) {
+	return nil, statusf(codes.Unimplemented, "NodeGetVolumeStats is not supported")
+}
+
+func (s *Server) mountParameters(volumeID string) (storage.MountDriver, *config.Volume, storage.DriverOptions, error) {
+	vc, err := s.getVolume(volumeID)
+	if err != nil {
+		return nil, nil, storage.DriverOptions{}, err
+	}
+
+	driver, err := backend.NewMountDriver(vc.Backends.Mount, s.global().MountPath)
+	if err != nil {
+		return nil, nil, storage.DriverOptions{}, status(codes.Internal, errors.GetDriver.Combine(err))
+	}
+
+	do, err := vc.ToDriverOptions(s.global().Timeout)
+	if err != nil {
+		return nil, nil, storage.DriverOptions{}, status(codes.Internal, errors.UnmarshalRequest.Combine(err))
+	}
+
+	return driver, vc, do, nil
+}
+
+// isMountpoint reports whether path is on a different device than its parent.
+func isMountpoint(path string) (bool, error) {
+	var st, parent unix.Stat_t
+
+	if err := unix.Stat(path, &st); err != nil {
+		return false, err
+	}
+
+	if err := unix.Stat(filepath.Dir(path), &parent); err != nil {
+		return false, err
+	}
+
+	return st.Dev != parent.Dev, nil
+}
+
+func bindMount(source, target string, readonly bool) error {
+	if err := os.MkdirAll(target, 0750); err != nil {
+		return err
+	}
+
+	if err := unix.Mount(source, target, "", unix.MS_BIND, ""); err != nil {
+		return err
+	}
+
+	if readonly {
+		// bind mounts ignore MS_RDONLY on the initial mount, so remount.
+		if err := unix.Mount("", target, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY, ""); err != nil {
+			unix.Unmount(target, 0)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func unmountTarget(target string) error {
+	mounted, err := isMountpoint(target)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if mounted {
+		if err := unix.Unmount(target, 0); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(target)
+}
+
+// NodeStageVolume implements Node.NodeStageVolume. The volume is mounted by
+// its storage driver under the global mount path, exactly like a docker
+// mount, and bind mounted to the staging path. The mount lock is held and
+// refreshed until the volume is unstaged.
+func (s *Server) NodeStageVolume(ctx context.Context, req *spec.NodeStageVolumeRequest) (*spec.NodeStageVolumeResponse, error) {
+	if req.VolumeId == "" {
+		return nil, statusf(codes.InvalidArgument, "volume ID is missing")
+	}
+
+	if req.StagingTargetPath == "" {
+		return nil, statusf(codes.InvalidArgument, "staging target path is missing")
+	}
+
+	if req.VolumeCapability == nil {
+		return nil, statusf(codes.InvalidArgument, "volume capability is missing")
+	}
+
+	driver, vc, do, err := s.mountParameters(req.VolumeId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateCapabilities([]*spec.VolumeCapability{req.VolumeCapability}, vc.Unlocked); err != nil {
+		return nil, err
+	}
+
+	volName := vc.String()
+
+	if mc, err := s.MountCollection.Get(volName); err == nil {
+		if mounted, err := isMountpoint(req.StagingTargetPath); err == nil && mounted {
+			return &spec.NodeStageVolumeResponse{}, nil
+		}
+
+		if err := bindMount(mc.Path, req.StagingTargetPath, false); err != nil {
+			return nil, status(codes.Internal, errors.MountFailed.Combine(err))
+		}
+
+		return &spec.NodeStageVolumeResponse{}, nil
+	}
+
+	ut := &config.UseMount{
+		Volume:   volName,
+		Reason:   lock.ReasonMount,
+		Hostname: s.Hostname,
+	}
+
+	if !vc.Unlocked {
+		stopChan, err := s.Lock.AcquireWithTTLRefresh(ut, s.global().TTL, s.global().Timeout)
+		if err != nil {
+			return nil, statusf(codes.FailedPrecondition, "%v", errors.LockFailed.Combine(errored.New(volName)).Combine(err))
+		}
+
+		s.addStopChan(volName, stopChan)
+	}
+
+	mc, err := driver.Mount(do)
+	if err == nil {
+		s.MountCollection.Add(mc)
+		if err = bindMount(mc.Path, req.StagingTargetPath, false); err == nil {
+			return &spec.NodeStageVolumeResponse{}, nil
+		}
+		s.MountCollection.Remove(volName)
+	}
+
+	logrus.Errorf("MOUNT FAILURE: %v", err)
+
+	if err := driver.Unmount(do); err != nil {
+		logrus.Errorf("Failure during unmount after failed mount: %v", err)
+	}
+
+	if !vc.Unlocked {
+		s.removeStopChan(volName)
+		if err := s.Lock.ClearLock(ut, s.global().Timeout); err != nil {
+			logrus.Errorf("Could not clear lock for %q after failed mount: %v", volName, err)
+		}
+	}
+
+	return nil, status(codes.Internal, errors.MountFailed.Combine(err))
+}
+
+// NodeUnstageVolume implements Node.NodeUnstageVolume. It reverses
+// NodeStageVolume, releasing the mount lock.
+func (s *Server) NodeUnstageVolume(ctx context.Context, req *spec.NodeUnstageVolumeRequest) (*spec.NodeUnstageVolumeResponse, error) {
+	if req.VolumeId == "" {
+		return nil, statusf(codes.InvalidArgument, "volume ID is missing")
+	}
+
+	if req.StagingTargetPath == "" {
+		return nil, statusf(codes.InvalidArgument, "staging target path is missing")
+	}
+
+	driver, vc, do, err := s.mountParameters(req.VolumeId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := unmountTarget(req.StagingTargetPath); err != nil {
+		return nil, status(codes.Internal, errors.UnmountFailed.Combine(err))
+	}
+
+	volName := vc.String()
+
+	if _, err := s.MountCollection.Get(volName); err != nil {
+		return &spec.NodeUnstageVolumeResponse{}, nil
+	}
+
+	if err := driver.Unmount(do); err != nil {
+		return nil, status(codes.Internal, errors.UnmountFailed.Combine(err))
+	}
+
+	s.MountCollection.Remove(volName)
+
+	if err := s.Client.RemoveMountStats(vc); err != nil {
+		logrus.Warnf("Could not remove mount stats for %q: %v", volName, err)
+	}
+
+	if !vc.Unlocked {
+		s.removeStopChan(volName)
+	}
+
+	return &spec.NodeUnstageVolumeResponse{}, nil
+}
+
+// NodePublishVolume implements Node.NodePublishVolume by bind mounting the
+// staging path to the target path.
+func (s *Server) NodePublishVolume(ctx context.Context, req *spec.NodePublishVolumeRequest) (*spec.NodePublishVolumeResponse, error) {
+	if req.VolumeId == "" {
+		return nil, statusf(codes.InvalidArgument, "volume ID is missing")
+	}
+
+	if req.StagingTargetPath == "" || req.TargetPath == "" {
+		return nil, statusf(codes.InvalidArgument, "staging target path and target path are required")
+	}
+
+	if req.VolumeCapability == nil {
+		return nil, statusf(codes.InvalidArgument, "volume capability is missing")
+	}
+
+	if _, err := s.getVolume(req.VolumeId); err != nil {
+		return nil, err
+	}
+
+	if mounted, err := isMountpoint(req.TargetPath); err == nil && mounted {
+		return &spec.NodePublishVolumeResponse{}, nil
+	}
+
+	if mounted, err := isMountpoint(req.StagingTargetPath); err != nil || !mounted {
+		return nil, statusf(codes.FailedPrecondition, "volume %q is not staged at %q", req.VolumeId, req.StagingTargetPath)
+	}
+
+	if err := bindMount(req.StagingTargetPath, req.TargetPath, req.Readonly); err != nil {
+		return nil, status(codes.Internal, errors.MountFailed.Combine(err))
+	}
+
+	return &spec.NodePublishVolumeResponse{}, nil
+}
+
+// NodeUnpublishVolume implements Node.NodeUnpublishVolume. Unpublishing a
+// target that is not mounted succeeds.
+func (s *Server) NodeUnpublishVolume(ctx context.Context, req *spec.NodeUnpublishVolumeRequest) (*spec.NodeUnpublishVolumeResponse, error) {
+	if req.VolumeId == "" {
+		return nil, statusf(codes.InvalidArgument, "volume ID is missing")
+	}
+
+	if req.TargetPath == "" {
+		return nil, statusf(codes.InvalidArgument, "target path is missing")
+	}
+
+	if err := unmountTarget(req.TargetPath); err != nil {
+		return nil, status(codes.Internal, errors.UnmountFailed.Combine(err))
+	}
+
+	return &spec.NodeUnpublishVolumeResponse{}, nil
+}
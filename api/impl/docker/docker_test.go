@@ -13,6 +13,7 @@ import (
 
 	"github.com/contiv/volplugin/api"
 	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/db/impl/memory"
 
 	. "gopkg.in/check.v1"
 )
@@ -161,3 +162,49 @@ func (s *dockerSuite) TestBasic(c *C) {
 	c.Assert(list.Err, Equals, "", Commentf("%v", list.Err))
 	c.Assert(list.Volumes, IsNil)
 }
+
+// quotaSuite runs the docker API on the in-memory keys API instead of etcd and
+// ceph; refused creates never reach a storage driver.
+type quotaSuite struct {
+	// docker is not embedded, so its tests do not run in this suite.
+	docker dockerSuite
+}
+
+var _ = Suite(&quotaSuite{})
+
+func (s *quotaSuite) SetUpTest(c *C) {
+	s.docker.client = config.NewClientFromKeysAPI("/volplugin", memory.NewClient("/volplugin").KeysAPI())
+	global := config.NewGlobalConfig()
+	s.docker.api = api.NewAPI(NewVolplugin(), "mon0", s.docker.client, &global)
+	s.docker.server = httptest.NewServer(s.docker.api.Router(s.docker.api))
+}
+
+func (s *quotaSuite) TearDownTest(c *C) {
+	s.docker.TearDownTest(c)
+}
+
+func (s *quotaSuite) TestCreateOverQuota(c *C) {
+	err := s.docker.client.PublishPolicy("policy1", &config.Policy{
+		Name:          "policy1",
+		Backend:       "ceph",
+		DriverOptions: map[string]string{"pool": "rbd"},
+		CreateOptions: config.CreateOptions{Size: "10MB"},
+		Quota:         &config.Quota{Volumes: 1},
+	})
+	c.Assert(err, IsNil)
+
+	vol, err := s.docker.client.CreateVolume(&config.VolumeRequest{Policy: "policy1", Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(s.docker.client.PublishVolume(vol), IsNil)
+
+	resp, err := s.docker.postStruct("VolumeDriver.Create", VolumeCreateRequest{Name: "policy1/test2"})
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, 200, Commentf("%v", resp))
+
+	dockerResp, err := s.docker.unmarshalResponse(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(dockerResp.Err, "Quota exceeded"), Equals, true, Commentf("%v", dockerResp))
+
+	_, err = s.docker.client.GetVolume("policy1", "test2")
+	c.Assert(err, NotNil)
+}
@@ -5,8 +5,11 @@ import (
 	"sync"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/contiv/volplugin/metrics"
 )
 
+var mountGauge = metrics.NewGaugeVec("volplugin_mounts", "Number of containers using each volume mounted on this host.", "volume")
+
 // Counter implements a tracker for specific mounts.
 //
 // Each volume is assigned an integer and that integer is atomically
@@ -40,6 +43,7 @@ func (c *Counter) Add(mp string) int {
 
 	c.count[mp]++
 	logrus.Debugf("Mount count increased to %d for %q", c.count[mp], mp)
+	c.report(mp)
 	return c.count[mp]
 }
 
@@ -51,6 +55,7 @@ func (c *Counter) AddCount(mp string, n int) int {
 
 	c.count[mp] += n
 	logrus.Debugf("Mount count increased to %d for %q", c.count[mp], mp)
+	c.report(mp)
 	return c.count[mp]
 }
 
@@ -66,5 +71,16 @@ func (c *Counter) Sub(mp string) int {
 		panic(fmt.Sprintf("Assertion failed while tracking unmount: mount count for %q is less than 0", mp))
 	}
 
+	c.report(mp)
 	return c.count[mp]
 }
+
+// report updates the mount gauge. It must be called with the mutex held.
+func (c *Counter) report(mp string) {
+	if c.count[mp] == 0 {
+		mountGauge.Delete(mp)
+		return
+	}
+
+	mountGauge.Set(float64(c.count[mp]), mp)
+}
@@ -7,7 +7,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/volplugin/apiserver"
-	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/db/store"
 
 	"github.com/codegangsta/cli"
 )
@@ -16,7 +16,7 @@ import (
 var version = ""
 
 func start(ctx *cli.Context) {
-	cfg, err := config.NewClient(ctx.String("prefix"), ctx.StringSlice("etcd"))
+	cfg, err := store.NewConfigClient(ctx.String("store"), ctx.String("prefix"), ctx.StringSlice("etcd"))
 	if err != nil {
 		logrus.Fatal(err)
 	}
@@ -27,6 +27,22 @@ func start(ctx *cli.Context) {
 		Timeout:  time.Duration(ctx.Int("timeout")) * time.Minute,
 	}
 
+	if ctx.String("tls-cert") != "" || ctx.String("tls-key") != "" {
+		d.TLS, err = apiserver.NewTLSConfig(ctx.String("tls-cert"), ctx.String("tls-key"), ctx.String("tls-client-ca"))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	} else if ctx.String("tls-client-ca") != "" {
+		logrus.Fatal("--tls-client-ca requires --tls-cert and --tls-key")
+	}
+
+	if ctx.String("tokens") != "" {
+		d.Tokens, err = apiserver.LoadTokens(ctx.String("tokens"))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
 	d.Daemon(ctx.String("listen"))
 }
 
@@ -52,6 +68,31 @@ func main() {
 			Usage: "URL for etcd",
 			Value: &cli.StringSlice{"http://localhost:2379"},
 		},
+		cli.StringFlag{
+			Name:   "store",
+			Usage:  "URL of the data store, e.g. consul://localhost:8500; overrides --etcd",
+			EnvVar: "STORE",
+		},
+		cli.StringFlag{
+			Name:   "tls-cert",
+			Usage:  "PEM file of the TLS certificate; serves HTTPS instead of HTTP",
+			EnvVar: "TLS_CERT",
+		},
+		cli.StringFlag{
+			Name:   "tls-key",
+			Usage:  "PEM file of the key of the TLS certificate",
+			EnvVar: "TLS_KEY",
+		},
+		cli.StringFlag{
+			Name:   "tls-client-ca",
+			Usage:  "PEM file of the CAs client certificates must be signed by; requires clients to present one",
+			EnvVar: "TLS_CLIENT_CA",
+		},
+		cli.StringFlag{
+			Name:   "tokens",
+			Usage:  "JSON file of the bearer tokens clients must present and their roles (read-only, operator or admin)",
+			EnvVar: "TOKENS",
+		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -0,0 +1,212 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+type contextKey int
+
+// tokenKey is the key of the token a request was authenticated with in the
+// request context.
+const tokenKey contextKey = iota
+
+// auditOperations are the routes recorded in the audit log, keyed by method
+// and path, and the operation each is recorded as.
+var auditOperations = map[string]string{
+	"POST /global":                                "global upload",
+	"POST /policies/{policy}":                     "policy upload",
+	"DELETE /policies/{policy}":                   "policy delete",
+	"POST /policies/{policy}/rollback/{revision}": "policy rollback",
+	"POST /volumes/create":                        "volume create",
+	"POST /volumes/copy":                          "volume copy",
+	"POST /volumes/resize":                        "volume resize",
+	"DELETE /volumes/remove":                      "volume remove",
+	"DELETE /volumes/removeforce":                 "volume removeforce",
+	"POST /runtime/{policy}/{volume}":             "runtime upload",
+	"POST /snapshots/take/{policy}/{volume}":      "snapshot take",
+	"POST /snapshots/rollback/{policy}/{volume}":  "snapshot rollback",
+	"POST /snapshots/prune/{policy}/{volume}":     "snapshot prune",
+}
+
+// auditRequest holds the fields of request bodies which identify the target
+// of an operation and its options.
+type auditRequest struct {
+	Policy   string            `json:"policy"`
+	Name     string            `json:"name"`
+	Options  map[string]string `json:"options"`
+	Snapshot string            `json:"snapshot"`
+}
+
+// auditRecorder remembers the status code and, for errors, the body written
+// by a handler.
+type auditRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (a *auditRecorder) WriteHeader(status int) {
+	a.status = status
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *auditRecorder) Write(content []byte) (int, error) {
+	if a.status >= http.StatusBadRequest {
+		a.body.Write(content)
+	}
+
+	return a.ResponseWriter.Write(content)
+}
+
+func (d *DaemonConfig) recordAudit(entry *config.AuditEntry) error {
+	return d.Config.RecordAudit(entry, d.Global.AuditRetention())
+}
+
+// auditHandler records every request to the route with record, once it has
+// been handled. It wraps authentication, so refused requests are recorded too.
+func auditHandler(route, operation string, record func(*config.AuditEntry) error, actionFunc func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			api.RESTHTTPError(w, errors.ReadBody.Combine(err))
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(content))
+
+		entry := &config.AuditEntry{
+			Time:      time.Now(),
+			Address:   remoteHost(r),
+			Operation: operation,
+		}
+
+		entry.Target, entry.Details = auditTarget(route, r, content)
+
+		rec := &auditRecorder{ResponseWriter: w, status: http.StatusOK}
+		actionFunc(rec, r)
+
+		// the token is known once the request has been authenticated.
+		entry.Caller = caller(r)
+
+		entry.Success = rec.status < http.StatusBadRequest
+		if !entry.Success {
+			herr := &api.HTTPError{}
+			if err := json.Unmarshal(rec.body.Bytes(), herr); err == nil && herr.Code != "" {
+				entry.Error = herr.Error()
+			} else {
+				entry.Error = strings.TrimSpace(rec.body.String())
+			}
+		}
+
+		if err := record(entry); err != nil {
+			logrus.Errorf("Recording %s of %q by %s in the audit log: %v", operation, entry.Target, entry.Caller, err)
+		}
+	}
+}
+
+// auditTarget returns the object a request operates on, and its options.
+func auditTarget(route string, r *http.Request, content []byte) (string, map[string]string) {
+	if route == "/global" {
+		return "global", nil
+	}
+
+	vars := mux.Vars(r)
+	details := map[string]string{}
+
+	if revision, ok := vars["revision"]; ok {
+		details["revision"] = revision
+	}
+
+	var target string
+	req := &auditRequest{}
+
+	switch {
+	case vars["policy"] != "" && vars["volume"] != "":
+		target = vars["policy"] + "/" + vars["volume"]
+		json.Unmarshal(content, req)
+	case vars["policy"] != "":
+		// the body is the policy itself.
+		target = vars["policy"]
+	default:
+		json.Unmarshal(content, req)
+		target = req.Policy + "/" + req.Name
+	}
+
+	for key, value := range req.Options {
+		if value != "" {
+			details[key] = value
+		}
+	}
+
+	if req.Snapshot != "" {
+		details["snapshot"] = req.Snapshot
+	}
+
+	if len(details) == 0 {
+		details = nil
+	}
+
+	return target, details
+}
+
+// caller identifies who made a request: by the name of their token, the
+// common name of their certificate or, failing both, their address.
+func caller(r *http.Request) string {
+	if token, ok := context.Get(r, tokenKey).(*Token); ok {
+		return token.Name
+	}
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return "cn=" + r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	return remoteHost(r)
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func (d *DaemonConfig) handleAudit(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			api.RESTHTTPError(w, errors.ListAudit.Combine(errors.UnmarshalRequest).Combine(err))
+			return
+		}
+	}
+
+	entries, err := d.Config.ListAudit(since, r.URL.Query().Get("volume"))
+	if err != nil {
+		api.RESTHTTPError(w, errors.ListAudit.Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(entries)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
@@ -0,0 +1,133 @@
+package apiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/apiserver/client"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/gorilla/mux"
+
+	. "gopkg.in/check.v1"
+)
+
+type auditSuite struct {
+	lock    sync.Mutex
+	entries []*config.AuditEntry
+}
+
+var _ = Suite(&auditSuite{})
+
+func (s *auditSuite) SetUpTest(c *C) {
+	s.entries = nil
+}
+
+func (s *auditSuite) record(entry *config.AuditEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// serve starts an apiserver with fake handlers for audited and unaudited
+// routes.
+func (s *auditSuite) serve(c *C, tokens []*Token) *httptest.Server {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}
+
+	mounted := func(w http.ResponseWriter, r *http.Request) {
+		api.RESTHTTPError(w, errors.RemoveVolume.Combine(errors.VolumeMounted))
+	}
+
+	r := mux.NewRouter()
+	for method, handlers := range map[string]routeHandlers{
+		"GET":    {"/volumes/{policy}/{volume}": ok},
+		"POST":   {"/volumes/create": ok, "/snapshots/rollback/{policy}/{volume}": ok, "/policies/{policy}/rollback/{revision}": ok, "/global": ok},
+		"DELETE": {"/volumes/remove": mounted},
+	} {
+		c.Assert(addRoute(r, handlers, method, RoleOperator, tokens, false, s.record), IsNil)
+	}
+
+	return httptest.NewServer(r)
+}
+
+func (s *auditSuite) client(server *httptest.Server, token string) *client.Client {
+	apiClient := client.New(strings.TrimPrefix(server.URL, "http://"), 10*time.Second)
+	apiClient.SetToken(token)
+	return apiClient
+}
+
+func (s *auditSuite) TestAudit(c *C) {
+	server := s.serve(c, []*Token{
+		{Name: "reader", Token: "reader-token", Role: RoleReadOnly},
+		{Name: "ci", Token: "ci-token", Role: RoleOperator},
+	})
+	defer server.Close()
+
+	ci := s.client(server, "ci-token")
+
+	// reads are not recorded.
+	_, err := ci.GetVolume("policy1", "test")
+	c.Assert(err, IsNil)
+	c.Assert(s.entries, IsNil)
+
+	_, err = ci.CreateVolume(&config.VolumeRequest{Policy: "policy1", Name: "test", Options: map[string]string{"size": "10MB"}})
+	c.Assert(err, IsNil)
+	c.Assert(ci.RollbackSnapshot("policy1", "test", "snap1"), IsNil)
+	_, err = ci.RollbackPolicy("policy1", "2")
+	c.Assert(err, IsNil)
+	c.Assert(ci.UploadGlobal(config.NewGlobalConfig()), IsNil)
+	c.Assert(ci.RemoveVolume("policy1", "test", 0, false), NotNil)
+
+	c.Assert(len(s.entries), Equals, 5)
+	for _, entry := range s.entries {
+		c.Assert(entry.Caller, Equals, "ci")
+		c.Assert(entry.Address, Equals, "127.0.0.1")
+		c.Assert(time.Since(entry.Time) < time.Minute, Equals, true)
+		entry.Time = time.Time{}
+		entry.Caller = ""
+		entry.Address = ""
+	}
+
+	c.Assert(s.entries, DeepEquals, []*config.AuditEntry{
+		{Operation: "volume create", Target: "policy1/test", Details: map[string]string{"size": "10MB"}, Success: true},
+		{Operation: "snapshot rollback", Target: "policy1/test", Details: map[string]string{"snapshot": "snap1"}, Success: true},
+		{Operation: "policy rollback", Target: "policy1", Details: map[string]string{"revision": "2"}, Success: true},
+		{Operation: "global upload", Target: "global", Success: true},
+		{Operation: "volume remove", Target: "policy1/test", Details: map[string]string{"force": "false"}, Error: "Removing volume: Volume is mounted"},
+	})
+
+	// requests refused by authentication are recorded too.
+	s.entries = nil
+	_, err = s.client(server, "reader-token").CreateVolume(&config.VolumeRequest{Policy: "policy1", Name: "test"})
+	assertCode(c, err, api.CodeForbidden)
+	c.Assert(s.client(server, "bogus-token").RemoveVolume("policy1", "test", 0, false), NotNil)
+
+	c.Assert(len(s.entries), Equals, 2)
+	c.Assert(s.entries[0].Caller, Equals, "reader")
+	c.Assert(s.entries[0].Operation, Equals, "volume create")
+	c.Assert(s.entries[0].Success, Equals, false)
+	c.Assert(strings.Contains(s.entries[0].Error, "requires the operator role"), Equals, true, Commentf("%s", s.entries[0].Error))
+	c.Assert(s.entries[1].Caller, Equals, "127.0.0.1")
+	c.Assert(s.entries[1].Operation, Equals, "volume remove")
+	c.Assert(s.entries[1].Target, Equals, "policy1/test")
+	c.Assert(s.entries[1].Success, Equals, false)
+}
+
+func (s *auditSuite) TestAuditWithoutTokens(c *C) {
+	server := s.serve(c, nil)
+	defer server.Close()
+
+	_, err := s.client(server, "").CreateVolume(&config.VolumeRequest{Policy: "policy1", Name: "test"})
+	c.Assert(err, IsNil)
+
+	c.Assert(len(s.entries), Equals, 1)
+	c.Assert(s.entries[0].Caller, Equals, "127.0.0.1")
+	c.Assert(s.entries[0].Target, Equals, "policy1/test")
+}
@@ -0,0 +1,206 @@
+package apiserver
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/errors"
+	"github.com/gorilla/context"
+)
+
+// Role is what a token allows. Each role allows everything the roles before
+// it do.
+type Role int
+
+const (
+	// RoleReadOnly may only read: policies, volumes, uses and so on.
+	RoleReadOnly Role = iota
+	// RoleOperator may also manage volumes: create, copy, resize, remove,
+	// snapshot them and change their runtime options.
+	RoleOperator
+	// RoleAdmin may do anything, including changing the global configuration
+	// and policies and forcefully removing volumes.
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleReadOnly: "read-only",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+// MarshalJSON marshals the role as its name.
+func (r Role) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// UnmarshalJSON unmarshals a role from its name.
+func (r *Role) UnmarshalJSON(content []byte) error {
+	var name string
+	if err := json.Unmarshal(content, &name); err != nil {
+		return err
+	}
+
+	for role, roleName := range roleNames {
+		if name == roleName {
+			*r = role
+			return nil
+		}
+	}
+
+	return errored.Errorf("Invalid role %q", name)
+}
+
+// Token is a bearer token clients authenticate with.
+type Token struct {
+	// Name identifies the holder of the token in logs.
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	Role  Role   `json:"role"`
+}
+
+// LoadTokens reads the tokens from a JSON file holding a list of them, e.g.
+//
+//	[{"name": "ci", "token": "6f1ed002ab55", "role": "operator"}]
+func LoadTokens(path string) ([]*Token, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := []*Token{}
+	if err := json.Unmarshal(content, &tokens); err != nil {
+		return nil, errored.Errorf("Parsing tokens file %q", path).Combine(err)
+	}
+
+	seen := map[string]bool{}
+	for i, token := range tokens {
+		if token.Token == "" {
+			return nil, errored.Errorf("Token %d (%q) in %q is empty", i, token.Name, path)
+		}
+
+		if seen[token.Token] {
+			return nil, errored.Errorf("Token %d (%q) in %q is a duplicate", i, token.Name, path)
+		}
+
+		seen[token.Token] = true
+	}
+
+	return tokens, nil
+}
+
+// NewTLSConfig returns the TLS configuration serving the certificate and key
+// in the PEM files. If clientCAFile is not empty, clients must present a
+// certificate signed by one of the CAs in it.
+func NewTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errored.Errorf("Loading TLS certificate %q and key %q", certFile, keyFile).Combine(err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		content, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, errored.Errorf("No certificates found in %q", clientCAFile)
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// authenticate returns the token a request carries in its Authorization
+// header.
+func authenticate(tokens []*Token, r *http.Request) (*Token, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, errors.Unauthorized.Combine(errored.New("Missing bearer token"))
+	}
+
+	bearer := []byte(strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")))
+
+	// compare every token in constant time, so timing does not leak them.
+	var found *Token
+	for _, token := range tokens {
+		if subtle.ConstantTimeCompare(bearer, []byte(token.Token)) == 1 {
+			found = token
+		}
+	}
+
+	if found == nil {
+		return nil, errors.Unauthorized.Combine(errored.New("Invalid bearer token"))
+	}
+
+	return found, nil
+}
+
+// authHandler only lets requests through whose token has at least role. With
+// no tokens, authentication is disabled and every request is let through.
+func authHandler(name string, tokens []*Token, role Role, actionFunc func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	if len(tokens) == 0 {
+		return actionFunc
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := authenticate(tokens, r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="volplugin"`)
+			api.RESTHTTPError(w, err)
+			return
+		}
+
+		// the token is set before checking its role, so refused requests are
+		// audited as its holder's.
+		context.Set(r, tokenKey, token)
+
+		if token.Role < role {
+			api.RESTHTTPError(w, errors.Forbidden.Combine(errored.Errorf("%s %s requires the %s role, token %q has %s", r.Method, name, role, token.Name, token.Role)))
+			return
+		}
+
+		actionFunc(w, r)
+	}
+}
+
+// authorize returns an error unless the request was authenticated with a
+// token that has at least role. It is for options which need more than the
+// role of their route. With no tokens, everything is authorized.
+func authorize(tokens []*Token, r *http.Request, role Role, operation string) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	token, ok := context.Get(r, tokenKey).(*Token)
+	if !ok {
+		return errors.Unauthorized.Combine(errored.Errorf("%s requires a token", operation))
+	}
+
+	if token.Role < role {
+		return errors.Forbidden.Combine(errored.Errorf("%s requires the %s role, token %q has %s", operation, role, token.Name, token.Role))
+	}
+
+	return nil
+}
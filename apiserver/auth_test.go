@@ -0,0 +1,285 @@
+package apiserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	. "testing"
+	"time"
+
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/apiserver/client"
+	"github.com/contiv/volplugin/config"
+	"github.com/gorilla/mux"
+
+	. "gopkg.in/check.v1"
+)
+
+type authSuite struct {
+	dir string
+}
+
+var _ = Suite(&authSuite{})
+
+func TestAuth(t *T) { TestingT(t) }
+
+func (s *authSuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("", "apiserver-auth")
+	c.Assert(err, IsNil)
+	s.dir = dir
+}
+
+func (s *authSuite) TearDownTest(c *C) {
+	os.RemoveAll(s.dir)
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newCA generates a self-signed CA and writes its certificate to name.pem.
+func (s *authSuite) newCA(c *C, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+
+	cert, err := x509.ParseCertificate(der)
+	c.Assert(err, IsNil)
+
+	s.writePEM(c, name+".pem", "CERTIFICATE", der)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue signs a certificate for 127.0.0.1 and writes it to name.pem and its
+// key to name-key.pem.
+func (s *authSuite) issue(c *C, ca *testCA, name string, usage x509.ExtKeyUsage) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	c.Assert(err, IsNil)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, IsNil)
+
+	s.writePEM(c, name+".pem", "CERTIFICATE", der)
+	s.writePEM(c, name+"-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+func (s *authSuite) writePEM(c *C, name, kind string, der []byte) {
+	content := pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der})
+	c.Assert(ioutil.WriteFile(s.path(name), content, 0600), IsNil)
+}
+
+func (s *authSuite) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+func (s *authSuite) TestLoadTokens(c *C) {
+	c.Assert(ioutil.WriteFile(s.path("tokens.json"), []byte(`[
+  {"name": "reader", "token": "r", "role": "read-only"},
+  {"name": "admin", "token": "a", "role": "admin"}
+]`), 0600), IsNil)
+
+	tokens, err := LoadTokens(s.path("tokens.json"))
+	c.Assert(err, IsNil)
+	c.Assert(tokens, DeepEquals, []*Token{
+		{Name: "reader", Token: "r", Role: RoleReadOnly},
+		{Name: "admin", Token: "a", Role: RoleAdmin},
+	})
+
+	content, err := json.Marshal(tokens[1])
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, `{"name":"admin","token":"a","role":"admin"}`)
+
+	for _, invalid := range []string{
+		`[{"name": "x", "token": "x", "role": "root"}]`,
+		`[{"name": "x", "token": "", "role": "admin"}]`,
+		`[{"name": "x", "token": "x", "role": "admin"}, {"name": "y", "token": "x", "role": "operator"}]`,
+		`{"name": "x"}`,
+	} {
+		c.Assert(ioutil.WriteFile(s.path("tokens.json"), []byte(invalid), 0600), IsNil)
+		_, err := LoadTokens(s.path("tokens.json"))
+		c.Assert(err, NotNil, Commentf("%s", invalid))
+	}
+
+	_, err = LoadTokens(s.path("nonexistent.json"))
+	c.Assert(err, NotNil)
+}
+
+// serve starts an apiserver with fake handlers for a route of each role.
+func (s *authSuite) serve(c *C, tokens []*Token, clientCA string) *httptest.Server {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		content, _ := json.Marshal(&config.Volume{PolicyName: "policy1", VolumeName: "test"})
+		w.Write(content)
+	}
+
+	r := mux.NewRouter()
+	c.Assert(addRoute(r, routeHandlers{"/volumes/{policy}/{volume}": ok}, "GET", RoleReadOnly, tokens, false, nil), IsNil)
+	c.Assert(addRoute(r, routeHandlers{"/volumes/create": ok}, "POST", RoleOperator, tokens, false, nil), IsNil)
+	c.Assert(addRoute(r, routeHandlers{"/volumes/removeforce": ok}, "DELETE", RoleAdmin, tokens, false, nil), IsNil)
+
+	tlsConfig, err := NewTLSConfig(s.path("server.pem"), s.path("server-key.pem"), clientCA)
+	c.Assert(err, IsNil)
+
+	server := httptest.NewUnstartedServer(r)
+	server.TLS = tlsConfig
+	server.StartTLS()
+
+	return server
+}
+
+func (s *authSuite) client(c *C, server *httptest.Server, token, cert string) *client.Client {
+	certFile, keyFile := "", ""
+	if cert != "" {
+		certFile, keyFile = s.path(cert+".pem"), s.path(cert+"-key.pem")
+	}
+
+	tlsConfig, err := client.TLSConfig(s.path("ca.pem"), certFile, keyFile)
+	c.Assert(err, IsNil)
+
+	apiClient := client.New(strings.TrimPrefix(server.URL, "https://"), 10*time.Second)
+	apiClient.SetTLS(tlsConfig)
+	apiClient.SetToken(token)
+
+	return apiClient
+}
+
+func assertCode(c *C, err error, code string) {
+	c.Assert(err, NotNil)
+	herr, ok := err.(*api.HTTPError)
+	c.Assert(ok, Equals, true, Commentf("%v", err))
+	c.Assert(herr.Code, Equals, code, Commentf("%v", err))
+}
+
+func (s *authSuite) TestRoles(c *C) {
+	ca := s.newCA(c, "ca")
+	s.issue(c, ca, "server", x509.ExtKeyUsageServerAuth)
+
+	server := s.serve(c, []*Token{
+		{Name: "reader", Token: "reader-token", Role: RoleReadOnly},
+		{Name: "operator", Token: "operator-token", Role: RoleOperator},
+		{Name: "admin", Token: "admin-token", Role: RoleAdmin},
+	}, "")
+	defer server.Close()
+
+	request := &config.VolumeRequest{Policy: "policy1", Name: "test"}
+
+	for _, token := range []string{"", "wrong-token"} {
+		apiClient := s.client(c, server, token, "")
+		_, err := apiClient.GetVolume("policy1", "test")
+		assertCode(c, err, api.CodeUnauthorized)
+		c.Assert(err.(*api.HTTPError).Status, Equals, http.StatusUnauthorized)
+	}
+
+	reader := s.client(c, server, "reader-token", "")
+	_, err := reader.GetVolume("policy1", "test")
+	c.Assert(err, IsNil)
+	_, err = reader.CreateVolume(request)
+	assertCode(c, err, api.CodeForbidden)
+	c.Assert(err.(*api.HTTPError).Status, Equals, http.StatusForbidden)
+
+	operator := s.client(c, server, "operator-token", "")
+	_, err = operator.GetVolume("policy1", "test")
+	c.Assert(err, IsNil)
+	_, err = operator.CreateVolume(request)
+	c.Assert(err, IsNil)
+	assertCode(c, operator.ForceRemoveVolume("policy1", "test"), api.CodeForbidden)
+
+	admin := s.client(c, server, "admin-token", "")
+	_, err = admin.CreateVolume(request)
+	c.Assert(err, IsNil)
+	c.Assert(admin.ForceRemoveVolume("policy1", "test"), IsNil)
+
+	// plain HTTP is not served.
+	_, err = client.New(strings.TrimPrefix(server.URL, "https://"), time.Second).GetVolume("policy1", "test")
+	c.Assert(err, NotNil)
+}
+
+func (s *authSuite) TestNoTokens(c *C) {
+	ca := s.newCA(c, "ca")
+	s.issue(c, ca, "server", x509.ExtKeyUsageServerAuth)
+
+	server := s.serve(c, nil, "")
+	defer server.Close()
+
+	c.Assert(s.client(c, server, "", "").ForceRemoveVolume("policy1", "test"), IsNil)
+}
+
+func (s *authSuite) TestClientCertificates(c *C) {
+	ca := s.newCA(c, "ca")
+	s.issue(c, ca, "server", x509.ExtKeyUsageServerAuth)
+	s.issue(c, ca, "client", x509.ExtKeyUsageClientAuth)
+
+	other := s.newCA(c, "other-ca")
+	s.issue(c, other, "other-client", x509.ExtKeyUsageClientAuth)
+
+	server := s.serve(c, []*Token{{Name: "admin", Token: "admin-token", Role: RoleAdmin}}, s.path("ca.pem"))
+	defer server.Close()
+
+	_, err := s.client(c, server, "admin-token", "client").GetVolume("policy1", "test")
+	c.Assert(err, IsNil)
+
+	// the certificate does not replace the token.
+	_, err = s.client(c, server, "", "client").GetVolume("policy1", "test")
+	assertCode(c, err, api.CodeUnauthorized)
+
+	for _, cert := range []string{"", "other-client"} {
+		_, err := s.client(c, server, "admin-token", cert).GetVolume("policy1", "test")
+		c.Assert(err, NotNil, Commentf("%q", cert))
+		_, ok := err.(*api.HTTPError)
+		c.Assert(ok, Equals, false, Commentf("%v", err))
+	}
+
+	// the server certificate is verified too.
+	tlsConfig, err := client.TLSConfig(s.path("other-ca.pem"), s.path("client.pem"), s.path("client-key.pem"))
+	c.Assert(err, IsNil)
+
+	apiClient := client.New(strings.TrimPrefix(server.URL, "https://"), 10*time.Second)
+	apiClient.SetTLS(tlsConfig)
+	apiClient.SetToken("admin-token")
+
+	_, err = apiClient.GetVolume("policy1", "test")
+	c.Assert(err, NotNil)
+
+	_, err = NewTLSConfig(s.path("server.pem"), s.path("server-key.pem"), s.path("nonexistent.pem"))
+	c.Assert(err, NotNil)
+
+	_, err = NewTLSConfig(s.path("server.pem"), s.path("client-key.pem"), "")
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,608 @@
+// Package client is a typed client for the REST API of the apiserver. Every
+// route of the apiserver has a method here; failed requests return the
+// *api.HTTPError the apiserver responded with, so callers can tell failures
+// apart with its Code or Contains.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/config"
+)
+
+// DefaultTimeout is the request timeout of clients created without one. It
+// is longer than the default timeout of the storage operations the apiserver
+// runs, so creating and removing volumes does not time out first.
+const DefaultTimeout = 15 * time.Minute
+
+// Client talks to an apiserver.
+type Client struct {
+	address string
+	scheme  string
+	token   string
+	client  *http.Client
+}
+
+// New creates a client for the apiserver at address, e.g. "127.0.0.1:9005".
+// Requests taking longer than timeout fail; a zero timeout uses
+// DefaultTimeout.
+func New(address string, timeout time.Duration) *Client {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Client{address: address, scheme: "http", client: &http.Client{Timeout: timeout}}
+}
+
+// SetTLS makes the client talk HTTPS with the TLS configuration, which
+// TLSConfig can build.
+func (c *Client) SetTLS(tlsConfig *tls.Config) {
+	c.scheme = "https"
+	c.client.Transport = &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig}
+}
+
+// SetToken makes the client authenticate with a bearer token.
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// TLSConfig returns the TLS configuration trusting the CAs in the PEM file
+// caFile, or the system's if it is empty, and presenting the client
+// certificate in certFile and keyFile if they are not empty.
+func TLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		content, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(content) {
+			return nil, errored.Errorf("No certificates found in %q", caFile)
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errored.Errorf("Loading TLS certificate %q and key %q", certFile, keyFile).Combine(err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// path joins the escaped parts to a path of the apiserver.
+func path(parts ...string) string {
+	for i, part := range parts {
+		// QueryEscape escapes slashes too, so a part stays a single path
+		// segment; only spaces are escaped differently in paths.
+		parts[i] = strings.Replace(url.QueryEscape(part), "+", "%20", -1)
+	}
+
+	return "/" + strings.Join(parts, "/")
+}
+
+// newRequest creates a request to the route, authenticated if the client has
+// a token.
+func (c *Client) newRequest(method, route string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.scheme+"://"+c.address+route, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	return req, nil
+}
+
+// request sends body, marshalled to JSON unless it is nil, and returns the
+// content of the response.
+func (c *Client) request(method, route string, body interface{}) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+
+		reader = bytes.NewBuffer(content)
+	}
+
+	req, err := c.newRequest(method, route, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, api.DecodeHTTPError(resp)
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// call is request which unmarshals the response into result, if it is not
+// nil.
+func (c *Client) call(method, route string, body, result interface{}) error {
+	content, err := c.request(method, route, body)
+	if err != nil || result == nil {
+		return err
+	}
+
+	return json.Unmarshal(content, result)
+}
+
+// GetGlobal retrieves the global configuration, in its published form.
+func (c *Client) GetGlobal() (*config.Global, error) {
+	content, err := c.request("GET", "/global", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.NewGlobalConfigFromJSON(content)
+}
+
+// UploadGlobal replaces the global configuration, given in its published
+// form.
+func (c *Client) UploadGlobal(global *config.Global) error {
+	return c.call("POST", "/global", global, nil)
+}
+
+// ListPolicies retrieves all the policies.
+func (c *Client) ListPolicies() ([]*config.Policy, error) {
+	policies := []*config.Policy{}
+	if err := c.call("GET", "/policies", nil, &policies); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// GetPolicy retrieves a policy.
+func (c *Client) GetPolicy(name string) (*config.Policy, error) {
+	policy := config.NewPolicy()
+	if err := c.call("GET", path("policies", name), nil, policy); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// UploadPolicy creates or replaces a policy, archiving a new revision of it.
+func (c *Client) UploadPolicy(name string, policy *config.Policy) error {
+	return c.call("POST", path("policies", name), policy, nil)
+}
+
+// DeletePolicy removes a policy. Its archived revisions are kept.
+func (c *Client) DeletePolicy(name string) error {
+	return c.call("DELETE", path("policies", name), nil, nil)
+}
+
+// PolicyUsage retrieves how much of its quotas a policy uses.
+func (c *Client) PolicyUsage(name string) (*config.PolicyUsage, error) {
+	usage := &config.PolicyUsage{}
+	if err := c.call("GET", path("policies", name, "usage"), nil, usage); err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// ListPolicyRevisions retrieves the archived revisions of a policy.
+func (c *Client) ListPolicyRevisions(name string) ([]string, error) {
+	revisions := []string{}
+	if err := c.call("GET", path("policy-archives", name), nil, &revisions); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// GetPolicyRevision retrieves an archived revision of a policy.
+func (c *Client) GetPolicyRevision(name, revision string) (*config.Policy, error) {
+	policy := config.NewPolicy()
+	if err := c.call("GET", path("policy-archives", name, revision), nil, policy); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// RollbackPolicy publishes an archived revision of a policy as the current
+// one, and returns it.
+func (c *Client) RollbackPolicy(name, revision string) (*config.Policy, error) {
+	policy := config.NewPolicy()
+	if err := c.call("POST", path("policies", name, "rollback", revision), nil, policy); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// ListAllVolumes retrieves the volumes of all policies whose labels match
+// selector. An empty selector matches every volume.
+func (c *Client) ListAllVolumes(selector string) ([]*config.Volume, error) {
+	volumes := []*config.Volume{}
+	if err := c.call("GET", "/volumes"+selectorQuery(selector), nil, &volumes); err != nil {
+		return nil, err
+	}
+
+	return volumes, nil
+}
+
+// ListVolumes retrieves the volumes of a policy whose labels match selector.
+// An empty selector matches every volume.
+func (c *Client) ListVolumes(policy, selector string) ([]*config.Volume, error) {
+	volumes := []*config.Volume{}
+	if err := c.call("GET", path("volumes", policy)+selectorQuery(selector), nil, &volumes); err != nil {
+		return nil, err
+	}
+
+	return volumes, nil
+}
+
+func selectorQuery(selector string) string {
+	if selector == "" {
+		return ""
+	}
+
+	return "?" + url.Values{"selector": []string{selector}}.Encode()
+}
+
+// GetVolume retrieves a volume.
+func (c *Client) GetVolume(policy, name string) (*config.Volume, error) {
+	volume := &config.Volume{}
+	if err := c.call("GET", path("volumes", policy, name), nil, volume); err != nil {
+		return nil, err
+	}
+
+	return volume, nil
+}
+
+// VolumeStats retrieves the usage of a volume.
+func (c *Client) VolumeStats(policy, name string) (*config.VolumeStats, error) {
+	stats := &config.VolumeStats{}
+	if err := c.call("GET", path("volumes", policy, name, "stats"), nil, stats); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// RequestVolume retrieves a volume the way volplugin does before mounting it.
+func (c *Client) RequestVolume(policy, name string) (*config.Volume, error) {
+	volume := &config.Volume{}
+	req := &config.VolumeRequest{Policy: policy, Name: name}
+	if err := c.call("POST", "/volumes/request", req, volume); err != nil {
+		return nil, err
+	}
+
+	return volume, nil
+}
+
+// CreateVolume creates a volume and returns it.
+func (c *Client) CreateVolume(req *config.VolumeRequest) (*config.Volume, error) {
+	volume := &config.Volume{}
+	if err := c.call("POST", "/volumes/create", req, volume); err != nil {
+		return nil, err
+	}
+
+	return volume, nil
+}
+
+// CopyVolume creates the volume target in the same policy from a snapshot of
+// another volume, and returns it.
+func (c *Client) CopyVolume(policy, name, snapshot, target string) (*config.Volume, error) {
+	req := &config.VolumeRequest{
+		Policy:  policy,
+		Name:    name,
+		Options: map[string]string{"snapshot": snapshot, "target": target},
+	}
+
+	volume := &config.Volume{}
+	if err := c.call("POST", "/volumes/copy", req, volume); err != nil {
+		return nil, err
+	}
+
+	return volume, nil
+}
+
+// ResizeVolume grows a volume to size, e.g. "10GB", and returns it. force
+// allows shrinking it, if its backend can.
+func (c *Client) ResizeVolume(policy, name, size string, force bool) (*config.Volume, error) {
+	req := &config.VolumeRequest{
+		Policy:  policy,
+		Name:    name,
+		Options: map[string]string{"size": size, "force": boolOption(force)},
+	}
+
+	volume := &config.Volume{}
+	if err := c.call("POST", "/volumes/resize", req, volume); err != nil {
+		return nil, err
+	}
+
+	return volume, nil
+}
+
+// RemoveVolume removes a volume and the image beneath it, waiting up to
+// timeout for it to be unmounted; a zero timeout uses the one of the global
+// configuration. force removes the locks of a mounted volume first.
+func (c *Client) RemoveVolume(policy, name string, timeout time.Duration, force bool) error {
+	req := &config.VolumeRequest{
+		Policy:  policy,
+		Name:    name,
+		Options: map[string]string{"timeout": "", "force": boolOption(force)},
+	}
+
+	if timeout != 0 {
+		req.Options["timeout"] = timeout.String()
+	}
+
+	return c.call("DELETE", "/volumes/remove", req, nil)
+}
+
+// ForceRemoveVolume removes a volume from the data store only, leaving the
+// image beneath it alone.
+func (c *Client) ForceRemoveVolume(policy, name string) error {
+	return c.call("DELETE", "/volumes/removeforce", &config.VolumeRequest{Policy: policy, Name: name}, nil)
+}
+
+func boolOption(b bool) string {
+	if b {
+		return "true"
+	}
+
+	return "false"
+}
+
+// GetRuntime retrieves the runtime options of a volume.
+func (c *Client) GetRuntime(policy, volume string) (*config.RuntimeOptions, error) {
+	runtime := &config.RuntimeOptions{}
+	if err := c.call("GET", path("runtime", policy, volume), nil, runtime); err != nil {
+		return nil, err
+	}
+
+	return runtime, nil
+}
+
+// UploadRuntime replaces the runtime options of a volume.
+func (c *Client) UploadRuntime(policy, volume string, runtime *config.RuntimeOptions) error {
+	return c.call("POST", path("runtime", policy, volume), runtime, nil)
+}
+
+// ListSnapshots retrieves the names of the snapshots of a volume.
+func (c *Client) ListSnapshots(policy, volume string) ([]string, error) {
+	snapshots := []string{}
+	if err := c.call("GET", path("snapshots", policy, volume), nil, &snapshots); err != nil {
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+// TakeSnapshot snapshots a volume immediately.
+func (c *Client) TakeSnapshot(policy, volume string) error {
+	return c.call("POST", path("snapshots", "take", policy, volume), nil, nil)
+}
+
+// RollbackSnapshot rolls a volume back to one of its snapshots.
+func (c *Client) RollbackSnapshot(policy, volume, snapshot string) error {
+	return c.call("POST", path("snapshots", "rollback", policy, volume), map[string]string{"snapshot": snapshot}, nil)
+}
+
+// GetSnapshotResult retrieves the outcome of the last scheduled snapshot of a
+// volume, including the failures of its hooks.
+func (c *Client) GetSnapshotResult(policy, volume string) (*config.SnapshotResult, error) {
+	result := &config.SnapshotResult{}
+	if err := c.call("GET", path("snapshots", "result", policy, volume), nil, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// PruneSnapshots removes the snapshots of a volume its retention rules do not
+// keep, and returns the verdict on each snapshot, newest first. A dry run
+// only returns the verdicts.
+func (c *Client) PruneSnapshots(policy, volume string, dryRun bool) ([]*config.SnapshotVerdict, error) {
+	method := "POST"
+	if dryRun {
+		method = "GET"
+	}
+
+	verdicts := []*config.SnapshotVerdict{}
+	if err := c.call(method, path("snapshots", "prune", policy, volume), nil, &verdicts); err != nil {
+		return nil, err
+	}
+
+	return verdicts, nil
+}
+
+// GetMountUse retrieves the mount lock of a volume.
+func (c *Client) GetMountUse(policy, volume string) (*config.UseMount, error) {
+	use := &config.UseMount{}
+	if err := c.call("GET", path("uses", "mounts", policy, volume), nil, use); err != nil {
+		return nil, err
+	}
+
+	return use, nil
+}
+
+// GetSnapshotUse retrieves the snapshot lock of a volume.
+func (c *Client) GetSnapshotUse(policy, volume string) (*config.UseSnapshot, error) {
+	use := &config.UseSnapshot{}
+	if err := c.call("GET", path("uses", "snapshots", policy, volume), nil, use); err != nil {
+		return nil, err
+	}
+
+	return use, nil
+}
+
+// GetVolsupervisorUse retrieves the volsupervisor lock, which names the
+// volsupervisor currently leading.
+func (c *Client) GetVolsupervisorUse() (*config.UseVolsupervisor, error) {
+	use := &config.UseVolsupervisor{}
+	if err := c.call("GET", "/uses/volsupervisor", nil, use); err != nil {
+		return nil, err
+	}
+
+	return use, nil
+}
+
+// ListAudit lists the audit log entries recorded since the given time, oldest
+// first. If volume is not empty, only the entries for it (as policy/name) are
+// listed.
+func (c *Client) ListAudit(since time.Time, volume string) ([]*config.AuditEntry, error) {
+	query := url.Values{}
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339Nano))
+	}
+
+	if volume != "" {
+		query.Set("volume", volume)
+	}
+
+	route := "/audit"
+	if len(query) > 0 {
+		route += "?" + query.Encode()
+	}
+
+	entries := []*config.AuditEntry{}
+	if err := c.call("GET", route, nil, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// EventOptions select the events streamed by Events.
+type EventOptions struct {
+	// Types are the types of events to stream, see config.EventTypes. No
+	// types streams all of them.
+	Types []string
+	// Volume, if set, only streams the events about this volume, as
+	// policy/name.
+	Volume string
+	// AfterIndex, if set, resumes the stream after the event with this
+	// index.
+	AfterIndex uint64
+}
+
+// Events streams events from the apiserver to f, until f returns false. The
+// client timeout does not apply, since streams last as long as they are read.
+// Errors sent by the apiserver on the stream are returned as *api.HTTPError.
+func (c *Client) Events(opts *EventOptions, f func(*config.Event) bool) error {
+	query := url.Values{}
+	if len(opts.Types) > 0 {
+		query.Set("type", strings.Join(opts.Types, ","))
+	}
+
+	if opts.Volume != "" {
+		query.Set("volume", opts.Volume)
+	}
+
+	if opts.AfterIndex != 0 {
+		query.Set("index", strconv.FormatUint(opts.AfterIndex, 10))
+	}
+
+	route := "/events"
+	if len(query) > 0 {
+		route += "?" + query.Encode()
+	}
+
+	req, err := c.newRequest("GET", route, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	streamClient := *c.client
+	streamClient.Timeout = 0
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return api.DecodeHTTPError(resp)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	// policies and volumes may be larger than the default line limit.
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var typ string
+	data := &bytes.Buffer{}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+
+			if typ == "error" {
+				herr := &api.HTTPError{}
+				if err := json.Unmarshal(data.Bytes(), herr); err != nil {
+					return errored.Errorf("Invalid error event %q", data.String()).Combine(err)
+				}
+				return herr
+			}
+
+			event := &config.Event{}
+			if err := json.Unmarshal(data.Bytes(), event); err != nil {
+				return errored.Errorf("Invalid event %q", data.String()).Combine(err)
+			}
+
+			if !f(event) {
+				return nil
+			}
+
+			typ = ""
+			data.Reset()
+		case strings.HasPrefix(line, "event:"):
+			typ = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return errored.New("Event stream closed by the apiserver")
+}
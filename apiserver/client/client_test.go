@@ -0,0 +1,258 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	. "testing"
+	"time"
+
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+
+	. "gopkg.in/check.v1"
+)
+
+type clientSuite struct {
+	server   *httptest.Server
+	client   *Client
+	requests []string
+	bodies   []string
+	handlers map[string]http.HandlerFunc
+}
+
+var _ = Suite(&clientSuite{})
+
+func TestClient(t *T) { TestingT(t) }
+
+func (s *clientSuite) SetUpTest(c *C) {
+	s.requests = []string{}
+	s.bodies = []string{}
+	s.handlers = map[string]http.HandlerFunc{}
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := r.Method + " " + r.URL.RequestURI()
+		content, _ := ioutil.ReadAll(r.Body)
+
+		s.requests = append(s.requests, request)
+		s.bodies = append(s.bodies, string(content))
+
+		if handler, ok := s.handlers[request]; ok {
+			handler(w, r)
+			return
+		}
+
+		api.RESTHTTPError(w, errors.NotExists.Combine(errors.GetVolume))
+	}))
+
+	s.client = New(strings.TrimPrefix(s.server.URL, "http://"), time.Second)
+}
+
+func (s *clientSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *clientSuite) respond(request string, v interface{}) {
+	s.handlers[request] = func(w http.ResponseWriter, r *http.Request) {
+		content, _ := json.Marshal(v)
+		w.Write(content)
+	}
+}
+
+func (s *clientSuite) TestVolumes(c *C) {
+	volume := &config.Volume{PolicyName: "policy1", VolumeName: "test", Labels: map[string]string{"team": "storage"}}
+
+	s.respond("GET /volumes/policy1/test", volume)
+	s.respond("GET /volumes?selector=team%3Dstorage", []*config.Volume{volume})
+	s.respond("POST /volumes/copy", volume)
+	s.respond("DELETE /volumes/remove", nil)
+
+	vol, err := s.client.GetVolume("policy1", "test")
+	c.Assert(err, IsNil)
+	c.Assert(vol, DeepEquals, volume)
+
+	vols, err := s.client.ListAllVolumes("team=storage")
+	c.Assert(err, IsNil)
+	c.Assert(vols, DeepEquals, []*config.Volume{volume})
+
+	_, err = s.client.CopyVolume("policy1", "test", "snap1", "copy")
+	c.Assert(err, IsNil)
+	c.Assert(s.bodies[2], Equals, `{"name":"test","policy":"policy1","options":{"snapshot":"snap1","target":"copy"}}`)
+
+	c.Assert(s.client.RemoveVolume("policy1", "test", time.Minute, true), IsNil)
+	c.Assert(s.bodies[3], Equals, `{"name":"test","policy":"policy1","options":{"force":"true","timeout":"1m0s"}}`)
+
+	// names are escaped.
+	_, err = s.client.GetVolume("policy 1", "test")
+	c.Assert(err, NotNil)
+	c.Assert(s.requests[4], Equals, "GET /volumes/policy%201/test")
+}
+
+func (s *clientSuite) TestPolicies(c *C) {
+	policy := config.NewPolicy()
+	policy.Name = "policy1"
+	policy.Backend = "nfs"
+
+	s.respond("GET /policies/policy1", policy)
+	s.respond("POST /policies/policy1/rollback/2", policy)
+	s.respond("GET /policy-archives/policy1", []string{"1", "2"})
+	s.respond("GET /policies/policy1/usage", &config.PolicyUsage{Volumes: 2, Size: 20})
+
+	p, err := s.client.GetPolicy("policy1")
+	c.Assert(err, IsNil)
+	c.Assert(p, DeepEquals, policy)
+
+	p, err = s.client.RollbackPolicy("policy1", "2")
+	c.Assert(err, IsNil)
+	c.Assert(p.Backend, Equals, "nfs")
+
+	revisions, err := s.client.ListPolicyRevisions("policy1")
+	c.Assert(err, IsNil)
+	c.Assert(revisions, DeepEquals, []string{"1", "2"})
+
+	usage, err := s.client.PolicyUsage("policy1")
+	c.Assert(err, IsNil)
+	c.Assert(usage, DeepEquals, &config.PolicyUsage{Volumes: 2, Size: 20})
+}
+
+func (s *clientSuite) TestGlobal(c *C) {
+	s.respond("GET /global", config.NewGlobalConfig().Published())
+
+	global, err := s.client.GetGlobal()
+	c.Assert(err, IsNil)
+	c.Assert(global, DeepEquals, config.NewGlobalConfig().Published())
+}
+
+func (s *clientSuite) TestErrors(c *C) {
+	_, err := s.client.GetVolume("policy1", "nonexistent")
+	c.Assert(err, NotNil)
+
+	herr, ok := err.(*api.HTTPError)
+	c.Assert(ok, Equals, true)
+	c.Assert(herr.Status, Equals, http.StatusNotFound)
+	c.Assert(herr.Code, Equals, api.CodeNotExists)
+	c.Assert(herr.Contains(errors.NotExists), Equals, true)
+
+	s.handlers["POST /snapshots/take/policy1/test"] = func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}
+
+	err = s.client.TakeSnapshot("policy1", "test")
+	c.Assert(err, NotNil)
+	c.Assert(err.(*api.HTTPError).Status, Equals, http.StatusBadGateway)
+	c.Assert(err.(*api.HTTPError).Message, Equals, "bad gateway")
+
+	s.handlers["GET /snapshots/policy1/test"] = func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	client := New(strings.TrimPrefix(s.server.URL, "http://"), 50*time.Millisecond)
+	_, err = client.ListSnapshots("policy1", "test")
+	c.Assert(err, NotNil)
+}
+
+func (s *clientSuite) TestVolsupervisorUse(c *C) {
+	leader := &config.UseVolsupervisor{Hostname: "mon0", Started: time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)}
+
+	_, err := s.client.GetVolsupervisorUse()
+	c.Assert(err.(*api.HTTPError).Status, Equals, http.StatusNotFound)
+
+	s.respond("GET /uses/volsupervisor", leader)
+
+	use, err := s.client.GetVolsupervisorUse()
+	c.Assert(err, IsNil)
+	c.Assert(use, DeepEquals, leader)
+}
+
+func (s *clientSuite) TestAudit(c *C) {
+	since := time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)
+	entry := &config.AuditEntry{Time: since, Caller: "ci", Operation: "volume remove", Target: "policy1/test", Success: true}
+
+	s.respond("GET /audit", []*config.AuditEntry{entry})
+	s.respond("GET /audit?since=2016-05-01T12%3A00%3A00Z&volume=policy1%2Ftest", []*config.AuditEntry{entry})
+
+	entries, err := s.client.ListAudit(time.Time{}, "")
+	c.Assert(err, IsNil)
+	c.Assert(entries, DeepEquals, []*config.AuditEntry{entry})
+
+	entries, err = s.client.ListAudit(since, "policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(entries, DeepEquals, []*config.AuditEntry{entry})
+}
+
+func (s *clientSuite) TestEvents(c *C) {
+	s.handlers["GET /events?index=10&type=volume%2Cuse&volume=policy1%2Ftest"] = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(": heartbeat\n\n" +
+			"id: 11\nevent: volume\ndata: {\"index\":11,\"type\":\"volume\",\"action\":\"set\",\"policy\":\"policy1\",\"volume\":\"policy1/test\",\"key\":\"volumes/policy1/test/create\",\"value\":{\"name\":\"test\"}}\n\n" +
+			"id: 12\nevent: use\ndata: {\"index\":12,\"type\":\"use\",\"action\":\"delete\",\"policy\":\"policy1\",\"volume\":\"policy1/test\",\"key\":\"users/mount/policy1/test\"}\n\n" +
+			"event: error\ndata: {\"code\":\"internal\",\"message\":\"Watching events\",\"causes\":[\"The event in requested index is outdated and cleared\"]}\n\n"))
+	}
+
+	opts := &EventOptions{Types: []string{"volume", "use"}, Volume: "policy1/test", AfterIndex: 10}
+
+	events := []*config.Event{}
+	err := s.client.Events(opts, func(event *config.Event) bool {
+		events = append(events, event)
+		return true
+	})
+
+	c.Assert(len(events), Equals, 2)
+	c.Assert(events[0].Index, Equals, uint64(11))
+	c.Assert(string(events[0].Value), Equals, `{"name":"test"}`)
+	c.Assert(events[1], DeepEquals, &config.Event{Index: 12, Type: "use", Action: "delete", Policy: "policy1", Volume: "policy1/test", Key: "users/mount/policy1/test"})
+
+	c.Assert(err, NotNil)
+	c.Assert(err.(*api.HTTPError).Code, Equals, api.CodeInternal)
+	c.Assert(err.(*api.HTTPError).Causes, DeepEquals, []string{"The event in requested index is outdated and cleared"})
+
+	// returning false stops the stream.
+	events = []*config.Event{}
+	err = s.client.Events(opts, func(event *config.Event) bool {
+		events = append(events, event)
+		return false
+	})
+	c.Assert(err, IsNil)
+	c.Assert(len(events), Equals, 1)
+
+	// so do errors before it starts.
+	err = s.client.Events(&EventOptions{}, func(*config.Event) bool { return true })
+	c.Assert(err.(*api.HTTPError).Status, Equals, http.StatusNotFound)
+}
+
+func (s *clientSuite) TestPruneSnapshots(c *C) {
+	verdicts := []*config.SnapshotVerdict{
+		{Name: "2016-05-02T12.00.00Z", Keep: true, Reasons: []string{config.RetainKeep}},
+		{Name: "2016-05-01T12.00.00Z", Keep: false},
+	}
+
+	s.respond("GET /snapshots/prune/policy1/test", verdicts)
+	s.respond("POST /snapshots/prune/policy1/test", verdicts)
+
+	result, err := s.client.PruneSnapshots("policy1", "test", true)
+	c.Assert(err, IsNil)
+	c.Assert(result, DeepEquals, verdicts)
+
+	result, err = s.client.PruneSnapshots("policy1", "test", false)
+	c.Assert(err, IsNil)
+	c.Assert(result, DeepEquals, verdicts)
+	c.Assert(s.requests, DeepEquals, []string{"GET /snapshots/prune/policy1/test", "POST /snapshots/prune/policy1/test"})
+}
+
+func (s *clientSuite) TestSnapshotResult(c *C) {
+	result := &config.SnapshotResult{
+		Time:     time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC),
+		Snapshot: "2016-05-01T12.00.00Z",
+		Success:  true,
+		Warnings: []string{"Post-snapshot hook: exit status 1"},
+	}
+
+	s.respond("GET /snapshots/result/policy1/test", result)
+
+	r, err := s.client.GetSnapshotResult("policy1", "test")
+	c.Assert(err, IsNil)
+	c.Assert(r, DeepEquals, result)
+}
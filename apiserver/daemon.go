@@ -2,6 +2,7 @@ package apiserver
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,7 +18,9 @@ import (
 	"github.com/contiv/volplugin/config"
 	"github.com/contiv/volplugin/errors"
 	"github.com/contiv/volplugin/info"
+	"github.com/contiv/volplugin/labels"
 	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/metrics"
 	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/storage/backend"
 	"github.com/contiv/volplugin/storage/control"
@@ -25,12 +28,21 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// growPoll is how often the state of a grow is checked while waiting for
+// volplugin.
+const growPoll = 100 * time.Millisecond
+
 // DaemonConfig is the configuration struct used by the apiserver to hold globals.
 type DaemonConfig struct {
 	Config   *config.Client
 	MountTTL int
 	Timeout  time.Duration
 	Global   *config.Global
+	// TLS, if set, makes the apiserver serve HTTPS instead of HTTP.
+	TLS *tls.Config
+	// Tokens are the bearer tokens requests must carry, and the role each
+	// grants. With no tokens, requests are not authenticated.
+	Tokens []*Token
 }
 
 // volume is the json response of a volume. Taken from
@@ -40,6 +52,11 @@ type volume struct {
 	Mountpoint string
 }
 
+// snapshotRequest is the body of requests that operate on a single snapshot.
+type snapshotRequest struct {
+	Snapshot string `json:"snapshot"`
+}
+
 type routeHandlers map[string]func(http.ResponseWriter, *http.Request)
 
 // Daemon initializes the daemon for use.
@@ -75,65 +92,118 @@ func (d *DaemonConfig) Daemon(listen string) {
 		}
 	}()
 
-	r := mux.NewRouter()
-
-	postRouter := map[string]func(http.ResponseWriter, *http.Request){
-		"/global":                           d.handleGlobalUpload,
-		"/volumes/create":                   d.handleCreate,
-		"/volumes/copy":                     d.handleCopy,
-		"/volumes/request":                  d.handleRequest,
-		"/policies/{policy}":                d.handlePolicyUpload,
-		"/runtime/{policy}/{volume}":        d.handleRuntimeUpload,
-		"/snapshots/take/{policy}/{volume}": d.handleSnapshotTake,
+	r, err := d.router()
+	if err != nil {
+		logrus.Fatalf("Error starting apiserver: %v", err)
 	}
 
-	if err := addRoute(r, postRouter, "POST", d.Global.Debug); err != nil {
-		logrus.Fatalf("Error starting apiserver: %v", err)
+	if len(d.Tokens) > 0 && d.TLS == nil {
+		logrus.Warn("Authentication is enabled without TLS: bearer tokens will be sent in clear text")
 	}
 
-	deleteRouter := map[string]func(http.ResponseWriter, *http.Request){
-		"/volumes/remove":      d.handleRemove,
-		"/volumes/removeforce": d.handleRemoveForce,
-		"/policies/{policy}":   d.handlePolicyDelete,
+	server := &http.Server{Addr: listen, Handler: r, TLSConfig: d.TLS}
+
+	if d.TLS != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
 	}
 
-	if err := addRoute(r, deleteRouter, "DELETE", d.Global.Debug); err != nil {
+	if err != nil {
 		logrus.Fatalf("Error starting apiserver: %v", err)
 	}
+}
 
-	getRouter := map[string]func(http.ResponseWriter, *http.Request){
-		"/global":                              d.handleGlobal,
-		"/policy-archives/{policy}":            d.handlePolicyListRevisions,
-		"/policy-archives/{policy}/{revision}": d.handlePolicyGetRevision,
-		"/policies":                            d.handlePolicyList,
-		"/policies/{policy}":                   d.handlePolicy,
-		"/uses/mounts/{policy}/{volume}":       d.handleUsesMountsVolume,
-		"/uses/snapshots/{policy}/{volume}":    d.handleUsesMountsSnapshots,
-		"/volumes":                             d.handleListAll,
-		"/volumes/{policy}":                    d.handleList,
-		"/volumes/{policy}/{volume}":           d.handleGet,
-		"/runtime/{policy}/{volume}":           d.handleRuntime,
-		"/snapshots/{policy}/{volume}":         d.handleSnapshotList,
+// router returns the routes of the apiserver, each letting only requests
+// whose token has the role of the route through.
+func (d *DaemonConfig) router() (*mux.Router, error) {
+	r := mux.NewRouter()
+
+	routers := map[string]map[Role]routeHandlers{
+		"POST": {
+			RoleReadOnly: {
+				"/volumes/request": d.handleRequest,
+			},
+			RoleOperator: {
+				"/volumes/create":                       d.handleCreate,
+				"/volumes/copy":                         d.handleCopy,
+				"/volumes/resize":                       d.handleResize,
+				"/runtime/{policy}/{volume}":            d.handleRuntimeUpload,
+				"/snapshots/take/{policy}/{volume}":     d.handleSnapshotTake,
+				"/snapshots/rollback/{policy}/{volume}": d.handleSnapshotRollback,
+				"/snapshots/prune/{policy}/{volume}":    d.handleSnapshotPrune,
+			},
+			RoleAdmin: {
+				"/global":                                d.handleGlobalUpload,
+				"/policies/{policy}":                     d.handlePolicyUpload,
+				"/policies/{policy}/rollback/{revision}": d.handlePolicyRollback,
+			},
+		},
+		"DELETE": {
+			RoleOperator: {
+				"/volumes/remove": d.handleRemove,
+			},
+			RoleAdmin: {
+				"/volumes/removeforce": d.handleRemoveForce,
+				"/policies/{policy}":   d.handlePolicyDelete,
+			},
+		},
+		"GET": {
+			RoleReadOnly: {
+				"/global":                              d.handleGlobal,
+				"/policy-archives/{policy}":            d.handlePolicyListRevisions,
+				"/policy-archives/{policy}/{revision}": d.handlePolicyGetRevision,
+				"/policies":                            d.handlePolicyList,
+				"/policies/{policy}":                   d.handlePolicy,
+				"/policies/{policy}/usage":             d.handlePolicyUsage,
+				"/uses/mounts/{policy}/{volume}":       d.handleUsesMountsVolume,
+				"/uses/snapshots/{policy}/{volume}":    d.handleUsesMountsSnapshots,
+				"/uses/volsupervisor":                  d.handleUsesVolsupervisor,
+				"/volumes":                             d.handleListAll,
+				"/volumes/{policy}":                    d.handleList,
+				"/volumes/{policy}/{volume}":           d.handleGet,
+				"/volumes/{policy}/{volume}/stats":     d.handleStats,
+				"/runtime/{policy}/{volume}":           d.handleRuntime,
+				"/snapshots/{policy}/{volume}":         d.handleSnapshotList,
+				"/snapshots/prune/{policy}/{volume}":   d.handleSnapshotPrune,
+				"/snapshots/result/{policy}/{volume}":  d.handleSnapshotResult,
+				"/events":                              d.handleEvents,
+			},
+			RoleAdmin: {
+				"/audit": d.handleAudit,
+			},
+		},
 	}
 
-	if err := addRoute(r, getRouter, "GET", d.Global.Debug); err != nil {
-		logrus.Fatalf("Error starting apiserver: %v", err)
+	for method, roles := range routers {
+		for role, handlers := range roles {
+			if err := addRoute(r, handlers, method, role, d.Tokens, d.Global.Debug, d.recordAudit); err != nil {
+				return nil, err
+			}
+		}
 	}
 
+	r.HandleFunc("/metrics", authHandler("/metrics", d.Tokens, RoleReadOnly, metrics.Handler().ServeHTTP)).Methods("GET")
+
 	if d.Global.Debug {
 		r.HandleFunc("{action:.*}", d.handleDebug)
 	}
 
-	if err := http.ListenAndServe(listen, r); err != nil {
-		logrus.Fatalf("Error starting apiserver: %v", err)
-	}
+	return r, nil
 }
 
-func addRoute(r *mux.Router, handlers routeHandlers, method string, debug bool) error {
+// addRoute registers the handlers for method, letting only requests whose
+// token has at least role through.
+func addRoute(r *mux.Router, handlers routeHandlers, method string, role Role, tokens []*Token, debug bool, record func(*config.AuditEntry) error) error {
 	for path, f := range handlers {
 		if strings.HasSuffix(path, "/") {
 			return fmt.Errorf("route path %v has trailing slash", path)
 		}
+		f = authHandler(path, tokens, role, f)
+		if operation, ok := auditOperations[method+" "+path]; ok && record != nil {
+			f = auditHandler(path, operation, record, f)
+		}
+		f = metricsHandler(path, method, f)
 		r.HandleFunc(path, logHandler(path, debug, f)).Methods(method)
 		pathSlash := fmt.Sprintf("%v/", path)
 		r.HandleFunc(pathSlash, logHandler(pathSlash, debug, f)).Methods(method)
@@ -203,6 +273,43 @@ func (d *DaemonConfig) handlePolicyUpload(w http.ResponseWriter, r *http.Request
 		api.RESTHTTPError(w, errors.PublishPolicy.Combine(err))
 		return
 	}
+
+	d.prunePolicyRevisions(policyName)
+}
+
+func (d *DaemonConfig) handlePolicyRollback(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	policyName := vars["policy"]
+
+	policy, err := d.Config.RollbackPolicy(policyName, vars["revision"])
+	if err != nil {
+		api.RESTHTTPError(w, errors.RollbackPolicy.Combine(err))
+		return
+	}
+
+	d.prunePolicyRevisions(policyName)
+
+	content, err := json.Marshal(policy)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalPolicy.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+// prunePolicyRevisions enforces the retention of the policy archive after a
+// new revision was published. Failures are only logged, as the policy was
+// published anyway.
+func (d *DaemonConfig) prunePolicyRevisions(policy string) {
+	pruned, err := d.Config.PrunePolicyRevisions(policy, d.Global.PolicyRevisions, d.Global.PolicyRevisionMaxAge())
+	if err != nil {
+		logrus.Errorf("Could not prune the revisions of policy %q: %v", policy, err)
+	}
+
+	if len(pruned) > 0 {
+		logrus.Debugf("Pruned revisions %v of policy %q", pruned, policy)
+	}
 }
 
 func (d *DaemonConfig) handlePolicyDelete(w http.ResponseWriter, r *http.Request) {
@@ -283,6 +390,29 @@ func (d *DaemonConfig) handlePolicy(w http.ResponseWriter, r *http.Request) {
 	w.Write(content)
 }
 
+func (d *DaemonConfig) handlePolicyUsage(w http.ResponseWriter, r *http.Request) {
+	policy := mux.Vars(r)["policy"]
+
+	if _, err := d.Config.GetPolicy(policy); err != nil {
+		api.RESTHTTPError(w, errors.GetPolicy.Combine(err))
+		return
+	}
+
+	usage, err := d.Config.GetPolicyUsage(policy)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetPolicy.Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(usage)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
 func (d *DaemonConfig) handleUsesMountsVolume(w http.ResponseWriter, r *http.Request) {
 	d.handleUserEndpoints(&config.UseMount{}, w, r)
 }
@@ -291,6 +421,22 @@ func (d *DaemonConfig) handleUsesMountsSnapshots(w http.ResponseWriter, r *http.
 	d.handleUserEndpoints(&config.UseSnapshot{}, w, r)
 }
 
+func (d *DaemonConfig) handleUsesVolsupervisor(w http.ResponseWriter, r *http.Request) {
+	use, err := d.Config.GetVolsupervisorUse()
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetVolsupervisor.Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(use)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
 func (d *DaemonConfig) handleUserEndpoints(ul config.UseLocker, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	policy := vars["policy"]
@@ -414,12 +560,253 @@ func (d *DaemonConfig) handleSnapshotTake(w http.ResponseWriter, r *http.Request
 	policy := vars["policy"]
 	volume := vars["volume"]
 
+	// volsupervisor enforces the quota when taking the snapshot, but checking
+	// here too lets the user know.
+	if err := d.checkSnapshotQuota(policy, volume); err != nil {
+		api.RESTHTTPError(w, errors.SnapshotFailed.Combine(err))
+		return
+	}
+
 	if err := d.Config.TakeSnapshot(fmt.Sprintf("%v/%v", policy, volume)); err != nil {
 		api.RESTHTTPError(w, errors.SnapshotFailed.Combine(err))
 		return
 	}
 }
 
+func (d *DaemonConfig) checkSnapshotQuota(policyName, volumeName string) error {
+	policy, err := d.Config.GetPolicy(policyName)
+	if err != nil {
+		return errors.GetPolicy.Combine(err)
+	}
+
+	if policy.Quota == nil || policy.Quota.Snapshots == 0 {
+		return nil
+	}
+
+	volConfig, err := d.Config.GetVolume(policyName, volumeName)
+	if err != nil {
+		return errors.GetVolume.Combine(err)
+	}
+
+	if volConfig.Backends.Snapshot == "" {
+		return nil
+	}
+
+	driver, err := backend.NewSnapshotDriver(volConfig.Backends.Snapshot)
+	if err != nil {
+		return errors.GetDriver.Combine(err)
+	}
+
+	do := storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   volConfig.String(),
+			Params: volConfig.DriverOptions,
+		},
+		Timeout: d.Global.Timeout,
+	}
+
+	snapshots, err := driver.ListSnapshots(do)
+	if err != nil {
+		return errors.ListSnapshots.Combine(err)
+	}
+
+	return policy.Quota.CheckSnapshot(len(snapshots))
+}
+
+func (d *DaemonConfig) handleSnapshotRollback(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	policy := vars["policy"]
+	volumeName := vars["volume"]
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		api.RESTHTTPError(w, errors.ReadBody.Combine(err))
+		return
+	}
+
+	req := &snapshotRequest{}
+	if err := json.Unmarshal(data, req); err != nil {
+		api.RESTHTTPError(w, errors.UnmarshalRequest.Combine(err))
+		return
+	}
+
+	if req.Snapshot == "" {
+		api.RESTHTTPError(w, errors.MissingSnapshot)
+		return
+	}
+
+	volConfig, err := d.Config.GetVolume(policy, volumeName)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
+		return
+	}
+
+	if volConfig.Backends.Snapshot == "" {
+		api.RESTHTTPError(w, errors.SnapshotsUnsupported.Combine(errored.New(volConfig.String())))
+		return
+	}
+
+	driver, err := backend.NewSnapshotDriver(volConfig.Backends.Snapshot)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetDriver.Combine(err))
+		return
+	}
+
+	// refuse outright instead of waiting for the mount lock: rolling back a
+	// volume underneath a running container is never what anyone wants.
+	mount := &config.UseMount{}
+	if err := d.Config.GetUse(mount, volConfig); err == nil {
+		api.RESTHTTPError(w, errors.VolumeMounted.Combine(errored.Errorf("%v is mounted on host %q", volConfig, mount.Hostname)))
+		return
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetHostname.Combine(err))
+		return
+	}
+
+	locks := []config.UseLocker{
+		&config.UseMount{
+			Volume:   volConfig.String(),
+			Reason:   lock.ReasonRollback,
+			Hostname: hostname,
+		},
+		&config.UseSnapshot{
+			Volume: volConfig.String(),
+			Reason: lock.ReasonRollback,
+		},
+	}
+
+	do := storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   volConfig.String(),
+			Params: volConfig.DriverOptions,
+		},
+		Timeout: d.Global.Timeout,
+	}
+
+	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock(locks, d.Global.Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		return driver.RollbackSnapshot(req.Snapshot, do)
+	})
+
+	if err != nil {
+		api.RESTHTTPError(w, errors.SnapshotRollback.Combine(errored.Errorf("volume %q, snapshot %q", volConfig, req.Snapshot)).Combine(err))
+		return
+	}
+}
+
+func (d *DaemonConfig) handleSnapshotResult(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	result, err := d.Config.GetSnapshotResult(vars["policy"], vars["volume"])
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetSnapshotResult.Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(result)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+// handleSnapshotPrune removes the snapshots of a volume its retention rules
+// do not keep, and returns the verdict on each snapshot. GET only works out
+// the verdicts, as a dry run.
+func (d *DaemonConfig) handleSnapshotPrune(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	policy := vars["policy"]
+	volumeName := vars["volume"]
+
+	volConfig, err := d.Config.GetVolume(policy, volumeName)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
+		return
+	}
+
+	if volConfig.Backends.Snapshot == "" {
+		api.RESTHTTPError(w, errors.SnapshotsUnsupported.Combine(errored.New(volConfig.String())))
+		return
+	}
+
+	// without scheduled snapshots the retention is not validated, and keep may
+	// well be 0.
+	if !volConfig.RuntimeOptions.UseSnapshots {
+		api.RESTHTTPError(w, errors.NoSnapshotRetention.Combine(errored.New(volConfig.String())))
+		return
+	}
+
+	driver, err := backend.NewSnapshotDriver(volConfig.Backends.Snapshot)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetDriver.Combine(err))
+		return
+	}
+
+	do := storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   volConfig.String(),
+			Params: volConfig.DriverOptions,
+		},
+		Timeout: d.Global.Timeout,
+	}
+
+	var verdicts []*config.SnapshotVerdict
+	retain := func() error {
+		list, err := driver.ListSnapshots(do)
+		if err != nil {
+			return errors.ListSnapshots.Combine(err)
+		}
+
+		verdicts, err = volConfig.RuntimeOptions.Snapshot.Retain(list, time.Now())
+		return err
+	}
+
+	if r.Method == "GET" {
+		err = retain()
+	} else {
+		uc := &config.UseSnapshot{
+			Volume: volConfig.String(),
+			Reason: lock.ReasonSnapshotPrune,
+		}
+
+		err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock([]config.UseLocker{uc}, d.Global.Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+			if err := retain(); err != nil {
+				return err
+			}
+
+			for _, verdict := range verdicts {
+				if verdict.Keep {
+					continue
+				}
+
+				logrus.Infof("Removing snapshot %q for volume %q", verdict.Name, volConfig)
+				if err := driver.RemoveSnapshot(verdict.Name, do); err != nil {
+					return errored.Errorf("Removing snapshot %q", verdict.Name).Combine(err)
+				}
+			}
+
+			return nil
+		})
+	}
+
+	if err != nil {
+		api.RESTHTTPError(w, errors.SnapshotPrune.Combine(errored.New(volConfig.String())).Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(verdicts)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
 func (d *DaemonConfig) handleCopy(w http.ResponseWriter, r *http.Request) {
 	req, err := unmarshalRequest(r)
 	if err != nil {
@@ -467,6 +854,12 @@ func (d *DaemonConfig) handleCopy(w http.ResponseWriter, r *http.Request) {
 
 	newVolConfig.VolumeName = req.Options["target"]
 
+	policy, err := d.Config.GetPolicy(req.Policy)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetPolicy.Combine(err))
+		return
+	}
+
 	do := storage.DriverOptions{
 		Volume: storage.Volume{
 			Name:   volConfig.String(),
@@ -502,7 +895,13 @@ func (d *DaemonConfig) handleCopy(w http.ResponseWriter, r *http.Request) {
 		Reason: lock.ReasonCopy,
 	}
 
-	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock([]config.UseLocker{newUC, newSnapUC, snapUC}, d.Global.Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+	locks := config.QuotaLocks(policy, lock.ReasonCopy, newUC, newSnapUC, snapUC)
+
+	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock(locks, d.Global.Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		if err := d.Config.CheckQuota(policy, newVolConfig); err != nil {
+			return err
+		}
+
 		if err := d.Config.PublishVolume(newVolConfig); err != nil {
 			return err
 		}
@@ -536,6 +935,173 @@ func (d *DaemonConfig) handleCopy(w http.ResponseWriter, r *http.Request) {
 	w.Write(content)
 }
 
+func (d *DaemonConfig) handleResize(w http.ResponseWriter, r *http.Request) {
+	req, err := unmarshalRequest(r)
+	if err != nil {
+		api.RESTHTTPError(w, errors.UnmarshalRequest.Combine(err))
+		return
+	}
+
+	if _, ok := req.Options["size"]; !ok {
+		api.RESTHTTPError(w, errors.MissingSizeOption)
+		return
+	}
+
+	volConfig, err := d.Config.GetVolume(req.Policy, req.Name)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
+		return
+	}
+
+	policy, err := d.Config.GetPolicy(req.Policy)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetPolicy.Combine(err))
+		return
+	}
+
+	oldSize, err := volConfig.CreateOptions.ActualSize()
+	if err != nil {
+		api.RESTHTTPError(w, errors.ResizeVolume.Combine(err))
+		return
+	}
+
+	newCreateOptions := config.CreateOptions{Size: req.Options["size"]}
+	newSize, err := newCreateOptions.ActualSize()
+	if err != nil {
+		api.RESTHTTPError(w, errors.ResizeVolume.Combine(err))
+		return
+	}
+
+	if newSize == 0 {
+		api.RESTHTTPError(w, errors.ResizeVolume.Combine(errored.Errorf("Invalid size %q", req.Options["size"])))
+		return
+	}
+
+	shrink := newSize < oldSize
+
+	force := req.Options["force"] == "true"
+
+	if shrink && !force {
+		api.RESTHTTPError(w, errors.ResizeShrink.Combine(errored.Errorf("%v: %dMB -> %dMB without force", volConfig, oldSize, newSize)))
+		return
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetHostname.Combine(err))
+		return
+	}
+
+	// growing is done online, so the volume may be mounted while we hold the
+	// snapshot lock. Shrinking can only happen while no one is using it.
+	locks := []config.UseLocker{
+		&config.UseSnapshot{
+			Volume: volConfig.String(),
+			Reason: lock.ReasonResize,
+		},
+	}
+
+	if shrink {
+		locks = append(locks, &config.UseMount{
+			Volume:   volConfig.String(),
+			Reason:   lock.ReasonResize,
+			Hostname: hostname,
+		})
+	}
+
+	if newSize != oldSize {
+		locks = config.QuotaLocks(policy, lock.ReasonResize, locks...)
+
+		err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock(locks, d.Global.Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+			if err := d.Config.CheckResizeQuota(policy, volConfig, newSize); err != nil {
+				return err
+			}
+
+			if err := control.ResizeVolume(volConfig, newSize, force, d.Global.Timeout); err != nil {
+				return err
+			}
+
+			volConfig.CreateOptions.Size = req.Options["size"]
+			if err := d.Config.UpdateVolume(volConfig); err != nil {
+				return err
+			}
+
+			if shrink {
+				return nil
+			}
+
+			return d.growMounted(volConfig, hostname)
+		})
+
+		if err != nil {
+			api.RESTHTTPError(w, errors.ResizeVolume.Combine(errored.New(volConfig.String())).Combine(err))
+			return
+		}
+	}
+
+	content, err := json.Marshal(volConfig)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+// growMounted asks the volplugin mounting the volume on another host to grow
+// its filesystem online, and waits until it has. The storage driver grows
+// the filesystems of volumes mounted on this host itself.
+func (d *DaemonConfig) growMounted(volConfig *config.Volume, hostname string) error {
+	mount := &config.UseMount{}
+	if err := d.Config.GetUse(mount, volConfig); err != nil {
+		if er, ok := err.(*errored.Error); ok && er.Contains(errors.NotExists) {
+			return nil
+		}
+
+		return err
+	}
+
+	if mount.Hostname == hostname {
+		return nil
+	}
+
+	grow := &config.Grow{
+		Volume:     volConfig.String(),
+		Hostname:   mount.Hostname,
+		FileSystem: volConfig.CreateOptions.FileSystem,
+		Timeout:    d.Global.Timeout,
+	}
+
+	if err := d.Config.RequestGrow(grow); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := d.Config.RemoveGrow(grow.Volume); err != nil {
+			logrus.Errorf("Could not remove the grow of volume %q: %v", volConfig, err)
+		}
+	}()
+
+	deadline := time.Now().Add(grow.Timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(growPoll)
+
+		grown, err := d.Config.GetGrow(grow.Volume)
+		if err != nil {
+			return err
+		}
+
+		switch grown.State {
+		case config.GrowDone:
+			return nil
+		case config.GrowFailed:
+			return errored.Errorf("volplugin on host %q could not grow the filesystem: %s", mount.Hostname, grown.Error)
+		}
+	}
+
+	return errored.Errorf("volplugin on host %q did not grow the filesystem after %v; it is grown at the next mount", mount.Hostname, grow.Timeout)
+}
+
 func (d *DaemonConfig) handleGlobal(w http.ResponseWriter, r *http.Request) {
 	content, err := json.Marshal(d.Global.Published())
 	if err != nil {
@@ -547,6 +1113,14 @@ func (d *DaemonConfig) handleGlobal(w http.ResponseWriter, r *http.Request) {
 }
 
 func (d *DaemonConfig) handleList(w http.ResponseWriter, r *http.Request) {
+	policy := mux.Vars(r)["policy"]
+
+	selector, err := labels.Parse(r.URL.Query().Get("selector"))
+	if err != nil {
+		api.RESTHTTPError(w, errors.ListVolume.Combine(err))
+		return
+	}
+
 	vols, err := d.Config.ListAllVolumes()
 	if err != nil {
 		api.RESTHTTPError(w, errors.ListVolume.Combine(err))
@@ -560,6 +1134,11 @@ func (d *DaemonConfig) handleList(w http.ResponseWriter, r *http.Request) {
 			api.RESTHTTPError(w, errors.InvalidVolume.Combine(errored.New(vol)))
 			return
 		}
+
+		if parts[0] != policy {
+			continue
+		}
+
 		// FIXME make this take a single string and not a split one
 		volConfig, err := d.Config.GetVolume(parts[0], parts[1])
 		if err != nil {
@@ -567,7 +1146,9 @@ func (d *DaemonConfig) handleList(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		response = append(response, volConfig)
+		if selector.Matches(volConfig.Labels) {
+			response = append(response, volConfig)
+		}
 	}
 
 	content, err := json.Marshal(response)
@@ -580,6 +1161,12 @@ func (d *DaemonConfig) handleList(w http.ResponseWriter, r *http.Request) {
 }
 
 func (d *DaemonConfig) handleListAll(w http.ResponseWriter, r *http.Request) {
+	selector, err := labels.Parse(r.URL.Query().Get("selector"))
+	if err != nil {
+		api.RESTHTTPError(w, errors.ListVolume.Combine(err))
+		return
+	}
+
 	vols, err := d.Config.ListAllVolumes()
 	if err != nil {
 		api.RESTHTTPError(w, errors.ListVolume.Combine(err))
@@ -600,7 +1187,9 @@ func (d *DaemonConfig) handleListAll(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		response = append(response, volConfig)
+		if selector.Matches(volConfig.Labels) {
+			response = append(response, volConfig)
+		}
 	}
 
 	content, err := json.Marshal(response)
@@ -618,10 +1207,7 @@ func (d *DaemonConfig) handleGet(w http.ResponseWriter, r *http.Request) {
 	volumeName := vars["volume"]
 
 	volConfig, err := d.Config.GetVolume(policy, volumeName)
-	if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.NotExists) {
-		w.WriteHeader(404)
-		return
-	} else if err != nil {
+	if err != nil {
 		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
 		return
 	}
@@ -635,6 +1221,57 @@ func (d *DaemonConfig) handleGet(w http.ResponseWriter, r *http.Request) {
 	w.Write(content)
 }
 
+func (d *DaemonConfig) handleStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	policy := vars["policy"]
+	volumeName := vars["volume"]
+
+	volConfig, err := d.Config.GetVolume(policy, volumeName)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
+		return
+	}
+
+	stats := &config.VolumeStats{}
+
+	// backends without a stats driver (like NFS) only report mount stats.
+	if _, ok := backend.StatsDrivers[volConfig.Backends.CRUD]; ok {
+		driver, err := backend.NewStatsDriver(volConfig.Backends.CRUD)
+		if err != nil {
+			api.RESTHTTPError(w, errors.GetDriver.Combine(err))
+			return
+		}
+
+		do, err := volConfig.ToDriverOptions(d.Global.Timeout)
+		if err != nil {
+			api.RESTHTTPError(w, errors.GetStats.Combine(err))
+			return
+		}
+
+		stats.Backend, err = driver.Stats(do)
+		if err != nil {
+			api.RESTHTTPError(w, errors.GetStats.Combine(err))
+			return
+		}
+	}
+
+	stats.Mount, err = d.Config.GetMountStats(policy, volumeName)
+	if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.NotExists) {
+		stats.Mount = nil
+	} else if err != nil {
+		api.RESTHTTPError(w, errors.GetStats.Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(stats)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
 func (d *DaemonConfig) createRemoveLocks(vc *config.Volume) ([]config.UseLocker, error) {
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -729,6 +1366,15 @@ func (d *DaemonConfig) handleRemove(w http.ResponseWriter, r *http.Request) {
 		timeout = t
 	}
 
+	// forcing clears the locks of a mounted volume, which only admins may do,
+	// like with /volumes/removeforce.
+	if req.Options["force"] == "true" {
+		if err := authorize(d.Tokens, r, RoleAdmin, "Forcefully removing a volume"); err != nil {
+			api.RESTHTTPError(w, errors.RemoveVolume.Combine(err))
+			return
+		}
+	}
+
 	vc, err := d.Config.GetVolume(req.Policy, req.Name)
 	if err != nil {
 		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
@@ -766,11 +1412,6 @@ func (d *DaemonConfig) handleRemove(w http.ResponseWriter, r *http.Request) {
 		return d.completeRemove(req, vc)
 	})
 
-	if err == errors.NotExists {
-		w.WriteHeader(404)
-		return
-	}
-
 	if err != nil {
 		api.RESTHTTPError(w, errors.RemoveVolume.Combine(errored.New(vc.String())).Combine(err))
 		return
@@ -785,11 +1426,6 @@ func (d *DaemonConfig) handleRemoveForce(w http.ResponseWriter, r *http.Request)
 	}
 
 	err = d.Config.RemoveVolume(req.Policy, req.Name)
-	if err == errors.NotExists {
-		w.WriteHeader(404)
-		return
-	}
-
 	if err != nil {
 		api.RESTHTTPError(w, errors.RemoveVolume.Combine(errored.Errorf("%v/%v", req.Policy, req.Name)).Combine(err))
 		return
@@ -804,10 +1440,7 @@ func (d *DaemonConfig) handleRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	tenConfig, err := d.Config.GetVolume(req.Policy, req.Name)
-	if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.NotExists) {
-		w.WriteHeader(404)
-		return
-	} else if err != nil {
+	if err != nil {
 		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
 		return
 	}
@@ -869,7 +1502,7 @@ func (d *DaemonConfig) handleCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock(
-		[]config.UseLocker{uc, snapUC},
+		config.QuotaLocks(policy, lock.ReasonCreate, uc, snapUC),
 		d.Global.Timeout,
 		d.createVolume(w, req, policy),
 	)
@@ -888,6 +1521,10 @@ func (d *DaemonConfig) createVolume(w http.ResponseWriter, req *config.VolumeReq
 
 		logrus.Debugf("Volume Create: %#v", *volConfig)
 
+		if err := d.Config.CheckQuota(policy, volConfig); err != nil {
+			return err
+		}
+
 		do, err := control.CreateVolume(policy, volConfig, d.Global.Timeout)
 		if err == errors.NoActionTaken {
 			goto publish
@@ -0,0 +1,227 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/apiserver/client"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/db/impl/memory"
+
+	. "gopkg.in/check.v1"
+)
+
+// daemonSuite runs the apiserver on the in-memory keys API instead of etcd.
+type daemonSuite struct {
+	daemon *DaemonConfig
+	server *httptest.Server
+}
+
+var _ = Suite(&daemonSuite{})
+
+func (s *daemonSuite) SetUpTest(c *C) {
+	s.daemon = &DaemonConfig{
+		Config:  config.NewClientFromKeysAPI("/volplugin", memory.NewClient("/volplugin").KeysAPI()),
+		Timeout: 10 * time.Second,
+		Global:  config.NewGlobalConfig(),
+		Tokens: []*Token{
+			{Name: "reader", Token: "reader-token", Role: RoleReadOnly},
+			{Name: "ci", Token: "ci-token", Role: RoleOperator},
+			{Name: "root", Token: "root-token", Role: RoleAdmin},
+		},
+	}
+
+	r, err := s.daemon.router()
+	c.Assert(err, IsNil)
+	s.server = httptest.NewServer(r)
+}
+
+func (s *daemonSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *daemonSuite) client(token string) *client.Client {
+	apiClient := client.New(strings.TrimPrefix(s.server.URL, "http://"), 10*time.Second)
+	apiClient.SetToken(token)
+	return apiClient
+}
+
+func testPolicy() *config.Policy {
+	return &config.Policy{
+		Backends:      &config.BackendDrivers{CRUD: "ceph", Mount: "ceph", Snapshot: "ceph"},
+		DriverOptions: map[string]string{"pool": "rbd"},
+		CreateOptions: config.CreateOptions{Size: "10MB"},
+	}
+}
+
+func (s *daemonSuite) TestPolicies(c *C) {
+	root := s.client("root-token")
+	reader := s.client("reader-token")
+
+	_, err := reader.GetPolicy("policy1")
+	assertCode(c, err, api.CodeNotExists)
+
+	assertCode(c, s.client("ci-token").UploadPolicy("policy1", testPolicy()), api.CodeForbidden)
+	c.Assert(root.UploadPolicy("policy1", testPolicy()), IsNil)
+
+	policy, err := reader.GetPolicy("policy1")
+	c.Assert(err, IsNil)
+	c.Assert(policy.Name, Equals, "policy1")
+	c.Assert(policy.DriverOptions["pool"], Equals, "rbd")
+
+	policies, err := reader.ListPolicies()
+	c.Assert(err, IsNil)
+	c.Assert(len(policies), Equals, 1)
+
+	revisions, err := reader.ListPolicyRevisions("policy1")
+	c.Assert(err, IsNil)
+	c.Assert(len(revisions), Equals, 1)
+
+	c.Assert(root.DeletePolicy("policy1"), IsNil)
+	_, err = reader.GetPolicy("policy1")
+	assertCode(c, err, api.CodeNotExists)
+}
+
+func (s *daemonSuite) TestForceRemoveRequiresAdmin(c *C) {
+	err := s.client("ci-token").RemoveVolume("policy1", "test", 0, true)
+	assertCode(c, err, api.CodeForbidden)
+	c.Assert(err.(*api.HTTPError).Status, Equals, http.StatusForbidden)
+
+	// without force, operators may remove volumes; this one does not exist.
+	assertCode(c, s.client("ci-token").RemoveVolume("policy1", "test", 0, false), api.CodeNotExists)
+	assertCode(c, s.client("root-token").RemoveVolume("policy1", "test", 0, true), api.CodeNotExists)
+}
+
+func (s *daemonSuite) TestEvents(c *C) {
+	c.Assert(s.client("root-token").UploadPolicy("policy1", testPolicy()), IsNil)
+
+	events := []*config.Event{}
+	err := s.client("reader-token").Events(&client.EventOptions{Types: []string{config.EventPolicy}, AfterIndex: 1}, func(event *config.Event) bool {
+		events = append(events, event)
+		return false
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(len(events), Equals, 1)
+	c.Assert(events[0].Policy, Equals, "policy1")
+
+	policy := &config.Policy{}
+	c.Assert(json.Unmarshal(events[0].Value, policy), IsNil)
+	c.Assert(policy.Name, Equals, "policy1")
+}
+
+func (s *daemonSuite) TestGlobal(c *C) {
+	global := config.NewGlobalConfig()
+	global.Debug = true
+
+	c.Assert(s.client("root-token").UploadGlobal(global), IsNil)
+
+	// the apiserver serves the global configuration it watches, which is not
+	// watched here; check the published one.
+	uploaded, err := s.daemon.Config.GetGlobal()
+	c.Assert(err, IsNil)
+	c.Assert(uploaded.Debug, Equals, true)
+
+	_, err = s.client("reader-token").GetGlobal()
+	c.Assert(err, IsNil)
+}
+
+func (s *daemonSuite) TestResizeQuota(c *C) {
+	policy := testPolicy()
+	policy.Quota = &config.Quota{Size: "15MB"}
+	c.Assert(s.client("root-token").UploadPolicy("policy1", policy), IsNil)
+
+	vol, err := s.daemon.Config.CreateVolume(&config.VolumeRequest{Policy: "policy1", Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(s.daemon.Config.PublishVolume(vol), IsNil)
+
+	_, err = s.client("ci-token").ResizeVolume("policy1", "test", "20MB", false)
+	assertCode(c, err, api.CodeQuotaExceeded)
+
+	vol, err = s.daemon.Config.GetVolume("policy1", "test")
+	c.Assert(err, IsNil)
+	c.Assert(vol.CreateOptions.Size, Equals, "10MB")
+}
+
+func (s *daemonSuite) TestResizeShrink(c *C) {
+	c.Assert(s.client("root-token").UploadPolicy("policy1", testPolicy()), IsNil)
+
+	vol, err := s.daemon.Config.CreateVolume(&config.VolumeRequest{Policy: "policy1", Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(s.daemon.Config.PublishVolume(vol), IsNil)
+
+	_, err = s.client("ci-token").ResizeVolume("policy1", "test", "5MB", false)
+	assertCode(c, err, api.CodeInvalid)
+	c.Assert(err, ErrorMatches, ".*Refusing to shrink volume.*without force.*")
+
+	vol, err = s.daemon.Config.GetVolume("policy1", "test")
+	c.Assert(err, IsNil)
+	c.Assert(vol.CreateOptions.Size, Equals, "10MB")
+}
+
+func (s *daemonSuite) TestResizeShrinkForced(c *C) {
+	// the loopback backend cannot resize, so a shrink which gets past the
+	// checks of the apiserver fails in the driver.
+	policy := testPolicy()
+	policy.Backends = &config.BackendDrivers{CRUD: "loopback", Mount: "loopback"}
+	policy.DriverOptions = map[string]string{"path": "/var/lib/volplugin/loopback"}
+	c.Assert(s.client("root-token").UploadPolicy("policy1", policy), IsNil)
+
+	vol, err := s.daemon.Config.CreateVolume(&config.VolumeRequest{Policy: "policy1", Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(s.daemon.Config.PublishVolume(vol), IsNil)
+
+	// forced shrinks require the volume to be unmounted.
+	s.daemon.Global.Timeout = time.Second
+	mount := &config.UseMount{Volume: vol.String(), Hostname: "host1"}
+	c.Assert(s.daemon.Config.PublishUse(mount), IsNil)
+	_, err = s.client("ci-token").ResizeVolume("policy1", "test", "5MB", true)
+	assertCode(c, err, api.CodeLocked)
+
+	c.Assert(s.daemon.Config.RemoveUse(mount, true), IsNil)
+	_, err = s.client("ci-token").ResizeVolume("policy1", "test", "5MB", true)
+	assertCode(c, err, api.CodeUnsupported)
+
+	vol, err = s.daemon.Config.GetVolume("policy1", "test")
+	c.Assert(err, IsNil)
+	c.Assert(vol.CreateOptions.Size, Equals, "10MB")
+}
+
+func (s *daemonSuite) TestGrowMounted(c *C) {
+	vol := &config.Volume{PolicyName: "policy1", VolumeName: "test", CreateOptions: config.CreateOptions{FileSystem: "ext4"}}
+
+	// volumes which are not mounted, or mounted here, need no volplugin.
+	c.Assert(s.daemon.growMounted(vol, "host1"), IsNil)
+	c.Assert(s.daemon.Config.PublishUse(&config.UseMount{Volume: vol.String(), Hostname: "host1"}), IsNil)
+	c.Assert(s.daemon.growMounted(vol, "host1"), IsNil)
+
+	// answer the request the way the volplugin on host2 does.
+	answer := func(state, errMsg string) {
+		for {
+			grow, err := s.daemon.Config.GetGrow(vol.String())
+			if err == nil {
+				c.Assert(grow.Hostname, Equals, "host1")
+				c.Assert(grow.FileSystem, Equals, "ext4")
+				grow.State = state
+				grow.Error = errMsg
+				c.Assert(s.daemon.Config.PublishGrow(grow), IsNil)
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	go answer(config.GrowDone, "")
+	c.Assert(s.daemon.growMounted(vol, "host2"), IsNil)
+
+	_, err := s.daemon.Config.GetGrow(vol.String())
+	c.Assert(err, NotNil)
+
+	go answer(config.GrowFailed, "resize2fs failed")
+	err = s.daemon.growMounted(vol, "host2")
+	c.Assert(err, ErrorMatches, `.*host "host1" could not grow the filesystem: resize2fs failed.*`)
+}
@@ -0,0 +1,164 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/watch"
+)
+
+// eventHeartbeat is how often a comment is sent on idle event streams, so
+// proxies do not time them out.
+const eventHeartbeat = 30 * time.Second
+
+// eventFilter selects the events sent on a stream.
+type eventFilter struct {
+	types  map[string]bool
+	volume string
+}
+
+// newEventFilter parses the type and volume query parameters. Types may be
+// repeated or comma separated; no types means all of them.
+func newEventFilter(r *http.Request) (*eventFilter, error) {
+	filter := &eventFilter{types: map[string]bool{}, volume: r.URL.Query().Get("volume")}
+
+	for _, param := range r.URL.Query()["type"] {
+		for _, typ := range strings.Split(param, ",") {
+			if !validEventType(typ) {
+				return nil, errors.InvalidEventFilter.Combine(errored.Errorf("Unknown event type %q, must be one of %v", typ, config.EventTypes))
+			}
+
+			filter.types[typ] = true
+		}
+	}
+
+	return filter, nil
+}
+
+func validEventType(typ string) bool {
+	for _, valid := range config.EventTypes {
+		if typ == valid {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *eventFilter) match(event *config.Event) bool {
+	if len(f.types) > 0 && !f.types[event.Type] {
+		return false
+	}
+
+	return f.volume == "" || f.volume == event.Volume
+}
+
+// eventIndex returns the index to resume the stream after: the index query
+// parameter or, when an EventSource reconnects, the Last-Event-ID header.
+func eventIndex(r *http.Request) (uint64, error) {
+	index := r.URL.Query().Get("index")
+	if index == "" {
+		index = r.Header.Get("Last-Event-ID")
+	}
+
+	if index == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.ParseUint(index, 10, 64)
+	if err != nil {
+		return 0, errors.InvalidEventFilter.Combine(errored.Errorf("Invalid index %q", index))
+	}
+
+	return i, nil
+}
+
+// writeEvent writes a server-sent event with the JSON of v as data. id is
+// left out if 0.
+func writeEvent(w io.Writer, id uint64, typ string, v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if id != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typ, content)
+	return err
+}
+
+// handleEvents streams changes to policies, volumes, runtime options, use
+// locks and snapshot signals as server-sent events, until the client goes
+// away. Errors after the stream started are sent as an "error" event.
+func (d *DaemonConfig) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	notifier, notifies := w.(http.CloseNotifier)
+	if !ok || !notifies {
+		api.RESTHTTPError(w, errors.WatchEvents.Combine(errored.New("Streaming is not supported")))
+		return
+	}
+
+	filter, err := newEventFilter(r)
+	if err != nil {
+		api.RESTHTTPError(w, errors.WatchEvents.Combine(err))
+		return
+	}
+
+	index, err := eventIndex(r)
+	if err != nil {
+		api.RESTHTTPError(w, errors.WatchEvents.Combine(err))
+		return
+	}
+
+	activity := make(chan *watch.Watch)
+	watcher := d.Config.WatchEvents(activity, index)
+	defer watch.StopWatcher(watcher)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	closed := notifier.CloseNotify()
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case err := <-watcher.ErrorChannel:
+			writeEvent(w, 0, "error", api.NewHTTPError(errors.WatchEvents.Combine(errors.EtcdToErrored(err))))
+			flusher.Flush()
+			return
+		case wa := <-activity:
+			event := wa.Config.(*config.Event)
+			if !filter.match(event) {
+				continue
+			}
+
+			if err := writeEvent(w, event.Index, event.Type, event); err != nil {
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
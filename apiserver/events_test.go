@@ -0,0 +1,77 @@
+package apiserver
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/contiv/volplugin/config"
+
+	. "gopkg.in/check.v1"
+)
+
+type eventsSuite struct{}
+
+var _ = Suite(&eventsSuite{})
+
+func (s *eventsSuite) TestEventFilter(c *C) {
+	r, err := http.NewRequest("GET", "/events?type=volume,runtime&type=use&volume=policy1/test", nil)
+	c.Assert(err, IsNil)
+
+	filter, err := newEventFilter(r)
+	c.Assert(err, IsNil)
+
+	c.Assert(filter.match(&config.Event{Type: config.EventVolume, Volume: "policy1/test"}), Equals, true)
+	c.Assert(filter.match(&config.Event{Type: config.EventUse, Volume: "policy1/test"}), Equals, true)
+	c.Assert(filter.match(&config.Event{Type: config.EventSnapshot, Volume: "policy1/test"}), Equals, false)
+	c.Assert(filter.match(&config.Event{Type: config.EventVolume, Volume: "policy1/other"}), Equals, false)
+	c.Assert(filter.match(&config.Event{Type: config.EventPolicy, Policy: "policy1"}), Equals, false)
+
+	r, err = http.NewRequest("GET", "/events", nil)
+	c.Assert(err, IsNil)
+
+	filter, err = newEventFilter(r)
+	c.Assert(err, IsNil)
+	c.Assert(filter.match(&config.Event{Type: config.EventPolicy, Policy: "policy1"}), Equals, true)
+
+	r, err = http.NewRequest("GET", "/events?type=volume,mount", nil)
+	c.Assert(err, IsNil)
+
+	_, err = newEventFilter(r)
+	c.Assert(err, NotNil)
+}
+
+func (s *eventsSuite) TestEventIndex(c *C) {
+	r, err := http.NewRequest("GET", "/events?index=42", nil)
+	c.Assert(err, IsNil)
+
+	index, err := eventIndex(r)
+	c.Assert(err, IsNil)
+	c.Assert(index, Equals, uint64(42))
+
+	// EventSources resume with the header.
+	r, err = http.NewRequest("GET", "/events", nil)
+	c.Assert(err, IsNil)
+
+	index, err = eventIndex(r)
+	c.Assert(err, IsNil)
+	c.Assert(index, Equals, uint64(0))
+
+	r.Header.Set("Last-Event-ID", "43")
+	index, err = eventIndex(r)
+	c.Assert(err, IsNil)
+	c.Assert(index, Equals, uint64(43))
+
+	r.Header.Set("Last-Event-ID", "latest")
+	_, err = eventIndex(r)
+	c.Assert(err, NotNil)
+}
+
+func (s *eventsSuite) TestWriteEvent(c *C) {
+	buf := &bytes.Buffer{}
+	c.Assert(writeEvent(buf, 12, config.EventSnapshot, &config.Event{Index: 12, Type: config.EventSnapshot, Action: "set", Policy: "policy1", Volume: "policy1/test", Key: "snapshots/policy1/test"}), IsNil)
+	c.Assert(buf.String(), Equals, "id: 12\nevent: snapshot\ndata: {\"index\":12,\"type\":\"snapshot\",\"action\":\"set\",\"policy\":\"policy1\",\"volume\":\"policy1/test\",\"key\":\"snapshots/policy1/test\"}\n\n")
+
+	buf.Reset()
+	c.Assert(writeEvent(buf, 0, "error", map[string]string{"code": "internal"}), IsNil)
+	c.Assert(buf.String(), Equals, "event: error\ndata: {\"code\":\"internal\"}\n\n")
+}
@@ -0,0 +1,56 @@
+package apiserver
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/contiv/volplugin/metrics"
+)
+
+var (
+	requestCount    = metrics.NewCounterVec("volplugin_apiserver_requests_total", "Requests handled by the apiserver.", "method", "route", "code")
+	requestDuration = metrics.NewHistogramVec("volplugin_apiserver_request_duration_seconds", "Time taken to handle apiserver requests.", nil, "method", "route")
+)
+
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Flush flushes the underlying writer, so streaming handlers can be measured
+// too.
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// CloseNotify tells streaming handlers when the client goes away.
+func (s *statusRecorder) CloseNotify() <-chan bool {
+	if notifier, ok := s.ResponseWriter.(http.CloseNotifier); ok {
+		return notifier.CloseNotify()
+	}
+
+	return make(chan bool)
+}
+
+// metricsHandler records the count and latency of requests to the route.
+// route is the mux template, so requests are not partitioned by volume.
+func metricsHandler(route, method string, actionFunc func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		actionFunc(rec, r)
+
+		requestDuration.Since(start, method, route)
+		requestCount.Inc(method, route, strconv.Itoa(rec.status))
+	}
+}
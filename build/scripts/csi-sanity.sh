@@ -0,0 +1,44 @@
+#!/bin/bash
+#
+# Runs the CSI sanity suite against a volplugin serving the CSI services on a
+# unix socket. Needs etcd and the apiserver running, like the system tests.
+
+set -e
+
+if [ ! -n "${USE_DRIVER}" ]
+then
+  export USE_DRIVER=loopback
+fi
+
+CSI_DIR=${CSI_DIR:-/tmp/volplugin-csi}
+CSI_POLICY=${CSI_POLICY:-csi-sanity}
+CSI_TEST_VERSION=${CSI_TEST_VERSION:-v1.1.1}
+
+if [ -z "`which csi-sanity`" ]
+then
+  echo "Fetching csi-sanity ${CSI_TEST_VERSION}..."
+  go get -d github.com/kubernetes-csi/csi-test/cmd/csi-sanity || :
+  (cd ${GOPATH%%:*}/src/github.com/kubernetes-csi/csi-test && \
+    git checkout -q ${CSI_TEST_VERSION} && \
+    go test -c -o ${GOPATH%%:*}/bin/csi-sanity ./cmd/csi-sanity)
+fi
+
+rm -rf ${CSI_DIR}
+mkdir -p ${CSI_DIR}
+echo "policy: ${CSI_POLICY}" > ${CSI_DIR}/parameters.yaml
+
+volcli policy upload ${CSI_POLICY} < systemtests/testdata/${USE_DRIVER}/policy1.json
+
+volplugin --host-label csi-sanity --csi-socket ${CSI_DIR}/csi.sock &> ${CSI_DIR}/volplugin.log &
+trap "kill $! && volcli policy delete ${CSI_POLICY}" EXIT
+
+while [ ! -S ${CSI_DIR}/csi.sock ]; do sleep 1; done
+
+echo running csi-sanity against the ${USE_DRIVER} driver...
+csi-sanity \
+  --csi.endpoint ${CSI_DIR}/csi.sock \
+  --csi.testvolumeparameters ${CSI_DIR}/parameters.yaml \
+  --csi.testvolumesize 10485760 \
+  --csi.mountdir ${CSI_DIR}/mount \
+  --csi.stagingdir ${CSI_DIR}/staging \
+  -ginkgo.focus "${TESTRUN}"
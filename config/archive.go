@@ -1,11 +1,15 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/errors"
 	"github.com/contiv/volplugin/watch"
 	"github.com/coreos/etcd/client"
@@ -20,10 +24,14 @@ func (c *Client) policyArchiveEntry(name string, timestamp string) string {
 	return c.prefixed(rootPolicyArchive, name, timestamp)
 }
 
+// revisionTimestamp is the name of a policy revision created now.
+func revisionTimestamp() string {
+	return fmt.Sprint(time.Now().Unix())
+}
+
 // CreatePolicyRevision creates an revision entry in a policy's history.
 func (c *Client) CreatePolicyRevision(name string, policy string) error {
-	timestamp := fmt.Sprint(time.Now().Unix())
-	key := c.policyArchiveEntry(name, timestamp)
+	key := c.policyArchiveEntry(name, revisionTimestamp())
 
 	_, err := c.etcdClient.Set(context.Background(), key, policy, nil)
 	if err != nil {
@@ -65,6 +73,81 @@ func (c *Client) GetPolicyRevision(name, revision string) (string, error) {
 	return resp.Node.Value, nil
 }
 
+// RollbackPolicy publishes a revision of a policy as its current version,
+// which records it as a new revision. The policy may have been deleted since.
+func (c *Client) RollbackPolicy(name, revision string) (*Policy, error) {
+	content, err := c.GetPolicyRevision(name, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := NewPolicy()
+	if err := json.Unmarshal([]byte(content), policy); err != nil {
+		return nil, errored.Errorf("Revision %q of policy %q is invalid", revision, name).Combine(err)
+	}
+
+	if err := c.PublishPolicy(name, policy); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// PrunePolicyRevisions removes the revisions of a policy beyond the newest
+// keep, and those older than maxAge. Zero values disable either limit. The
+// newest revision is always kept. The removed revisions are returned.
+func (c *Client) PrunePolicyRevisions(name string, keep uint, maxAge time.Duration) ([]string, error) {
+	pruned := []string{}
+
+	if keep == 0 && maxAge == 0 {
+		return pruned, nil
+	}
+
+	revisions, err := c.ListPolicyRevisions(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// revisions are unix timestamps; anything else was not written by us and
+	// is left alone.
+	timestamps := []int64{}
+	for _, revision := range revisions {
+		if timestamp, err := strconv.ParseInt(revision, 10, 64); err == nil {
+			timestamps = append(timestamps, timestamp)
+		}
+	}
+
+	sort.Sort(byTimestamp(timestamps))
+
+	for i, timestamp := range timestamps {
+		if i == len(timestamps)-1 {
+			break
+		}
+
+		tooMany := keep > 0 && uint(len(timestamps)-i) > keep
+		tooOld := maxAge > 0 && time.Since(time.Unix(timestamp, 0)) > maxAge
+
+		if !tooMany && !tooOld {
+			continue
+		}
+
+		revision := fmt.Sprint(timestamp)
+		if _, err := c.etcdClient.Delete(context.Background(), c.policyArchiveEntry(name, revision), nil); err != nil {
+			return pruned, errors.EtcdToErrored(err)
+		}
+
+		pruned = append(pruned, revision)
+	}
+
+	return pruned, nil
+}
+
+type byTimestamp []int64
+
+func (s byTimestamp) Len() int           { return len(s) }
+func (s byTimestamp) Less(i, j int) bool { return s[i] < s[j] }
+func (s byTimestamp) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
 // WatchForPolicyChanges creates a watch which returns the policy name and revision
 // whenever a new policy is uploaded.
 func (c *Client) WatchForPolicyChanges(activity chan *watch.Watch) {
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/contiv/volplugin/watch"
+	"golang.org/x/net/context"
 	. "gopkg.in/check.v1"
 )
 
@@ -68,3 +72,59 @@ func (s *configSuite) TestWatchForPolicyChanges(c *C) {
 	_, err := s.tlc.GetPolicyRevision(name, revision)
 	c.Assert(err, IsNil)
 }
+
+func (s *configSuite) TestRollbackPolicy(c *C) {
+	policy := *testPolicies["basic"]
+	c.Assert(s.tlc.PublishPolicy(testPolicyName, &policy), IsNil)
+
+	revisions, err := s.tlc.ListPolicyRevisions(testPolicyName)
+	c.Assert(err, IsNil)
+	c.Assert(len(revisions), Equals, 1)
+
+	c.Assert(s.tlc.DeletePolicy(testPolicyName), IsNil)
+
+	// revisions are timestamped to the second.
+	time.Sleep(time.Second)
+
+	rolledBack, err := s.tlc.RollbackPolicy(testPolicyName, revisions[0])
+	c.Assert(err, IsNil)
+	c.Assert(rolledBack.CreateOptions, DeepEquals, policy.CreateOptions)
+
+	current, err := s.tlc.GetPolicy(testPolicyName)
+	c.Assert(err, IsNil)
+	c.Assert(current, DeepEquals, rolledBack)
+	c.Assert(revisionCount(s, c), Equals, 2)
+
+	_, err = s.tlc.RollbackPolicy(testPolicyName, "1")
+	c.Assert(err, NotNil)
+}
+
+func (s *configSuite) TestPrunePolicyRevisions(c *C) {
+	now := time.Now()
+
+	for _, age := range []time.Duration{72 * time.Hour, 48 * time.Hour, 24 * time.Hour, time.Hour, 0} {
+		key := s.tlc.policyArchiveEntry(testPolicyName, fmt.Sprint(now.Add(-age).Unix()))
+		_, err := s.tlc.etcdClient.Set(context.Background(), key, "{}", nil)
+		c.Assert(err, IsNil)
+	}
+
+	pruned, err := s.tlc.PrunePolicyRevisions(testPolicyName, 0, 0)
+	c.Assert(err, IsNil)
+	c.Assert(len(pruned), Equals, 0)
+
+	pruned, err = s.tlc.PrunePolicyRevisions(testPolicyName, 4, 0)
+	c.Assert(err, IsNil)
+	c.Assert(pruned, DeepEquals, []string{fmt.Sprint(now.Add(-72 * time.Hour).Unix())})
+	c.Assert(revisionCount(s, c), Equals, 4)
+
+	pruned, err = s.tlc.PrunePolicyRevisions(testPolicyName, 0, 36*time.Hour)
+	c.Assert(err, IsNil)
+	c.Assert(pruned, DeepEquals, []string{fmt.Sprint(now.Add(-48 * time.Hour).Unix())})
+	c.Assert(revisionCount(s, c), Equals, 3)
+
+	// the newest revision always survives.
+	pruned, err = s.tlc.PrunePolicyRevisions(testPolicyName, 1, time.Nanosecond)
+	c.Assert(err, IsNil)
+	c.Assert(len(pruned), Equals, 2)
+	c.Assert(revisionCount(s, c), Equals, 1)
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+// AuditEntry records a mutating operation: who did what to which object,
+// and whether it succeeded.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Caller identifies who requested the operation: the name of their
+	// token, their client certificate, or their address.
+	Caller string `json:"caller"`
+	// Address is the address the request came from.
+	Address string `json:"address,omitempty"`
+	// Operation is what was done, e.g. "volume remove".
+	Operation string `json:"operation"`
+	// Target is the object of the operation: a volume as policy/name, a
+	// policy name or "global".
+	Target string `json:"target"`
+	// Details are the options of the operation, e.g. the target of a copy.
+	Details map[string]string `json:"details,omitempty"`
+	Success bool              `json:"success"`
+	Error   string            `json:"error,omitempty"`
+}
+
+func (c *Client) audit() string {
+	return c.prefixed(rootAudit)
+}
+
+// RecordAudit appends an entry to the audit log. It expires after retention;
+// a zero retention keeps it forever.
+func (c *Client) RecordAudit(entry *AuditEntry, retention time.Duration) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.etcdClient.CreateInOrder(context.Background(), c.audit(), string(content), &client.CreateInOrderOptions{TTL: retention})
+	return errors.EtcdToErrored(err)
+}
+
+// ListAudit returns the audit log entries recorded since the given time,
+// oldest first. If target is not empty, only the entries for it are returned.
+func (c *Client) ListAudit(since time.Time, target string) ([]*AuditEntry, error) {
+	entries := []*AuditEntry{}
+
+	resp, err := c.etcdClient.Get(context.Background(), c.audit(), &client.GetOptions{Sort: true, Quorum: true})
+	if err != nil {
+		if er, ok := errors.EtcdToErrored(err).(*errored.Error); ok && er.Contains(errors.NotExists) {
+			return entries, nil
+		}
+
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	for _, node := range resp.Node.Nodes {
+		entry := &AuditEntry{}
+		if err := json.Unmarshal([]byte(node.Value), entry); err != nil {
+			return nil, errored.Errorf("Audit log entry %q is invalid", node.Key).Combine(err)
+		}
+
+		if entry.Time.Before(since) || (target != "" && entry.Target != target) {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *configSuite) TestAudit(c *C) {
+	entries, err := s.tlc.ListAudit(time.Time{}, "")
+	c.Assert(err, IsNil)
+	c.Assert(entries, DeepEquals, []*AuditEntry{})
+
+	start := time.Now().UTC().Add(-time.Hour)
+
+	recorded := []*AuditEntry{
+		{Time: start, Caller: "admin", Operation: "policy upload", Target: "policy1", Success: true},
+		{Time: start.Add(time.Minute), Caller: "ci", Address: "10.0.0.1", Operation: "volume create", Target: "policy1/test", Details: map[string]string{"size": "10MB"}, Success: true},
+		{Time: start.Add(2 * time.Minute), Caller: "ci", Operation: "volume remove", Target: "policy1/test", Error: "Volume is mounted"},
+	}
+
+	for _, entry := range recorded {
+		c.Assert(s.tlc.RecordAudit(entry, 0), IsNil)
+	}
+
+	entries, err = s.tlc.ListAudit(time.Time{}, "")
+	c.Assert(err, IsNil)
+	c.Assert(entries, DeepEquals, recorded)
+
+	entries, err = s.tlc.ListAudit(start.Add(time.Second), "")
+	c.Assert(err, IsNil)
+	c.Assert(entries, DeepEquals, recorded[1:])
+
+	entries, err = s.tlc.ListAudit(time.Time{}, "policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(entries, DeepEquals, recorded[1:])
+
+	entries, err = s.tlc.ListAudit(start.Add(90*time.Second), "policy1")
+	c.Assert(err, IsNil)
+	c.Assert(entries, DeepEquals, []*AuditEntry{})
+
+	// entries expire after the retention.
+	c.Assert(s.tlc.RecordAudit(&AuditEntry{Time: time.Now().UTC(), Operation: "global upload", Target: "global"}, time.Second), IsNil)
+	entries, err = s.tlc.ListAudit(time.Time{}, "global")
+	c.Assert(err, IsNil)
+	c.Assert(len(entries), Equals, 1)
+
+	time.Sleep(2 * time.Second)
+	entries, err = s.tlc.ListAudit(time.Time{}, "global")
+	c.Assert(err, IsNil)
+	c.Assert(entries, DeepEquals, []*AuditEntry{})
+}
@@ -19,14 +19,20 @@ import (
 )
 
 const (
-	rootVolume        = "volumes"
-	rootUse           = "users"
-	rootPolicy        = "policies"
-	rootPolicyArchive = "policy-archives"
-	rootSnapshots     = "snapshots"
+	rootVolume          = "volumes"
+	rootUse             = "users"
+	rootPolicy          = "policies"
+	rootPolicyArchive   = "policy-archives"
+	rootSnapshots       = "snapshots"
+	rootStats           = "stats"
+	rootAudit           = "audit"
+	rootSnapshotRuns    = "snapshot-runs"
+	rootFreezes         = "freezes"
+	rootGrows           = "grows"
+	rootSnapshotResults = "snapshot-results"
 )
 
-var defaultPaths = []string{rootVolume, rootUse, rootPolicy, rootPolicyArchive, rootSnapshots}
+var defaultPaths = []string{rootVolume, rootUse, rootPolicy, rootPolicyArchive, rootSnapshots, rootStats, rootAudit, rootSnapshotRuns, rootFreezes, rootGrows, rootSnapshotResults}
 
 // VolumeRequest provides a request structure for communicating volumes to the
 // apiserver or internally. it is the basic representation of a volume.
@@ -58,9 +64,16 @@ func NewClient(prefix string, etcdHosts []string) (*Client, error) {
 		return nil, err
 	}
 
+	return NewClientFromKeysAPI(prefix, client.NewKeysAPI(etcdClient)), nil
+}
+
+// NewClientFromKeysAPI creates a Client on top of any etcd v2 keys API, such
+// as the ones db/store builds for other stores, or the one of the in-memory
+// db client, which tests use to run without etcd.
+func NewClientFromKeysAPI(prefix string, keysAPI client.KeysAPI) *Client {
 	config := &Client{
 		prefix:     prefix,
-		etcdClient: client.NewKeysAPI(etcdClient),
+		etcdClient: keysAPI,
 	}
 
 	watch.Init(config.etcdClient)
@@ -70,7 +83,7 @@ func NewClient(prefix string, etcdHosts []string) (*Client, error) {
 		config.etcdClient.Set(context.Background(), config.prefixed(path), "", &client.SetOptions{Dir: true})
 	}
 
-	return config, nil
+	return config
 }
 
 func (c *Client) prefixed(strs ...string) string {
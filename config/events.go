@@ -0,0 +1,107 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/contiv/volplugin/watch"
+	"github.com/coreos/etcd/client"
+)
+
+// Types of Event.
+const (
+	EventPolicy   = "policy"
+	EventVolume   = "volume"
+	EventRuntime  = "runtime"
+	EventUse      = "use"
+	EventSnapshot = "snapshot"
+)
+
+// EventTypes are all the types of Event.
+var EventTypes = []string{EventPolicy, EventVolume, EventRuntime, EventUse, EventSnapshot}
+
+// Event is a change to a policy, volume, runtime options, use lock or
+// snapshot signal.
+type Event struct {
+	// Index is the etcd index of the change. Watching from it resumes after
+	// the event.
+	Index uint64 `json:"index"`
+	Type  string `json:"type"`
+	// Action is the etcd action, e.g. "set" or "delete".
+	Action string `json:"action"`
+	Policy string `json:"policy"`
+	// Volume is the volume the event is about, as policy/name. It is empty
+	// for policy events.
+	Volume string `json:"volume,omitempty"`
+	// Key is the changed key, relative to the prefix.
+	Key string `json:"key"`
+	// Value is the new JSON value of the key, if any.
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// WatchEvents watches for changes to policies, volumes, runtime options, use
+// locks and snapshot signals, sending an *Event for each to activity. If
+// afterIndex is not 0, the changes since that index are sent first. The watch
+// stops on the first error, which is sent to the watcher's ErrorChannel;
+// stop it with watch.StopWatcher.
+func (c *Client) WatchEvents(activity chan *watch.Watch, afterIndex uint64) *watch.Watcher {
+	w := watch.NewWatcher(activity, c.prefix, func(resp *client.Response, w *watch.Watcher) {
+		event := c.event(resp)
+		if event == nil {
+			return
+		}
+
+		select {
+		case w.Channel <- &watch.Watch{Key: event.Key, Config: event}:
+		case <-w.Done():
+		}
+	})
+
+	w.AfterIndex = afterIndex
+	w.StopOnError = true
+	watch.Create(w)
+
+	return w
+}
+
+// event converts a watch response into an Event, or nil if the key is not
+// one events are sent for.
+func (c *Client) event(resp *client.Response) *Event {
+	if resp.Node == nil {
+		return nil
+	}
+
+	key := strings.TrimPrefix(resp.Node.Key, c.prefix+"/")
+	parts := strings.Split(key, "/")
+
+	event := &Event{Index: resp.Node.ModifiedIndex, Action: resp.Action, Key: key}
+
+	switch {
+	case parts[0] == rootPolicy && len(parts) == 2:
+		event.Type, event.Policy = EventPolicy, parts[1]
+	case parts[0] == rootVolume && len(parts) == 3 && resp.Node.Dir:
+		// volume directories are created empty, so only their removal matters.
+		if resp.Action != "delete" && resp.Action != "expire" {
+			return nil
+		}
+		event.Type, event.Policy, event.Volume = EventVolume, parts[1], parts[1]+"/"+parts[2]
+	case parts[0] == rootVolume && len(parts) == 4 && parts[3] == "create":
+		event.Type, event.Policy, event.Volume = EventVolume, parts[1], parts[1]+"/"+parts[2]
+	case parts[0] == rootVolume && len(parts) == 4 && parts[3] == "runtime":
+		event.Type, event.Policy, event.Volume = EventRuntime, parts[1], parts[1]+"/"+parts[2]
+	case parts[0] == rootUse && len(parts) == 4:
+		event.Type, event.Policy, event.Volume = EventUse, parts[2], parts[2]+"/"+parts[3]
+	case parts[0] == rootSnapshots && len(parts) == 3:
+		event.Type, event.Policy, event.Volume = EventSnapshot, parts[1], parts[1]+"/"+parts[2]
+	default:
+		return nil
+	}
+
+	// values which are not JSON, e.g. empty ones, are left out.
+	var value json.RawMessage
+	if !resp.Node.Dir && json.Unmarshal([]byte(resp.Node.Value), &value) == nil {
+		event.Value = value
+	}
+
+	return event
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"time"
+
+	"github.com/contiv/volplugin/watch"
+	. "gopkg.in/check.v1"
+)
+
+func (s *configSuite) readEvent(c *C, w *watch.Watcher, activity chan *watch.Watch) *Event {
+	select {
+	case wa := <-activity:
+		return wa.Config.(*Event)
+	case err := <-w.ErrorChannel:
+		c.Fatal(err)
+	case <-time.After(10 * time.Second):
+		c.Fatal("timed out waiting for an event")
+	}
+
+	return nil
+}
+
+func (s *configSuite) TestWatchEvents(c *C) {
+	activity := make(chan *watch.Watch)
+	w := s.tlc.WatchEvents(activity, 0)
+	defer watch.StopWatcher(w)
+
+	policy := testPolicies["basic"]
+	c.Assert(s.tlc.PublishPolicy("policy1", policy), IsNil)
+
+	event := s.readEvent(c, w, activity)
+	c.Assert(event.Type, Equals, EventPolicy)
+	c.Assert(event.Policy, Equals, "policy1")
+	c.Assert(event.Volume, Equals, "")
+	c.Assert(event.Key, Equals, "policies/policy1")
+	c.Assert(event.Value, NotNil)
+
+	vol, err := s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(s.tlc.PublishVolume(vol), IsNil)
+
+	event = s.readEvent(c, w, activity)
+	c.Assert(event.Type, Equals, EventVolume)
+	c.Assert(event.Volume, Equals, "policy1/test")
+
+	event = s.readEvent(c, w, activity)
+	c.Assert(event.Type, Equals, EventRuntime)
+	c.Assert(event.Volume, Equals, "policy1/test")
+
+	c.Assert(s.tlc.TakeSnapshot("policy1/test"), IsNil)
+	event = s.readEvent(c, w, activity)
+	c.Assert(event.Type, Equals, EventSnapshot)
+	c.Assert(event.Action, Equals, "set")
+	c.Assert(event.Value, IsNil)
+	snapshotIndex := event.Index
+
+	c.Assert(s.tlc.RemoveVolume("policy1", "test"), IsNil)
+	event = s.readEvent(c, w, activity)
+	c.Assert(event.Type, Equals, EventVolume)
+	c.Assert(event.Action, Equals, "delete")
+	c.Assert(event.Volume, Equals, "policy1/test")
+
+	// resuming after the snapshot signal sends the removal again.
+	resumed := make(chan *watch.Watch)
+	w2 := s.tlc.WatchEvents(resumed, snapshotIndex)
+	defer watch.StopWatcher(w2)
+
+	event = s.readEvent(c, w2, resumed)
+	c.Assert(event.Type, Equals, EventVolume)
+	c.Assert(event.Action, Equals, "delete")
+}
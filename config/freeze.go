@@ -0,0 +1,185 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/watch"
+	"github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+// DefaultFreezeTimeout is the longest filesystems stay frozen for consistent
+// snapshots when their freeze timeout is not set.
+const DefaultFreezeTimeout = 10 * time.Second
+
+// DefaultHookTimeout is the longest snapshot hooks run when their timeout is
+// not set.
+const DefaultHookTimeout = 30 * time.Second
+
+// The states of a Freeze.
+const (
+	// FreezeRequested is set by volsupervisor when it asks for the freeze.
+	FreezeRequested = "requested"
+	// FreezeFrozen is set by volplugin once the pre-snapshot hook has run and
+	// the filesystem is frozen.
+	FreezeFrozen = "frozen"
+	// FreezeFailed is set by volplugin if the pre-snapshot hook failed or it
+	// could not freeze the filesystem.
+	FreezeFailed = "failed"
+	// FreezeThaw is set by volsupervisor once the snapshot is taken.
+	FreezeThaw = "thaw"
+	// FreezeThawed is set by volplugin once the filesystem is thawed and the
+	// post-snapshot hook has run.
+	FreezeThawed = "thawed"
+)
+
+// Freeze is a request from volsupervisor to the volplugin mounting a volume
+// to run its pre-snapshot hook and freeze its filesystem, so a snapshot of it
+// is consistent. volplugin thaws the filesystem and runs the post-snapshot
+// hook when asked to, when the request is removed, or after the timeout at
+// the latest.
+type Freeze struct {
+	Volume   string        `json:"volume"`
+	Hostname string        `json:"hostname"`
+	Timeout  time.Duration `json:"timeout"`
+	// Filesystem is whether to freeze the filesystem; if not, only the hooks
+	// run.
+	Filesystem  bool          `json:"filesystem"`
+	PreHook     string        `json:"pre-hook,omitempty"`
+	PostHook    string        `json:"post-hook,omitempty"`
+	HookTimeout time.Duration `json:"hook-timeout,omitempty"`
+	State       string        `json:"state"`
+	// Error is why the filesystem could not be frozen or thawed, and
+	// HookError why the last hook failed.
+	Error     string `json:"error,omitempty"`
+	HookError string `json:"hook-error,omitempty"`
+}
+
+// ttl is the longest a freeze may exist: the hooks each run for at most
+// their timeout, freezing the filesystem takes at most the timeout, and it
+// stays frozen for at most as long again.
+func (f *Freeze) ttl() time.Duration {
+	return 2*f.Timeout + 2*f.HookTimeout
+}
+
+// ParseFreezeTimeout returns FreezeTimeout, or DefaultFreezeTimeout if it is
+// not set.
+func (s *SnapshotConfig) ParseFreezeTimeout() (time.Duration, error) {
+	if s.FreezeTimeout == "" {
+		return DefaultFreezeTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(s.FreezeTimeout)
+	if err != nil || timeout < time.Second {
+		return 0, errored.Errorf("Invalid snapshot freeze timeout %q: must be at least 1s", s.FreezeTimeout).Combine(err)
+	}
+
+	return timeout, nil
+}
+
+func (c *Client) freeze(volume string) string {
+	return c.prefixed(rootFreezes, volume)
+}
+
+// ParseHookTimeout returns HookTimeout, or DefaultHookTimeout if it is not
+// set.
+func (s *SnapshotConfig) ParseHookTimeout() (time.Duration, error) {
+	if s.HookTimeout == "" {
+		return DefaultHookTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(s.HookTimeout)
+	if err != nil || timeout < time.Second {
+		return 0, errored.Errorf("Invalid snapshot hook timeout %q: must be at least 1s", s.HookTimeout).Combine(err)
+	}
+
+	return timeout, nil
+}
+
+// RequestFreeze asks the volplugin on the host to freeze the volume. It fails
+// with errors.Exists if a freeze of the volume is already requested. The
+// request expires once it cannot be in use anymore.
+func (c *Client) RequestFreeze(freeze *Freeze) error {
+	freeze.State = FreezeRequested
+
+	content, err := json.Marshal(freeze)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.etcdClient.Set(context.Background(), c.freeze(freeze.Volume), string(content), &client.SetOptions{PrevExist: client.PrevNoExist, TTL: freeze.ttl()})
+	return errors.EtcdToErrored(err)
+}
+
+// PublishFreeze updates the state of a requested freeze. It fails with
+// errors.NotExists if the request was removed or has expired.
+func (c *Client) PublishFreeze(freeze *Freeze) error {
+	content, err := json.Marshal(freeze)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.etcdClient.Set(context.Background(), c.freeze(freeze.Volume), string(content), &client.SetOptions{PrevExist: client.PrevExist, TTL: freeze.ttl()})
+	return errors.EtcdToErrored(err)
+}
+
+// GetFreeze retrieves the freeze requested for a volume.
+func (c *Client) GetFreeze(volume string) (*Freeze, error) {
+	resp, err := c.etcdClient.Get(context.Background(), c.freeze(volume), nil)
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	freeze := &Freeze{}
+	if err := json.Unmarshal([]byte(resp.Node.Value), freeze); err != nil {
+		return nil, err
+	}
+
+	return freeze, nil
+}
+
+// RemoveFreeze removes the freeze requested for a volume, thawing its
+// filesystem. Does not fail if there is none.
+func (c *Client) RemoveFreeze(volume string) error {
+	_, err := c.etcdClient.Delete(context.Background(), c.freeze(volume), nil)
+	if err != nil {
+		if er, ok := errors.EtcdToErrored(err).(*errored.Error); ok && er.Contains(errors.NotExists) {
+			return nil
+		}
+	}
+
+	return errors.EtcdToErrored(err)
+}
+
+// WatchFreezes watches the freezes requested. The key of each watch is the
+// volume; its config is the *Freeze, or nil once the freeze is removed or
+// has expired.
+func (c *Client) WatchFreezes(activity chan *watch.Watch) {
+	w := watch.NewWatcher(activity, c.prefixed(rootFreezes), func(resp *client.Response, w *watch.Watcher) {
+		if resp.Node.Dir {
+			return
+		}
+
+		vw := &watch.Watch{Key: strings.TrimPrefix(resp.Node.Key, c.prefixed(rootFreezes)+"/")}
+
+		switch resp.Action {
+		case "delete", "expire", "compareAndDelete":
+		default:
+			freeze := &Freeze{}
+			if err := json.Unmarshal([]byte(resp.Node.Value), freeze); err != nil {
+				logrus.Errorf("Could not unmarshal the freeze of volume %q: %v", vw.Key, err)
+				return
+			}
+			vw.Config = freeze
+		}
+
+		w.Channel <- vw
+	})
+
+	watch.Create(w)
+}
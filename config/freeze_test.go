@@ -0,0 +1,75 @@
+package config
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/watch"
+)
+
+func (s *configSuite) TestFreezeTimeout(c *C) {
+	timeout, err := (&SnapshotConfig{}).ParseFreezeTimeout()
+	c.Assert(err, IsNil)
+	c.Assert(timeout, Equals, DefaultFreezeTimeout)
+
+	timeout, err = (&SnapshotConfig{FreezeTimeout: "30s"}).ParseFreezeTimeout()
+	c.Assert(err, IsNil)
+	c.Assert(timeout, Equals, 30*time.Second)
+
+	for _, invalid := range []string{"soon", "500ms", "-1m"} {
+		_, err := (&SnapshotConfig{FreezeTimeout: invalid}).ParseFreezeTimeout()
+		c.Assert(err, NotNil, Commentf("%q", invalid))
+
+		_, err = (&SnapshotConfig{HookTimeout: invalid}).ParseHookTimeout()
+		c.Assert(err, NotNil, Commentf("%q", invalid))
+	}
+
+	timeout, err = (&SnapshotConfig{}).ParseHookTimeout()
+	c.Assert(err, IsNil)
+	c.Assert(timeout, Equals, DefaultHookTimeout)
+
+	timeout, err = (&SnapshotConfig{HookTimeout: "2m"}).ParseHookTimeout()
+	c.Assert(err, IsNil)
+	c.Assert(timeout, Equals, 2*time.Minute)
+}
+
+func (s *configSuite) TestFreeze(c *C) {
+	activity := make(chan *watch.Watch)
+	s.tlc.WatchFreezes(activity)
+	defer watch.Stop(s.tlc.prefixed(rootFreezes))
+
+	freeze := &Freeze{Volume: "policy1/test", Hostname: "mon0", Timeout: time.Minute, Filesystem: true, PreHook: "sync", HookTimeout: time.Second}
+	c.Assert(s.tlc.RequestFreeze(freeze), IsNil)
+
+	w := <-activity
+	c.Assert(w.Key, Equals, "policy1/test")
+	c.Assert(w.Config, DeepEquals, &Freeze{Volume: "policy1/test", Hostname: "mon0", Timeout: time.Minute, Filesystem: true, PreHook: "sync", HookTimeout: time.Second, State: FreezeRequested})
+
+	// only one freeze of a volume at a time.
+	err := s.tlc.RequestFreeze(freeze)
+	c.Assert(err, NotNil)
+	c.Assert(err.(*errored.Error).Contains(errors.Exists), Equals, true)
+
+	freeze.State = FreezeFrozen
+	c.Assert(s.tlc.PublishFreeze(freeze), IsNil)
+	c.Assert((<-activity).Config.(*Freeze).State, Equals, FreezeFrozen)
+
+	freeze2, err := s.tlc.GetFreeze("policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(freeze2, DeepEquals, freeze)
+
+	c.Assert(s.tlc.RemoveFreeze("policy1/test"), IsNil)
+	w = <-activity
+	c.Assert(w.Key, Equals, "policy1/test")
+	c.Assert(w.Config, IsNil)
+
+	c.Assert(s.tlc.RemoveFreeze("policy1/test"), IsNil)
+
+	// volplugin cannot publish a freeze volsupervisor has given up on.
+	err = s.tlc.PublishFreeze(freeze)
+	c.Assert(err, NotNil)
+	c.Assert(err.(*errored.Error).Contains(errors.NotExists), Equals, true)
+}
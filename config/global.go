@@ -16,6 +16,9 @@ const (
 	DefaultGlobalTTL = 30 * time.Second
 	// DefaultTimeout is the standard command timeout when none is provided.
 	DefaultTimeout = 10 * time.Minute
+	// DefaultAuditDays is the number of days audit log entries are kept for
+	// when the global configuration does not say.
+	DefaultAuditDays = 30
 
 	timeoutFixBase   = time.Minute
 	ttlFixBase       = time.Second
@@ -28,6 +31,15 @@ type Global struct {
 	Timeout   time.Duration
 	TTL       time.Duration
 	MountPath string
+	// PolicyRevisions is the number of revisions kept in the archive of each
+	// policy. 0 keeps them all.
+	PolicyRevisions uint
+	// PolicyRevisionDays is the number of days revisions are kept in the
+	// archive. 0 keeps them forever.
+	PolicyRevisionDays uint
+	// AuditDays is the number of days entries are kept in the audit log. 0
+	// keeps them forever.
+	AuditDays uint
 }
 
 // NewGlobalConfigFromJSON transforms json into a global.
@@ -47,6 +59,7 @@ func NewGlobalConfig() *Global {
 		TTL:       DefaultGlobalTTL,
 		MountPath: defaultMountPath,
 		Timeout:   DefaultTimeout,
+		AuditDays: DefaultAuditDays,
 	}
 }
 
@@ -136,6 +149,18 @@ func (global *Global) SetEmpty() *Global {
 	return &newGlobal
 }
 
+// PolicyRevisionMaxAge returns how long revisions are kept in the archive,
+// or 0 if they are kept forever.
+func (global *Global) PolicyRevisionMaxAge() time.Duration {
+	return time.Duration(global.PolicyRevisionDays) * 24 * time.Hour
+}
+
+// AuditRetention returns how long entries are kept in the audit log, or 0 if
+// they are kept forever.
+func (global *Global) AuditRetention() time.Duration {
+	return time.Duration(global.AuditDays) * 24 * time.Hour
+}
+
 // WatchGlobal watches a global and updates it as soon as the config changes.
 func (tlc *Client) WatchGlobal(activity chan *watch.Watch) {
 	w := watch.NewWatcher(activity, tlc.prefixed("global-config"), func(resp *client.Response, w *watch.Watcher) {
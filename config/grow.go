@@ -0,0 +1,131 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/watch"
+	"github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+// The states of a Grow.
+const (
+	// GrowRequested is set by apiserver when it asks for the filesystem to be
+	// grown.
+	GrowRequested = "requested"
+	// GrowDone is set by volplugin once the filesystem is grown.
+	GrowDone = "done"
+	// GrowFailed is set by volplugin if it could not grow the filesystem.
+	GrowFailed = "failed"
+)
+
+// Grow is a request from apiserver to the volplugin mounting a volume to grow
+// its filesystem online, once the volume itself was resized.
+type Grow struct {
+	Volume     string        `json:"volume"`
+	Hostname   string        `json:"hostname"`
+	FileSystem string        `json:"filesystem"`
+	Timeout    time.Duration `json:"timeout"`
+	State      string        `json:"state"`
+	// Error is why the filesystem could not be grown.
+	Error string `json:"error,omitempty"`
+}
+
+// ttl is the longest a grow may exist: volplugin takes at most the timeout
+// to grow the filesystem, and apiserver waits for as long again.
+func (g *Grow) ttl() time.Duration {
+	return 2 * g.Timeout
+}
+
+func (c *Client) grow(volume string) string {
+	return c.prefixed(rootGrows, volume)
+}
+
+// RequestGrow asks the volplugin on the host to grow the filesystem of the
+// volume. It fails with errors.Exists if a grow of the volume is already
+// requested. The request expires once it cannot be in use anymore.
+func (c *Client) RequestGrow(grow *Grow) error {
+	grow.State = GrowRequested
+
+	content, err := json.Marshal(grow)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.etcdClient.Set(context.Background(), c.grow(grow.Volume), string(content), &client.SetOptions{PrevExist: client.PrevNoExist, TTL: grow.ttl()})
+	return errors.EtcdToErrored(err)
+}
+
+// PublishGrow updates the state of a requested grow. It fails with
+// errors.NotExists if the request was removed or has expired.
+func (c *Client) PublishGrow(grow *Grow) error {
+	content, err := json.Marshal(grow)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.etcdClient.Set(context.Background(), c.grow(grow.Volume), string(content), &client.SetOptions{PrevExist: client.PrevExist, TTL: grow.ttl()})
+	return errors.EtcdToErrored(err)
+}
+
+// GetGrow retrieves the grow requested for a volume.
+func (c *Client) GetGrow(volume string) (*Grow, error) {
+	resp, err := c.etcdClient.Get(context.Background(), c.grow(volume), nil)
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	grow := &Grow{}
+	if err := json.Unmarshal([]byte(resp.Node.Value), grow); err != nil {
+		return nil, err
+	}
+
+	return grow, nil
+}
+
+// RemoveGrow removes the grow requested for a volume. Does not fail if there
+// is none.
+func (c *Client) RemoveGrow(volume string) error {
+	_, err := c.etcdClient.Delete(context.Background(), c.grow(volume), nil)
+	if err != nil {
+		if er, ok := errors.EtcdToErrored(err).(*errored.Error); ok && er.Contains(errors.NotExists) {
+			return nil
+		}
+	}
+
+	return errors.EtcdToErrored(err)
+}
+
+// WatchGrows watches the grows requested. The key of each watch is the
+// volume; its config is the *Grow. Removed and expired grows are not
+// reported.
+func (c *Client) WatchGrows(activity chan *watch.Watch) {
+	w := watch.NewWatcher(activity, c.prefixed(rootGrows), func(resp *client.Response, w *watch.Watcher) {
+		if resp.Node.Dir {
+			return
+		}
+
+		switch resp.Action {
+		case "delete", "expire", "compareAndDelete":
+			return
+		}
+
+		vw := &watch.Watch{Key: strings.TrimPrefix(resp.Node.Key, c.prefixed(rootGrows)+"/")}
+
+		grow := &Grow{}
+		if err := json.Unmarshal([]byte(resp.Node.Value), grow); err != nil {
+			logrus.Errorf("Could not unmarshal the grow of volume %q: %v", vw.Key, err)
+			return
+		}
+		vw.Config = grow
+
+		w.Channel <- vw
+	})
+
+	watch.Create(w)
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db/keysapi"
+	"github.com/contiv/volplugin/errors"
+
+	"golang.org/x/net/context"
+)
+
+// leaseStore is a keys API which can hold use locks with leases.
+type leaseStore interface {
+	keysapi.Transactor
+	keysapi.Leaser
+}
+
+// UseLease is a set of use locks attached to a lease of the store. The locks
+// are released together when the lease is, or when it is not kept alive
+// within its TTL, for example because their holder died.
+type UseLease struct {
+	ID  int64
+	TTL time.Duration
+
+	store leaseStore
+}
+
+// SupportsLeases reports whether the store can hold use locks with leases,
+// see PublishUsesWithLease. etcd v3 can; etcd v2 and consul cannot.
+func (c *Client) SupportsLeases() bool {
+	_, ok := c.etcdClient.(leaseStore)
+	return ok
+}
+
+// PublishUsesWithLease acquires all the use locks in a single transaction,
+// attached to a new lease which expires after ttl unless kept alive. If any
+// of them is held by someone else, none are acquired and errors.LockFailed
+// is returned. Uses for which MayExist is true may already be held with the
+// same content, in which case they are taken over.
+func (c *Client) PublishUsesWithLease(ttl time.Duration, uts ...UseLocker) (*UseLease, error) {
+	store, ok := c.etcdClient.(leaseStore)
+	if !ok {
+		return nil, errored.Errorf("The store cannot hold use locks with leases")
+	}
+
+	ops := []*keysapi.Op{}
+
+	for _, ut := range uts {
+		content, err := json.Marshal(ut)
+		if err != nil {
+			return nil, err
+		}
+
+		op := &keysapi.Op{Key: c.use(ut.Type(), ut.GetVolume()), Value: string(content)}
+		if ut.MayExist() {
+			if resp, err := c.etcdClient.Get(context.Background(), op.Key, nil); err == nil && resp.Node.Value == op.Value {
+				op.Index = resp.Node.ModifiedIndex
+			}
+		}
+
+		ops = append(ops, op)
+	}
+
+	id, err := store.Grant(ttl)
+	if err != nil {
+		return nil, errors.LockFailed.Combine(err)
+	}
+
+	for _, op := range ops {
+		op.Lease = id
+	}
+
+	logrus.Debugf("Publishing uses with lease %d: %#v", id, uts)
+
+	if err := store.Txn(ops); err != nil {
+		if err := store.Revoke(id); err != nil {
+			logrus.Errorf("Could not revoke lease %d: %v", id, err)
+		}
+
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	return &UseLease{ID: id, TTL: ttl, store: store}, nil
+}
+
+// KeepAlive renews the lease for its TTL. It fails if the lease was lost.
+func (l *UseLease) KeepAlive() error {
+	if err := l.store.KeepAlive(l.ID); err != nil {
+		return errored.Errorf("Lost lease %d", l.ID).Combine(err)
+	}
+
+	return nil
+}
+
+// Release revokes the lease, releasing all its locks.
+func (l *UseLease) Release() error {
+	return l.store.Revoke(l.ID)
+}
@@ -4,15 +4,19 @@ import (
 	"encoding/json"
 
 	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db/keysapi"
 	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/labels"
 	"github.com/coreos/etcd/client"
 	"golang.org/x/net/context"
 )
 
 // Type definitions for backend drivers
 var defaultDrivers = map[string]*BackendDrivers{
-	"ceph": {"ceph", "ceph", "ceph"},
-	"nfs":  {"", "nfs", ""},
+	"ceph":     {"ceph", "ceph", "ceph"},
+	"loopback": {"loopback", "loopback", "loopback"},
+	"lvm":      {"lvm", "lvm", "lvm"},
+	"nfs":      {"", "nfs", ""},
 }
 
 // Policy is the configuration of the policy. It includes default
@@ -26,6 +30,8 @@ type Policy struct {
 	FileSystems    map[string]string `json:"filesystems"`
 	Backends       *BackendDrivers   `json:"backends,omitempty"`
 	Backend        string            `json:"backend,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty" merge:"label.*"`
+	Quota          *Quota            `json:"quota,omitempty"`
 }
 
 // BackendDrivers is a struct containing all the drivers used under this policy
@@ -63,23 +69,32 @@ func (c *Client) PublishPolicy(name string, cfg *Policy) error {
 		return err
 	}
 
-	// NOTE: The creation of the policy revision entry and the actual publishing of the policy
-	//       should be wrapped in a transaction so they either both succeed or both fail, but
-	//       etcd2 doesn't support transactions (etcd3 does/will).
-	//
-	//       For now, we create the revision entry first and then publish the policy.  It's
-	//       better to have an entry for a policy revision that was never actually published
-	//       than to have a policy published which has no revision recorded for it.
-	if err := c.CreatePolicyRevision(name, string(value)); err != nil {
-		return err
-	}
-
 	// create the volume directory for the policy so that files can be written there.
 	// for example: /volplugin/policies/policy1 will create
 	// /volplugin/volumes/policy1 so that a volume of policy1/test can be created
 	// at /volplugin/volumes/policy1/test
 	c.etcdClient.Set(context.Background(), c.prefixed(rootVolume, name), "", &client.SetOptions{Dir: true})
 
+	// The creation of the policy revision entry and the actual publishing of the policy
+	// are done in a transaction when the store supports them (etcd3), so they either
+	// both succeed or both fail.
+	if txn, ok := c.etcdClient.(keysapi.Transactor); ok {
+		err := txn.Txn([]*keysapi.Op{
+			{Key: c.policyArchiveEntry(name, revisionTimestamp()), Value: string(value), Index: keysapi.Unconditional},
+			{Key: c.policy(name), Value: string(value), Index: keysapi.Unconditional},
+		})
+
+		return errors.EtcdToErrored(err)
+	}
+
+	// NOTE: etcd2 doesn't support transactions, so we create the revision entry first and
+	//       then publish the policy.  It's better to have an entry for a policy revision
+	//       that was never actually published than to have a policy published which has
+	//       no revision recorded for it.
+	if err := c.CreatePolicyRevision(name, string(value)); err != nil {
+		return err
+	}
+
 	if _, err := c.etcdClient.Set(context.Background(), c.policy(name), string(value), &client.SetOptions{PrevExist: client.PrevIgnore}); err != nil {
 		return errors.EtcdToErrored(err)
 	}
@@ -145,6 +160,10 @@ func (cfg *Policy) Validate() error {
 		return errors.ErrJSONValidation.Combine(err)
 	}
 
+	if err := labels.Validate(cfg.Labels); err != nil {
+		return err
+	}
+
 	if cfg.Backends == nil { // backend should be defined and its validated
 		backends, ok := defaultDrivers[cfg.Backend]
 
@@ -159,6 +178,19 @@ func (cfg *Policy) Validate() error {
 		return errored.Errorf("Size set to zero for non-empty CRUD backend %v", cfg.Backends.CRUD).Combine(err)
 	}
 
+	if cfg.Quota != nil {
+		if err := cfg.Quota.Validate(); err != nil {
+			return err
+		}
+
+		// the scheduled snapshots are pruned after a new one is taken, so there
+		// must be room for one more than are kept.
+		keep := cfg.RuntimeOptions.Snapshot.Keep
+		if cfg.RuntimeOptions.UseSnapshots && cfg.Quota.Snapshots > 0 && keep >= cfg.Quota.Snapshots {
+			return errored.Errorf("Policy keeps %d snapshots, but its quota only allows %d", keep, cfg.Quota.Snapshots)
+		}
+	}
+
 	return nil
 }
 
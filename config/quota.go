@@ -0,0 +1,179 @@
+package config
+
+import (
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/docker/go-units"
+)
+
+// Quota limits what the volumes of a policy may use. Zero values are
+// unlimited.
+type Quota struct {
+	// Volumes is the maximum number of volumes in the policy.
+	Volumes uint `json:"volumes,omitempty"`
+	// Size is the maximum total provisioned size of the volumes in the
+	// policy, e.g. "100GB".
+	Size string `json:"size,omitempty"`
+	// Snapshots is the maximum number of snapshots of each volume.
+	Snapshots uint `json:"snapshots,omitempty"`
+}
+
+// PolicyUsage is what the volumes of a policy currently use.
+type PolicyUsage struct {
+	Volumes uint `json:"volumes"`
+	// Size is the total provisioned size of the volumes, in megabytes.
+	Size uint64 `json:"size"`
+}
+
+// ActualSize returns the size quota as an integer of megabytes, or 0 if
+// there is none.
+func (q *Quota) ActualSize() (uint64, error) {
+	if q.Size == "" {
+		return 0, nil
+	}
+
+	size, err := units.FromHumanSize(q.Size)
+	return uint64(size) / units.MB, err
+}
+
+// Validate ensures the quota can be enforced.
+func (q *Quota) Validate() error {
+	if _, err := q.ActualSize(); err != nil {
+		return errored.Errorf("Invalid size quota %q", q.Size).Combine(err)
+	}
+
+	return nil
+}
+
+// CheckVolume returns errors.QuotaExceeded if a new volume of size megabytes
+// does not fit in the quota, given the current usage.
+func (q *Quota) CheckVolume(usage *PolicyUsage, size uint64) error {
+	if q.Volumes > 0 && usage.Volumes+1 > q.Volumes {
+		return errors.QuotaExceeded.Combine(errored.Errorf("policy is limited to %d volumes", q.Volumes))
+	}
+
+	maxSize, err := q.ActualSize()
+	if err != nil {
+		return err
+	}
+
+	if maxSize > 0 && usage.Size+size > maxSize {
+		return errors.QuotaExceeded.Combine(errored.Errorf("policy is limited to %s in total; %dMB are in use and %dMB were requested", q.Size, usage.Size, size))
+	}
+
+	return nil
+}
+
+// CheckResize returns errors.QuotaExceeded if growing a volume from oldSize
+// to newSize megabytes does not fit in the quota, given the current usage.
+// Shrinking always fits.
+func (q *Quota) CheckResize(usage *PolicyUsage, oldSize, newSize uint64) error {
+	if newSize <= oldSize {
+		return nil
+	}
+
+	maxSize, err := q.ActualSize()
+	if err != nil {
+		return err
+	}
+
+	if maxSize > 0 && usage.Size+newSize-oldSize > maxSize {
+		return errors.QuotaExceeded.Combine(errored.Errorf("policy is limited to %s in total; %dMB are in use and %dMB more were requested", q.Size, usage.Size, newSize-oldSize))
+	}
+
+	return nil
+}
+
+// CheckSnapshot returns errors.QuotaExceeded if a volume which has count
+// snapshots may not take another.
+func (q *Quota) CheckSnapshot(count int) error {
+	if q.Snapshots > 0 && count >= int(q.Snapshots) {
+		return errors.QuotaExceeded.Combine(errored.Errorf("volumes are limited to %d snapshots", q.Snapshots))
+	}
+
+	return nil
+}
+
+// GetPolicyUsage returns the number and total size of the volumes of a
+// policy.
+func (c *Client) GetPolicyUsage(policy string) (*PolicyUsage, error) {
+	usage := &PolicyUsage{}
+
+	volumes, err := c.ListVolumes(policy)
+	if err != nil {
+		if er, ok := err.(*errored.Error); ok && er.Contains(errors.NotExists) {
+			return usage, nil
+		}
+
+		return nil, err
+	}
+
+	for _, vol := range volumes {
+		size, err := vol.CreateOptions.ActualSize()
+		if err != nil {
+			return nil, err
+		}
+
+		usage.Volumes++
+		usage.Size += size
+	}
+
+	return usage, nil
+}
+
+// CheckQuota returns errors.QuotaExceeded if the volume does not fit in the
+// quota of its policy. Volumes which already exist always fit. Callers should
+// hold the UsePolicy lock of the policy, so the usage cannot change before the
+// volume is published.
+func (c *Client) CheckQuota(policy *Policy, vc *Volume) error {
+	if policy.Quota == nil {
+		return nil
+	}
+
+	if _, err := c.GetVolume(vc.PolicyName, vc.VolumeName); err == nil {
+		return nil
+	}
+
+	usage, err := c.GetPolicyUsage(vc.PolicyName)
+	if err != nil {
+		return err
+	}
+
+	size, err := vc.CreateOptions.ActualSize()
+	if err != nil {
+		return err
+	}
+
+	return policy.Quota.CheckVolume(usage, size)
+}
+
+// CheckResizeQuota returns errors.QuotaExceeded if growing the volume to
+// newSize megabytes does not fit in the quota of its policy. Like CheckQuota,
+// callers should hold the UsePolicy lock of the policy.
+func (c *Client) CheckResizeQuota(policy *Policy, vc *Volume, newSize uint64) error {
+	if policy.Quota == nil {
+		return nil
+	}
+
+	usage, err := c.GetPolicyUsage(vc.PolicyName)
+	if err != nil {
+		return err
+	}
+
+	oldSize, err := vc.CreateOptions.ActualSize()
+	if err != nil {
+		return err
+	}
+
+	return policy.Quota.CheckResize(usage, oldSize, newSize)
+}
+
+// QuotaLocks returns locks with the UsePolicy lock of the policy prepended
+// if the policy has a quota.
+func QuotaLocks(policy *Policy, reason string, locks ...UseLocker) []UseLocker {
+	if policy.Quota == nil {
+		return locks
+	}
+
+	return append([]UseLocker{&UsePolicy{Policy: policy.Name, Reason: reason}}, locks...)
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+
+	. "gopkg.in/check.v1"
+)
+
+func isQuotaExceeded(err error) bool {
+	er, ok := err.(*errored.Error)
+	return ok && er.Contains(errors.QuotaExceeded)
+}
+
+func (s *configSuite) TestQuotaChecks(c *C) {
+	quota := &Quota{Volumes: 2, Size: "100MB", Snapshots: 3}
+	c.Assert(quota.Validate(), IsNil)
+
+	c.Assert(quota.CheckVolume(&PolicyUsage{Volumes: 1, Size: 50}, 50), IsNil)
+	c.Assert(isQuotaExceeded(quota.CheckVolume(&PolicyUsage{Volumes: 2, Size: 50}, 10)), Equals, true)
+	c.Assert(isQuotaExceeded(quota.CheckVolume(&PolicyUsage{Volumes: 1, Size: 50}, 51)), Equals, true)
+
+	c.Assert(quota.CheckSnapshot(2), IsNil)
+	c.Assert(isQuotaExceeded(quota.CheckSnapshot(3)), Equals, true)
+
+	c.Assert(quota.CheckResize(&PolicyUsage{Volumes: 2, Size: 90}, 40, 50), IsNil)
+	c.Assert(isQuotaExceeded(quota.CheckResize(&PolicyUsage{Volumes: 2, Size: 90}, 40, 51)), Equals, true)
+	c.Assert(quota.CheckResize(&PolicyUsage{Volumes: 2, Size: 200}, 40, 20), IsNil)
+
+	c.Assert((&Quota{}).CheckVolume(&PolicyUsage{Volumes: 1000, Size: 1000000}, 1000), IsNil)
+	c.Assert((&Quota{}).CheckSnapshot(1000), IsNil)
+	c.Assert((&Quota{Size: "garbage"}).Validate(), NotNil)
+
+	policy := *testPolicies["basic"]
+	policy.Quota = &Quota{Snapshots: 10}
+	c.Assert(policy.Validate(), NotNil)
+	policy.Quota = &Quota{Snapshots: 11}
+	c.Assert(policy.Validate(), IsNil)
+}
+
+func (s *configSuite) TestCheckQuota(c *C) {
+	policy := *testPolicies["basic"]
+	policy.Quota = &Quota{Volumes: 2, Size: "25MB"}
+	c.Assert(s.tlc.PublishPolicy("policy1", &policy), IsNil)
+
+	usage, err := s.tlc.GetPolicyUsage("policy1")
+	c.Assert(err, IsNil)
+	c.Assert(*usage, DeepEquals, PolicyUsage{})
+
+	vol, err := s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(s.tlc.CheckQuota(&policy, vol), IsNil)
+	c.Assert(s.tlc.PublishVolume(vol), IsNil)
+
+	usage, err = s.tlc.GetPolicyUsage("policy1")
+	c.Assert(err, IsNil)
+	c.Assert(*usage, DeepEquals, PolicyUsage{Volumes: 1, Size: 10})
+
+	// volumes which already exist always fit.
+	c.Assert(s.tlc.CheckQuota(&policy, vol), IsNil)
+
+	vol, err = s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "test2", Options: map[string]string{"size": "20MB"}})
+	c.Assert(err, IsNil)
+	c.Assert(isQuotaExceeded(s.tlc.CheckQuota(&policy, vol)), Equals, true)
+
+	vol, err = s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "test2"})
+	c.Assert(err, IsNil)
+	c.Assert(s.tlc.CheckQuota(&policy, vol), IsNil)
+	c.Assert(s.tlc.PublishVolume(vol), IsNil)
+
+	vol, err = s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "test3", Options: map[string]string{"size": "1MB"}})
+	c.Assert(err, IsNil)
+	c.Assert(isQuotaExceeded(s.tlc.CheckQuota(&policy, vol)), Equals, true)
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The rules of snapshot retention, as given in the reasons of a
+// SnapshotVerdict.
+const (
+	RetainKeep    = "keep"
+	RetainHourly  = "hourly"
+	RetainDaily   = "daily"
+	RetainWeekly  = "weekly"
+	RetainMonthly = "monthly"
+	RetainMaxAge  = "max-age"
+)
+
+// SnapshotVerdict is whether snapshot retention keeps a snapshot, and why.
+type SnapshotVerdict struct {
+	Name string `json:"name"`
+	Keep bool   `json:"keep"`
+	// Reasons are the rules keeping the snapshot, or RetainMaxAge if it is
+	// removed for its age.
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// retentionTier keeps the newest snapshot of each of the last count periods.
+type retentionTier struct {
+	reason string
+	count  uint
+	period func(t time.Time) string
+}
+
+type timedSnapshot struct {
+	verdict *SnapshotVerdict
+	time    time.Time
+}
+
+type snapshotsByTime []*timedSnapshot
+
+func (s snapshotsByTime) Len() int           { return len(s) }
+func (s snapshotsByTime) Less(i, j int) bool { return s[i].time.After(s[j].time) }
+func (s snapshotsByTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (s *SnapshotConfig) retentionTiers() []retentionTier {
+	return []retentionTier{
+		{RetainHourly, s.KeepHourly, func(t time.Time) string { return t.Format("2006-01-02T15") }},
+		{RetainDaily, s.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{RetainWeekly, s.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{RetainMonthly, s.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+}
+
+// Retain decides which of the snapshots of a volume, as listed by its
+// snapshot driver, to keep at now. The verdicts are ordered newest first.
+// Snapshots whose names are not times (see ParseSnapshotName) come after the
+// others, in the reverse of the order listed, since drivers list the oldest
+// first; only Keep applies to them.
+func (s *SnapshotConfig) Retain(names []string, now time.Time) ([]*SnapshotVerdict, error) {
+	maxAge, err := s.ParseMaxAge()
+	if err != nil {
+		return nil, err
+	}
+
+	timed := snapshotsByTime{}
+	untimed := []*SnapshotVerdict{}
+
+	for _, name := range names {
+		verdict := &SnapshotVerdict{Name: name}
+		if t, ok := ParseSnapshotName(name); ok {
+			timed = append(timed, &timedSnapshot{verdict: verdict, time: t.UTC()})
+		} else {
+			untimed = append([]*SnapshotVerdict{verdict}, untimed...)
+		}
+	}
+
+	sort.Stable(timed)
+
+	verdicts := []*SnapshotVerdict{}
+	for _, snapshot := range timed {
+		verdicts = append(verdicts, snapshot.verdict)
+	}
+	verdicts = append(verdicts, untimed...)
+
+	for i := 0; i < len(verdicts) && i < int(s.Keep); i++ {
+		verdicts[i].Keep = true
+		verdicts[i].Reasons = append(verdicts[i].Reasons, RetainKeep)
+	}
+
+	for _, tier := range s.retentionTiers() {
+		last := ""
+		count := tier.count
+
+		for _, snapshot := range timed {
+			if count == 0 {
+				break
+			}
+
+			if period := tier.period(snapshot.time); period != last {
+				snapshot.verdict.Keep = true
+				snapshot.verdict.Reasons = append(snapshot.verdict.Reasons, tier.reason)
+				last = period
+				count--
+			}
+		}
+	}
+
+	// max-age wins over the tiers, but never removes the newest Keep
+	// snapshots: if snapshots stopped for longer than max-age, it would remove
+	// every snapshot of the volume.
+	if maxAge > 0 {
+		for i, snapshot := range timed {
+			if i < int(s.Keep) {
+				continue
+			}
+
+			if now.Sub(snapshot.time) > maxAge {
+				snapshot.verdict.Keep = false
+				snapshot.verdict.Reasons = []string{RetainMaxAge}
+			}
+		}
+	}
+
+	return verdicts, nil
+}
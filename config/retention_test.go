@@ -0,0 +1,78 @@
+package config
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// retained returns the names of the snapshots kept, and the reasons of all
+// of them.
+func retained(c *C, sc *SnapshotConfig, names []string, now time.Time) ([]string, map[string][]string) {
+	verdicts, err := sc.Retain(names, now)
+	c.Assert(err, IsNil)
+	c.Assert(len(verdicts), Equals, len(names))
+
+	kept := []string{}
+	reasons := map[string][]string{}
+	for _, verdict := range verdicts {
+		if verdict.Keep {
+			kept = append(kept, verdict.Name)
+		}
+		reasons[verdict.Name] = verdict.Reasons
+	}
+
+	return kept, reasons
+}
+
+func (s *configSuite) TestSnapshotRetention(c *C) {
+	now := time.Date(2016, 5, 2, 12, 0, 0, 0, time.UTC)
+
+	// a snapshot every 6 hours for ten days, listed oldest first.
+	names := []string{}
+	for t := now.Add(-10 * 24 * time.Hour); !t.After(now); t = t.Add(6 * time.Hour) {
+		names = append(names, SnapshotName(t))
+	}
+
+	kept, _ := retained(c, &SnapshotConfig{Keep: 2}, names, now)
+	c.Assert(kept, DeepEquals, []string{"2016-05-02T12.00.00Z", "2016-05-02T06.00.00Z"})
+
+	kept, reasons := retained(c, &SnapshotConfig{Keep: 1, KeepHourly: 2, KeepDaily: 3, KeepWeekly: 3, KeepMonthly: 2}, names, now)
+	c.Assert(kept, DeepEquals, []string{
+		"2016-05-02T12.00.00Z", // keep, hourly, daily, weekly (2016-W18), monthly
+		"2016-05-02T06.00.00Z", // hourly
+		"2016-05-01T18.00.00Z", // daily, weekly (2016-W17)
+		"2016-04-30T18.00.00Z", // daily, monthly
+		"2016-04-24T18.00.00Z", // weekly (2016-W16)
+	})
+	c.Assert(reasons["2016-05-02T12.00.00Z"], DeepEquals, []string{RetainKeep, RetainHourly, RetainDaily, RetainWeekly, RetainMonthly})
+	c.Assert(reasons["2016-04-30T18.00.00Z"], DeepEquals, []string{RetainDaily, RetainMonthly})
+	c.Assert(reasons["2016-04-24T18.00.00Z"], DeepEquals, []string{RetainWeekly})
+	c.Assert(reasons["2016-04-30T12.00.00Z"], IsNil)
+
+	// max-age wins over the tiers.
+	kept, reasons = retained(c, &SnapshotConfig{Keep: 2, KeepHourly: 100, MaxAge: "24h"}, names, now)
+	c.Assert(len(kept), Equals, 5)
+	c.Assert(reasons[names[0]], DeepEquals, []string{RetainMaxAge})
+
+	// but not over keep: when snapshots stopped for longer than max-age, the
+	// newest are still kept.
+	kept, reasons = retained(c, &SnapshotConfig{Keep: 2, KeepHourly: 100, MaxAge: "24h"}, names, now.Add(30*24*time.Hour))
+	c.Assert(kept, DeepEquals, []string{"2016-05-02T12.00.00Z", "2016-05-02T06.00.00Z"})
+	c.Assert(reasons["2016-05-02T12.00.00Z"], DeepEquals, []string{RetainKeep, RetainHourly})
+	c.Assert(reasons["2016-05-01T18.00.00Z"], DeepEquals, []string{RetainMaxAge})
+
+	// snapshots named otherwise come last, and only keep applies to them.
+	legacy := []string{"before-upgrade", "2016-05-02 04:00:00.5 -0700 PDT m=+1.5", "after-upgrade", "2016-05-01T09.00.00Z"}
+	verdicts, err := (&SnapshotConfig{Keep: 3, KeepDaily: 5, MaxAge: "1h"}).Retain(legacy, now)
+	c.Assert(err, IsNil)
+	c.Assert(verdicts, DeepEquals, []*SnapshotVerdict{
+		{Name: "2016-05-02 04:00:00.5 -0700 PDT m=+1.5", Keep: true, Reasons: []string{RetainKeep, RetainDaily}},
+		{Name: "2016-05-01T09.00.00Z", Keep: true, Reasons: []string{RetainKeep, RetainDaily}},
+		{Name: "after-upgrade", Keep: true, Reasons: []string{RetainKeep}},
+		{Name: "before-upgrade", Keep: false},
+	})
+
+	_, err = (&SnapshotConfig{Keep: 1, MaxAge: "forever"}).Retain(names, now)
+	c.Assert(err, NotNil)
+}
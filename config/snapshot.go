@@ -0,0 +1,187 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/cron"
+	"github.com/contiv/volplugin/errors"
+	"golang.org/x/net/context"
+)
+
+// DefaultSnapshotJitter is the longest snapshots are delayed when their
+// jitter is not set.
+const DefaultSnapshotJitter = time.Minute
+
+// SnapshotNameLayout is the layout of the names of the snapshots
+// volsupervisor takes: RFC3339 in UTC, with dots instead of the colons LVM
+// does not allow in names.
+const SnapshotNameLayout = "2006-01-02T15.04.05Z"
+
+// legacySnapshotNameLayout is the layout of time.Time.String(), which
+// volsupervisor used to name snapshots after.
+const legacySnapshotNameLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// SnapshotName returns the name of a snapshot taken at t.
+func SnapshotName(t time.Time) string {
+	return t.UTC().Format(SnapshotNameLayout)
+}
+
+// ParseSnapshotName returns when a snapshot was taken from its name, which
+// is either a SnapshotName or, for older snapshots, a time.Time.String(). ok
+// is false for any other name, such as those of snapshots taken by hand.
+func ParseSnapshotName(name string) (t time.Time, ok bool) {
+	if t, err := time.Parse(SnapshotNameLayout, name); err == nil {
+		return t, true
+	}
+
+	// time.Time.String() appends the reading of the monotonic clock, if any.
+	if i := strings.Index(name, " m="); i >= 0 {
+		name = name[:i]
+	}
+
+	if t, err := time.Parse(legacySnapshotNameLayout, name); err == nil {
+		return t, true
+	}
+
+	return time.Time{}, false
+}
+
+// ParseSchedule returns when snapshots are taken: the cron expression of
+// Schedule if set, else every Frequency.
+func (s *SnapshotConfig) ParseSchedule() (cron.Schedule, error) {
+	if s.Schedule != "" {
+		schedule, err := cron.Parse(s.Schedule)
+		if err != nil {
+			return nil, err
+		}
+
+		if schedule.Next(time.Now()).IsZero() {
+			return nil, errored.Errorf("Snapshot schedule %q never fires", s.Schedule)
+		}
+
+		return schedule, nil
+	}
+
+	freq, err := time.ParseDuration(s.Frequency)
+	if err != nil {
+		return nil, errored.Errorf("Invalid snapshot frequency %q", s.Frequency).Combine(err)
+	}
+
+	if freq <= 0 {
+		return nil, errored.Errorf("Invalid snapshot frequency %q: must be positive", s.Frequency)
+	}
+
+	return cron.Every(freq), nil
+}
+
+// MaxJitter returns the longest a snapshot of the schedule may be delayed:
+// Jitter if set, else a tenth of the interval of the schedule after now, at
+// most DefaultSnapshotJitter.
+func (s *SnapshotConfig) MaxJitter(schedule cron.Schedule, now time.Time) (time.Duration, error) {
+	if s.Jitter != "" {
+		jitter, err := time.ParseDuration(s.Jitter)
+		if err != nil || jitter < 0 {
+			return 0, errored.Errorf("Invalid snapshot jitter %q", s.Jitter).Combine(err)
+		}
+
+		return jitter, nil
+	}
+
+	next := schedule.Next(now)
+	if next.IsZero() {
+		return 0, nil
+	}
+
+	jitter := schedule.Next(next).Sub(next) / 10
+	if jitter > DefaultSnapshotJitter {
+		jitter = DefaultSnapshotJitter
+	}
+
+	return jitter, nil
+}
+
+// ParseMaxAge returns MaxAge, or 0 if snapshots are kept forever.
+func (s *SnapshotConfig) ParseMaxAge() (time.Duration, error) {
+	if s.MaxAge == "" {
+		return 0, nil
+	}
+
+	maxAge, err := time.ParseDuration(s.MaxAge)
+	if err != nil || maxAge <= 0 {
+		return 0, errored.Errorf("Invalid snapshot max-age %q", s.MaxAge).Combine(err)
+	}
+
+	return maxAge, nil
+}
+
+func (c *Client) snapshotRun(policy, name string) string {
+	return c.prefixed(rootSnapshotRuns, policy, name)
+}
+
+// GetSnapshotRun returns when the scheduled snapshots of a volume last ran,
+// or the zero time if they never did.
+func (c *Client) GetSnapshotRun(policy, name string) (time.Time, error) {
+	resp, err := c.etcdClient.Get(context.Background(), c.snapshotRun(policy, name), nil)
+	if err != nil {
+		if er, ok := errors.EtcdToErrored(err).(*errored.Error); ok && er.Contains(errors.NotExists) {
+			return time.Time{}, nil
+		}
+
+		return time.Time{}, errors.EtcdToErrored(err)
+	}
+
+	return time.Parse(time.RFC3339Nano, resp.Node.Value)
+}
+
+// PublishSnapshotRun records when the scheduled snapshots of a volume ran.
+func (c *Client) PublishSnapshotRun(policy, name string, run time.Time) error {
+	_, err := c.etcdClient.Set(context.Background(), c.snapshotRun(policy, name), run.Format(time.RFC3339Nano), nil)
+	return errors.EtcdToErrored(err)
+}
+
+// SnapshotResult is the outcome of the last snapshot volsupervisor took of a
+// volume.
+type SnapshotResult struct {
+	Time time.Time `json:"time"`
+	// Snapshot is the name of the snapshot, empty if it was not taken.
+	Snapshot string `json:"snapshot,omitempty"`
+	Success  bool   `json:"success"`
+	// Error is why the snapshot was not taken.
+	Error string `json:"error,omitempty"`
+	// Warnings are failures which did not stop the snapshot, such as failing
+	// to freeze the filesystem or a failed post-snapshot hook.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+func (c *Client) snapshotResult(policy, name string) string {
+	return c.prefixed(rootSnapshotResults, policy, name)
+}
+
+// GetSnapshotResult returns the outcome of the last snapshot of a volume.
+func (c *Client) GetSnapshotResult(policy, name string) (*SnapshotResult, error) {
+	resp, err := c.etcdClient.Get(context.Background(), c.snapshotResult(policy, name), nil)
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	result := &SnapshotResult{}
+	if err := json.Unmarshal([]byte(resp.Node.Value), result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// PublishSnapshotResult records the outcome of the last snapshot of a volume.
+func (c *Client) PublishSnapshotResult(policy, name string, result *SnapshotResult) error {
+	content, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.etcdClient.Set(context.Background(), c.snapshotResult(policy, name), string(content), nil)
+	return errors.EtcdToErrored(err)
+}
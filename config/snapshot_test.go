@@ -0,0 +1,132 @@
+package config
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+)
+
+func (s *configSuite) TestSnapshotSchedule(c *C) {
+	now := time.Date(2016, 5, 1, 12, 10, 0, 0, time.UTC)
+
+	sc := &SnapshotConfig{Frequency: "30m"}
+	schedule, err := sc.ParseSchedule()
+	c.Assert(err, IsNil)
+	c.Assert(schedule.Next(now), Equals, time.Date(2016, 5, 1, 12, 30, 0, 0, time.UTC))
+
+	jitter, err := sc.MaxJitter(schedule, now)
+	c.Assert(err, IsNil)
+	c.Assert(jitter, Equals, time.Minute)
+
+	// the schedule wins over the frequency.
+	sc.Schedule = "0 2 * * *"
+	schedule, err = sc.ParseSchedule()
+	c.Assert(err, IsNil)
+	c.Assert(schedule.Next(now), Equals, time.Date(2016, 5, 2, 2, 0, 0, 0, time.UTC))
+
+	sc = &SnapshotConfig{Frequency: "2s"}
+	schedule, err = sc.ParseSchedule()
+	c.Assert(err, IsNil)
+	jitter, err = sc.MaxJitter(schedule, now)
+	c.Assert(err, IsNil)
+	c.Assert(jitter, Equals, 200*time.Millisecond)
+
+	sc.Jitter = "0s"
+	jitter, err = sc.MaxJitter(schedule, now)
+	c.Assert(err, IsNil)
+	c.Assert(jitter, Equals, time.Duration(0))
+
+	for _, invalid := range []*SnapshotConfig{
+		{Frequency: "10d"},
+		{Frequency: "0s"},
+		{Schedule: "0 0 30 2 *"},
+		{Schedule: "@fortnightly"},
+	} {
+		_, err := invalid.ParseSchedule()
+		c.Assert(err, NotNil, Commentf("%#v", invalid))
+	}
+
+	_, err = (&SnapshotConfig{Jitter: "-1m"}).MaxJitter(schedule, now)
+	c.Assert(err, NotNil)
+}
+
+func (s *configSuite) TestSnapshotRun(c *C) {
+	run, err := s.tlc.GetSnapshotRun("policy1", "test")
+	c.Assert(err, IsNil)
+	c.Assert(run.IsZero(), Equals, true)
+
+	now := time.Now().UTC()
+	c.Assert(s.tlc.PublishSnapshotRun("policy1", "test", now), IsNil)
+
+	run, err = s.tlc.GetSnapshotRun("policy1", "test")
+	c.Assert(err, IsNil)
+	c.Assert(run.Equal(now), Equals, true)
+
+	c.Assert(s.tlc.PublishPolicy("policy1", testPolicies["basic"]), IsNil)
+	vol, err := s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(s.tlc.PublishVolume(vol), IsNil)
+
+	// removing the volume forgets the run.
+	c.Assert(s.tlc.RemoveVolume("policy1", "test"), IsNil)
+	run, err = s.tlc.GetSnapshotRun("policy1", "test")
+	c.Assert(err, IsNil)
+	c.Assert(run.IsZero(), Equals, true)
+}
+
+func (s *configSuite) TestSnapshotResult(c *C) {
+	_, err := s.tlc.GetSnapshotResult("policy1", "test")
+	c.Assert(err, NotNil)
+	c.Assert(err.(*errored.Error).Contains(errors.NotExists), Equals, true)
+
+	result := &SnapshotResult{
+		Time:     time.Now().UTC(),
+		Error:    "Snapshot hook failed: exit status 1",
+		Warnings: []string{"Post-snapshot hook: exit status 2"},
+	}
+	c.Assert(s.tlc.PublishSnapshotResult("policy1", "test", result), IsNil)
+
+	result2, err := s.tlc.GetSnapshotResult("policy1", "test")
+	c.Assert(err, IsNil)
+	c.Assert(result2.Time.Equal(result.Time), Equals, true)
+	result2.Time = result.Time
+	c.Assert(result2, DeepEquals, result)
+
+	c.Assert(s.tlc.PublishPolicy("policy1", testPolicies["basic"]), IsNil)
+	vol, err := s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(s.tlc.PublishVolume(vol), IsNil)
+
+	// removing the volume forgets the result.
+	c.Assert(s.tlc.RemoveVolume("policy1", "test"), IsNil)
+	_, err = s.tlc.GetSnapshotResult("policy1", "test")
+	c.Assert(err, NotNil)
+}
+
+func (s *configSuite) TestSnapshotName(c *C) {
+	taken := time.Date(2016, 5, 1, 12, 10, 5, 0, time.UTC)
+
+	name := SnapshotName(taken.In(time.FixedZone("PDT", -7*3600)))
+	c.Assert(name, Equals, "2016-05-01T12.10.05Z")
+
+	t, ok := ParseSnapshotName(name)
+	c.Assert(ok, Equals, true)
+	c.Assert(t.Equal(taken), Equals, true)
+
+	for _, legacy := range []string{
+		"2016-05-01 05:10:05.123456789 -0700 PDT",
+		"2016-05-01 05:10:05.123456789 -0700 PDT m=+3.000000001",
+	} {
+		t, ok := ParseSnapshotName(legacy)
+		c.Assert(ok, Equals, true, Commentf("%q", legacy))
+		c.Assert(t.Equal(taken.Add(123456789)), Equals, true, Commentf("%q", legacy))
+	}
+
+	for _, invalid := range []string{"", "before-upgrade", "2016-05-01"} {
+		_, ok := ParseSnapshotName(invalid)
+		c.Assert(ok, Equals, false, Commentf("%q", invalid))
+	}
+}
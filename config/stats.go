@@ -0,0 +1,74 @@
+package config
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+// MountStats is the filesystem usage of a mounted volume, as reported by the
+// volplugin that mounted it.
+type MountStats struct {
+	Hostname   string              `json:"hostname"`
+	Mountpoint string              `json:"mountpoint"`
+	Filesystem storage.VolumeStats `json:"filesystem"`
+	Updated    time.Time           `json:"updated"`
+}
+
+// VolumeStats is the usage of a volume. Backend is reported by the storage
+// backend and is missing if the backend cannot report it. Mount is missing
+// if the volume is not mounted.
+type VolumeStats struct {
+	Backend *storage.VolumeStats `json:"backend,omitempty"`
+	Mount   *MountStats          `json:"mount,omitempty"`
+}
+
+func (c *Client) stats(policy, name string) string {
+	return c.prefixed(rootStats, policy, name)
+}
+
+// PublishMountStats publishes the mount stats for a volume. The record
+// expires after the TTL, so stats of volumes that are no longer mounted (or
+// whose volplugin has died) disappear on their own.
+func (c *Client) PublishMountStats(vc *Volume, ms *MountStats, ttl time.Duration) error {
+	content, err := json.Marshal(ms)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.etcdClient.Set(context.Background(), c.stats(vc.PolicyName, vc.VolumeName), string(content), &client.SetOptions{TTL: ttl})
+	return errors.EtcdToErrored(err)
+}
+
+// RemoveMountStats removes the mount stats for a volume. Does not fail if
+// there are none.
+func (c *Client) RemoveMountStats(vc *Volume) error {
+	_, err := c.etcdClient.Delete(context.Background(), c.stats(vc.PolicyName, vc.VolumeName), nil)
+	if err != nil {
+		if er, ok := errors.EtcdToErrored(err).(*errored.Error); ok && er.Contains(errors.NotExists) {
+			return nil
+		}
+	}
+
+	return errors.EtcdToErrored(err)
+}
+
+// GetMountStats retrieves the mount stats for a volume.
+func (c *Client) GetMountStats(policy, name string) (*MountStats, error) {
+	resp, err := c.etcdClient.Get(context.Background(), c.stats(policy, name), nil)
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	ms := &MountStats{}
+	if err := json.Unmarshal([]byte(resp.Node.Value), ms); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
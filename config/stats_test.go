@@ -0,0 +1,43 @@
+package config
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+)
+
+func (s *configSuite) TestMountStats(c *C) {
+	vc := &Volume{PolicyName: "policy1", VolumeName: "test"}
+
+	_, err := s.tlc.GetMountStats("policy1", "test")
+	c.Assert(err, NotNil)
+	c.Assert(err.(*errored.Error).Contains(errors.NotExists), Equals, true)
+
+	ms := &MountStats{
+		Hostname:   "mon0",
+		Mountpoint: "/mnt/ceph/rbd/policy1.test",
+		Filesystem: storage.VolumeStats{Provisioned: 10485760, Allocated: 1048576},
+		Updated:    time.Now().UTC().Truncate(time.Second),
+	}
+
+	c.Assert(s.tlc.PublishMountStats(vc, ms, time.Minute), IsNil)
+
+	ms2, err := s.tlc.GetMountStats("policy1", "test")
+	c.Assert(err, IsNil)
+	c.Assert(ms2, DeepEquals, ms)
+
+	c.Assert(s.tlc.RemoveMountStats(vc), IsNil)
+	c.Assert(s.tlc.RemoveMountStats(vc), IsNil)
+
+	_, err = s.tlc.GetMountStats("policy1", "test")
+	c.Assert(err, NotNil)
+
+	c.Assert(s.tlc.PublishMountStats(vc, ms, time.Second), IsNil)
+	time.Sleep(2 * time.Second)
+	_, err = s.tlc.GetMountStats("policy1", "test")
+	c.Assert(err, NotNil)
+}
@@ -23,13 +23,30 @@ var (
 	// UseTypeVolsupervisor is for taking locks on the volsupervisor process.
 	// Please see the UseVolsupervisor type.
 	UseTypeVolsupervisor = "volsupervisor"
+
+	// UseTypePolicy is for taking locks on a whole policy. Please see the
+	// UsePolicy type.
+	UseTypePolicy = "policy"
 )
 
 // UseVolsupervisor is a global lock on the volsupervisor process itself.
 // UseVolsupervisor is kind of a hack currently and this will be addressed in
 // the DB rewrite.
+//
+// The volsupervisor holding it leads: it alone takes and prunes snapshots,
+// while the others stand by to take it over once it expires. Started tells
+// apart volsupervisors run on the same host.
 type UseVolsupervisor struct {
 	Hostname string
+	Started  time.Time
+}
+
+// UsePolicy is a lock on a whole policy, held while volumes are added to a
+// policy with a quota so that the usage cannot change between checking it
+// and adding the volume.
+type UsePolicy struct {
+	Policy string
+	Reason string
 }
 
 // UseMount is the mount locking mechanism for users. Users are hosts,
@@ -122,6 +139,26 @@ func (us *UseVolsupervisor) MayExist() bool {
 	return false
 }
 
+// GetVolume returns the policy name; the lock covers all its volumes.
+func (up *UsePolicy) GetVolume() string {
+	return up.Policy
+}
+
+// GetReason gets the reason for this use.
+func (up *UsePolicy) GetReason() string {
+	return up.Reason
+}
+
+// Type returns the type of lock.
+func (up *UsePolicy) Type() string {
+	return UseTypePolicy
+}
+
+// MayExist determines if a key may exist during initial write
+func (up *UsePolicy) MayExist() bool {
+	return false
+}
+
 func (c *Client) use(typ string, vc string) string {
 	return c.prefixed(rootUse, typ, vc)
 }
@@ -212,6 +249,23 @@ func (c *Client) GetUse(ut UseLocker, vc *Volume) error {
 	return nil
 }
 
+// GetVolsupervisorUse retrieves the volsupervisor lock, which names the
+// volsupervisor currently leading.
+func (c *Client) GetVolsupervisorUse() (*UseVolsupervisor, error) {
+	use := &UseVolsupervisor{}
+
+	resp, err := c.etcdClient.Get(context.Background(), c.use(use.Type(), use.GetVolume()), nil)
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	if err := json.Unmarshal([]byte(resp.Node.Value), use); err != nil {
+		return nil, err
+	}
+
+	return use, nil
+}
+
 // ListUses lists the items in use.
 func (c *Client) ListUses(typ string) ([]string, error) {
 	resp, err := c.etcdClient.Get(context.Background(), c.prefixed(rootUse, typ), &client.GetOptions{Sort: true, Recursive: true})
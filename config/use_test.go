@@ -79,3 +79,22 @@ func (s *configSuite) TestUseListEtcdDown(c *C) {
 		c.Assert(err, NotNil)
 	})
 }
+
+func (s *configSuite) TestVolsupervisorUse(c *C) {
+	_, err := s.tlc.GetVolsupervisorUse()
+	c.Assert(err, NotNil)
+
+	leader := &UseVolsupervisor{Hostname: "host1", Started: time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)}
+	c.Assert(s.tlc.PublishUse(leader), IsNil)
+
+	// only one volsupervisor may lead.
+	c.Assert(s.tlc.PublishUse(&UseVolsupervisor{Hostname: "host2", Started: leader.Started}), NotNil)
+
+	use, err := s.tlc.GetVolsupervisorUse()
+	c.Assert(err, IsNil)
+	c.Assert(use, DeepEquals, leader)
+
+	c.Assert(s.tlc.RemoveUse(leader, false), IsNil)
+	_, err = s.tlc.GetVolsupervisorUse()
+	c.Assert(err, NotNil)
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/contiv/errored"
 
@@ -29,6 +30,30 @@ func (cfg *RuntimeOptions) ValidateJSON() error {
 		return combineErrors(result.Errors())
 	}
 
+	// the schema cannot tell whether the schedule and durations parse.
+	if cfg.UseSnapshots {
+		schedule, err := cfg.Snapshot.ParseSchedule()
+		if err != nil {
+			return err
+		}
+
+		if _, err := cfg.Snapshot.MaxJitter(schedule, time.Now()); err != nil {
+			return err
+		}
+
+		if _, err := cfg.Snapshot.ParseMaxAge(); err != nil {
+			return err
+		}
+
+		if _, err := cfg.Snapshot.ParseFreezeTimeout(); err != nil {
+			return err
+		}
+
+		if _, err := cfg.Snapshot.ParseHookTimeout(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -171,6 +171,20 @@ var (
 			"nosnapshots": {
 				UseSnapshots: false,
 			},
+			"schedule": {
+				UseSnapshots: true,
+				Snapshot: SnapshotConfig{
+					Keep:          10,
+					Schedule:      "0 2 * * *",
+					Jitter:        "5m",
+					KeepDaily:     7,
+					MaxAge:        "720h",
+					Consistent:    true,
+					FreezeTimeout: "30s",
+					PreHook:       "pg_ctl checkpoint",
+					HookTimeout:   "1m",
+				},
+			},
 		},
 		"invalid": {
 			"nosnapshotconfig": {
@@ -209,6 +223,47 @@ var (
 					Frequency: "10d",
 				},
 			},
+			"invalidschedule": {
+				UseSnapshots: true,
+				Snapshot: SnapshotConfig{
+					Schedule: "0 25 * * *",
+					Keep:     1,
+				},
+			},
+			"invalidjitter": {
+				UseSnapshots: true,
+				Snapshot: SnapshotConfig{
+					Frequency: "1m",
+					Jitter:    "soon",
+					Keep:      1,
+				},
+			},
+			"invalidmaxage": {
+				UseSnapshots: true,
+				Snapshot: SnapshotConfig{
+					Frequency: "1m",
+					Keep:      1,
+					MaxAge:    "-1h",
+				},
+			},
+			"invalidfreezetimeout": {
+				UseSnapshots: true,
+				Snapshot: SnapshotConfig{
+					Frequency:     "1m",
+					Keep:          1,
+					Consistent:    true,
+					FreezeTimeout: "forever",
+				},
+			},
+			"invalidhooktimeout": {
+				UseSnapshots: true,
+				Snapshot: SnapshotConfig{
+					Frequency:   "1m",
+					Keep:        1,
+					PreHook:     "sync",
+					HookTimeout: "0s",
+				},
+			},
 			"invalidsnapshotconfig": {
 				UseSnapshots: true,
 				Snapshot: SnapshotConfig{ // invalid frequency and keep values
@@ -241,6 +296,16 @@ func (s *configSuite) TestRuntimeValidation(c *C) {
 
 	c.Assert(invalidRuntimeConfigs["nokeep"].ValidateJSON(), ErrorMatches, "(?m)*snapshot.keep:.*greater than or equal to 1.*")
 
+	c.Assert(invalidRuntimeConfigs["invalidschedule"].ValidateJSON(), ErrorMatches, "(?m).*Invalid hour \"25\".*")
+
+	c.Assert(invalidRuntimeConfigs["invalidjitter"].ValidateJSON(), ErrorMatches, "(?m).*Invalid snapshot jitter \"soon\".*")
+
+	c.Assert(invalidRuntimeConfigs["invalidmaxage"].ValidateJSON(), ErrorMatches, "(?m).*Invalid snapshot max-age \"-1h\".*")
+
+	c.Assert(invalidRuntimeConfigs["invalidfreezetimeout"].ValidateJSON(), ErrorMatches, "(?m).*Invalid snapshot freeze timeout \"forever\".*")
+
+	c.Assert(invalidRuntimeConfigs["invalidhooktimeout"].ValidateJSON(), ErrorMatches, "(?m).*Invalid snapshot hook timeout \"0s\".*")
+
 	err = invalidRuntimeConfigs["invalidsnapshotconfig"].ValidateJSON()
 	c.Assert(err, ErrorMatches, "(?m)*snapshot.frequency:.*Does not match pattern.*")
 	c.Assert(err, ErrorMatches, "(?m)*snapshot.keep:.*greater than or equal to 1.*")
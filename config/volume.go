@@ -9,6 +9,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/labels"
 	"github.com/contiv/volplugin/merge"
 	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/storage/backend"
@@ -30,6 +31,7 @@ type Volume struct {
 	CreateOptions  CreateOptions     `json:"create"`
 	RuntimeOptions RuntimeOptions    `json:"runtime"`
 	Backends       *BackendDrivers   `json:"backends,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty" merge:"label.*"`
 }
 
 // CreateOptions are the set of options used by apiserver during the volume
@@ -55,8 +57,44 @@ type RateLimitConfig struct {
 
 // SnapshotConfig is the configuration for snapshots.
 type SnapshotConfig struct {
+	// Frequency takes a snapshot at every multiple of this duration since
+	// the Unix epoch. Schedule replaces it if both are set.
 	Frequency string `json:"frequency" merge:"snapshots.frequency"`
-	Keep      uint   `json:"keep" merge:"snapshots.keep"`
+	// Schedule is a cron expression of when to take snapshots, e.g.
+	// "0 2 * * *" for 02:00 daily, in the time zone of volsupervisor.
+	Schedule string `json:"schedule,omitempty" merge:"snapshots.schedule"`
+	// Jitter is the longest a snapshot may be delayed, so the snapshots of
+	// different volumes are spread out. Each volume is always delayed by the
+	// same amount. If empty, it is a tenth of the interval, and at most
+	// DefaultSnapshotJitter.
+	Jitter string `json:"jitter,omitempty" merge:"snapshots.jitter"`
+	// Keep is how many of the newest snapshots are kept.
+	Keep uint `json:"keep" merge:"snapshots.keep"`
+	// KeepHourly, KeepDaily, KeepWeekly and KeepMonthly also keep the newest
+	// snapshot of each of the last that many hours, days, ISO weeks and
+	// months (in UTC) which have snapshots.
+	KeepHourly  uint `json:"keep-hourly,omitempty" merge:"snapshots.keep.hourly"`
+	KeepDaily   uint `json:"keep-daily,omitempty" merge:"snapshots.keep.daily"`
+	KeepWeekly  uint `json:"keep-weekly,omitempty" merge:"snapshots.keep.weekly"`
+	KeepMonthly uint `json:"keep-monthly,omitempty" merge:"snapshots.keep.monthly"`
+	// MaxAge is a duration after which snapshots are removed even if the
+	// tiers above keep them. The newest Keep snapshots are never removed for
+	// their age. Empty keeps them forever.
+	MaxAge string `json:"max-age,omitempty" merge:"snapshots.max-age"`
+	// Consistent freezes the filesystem of the volume on the host mounting it
+	// while the snapshot is taken, so the snapshot is consistent rather than
+	// only crash-consistent.
+	Consistent bool `json:"consistent,omitempty" merge:"snapshots.consistent"`
+	// FreezeTimeout is the longest the filesystem stays frozen; it is thawed
+	// after it even if the snapshot is not done. If empty, it is DefaultFreezeTimeout.
+	FreezeTimeout string `json:"freeze-timeout,omitempty" merge:"snapshots.freeze-timeout"`
+	// PreHook and PostHook are shell commands run in each container using the
+	// volume, on the host mounting it, before and after the snapshot; e.g. to
+	// flush a database. The snapshot is not taken if PreHook fails.
+	PreHook  string `json:"pre-hook,omitempty" merge:"snapshots.pre-hook"`
+	PostHook string `json:"post-hook,omitempty" merge:"snapshots.post-hook"`
+	// HookTimeout is the longest each hook may run. If empty, it is DefaultHookTimeout.
+	HookTimeout string `json:"hook-timeout,omitempty" merge:"snapshots.hook-timeout"`
 }
 
 func (c *Client) volume(policy, name, typ string) string {
@@ -118,6 +156,7 @@ func (c *Client) CreateVolume(rc *VolumeRequest) (*Volume, error) {
 		PolicyName:     rc.Policy,
 		VolumeName:     rc.Name,
 		MountSource:    mount,
+		Labels:         resp.Labels,
 	}
 
 	if err := vc.Validate(); err != nil {
@@ -151,6 +190,25 @@ func (c *Client) PublishVolume(vc *Volume) error {
 	return c.PublishVolumeRuntime(vc, vc.RuntimeOptions)
 }
 
+// UpdateVolume rewrites the record of an existing volume in etcd. Unlike
+// PublishVolume, it fails if the volume does not exist.
+func (c *Client) UpdateVolume(vc *Volume) error {
+	if err := vc.Validate(); err != nil {
+		return err
+	}
+
+	remarshal, err := json.Marshal(vc)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.etcdClient.Set(context.Background(), c.volume(vc.PolicyName, vc.VolumeName, "create"), string(remarshal), &client.SetOptions{PrevExist: client.PrevExist}); err != nil {
+		return errors.EtcdToErrored(err)
+	}
+
+	return nil
+}
+
 // ActualSize returns the size of the volume as an integer of megabytes.
 func (co *CreateOptions) ActualSize() (uint64, error) {
 	sizeStr := co.Size
@@ -207,8 +265,21 @@ func (c *Client) GetVolumeRuntime(policy, name string) (RuntimeOptions, error) {
 // RemoveVolume removes a volume from configuration.
 func (c *Client) RemoveVolume(policy, name string) error {
 	logrus.Debugf("Removing volume %s/%s from database", policy, name)
-	_, err := c.etcdClient.Delete(context.Background(), c.prefixed(rootVolume, policy, name), &client.DeleteOptions{Recursive: true})
-	return errors.EtcdToErrored(err)
+	if _, err := c.etcdClient.Delete(context.Background(), c.prefixed(rootVolume, policy, name), &client.DeleteOptions{Recursive: true}); err != nil {
+		return errors.EtcdToErrored(err)
+	}
+
+	// a volume of the same name starts its snapshot schedule and results
+	// afresh.
+	for _, key := range []string{c.snapshotRun(policy, name), c.snapshotResult(policy, name)} {
+		if _, err := c.etcdClient.Delete(context.Background(), key, nil); err != nil {
+			if er, ok := errors.EtcdToErrored(err).(*errored.Error); !ok || !er.Contains(errors.NotExists) {
+				return errors.EtcdToErrored(err)
+			}
+		}
+	}
+
+	return nil
 }
 
 // ListVolumes returns a map of volume name -> Volume.
@@ -353,6 +424,10 @@ func (cfg *Volume) Validate() error {
 		return errors.ErrJSONValidation.Combine(err)
 	}
 
+	if err := labels.Validate(cfg.Labels); err != nil {
+		return err
+	}
+
 	return cfg.validateBackends()
 }
 
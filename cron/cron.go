@@ -0,0 +1,238 @@
+// Package cron parses cron expressions and works out when they next fire.
+package cron
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+)
+
+// Schedule is a recurring time.
+type Schedule interface {
+	// Next returns the first time the schedule fires strictly after t, or
+	// the zero time if it never does.
+	Next(t time.Time) time.Time
+}
+
+type field struct {
+	name     string
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minutes = field{name: "minute", min: 0, max: 59}
+	hours   = field{name: "hour", min: 0, max: 23}
+	days    = field{name: "day of month", min: 1, max: 31}
+	months  = field{name: "month", min: 1, max: 12, names: map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is Sunday too, as in most crons.
+	weekdays = field{name: "day of week", min: 0, max: 7, names: map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// maxSearch bounds the search for the next time; "0 0 30 2 *" never fires.
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// spec is a parsed five field expression. Each field is a bit set of the
+// values it matches.
+type spec struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar are true if the field was *. If neither is, a day
+	// matches if either matches, as in Vixie cron.
+	domStar, dowStar bool
+}
+
+// Parse parses a cron expression: the five fields minute, hour, day of month,
+// month and day of week, or one of the descriptors @yearly, @annually,
+// @monthly, @weekly, @daily, @midnight and @hourly. Fields are *, values,
+// ranges (1-5), steps (*/15, 0-30/10) or comma separated lists of them.
+// Months and days of the week may also be given by their first three
+// letters. The schedule fires in the location of the times given to Next.
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@") {
+		full, ok := descriptors[strings.ToLower(expr)]
+		if !ok {
+			return nil, errored.Errorf("Unknown cron descriptor %q", expr)
+		}
+
+		expr = full
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errored.Errorf("Cron expression %q must have 5 fields (minute, hour, day of month, month, day of week), it has %d", expr, len(fields))
+	}
+
+	s := &spec{domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+
+	for i, f := range []struct {
+		field field
+		bits  *uint64
+	}{
+		{minutes, &s.minute},
+		{hours, &s.hour},
+		{days, &s.dom},
+		{months, &s.month},
+		{weekdays, &s.dow},
+	} {
+		bits, err := parseField(fields[i], f.field)
+		if err != nil {
+			return nil, errored.Errorf("Invalid cron expression %q", expr).Combine(err)
+		}
+
+		*f.bits = bits
+	}
+
+	// fold Sunday as 7 into 0.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	return s, nil
+}
+
+func parseField(expr string, f field) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(expr, ",") {
+		rng, step := part, uint(1)
+
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.ParseUint(part[i+1:], 10, 0)
+			if err != nil || n == 0 {
+				return 0, errored.Errorf("Invalid step %q in %s field %q", part[i+1:], f.name, expr)
+			}
+
+			rng, step = part[:i], uint(n)
+		}
+
+		var start, end uint
+		switch {
+		case rng == "*":
+			start, end = f.min, f.max
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+
+			var err error
+			if start, err = parseValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+
+			if end, err = parseValue(bounds[1], f); err != nil {
+				return 0, err
+			}
+
+			if end < start {
+				return 0, errored.Errorf("Range %q in %s field is backwards", rng, f.name)
+			}
+		default:
+			var err error
+			if start, err = parseValue(rng, f); err != nil {
+				return 0, err
+			}
+
+			end = start
+			// 5/15 means from 5 to the end, every 15.
+			if step > 1 {
+				end = f.max
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << i
+		}
+	}
+
+	return bits, nil
+}
+
+func parseValue(value string, f field) (uint, error) {
+	if n, ok := f.names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+
+	n, err := strconv.ParseUint(value, 10, 0)
+	if err != nil || uint(n) < f.min || uint(n) > f.max {
+		return 0, errored.Errorf("Invalid %s %q: must be between %d and %d", f.name, value, f.min, f.max)
+	}
+
+	return uint(n), nil
+}
+
+func (s *spec) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+func (s *spec) Next(t time.Time) time.Time {
+	loc := t.Location()
+	limit := t.Add(maxSearch)
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+type every time.Duration
+
+// Every returns the schedule firing at every multiple of d since the Unix
+// epoch.
+func Every(d time.Duration) Schedule {
+	return every(d)
+}
+
+func (e every) Next(t time.Time) time.Time {
+	d := time.Duration(e)
+	if d <= 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, (t.UnixNano()/int64(d)+1)*int64(d)).In(t.Location())
+}
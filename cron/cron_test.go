@@ -0,0 +1,94 @@
+package cron
+
+import (
+	. "testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type cronSuite struct{}
+
+var _ = Suite(&cronSuite{})
+
+func TestCron(t *T) { TestingT(t) }
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+func (s *cronSuite) TestNext(c *C) {
+	for _, test := range []struct {
+		expr, from, next string
+	}{
+		{"* * * * *", "2016-05-01 12:00", "2016-05-01 12:01"},
+		{"0 2 * * *", "2016-05-01 12:00", "2016-05-02 02:00"},
+		{"0 2 * * *", "2016-05-01 01:59", "2016-05-01 02:00"},
+		{"0 2 * * *", "2016-05-01 02:00", "2016-05-02 02:00"},
+		{"@daily", "2016-12-31 23:59", "2017-01-01 00:00"},
+		{"@hourly", "2016-05-01 12:30", "2016-05-01 13:00"},
+		{"@weekly", "2016-05-01 12:00", "2016-05-08 00:00"},
+		{"@monthly", "2016-05-01 00:00", "2016-06-01 00:00"},
+		{"@yearly", "2016-05-01 00:00", "2017-01-01 00:00"},
+		{"*/15 * * * *", "2016-05-01 12:16", "2016-05-01 12:30"},
+		{"5/20 * * * *", "2016-05-01 12:46", "2016-05-01 13:05"},
+		{"0-30/10 9-17 * * mon-fri", "2016-04-29 17:30", "2016-05-02 09:00"},
+		{"0 0 * * 7", "2016-05-02 00:00", "2016-05-08 00:00"},
+		{"30 3 1,15 * *", "2016-05-02 00:00", "2016-05-15 03:30"},
+		{"0 0 29 feb *", "2016-03-01 00:00", "2020-02-29 00:00"},
+		// with both days restricted, either matches.
+		{"0 0 13 * fri", "2016-05-01 00:00", "2016-05-06 00:00"},
+	} {
+		schedule, err := Parse(test.expr)
+		c.Assert(err, IsNil, Commentf("%q", test.expr))
+		c.Assert(schedule.Next(date(test.from)), Equals, date(test.next), Commentf("%q from %s", test.expr, test.from))
+	}
+
+	schedule, err := Parse("0 0 30 2 *")
+	c.Assert(err, IsNil)
+	c.Assert(schedule.Next(date("2016-01-01 00:00")).IsZero(), Equals, true)
+}
+
+func (s *cronSuite) TestNextLocation(c *C) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+
+	schedule, err := Parse("0 2 * * *")
+	c.Assert(err, IsNil)
+
+	next := schedule.Next(time.Date(2016, 5, 1, 12, 0, 0, 0, loc))
+	c.Assert(next.Equal(time.Date(2016, 5, 2, 2, 0, 0, 0, loc)), Equals, true)
+	c.Assert(next.Location(), Equals, loc)
+}
+
+func (s *cronSuite) TestParseErrors(c *C) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"30-10 * * * *",
+		"* * * foo *",
+		"@fortnightly",
+	} {
+		_, err := Parse(expr)
+		c.Assert(err, NotNil, Commentf("%q", expr))
+	}
+}
+
+func (s *cronSuite) TestEvery(c *C) {
+	schedule := Every(30 * time.Minute)
+	c.Assert(schedule.Next(date("2016-05-01 12:10")), Equals, date("2016-05-01 12:30"))
+	c.Assert(schedule.Next(date("2016-05-01 12:30")), Equals, date("2016-05-01 13:00"))
+
+	c.Assert(Every(0).Next(date("2016-05-01 12:10")).IsZero(), Equals, true)
+}
@@ -4,8 +4,10 @@ import "time"
 
 // DefaultDrivers are macro type definitions for backend drivers.
 var DefaultDrivers = map[string]*BackendDrivers{
-	"ceph": {"ceph", "ceph", "ceph"},
-	"nfs":  {"", "nfs", ""},
+	"ceph":     {"ceph", "ceph", "ceph"},
+	"loopback": {"loopback", "loopback", "loopback"},
+	"lvm":      {"lvm", "lvm", "lvm"},
+	"nfs":      {"", "nfs", ""},
 }
 
 // DefaultFilesystems is a map of our default supported filesystems. Overridden
@@ -43,6 +43,10 @@ type Client interface {
 	// Dump dumps a tarball make with mktemp() to the specified directory.
 	Dump(string) (string, error)
 
+	// Restore loads a tarball made by Dump back into the database. See
+	// RestoreOptions for the modes of operation.
+	Restore(string, RestoreOptions) (*RestoreResult, error)
+
 	// Prefix returns the base prefix for our keyspace.
 	Prefix() string
 
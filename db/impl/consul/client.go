@@ -0,0 +1,331 @@
+package consul
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db"
+	"github.com/contiv/volplugin/db/jsonio"
+	"github.com/contiv/volplugin/errors"
+)
+
+// Client implements the db.Client interface.
+type Client struct {
+	prefix       string
+	kv           *KV
+	watchers     map[string]chan struct{}
+	watcherMutex sync.Mutex
+}
+
+// NewClient creates a new Client talking to the consul agent at address.
+// Consul keys never start with a slash, so one is trimmed from prefix.
+func NewClient(address string, prefix string) (*Client, error) {
+	c := &Client{
+		kv:       NewKV(address),
+		prefix:   strings.Trim(prefix, "/"),
+		watchers: map[string]chan struct{}{},
+	}
+
+	// consul has no directories, so just make sure the agent is reachable.
+	if _, err := c.kv.List(c.prefix); err != nil {
+		return nil, errored.New("Initial setup").Combine(err)
+	}
+
+	return c, nil
+}
+
+func (c *Client) qualified(path string) string {
+	return strings.Join([]string{c.prefix, path}, "/")
+}
+
+// Get retrieves the item from consul's key/value store and then populates obj with its data.
+func (c *Client) Get(obj db.Entity) error {
+	if obj.Hooks().PreGet != nil {
+		if err := obj.Hooks().PreGet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	pair, err := c.kv.Get(c.qualified(path))
+	if err != nil {
+		return err
+	}
+
+	if err := jsonio.Read(obj, pair.Value); err != nil {
+		return err
+	}
+
+	if err := obj.SetKey(c.trimPath(pair.Key)); err != nil {
+		return err
+	}
+
+	if obj.Hooks().PostGet != nil {
+		if err := obj.Hooks().PostGet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	return obj.Validate()
+}
+
+// Set takes the object and commits it to the database. The write is a
+// check-and-set against the ModifyIndex of the key when it was read, so a
+// concurrent write to the same key makes Set fail instead of being silently
+// overwritten.
+func (c *Client) Set(obj db.Entity) error {
+	if err := obj.Validate(); err != nil {
+		return err
+	}
+
+	if obj.Hooks().PreSet != nil {
+		if err := obj.Hooks().PreSet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	content, err := jsonio.Write(obj)
+	if err != nil {
+		return err
+	}
+
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	var index uint64
+	pair, err := c.kv.Get(c.qualified(path))
+	if err == nil {
+		index = pair.ModifyIndex
+	} else if err != errors.NotExists {
+		return err
+	}
+
+	ok, err := c.kv.CAS(c.qualified(path), content, index)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errored.Errorf("%q was modified during the write", path)
+	}
+
+	if obj.Hooks().PostSet != nil {
+		if err := obj.Hooks().PostSet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the object from the store.
+func (c *Client) Delete(obj db.Entity) error {
+	if obj.Hooks().PreDelete != nil {
+		if err := obj.Hooks().PreDelete(c, obj); err != nil {
+			return err
+		}
+	}
+
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	// consul does not complain about missing keys; etcd does, so we match it.
+	if _, err := c.kv.Get(c.qualified(path)); err != nil {
+		return err
+	}
+
+	if err := c.kv.Delete(c.qualified(path), false); err != nil {
+		return err
+	}
+
+	if obj.Hooks().PostDelete != nil {
+		if err := obj.Hooks().PostDelete(c, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Prefix returns a copy of the string used to make the database prefix.
+func (c *Client) Prefix() string {
+	return c.prefix
+}
+
+// Watch watches a given object for changes.
+func (c *Client) Watch(obj db.Entity) (chan db.Entity, chan error) {
+	path, err := obj.Path()
+	if err != nil {
+		errChan := make(chan error, 1)
+		errChan <- err
+		return make(chan db.Entity), errChan
+	}
+
+	return c.watchPath(obj, path, false)
+}
+
+// WatchStop stops a watch for a given object.
+func (c *Client) WatchStop(obj db.Entity) error {
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	return c.watchStopPath(path)
+}
+
+// WatchPrefix watches all items under the given entity's prefix
+func (c *Client) WatchPrefix(obj db.Entity) (chan db.Entity, chan error) {
+	return c.watchPath(obj, obj.Prefix(), true)
+}
+
+// WatchPrefixStop stops a WatchPrefix.
+func (c *Client) WatchPrefixStop(obj db.Entity) error {
+	return c.watchStopPath(obj.Prefix())
+}
+
+// watchPath watches a path with blocking queries. Every key whose ModifyIndex
+// is newer than the last query is yielded as an entity; deletions are not
+// reported, like with the etcd client. Only one watch for a given path may be
+// active at a time.
+func (c *Client) watchPath(obj db.Entity, path string, recursive bool) (chan db.Entity, chan error) {
+	c.watcherMutex.Lock()
+	defer c.watcherMutex.Unlock()
+
+	stopChan := make(chan struct{})
+	retChan := make(chan db.Entity)
+	errChan := make(chan error, 1)
+
+	go func() {
+		var index uint64
+
+		for {
+			pairs, newIndex, err := c.kv.Watch(c.qualified(path), recursive, index, stopChan)
+
+			select {
+			case <-stopChan:
+				logrus.Debugf("watch for %q canceled", path)
+				return
+			default:
+			}
+
+			if err != nil && err != errors.NotExists {
+				errChan <- err
+				time.Sleep(time.Second)
+				continue
+			}
+
+			// the first query only establishes the index we watch from.
+			// consul resets indexes when a cluster is rebuilt; start over then.
+			if index > 0 && newIndex >= index {
+				for _, entity := range c.traverse(pairs, obj, index) {
+					retChan <- entity
+				}
+			}
+
+			if newIndex < index {
+				newIndex = 0
+			}
+
+			index = newIndex
+		}
+	}()
+
+	_, ok := c.watchers[path]
+	if ok {
+		close(c.watchers[path])
+	}
+	c.watchers[path] = stopChan
+
+	return retChan, errChan
+}
+
+// watchStopPath stops a watch given a path to stop the watch on.
+func (c *Client) watchStopPath(path string) error {
+	c.watcherMutex.Lock()
+	defer c.watcherMutex.Unlock()
+
+	stopChan, ok := c.watchers[path]
+	if !ok {
+		return errors.InvalidDBPath.Combine(errored.New("missing key during watch"))
+	}
+
+	close(stopChan)
+	delete(c.watchers, path)
+
+	return nil
+}
+
+func (c *Client) trimPath(key string) string {
+	return strings.Trim(strings.TrimPrefix(strings.Trim(key, "/"), c.Prefix()), "/")
+}
+
+// traverse converts anything that looks like an entity into an entity and
+// returns it as part of the array. Only keys modified after index are
+// considered. Keys ending in a slash are folders created by other consul
+// tools, and are skipped.
+//
+// traverse will log & skip errors to ensure bad data will not break this routine.
+func (c *Client) traverse(pairs []*KVPair, obj db.Entity, index uint64) []db.Entity {
+	entities := []db.Entity{}
+
+	for _, pair := range pairs {
+		if strings.HasSuffix(pair.Key, "/") || pair.ModifyIndex <= index {
+			continue
+		}
+
+		copy := obj.Copy()
+
+		if err := jsonio.Read(copy, pair.Value); err != nil {
+			// This is kept this way so a buggy policy won't break listing all of them
+			logrus.Errorf("Received error retrieving value at path %q during list: %v", pair.Key, err)
+			continue
+		}
+
+		if err := copy.SetKey(c.trimPath(pair.Key)); err != nil {
+			logrus.Error(err)
+			continue
+		}
+
+		// same here. fire hooks to retrieve the full entity. only log but don't append on error.
+		if copy.Hooks().PostGet != nil {
+			if err := copy.Hooks().PostGet(c, copy); err != nil {
+				logrus.Errorf("Error received trying to run fetch hooks during %q list: %v", pair.Key, err)
+				continue
+			}
+		}
+
+		entities = append(entities, copy)
+	}
+
+	return entities
+}
+
+// List populates obj with the list of the db in the collection
+// corresponding to the entity.
+func (c *Client) List(obj db.Entity) ([]db.Entity, error) {
+	return c.ListPrefix("", obj)
+}
+
+// ListPrefix is used to list a subtree of an entity, such as listing volume by policy.
+func (c *Client) ListPrefix(prefix string, obj db.Entity) ([]db.Entity, error) {
+	// the trailing slash keeps "policy1" from matching "policy10".
+	pairs, err := c.kv.List(c.qualified(path.Join(obj.Prefix(), prefix)) + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	return c.traverse(pairs, obj, 0), nil
+}
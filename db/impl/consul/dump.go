@@ -0,0 +1,53 @@
+package consul
+
+import (
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db"
+	"github.com/contiv/volplugin/db/impl/dump"
+	"github.com/contiv/volplugin/errors"
+)
+
+// Dump yields a database dump of the keyspace we manage. It will be contained
+// in a tarball based on the timestamp of the dump. If a dir is provided, it
+// will be placed under that directory.
+func (c *Client) Dump(dir string) (string, error) {
+	kvPairs, err := c.kv.List(c.prefix)
+	if err != nil {
+		return "", errored.Errorf(`Failed to recursively GET "%v" namespace from consul`, c.prefix).Combine(err)
+	}
+
+	pairs := []dump.Pair{}
+	for _, pair := range kvPairs {
+		pairs = append(pairs, dump.Pair{Key: pair.Key, Value: pair.Value})
+	}
+
+	return dump.Tarball(dir, "consul", pairs)
+}
+
+// Restore loads a tarball made by Dump, or by any other client, back into
+// consul, following opts.
+func (c *Client) Restore(tarball string, opts db.RestoreOptions) (*db.RestoreResult, error) {
+	source := opts.SourcePrefix
+	if source == "" {
+		source = c.prefix
+	}
+
+	return dump.Restore(restoreStore{c}, tarball, source, opts)
+}
+
+type restoreStore struct {
+	*Client
+}
+
+func (r restoreStore) Exists(key string) (bool, error) {
+	_, err := r.kv.Get(r.qualified(key))
+	if err == errors.NotExists {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (r restoreStore) Put(key string, value []byte) error {
+	return r.kv.Put(r.qualified(key), value)
+}
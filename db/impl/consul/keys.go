@@ -0,0 +1,273 @@
+package consul
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db/keysapi"
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+)
+
+// NewKeysAPI returns an etcd v2 client.KeysAPI over the consul agent at
+// address, so config.Client and the daemons built on it run on consul.
+//
+// Keys written with a TTL keep their expiry in the flags of the key, and are
+// removed when they are read after it. Keys with a TTL of up to a day are
+// also held by a consul session which deletes them when it expires; consul
+// rounds the TTL up to 10 seconds, and may take up to twice the TTL to remove
+// the key. Watches starting at an earlier index only see the keys changed
+// since, not the ones deleted.
+func NewKeysAPI(address string) (client.KeysAPI, error) {
+	kv := NewKV(address)
+
+	if _, err := kv.Leader(); err != nil {
+		return nil, errored.New("Initial setup").Combine(err)
+	}
+
+	return keysapi.New(&keyStore{kv: kv}), nil
+}
+
+// keyStore is the keysapi.Store of consul. The index of the store is the
+// X-Consul-Index of the last request.
+type keyStore struct {
+	kv *KV
+}
+
+func storePair(pair *KVPair) *keysapi.Pair {
+	result := &keysapi.Pair{Key: pair.Key, Value: string(pair.Value), CreateIndex: pair.CreateIndex, ModifyIndex: pair.ModifyIndex}
+	if pair.Flags != 0 {
+		result.Expires = time.Unix(0, int64(pair.Flags))
+	}
+
+	return result
+}
+
+// expired reports whether the key passed the expiry in its flags, and if so
+// removes it, unless it was written again since.
+func (s *keyStore) expired(pair *KVPair) (bool, error) {
+	if pair.Flags == 0 || time.Now().UnixNano() < int64(pair.Flags) {
+		return false, nil
+	}
+
+	_, err := s.kv.DeleteCAS(pair.Key, pair.ModifyIndex)
+	return true, err
+}
+
+func (s *keyStore) get(key string) (*KVPair, uint64, error) {
+	pairs, index, err := s.kv.Watch(key, false, 0, nil)
+	if err == errors.NotExists || (err == nil && len(pairs) == 0) {
+		return nil, index, nil
+	} else if err != nil {
+		return nil, index, err
+	}
+
+	return pairs[0], index, nil
+}
+
+func (s *keyStore) Get(key string) (*keysapi.Pair, uint64, error) {
+	pair, index, err := s.get(key)
+	if pair == nil {
+		return nil, index, err
+	}
+
+	if expired, err := s.expired(pair); expired || err != nil {
+		return nil, index, err
+	}
+
+	return storePair(pair), index, nil
+}
+
+func (s *keyStore) List(prefix string) ([]*keysapi.Pair, uint64, error) {
+	pairs, index, err := s.kv.Watch(prefix, true, 0, nil)
+	if err != nil && err != errors.NotExists {
+		return nil, index, err
+	}
+
+	result := []*keysapi.Pair{}
+	for _, pair := range pairs {
+		expired, err := s.expired(pair)
+		if err != nil {
+			return nil, index, err
+		}
+
+		if !expired {
+			result = append(result, storePair(pair))
+		}
+	}
+
+	return result, index, nil
+}
+
+// Put writes the key. Keys with a TTL are written with their expiry, and
+// those a session can hold are acquired by one, which is renewed when the key
+// is written again; writing the key without a TTL, or with one longer than a
+// session takes, releases it from its session.
+func (s *keyStore) Put(key, value string, index uint64, ttl time.Duration) (*keysapi.Pair, uint64, error) {
+	query := url.Values{}
+	if index != keysapi.Unconditional {
+		query.Set("cas", strconv.FormatUint(index, 10))
+	}
+
+	if ttl > 0 {
+		query.Set("flags", strconv.FormatInt(time.Now().Add(ttl).UnixNano(), 10))
+	}
+
+	current, _, err := s.get(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var created string
+
+	switch {
+	case ttl > maxSessionTTL:
+		// the key is only removed when it is read after its expiry.
+		if current != nil && current.Session != "" {
+			query.Set("release", current.Session)
+		}
+	case ttl > 0 && current != nil && current.Session != "" && s.kv.RenewSession(current.Session) == nil:
+		query.Set("acquire", current.Session)
+	case ttl > 0:
+		if created, err = s.kv.CreateSession(ttl); err != nil {
+			return nil, 0, err
+		}
+		query.Set("acquire", created)
+	case current != nil && current.Session != "":
+		query.Set("release", current.Session)
+	}
+
+	ok, err := s.kv.write("PUT", key, query, []byte(value))
+	if !ok && created != "" {
+		s.kv.DestroySession(created)
+	}
+
+	if err != nil || !ok {
+		_, index, _ := s.get(key)
+		return nil, index, err
+	}
+
+	pair, index, err := s.get(key)
+	if err != nil || pair == nil {
+		return nil, index, err
+	}
+
+	return storePair(pair), index, nil
+}
+
+func (s *keyStore) Delete(key string, index uint64) (bool, uint64, error) {
+	var (
+		ok  = true
+		err error
+	)
+
+	if index == keysapi.Unconditional {
+		err = s.kv.Delete(key, false)
+	} else {
+		ok, err = s.kv.DeleteCAS(key, index)
+	}
+
+	if err != nil {
+		return false, 0, err
+	}
+
+	_, newIndex, err := s.get(key)
+	return ok, newIndex, err
+}
+
+func (s *keyStore) DeletePrefix(prefix string) (uint64, error) {
+	if err := s.kv.Delete(prefix, true); err != nil {
+		return 0, err
+	}
+
+	_, index, err := s.get(prefix)
+	return index, err
+}
+
+func (s *keyStore) Watch(prefix string, index uint64) keysapi.StoreWatcher {
+	return &keyWatcher{kv: s.kv, prefix: prefix, index: index}
+}
+
+// keyWatcher watches keys with blocking queries. consul returns all the keys
+// under the prefix when any of them changes, so the changes are found by
+// comparing them with the previous result.
+type keyWatcher struct {
+	kv      *KV
+	prefix  string
+	index   uint64
+	keys    map[string]*KVPair
+	started bool
+}
+
+func (w *keyWatcher) Next(cancel <-chan struct{}) ([]*keysapi.Change, error) {
+	for {
+		var queryIndex uint64
+		if w.started {
+			queryIndex = w.index
+		}
+
+		pairs, index, err := w.kv.Watch(w.prefix, true, queryIndex, cancel)
+		if err != nil && err != errors.NotExists {
+			return nil, err
+		}
+
+		keys := map[string]*KVPair{}
+		changes := []*keysapi.Change{}
+
+		for _, pair := range pairs {
+			keys[pair.Key] = pair
+
+			var prev *KVPair
+			if w.started {
+				prev = w.keys[pair.Key]
+				if prev != nil && prev.ModifyIndex == pair.ModifyIndex {
+					continue
+				}
+			} else if w.index == 0 || pair.ModifyIndex <= w.index {
+				// the first query only reports the keys changed after the
+				// index the watch started at, if any.
+				continue
+			}
+
+			change := &keysapi.Change{Key: pair.Key, Pair: storePair(pair), Index: pair.ModifyIndex}
+			if prev != nil {
+				change.Prev = storePair(prev)
+			}
+			changes = append(changes, change)
+		}
+
+		for key, prev := range w.keys {
+			if _, ok := keys[key]; !ok {
+				changes = append(changes, &keysapi.Change{Key: key, Prev: storePair(prev), Index: index})
+			}
+		}
+
+		// a blocking query with an index of 0 returns at once.
+		if index == 0 {
+			index = 1
+		}
+
+		w.keys = keys
+		w.index = index
+		w.started = true
+
+		if len(changes) > 0 {
+			sort.Sort(changesByIndex(changes))
+			return changes, nil
+		}
+	}
+}
+
+type changesByIndex []*keysapi.Change
+
+func (c changesByIndex) Len() int      { return len(c) }
+func (c changesByIndex) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c changesByIndex) Less(i, j int) bool {
+	if c[i].Index != c[j].Index {
+		return c[i].Index < c[j].Index
+	}
+	return c[i].Key < c[j].Key
+}
@@ -0,0 +1,309 @@
+package consul
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+)
+
+// The consul API client is not vendored, and the KV part of the HTTP API is
+// small, so KV implements just what the db and volmigrate clients need.
+// Values are base64 encoded by consul; encoding/json decodes them into Value.
+
+// KVPair is a key in consul's key/value store.
+type KVPair struct {
+	Key         string
+	Value       []byte
+	CreateIndex uint64
+	ModifyIndex uint64
+	// Flags is an opaque number consul keeps with the key.
+	Flags uint64
+	// Session is the session holding the key, if any.
+	Session string
+}
+
+// KV is a client for consul's key/value HTTP API.
+type KV struct {
+	address string
+	client  *http.Client
+}
+
+// NewKV returns a KV talking to the consul agent at address, which is a
+// host:port pair or a http(s) URL.
+func NewKV(address string) *KV {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	return &KV{
+		address: strings.TrimRight(address, "/"),
+		// blocking queries wait for up to waitTime, plus the jitter consul adds.
+		client: &http.Client{Timeout: waitTime + time.Minute},
+	}
+}
+
+// waitTime is how long blocking queries wait for changes before returning.
+const waitTime = 5 * time.Minute
+
+func (kv *KV) url(key string, query url.Values) string {
+	u := kv.address + "/v1/kv/" + strings.TrimLeft(key, "/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+func (kv *KV) do(method, key string, query url.Values, body []byte, cancel <-chan struct{}) (*http.Response, error) {
+	req, err := http.NewRequest(method, kv.url(key, query), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Cancel = cancel
+
+	resp, err := kv.client.Do(req)
+	if err != nil {
+		return nil, errored.Errorf("consul %s %q", method, key).Combine(err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return resp, errors.NotExists
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		content, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, errored.Errorf("consul %s %q: status %d: %s", method, key, resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+
+	return resp, nil
+}
+
+// Watch fetches key, or every key under it if recurse is true. If index is
+// non-zero, the request is a blocking query: it returns when the index of the
+// result is greater than index, waitTime passes, or cancel is closed. The
+// index of the result is returned along with the pairs, even if the key does
+// not exist.
+func (kv *KV) Watch(key string, recurse bool, index uint64, cancel <-chan struct{}) ([]*KVPair, uint64, error) {
+	query := url.Values{}
+	if recurse {
+		query.Set("recurse", "true")
+	}
+
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", fmt.Sprintf("%ds", int(waitTime.Seconds())))
+	}
+
+	resp, err := kv.do("GET", key, query, nil, cancel)
+	if resp == nil {
+		return nil, 0, err
+	}
+
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return nil, newIndex, err
+	}
+	defer resp.Body.Close()
+
+	pairs := []*KVPair{}
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, newIndex, errored.Errorf("consul GET %q: could not decode response", key).Combine(err)
+	}
+
+	return pairs, newIndex, nil
+}
+
+// Get fetches a single key. errors.NotExists is returned if it is missing.
+func (kv *KV) Get(key string) (*KVPair, error) {
+	pairs, _, err := kv.Watch(key, false, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pairs) == 0 {
+		return nil, errors.NotExists
+	}
+
+	return pairs[0], nil
+}
+
+// List fetches all the keys under prefix. A missing prefix yields no pairs.
+func (kv *KV) List(prefix string) ([]*KVPair, error) {
+	pairs, _, err := kv.Watch(prefix, true, 0, nil)
+	if err == errors.NotExists {
+		return []*KVPair{}, nil
+	}
+
+	return pairs, err
+}
+
+// Put writes the key unconditionally.
+func (kv *KV) Put(key string, value []byte) error {
+	resp, err := kv.do("PUT", key, nil, value, nil)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// CAS writes the key only if its ModifyIndex is still index. An index of 0
+// only writes the key if it does not exist. The returned bool reports
+// whether the write happened.
+func (kv *KV) CAS(key string, value []byte, index uint64) (bool, error) {
+	return kv.write("PUT", key, url.Values{"cas": []string{strconv.FormatUint(index, 10)}}, value)
+}
+
+// write sends a write whose success consul reports in the body, such as
+// check-and-set writes and lock acquisitions.
+func (kv *KV) write(method, key string, query url.Values, value []byte) (bool, error) {
+	resp, err := kv.do(method, key, query, value, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(string(content)) == "true", nil
+}
+
+// Delete removes the key, or everything under it if recurse is true. Missing
+// keys are not an error.
+func (kv *KV) Delete(key string, recurse bool) error {
+	query := url.Values{}
+	if recurse {
+		query.Set("recurse", "true")
+	}
+
+	resp, err := kv.do("DELETE", key, query, nil, nil)
+	if err == errors.NotExists {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// DeleteCAS removes the key only if its ModifyIndex is still index. The
+// returned bool reports whether it did.
+func (kv *KV) DeleteCAS(key string, index uint64) (bool, error) {
+	return kv.write("DELETE", key, url.Values{"cas": []string{strconv.FormatUint(index, 10)}}, nil)
+}
+
+// minSessionTTL and maxSessionTTL bound the TTL consul accepts for sessions.
+const (
+	minSessionTTL = 10 * time.Second
+	maxSessionTTL = 24 * time.Hour
+)
+
+// session calls the session endpoint at path and decodes the response into
+// result, unless it is nil.
+func (kv *KV) session(path string, body interface{}, result interface{}) error {
+	var content []byte
+	if body != nil {
+		var err error
+		if content, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest("PUT", kv.address+"/v1/session/"+path, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	resp, err := kv.client.Do(req)
+	if err != nil {
+		return errored.Errorf("consul session %q", path).Combine(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errors.NotExists
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		content, _ := ioutil.ReadAll(resp.Body)
+		return errored.Errorf("consul session %q: status %d: %s", path, resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// CreateSession creates a session which deletes the keys it holds when it is
+// not renewed within ttl. consul only takes TTLs between 10 seconds and a
+// day, and may take up to twice the TTL to notice the session expired;
+// shorter TTLs are rounded up, and longer ones are refused.
+func (kv *KV) CreateSession(ttl time.Duration) (string, error) {
+	if ttl > maxSessionTTL {
+		return "", errored.Errorf("consul session TTL %v is longer than %v", ttl, maxSessionTTL)
+	}
+
+	if ttl < minSessionTTL {
+		ttl = minSessionTTL
+	}
+
+	body := map[string]string{
+		"TTL":       fmt.Sprintf("%ds", int(ttl.Seconds())),
+		"Behavior":  "delete",
+		"LockDelay": "0s",
+	}
+
+	result := &struct{ ID string }{}
+	if err := kv.session("create", body, result); err != nil {
+		return "", err
+	}
+
+	return result.ID, nil
+}
+
+// RenewSession renews the session for its TTL. errors.NotExists is returned
+// if it already expired.
+func (kv *KV) RenewSession(id string) error {
+	return kv.session("renew/"+id, nil, nil)
+}
+
+// DestroySession destroys the session, deleting the keys it holds.
+func (kv *KV) DestroySession(id string) error {
+	return kv.session("destroy/"+id, nil, nil)
+}
+
+// Leader returns the address of the leader of the consul cluster, which
+// makes sure the agent is reachable and the cluster is up.
+func (kv *KV) Leader() (string, error) {
+	resp, err := kv.client.Get(kv.address + "/v1/status/leader")
+	if err != nil {
+		return "", errored.New("consul status").Combine(err)
+	}
+	defer resp.Body.Close()
+
+	var leader string
+	if err := json.NewDecoder(resp.Body).Decode(&leader); err != nil {
+		return "", errored.New("consul status: could not decode response").Combine(err)
+	}
+
+	if leader == "" {
+		return "", errored.New("consul status: the cluster has no leader")
+	}
+
+	return leader, nil
+}
@@ -0,0 +1,130 @@
+// Package dump writes database dumps for the db.Client implementations whose
+// stores have flat keyspaces, and restores the dumps of all of them. The
+// tarballs have the same layout as the etcd v2 client's dumps: directories are
+// derived from the keys.
+package dump
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+)
+
+// Pair is a key and its value.
+type Pair struct {
+	Key   string
+	Value []byte
+}
+
+// Tarball writes the pairs to a tarball named after kind and the current
+// time, under dir (or the temporary directory if dir is empty), and returns
+// its path. The tarball extracts to a directory with the same name.
+func Tarball(dir, kind string, pairs []Pair) (string, error) {
+	now := time.Now()
+
+	// tar hangs during unpacking if the base directory has colons in it
+	// unless --force-local is specified, so use the simpler "%Y%m%d-%H%M%S".
+	niceTimeFormat := fmt.Sprintf("%d%02d%02d-%02d%02d%02d",
+		now.Year(), now.Month(), now.Day(),
+		now.Hour(), now.Minute(), now.Second())
+
+	file, err := ioutil.TempFile(dir, kind+"_dump_"+niceTimeFormat+"_")
+	if err != nil {
+		return "", errored.Errorf("Failed to create tempfile").Combine(err)
+	}
+	defer file.Close()
+
+	// create a gzipped, tarball writer which cleans up after itself
+	gzipWriter := gzip.NewWriter(file)
+	defer gzipWriter.Close()
+
+	tarWriter := tar.NewWriter(gzipWriter)
+	defer tarWriter.Close()
+
+	// ensure that the tarball extracts to a folder with the same name as the tarball
+	baseDirectory := filepath.Base(file.Name())
+	dirs := map[string]struct{}{}
+
+	for _, pair := range pairs {
+		key := "/" + strings.Trim(pair.Key, "/")
+
+		for _, parent := range parents(key) {
+			if _, ok := dirs[parent]; ok {
+				continue
+			}
+			dirs[parent] = struct{}{}
+
+			if err := add(tarWriter, baseDirectory+parent, nil, true); err != nil {
+				return "", err
+			}
+		}
+
+		// keys ending in a slash are directory markers, e.g. consul folders.
+		if strings.HasSuffix(pair.Key, "/") {
+			continue
+		}
+
+		if err := add(tarWriter, baseDirectory+key, pair.Value, false); err != nil {
+			return "", err
+		}
+	}
+
+	// give the file a more fitting name
+	newFilename := file.Name() + ".tar.gz"
+
+	if err := os.Rename(file.Name(), newFilename); err != nil {
+		return "", err
+	}
+
+	return newFilename, nil
+}
+
+// parents returns the directories leading to key, outermost first.
+func parents(key string) []string {
+	dirs := []string{}
+	for dir := path.Dir(key); dir != "/" && dir != "."; dir = path.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+	}
+
+	return dirs
+}
+
+func add(writer *tar.Writer, name string, value []byte, dir bool) error {
+	now := time.Now()
+
+	header := &tar.Header{
+		AccessTime: now,
+		ChangeTime: now,
+		ModTime:    now,
+		Name:       name,
+	}
+
+	if dir {
+		header.Mode = 0700
+		header.Typeflag = tar.TypeDir
+	} else {
+		header.Mode = 0600
+		header.Size = int64(len(value))
+		header.Typeflag = tar.TypeReg
+	}
+
+	if err := writer.WriteHeader(header); err != nil {
+		return errored.Errorf("Failed to write tar entry header").Combine(err)
+	}
+
+	if !dir {
+		if _, err := writer.Write(value); err != nil {
+			return errored.Errorf("Failed to write tar entry").Combine(err)
+		}
+	}
+
+	return nil
+}
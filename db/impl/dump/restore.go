@@ -0,0 +1,151 @@
+package dump
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db"
+	"github.com/contiv/volplugin/errors"
+)
+
+// transientRoots hold keys which carry a TTL in etcd, or which signal work to
+// the daemons: use locks, stats, freezes, grows, snapshot requests and the
+// audit log. The tarball does not record TTLs, and restoring them as
+// permanent keys would leave stale locks and signals behind, so they are
+// never restored.
+var transientRoots = []string{"users", "stats", "freezes", "grows", "snapshots", "audit"}
+
+func transient(key string) bool {
+	for _, root := range transientRoots {
+		if strings.HasPrefix(key, root+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Store is the key/value access Restore needs. Keys are relative to the
+// client's prefix.
+type Store interface {
+	Exists(key string) (bool, error)
+	Put(key string, value []byte) error
+}
+
+// Read returns the keys and values in a tarball written by Tarball or by the
+// etcd v2 client. Keys are stripped of the tarball's base directory, and
+// directories are skipped.
+func Read(tarball string) ([]Pair, error) {
+	file, err := os.Open(tarball)
+	if err != nil {
+		return nil, errored.Errorf("Could not open tarball %q", tarball).Combine(err)
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, errored.Errorf("Could not decompress tarball %q", tarball).Combine(err)
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	pairs := []Pair{}
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errored.Errorf("Could not read tarball %q", tarball).Combine(err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		parts := strings.SplitN(strings.Trim(header.Name, "/"), "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		value, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			return nil, errored.Errorf("Could not read %q from tarball %q", header.Name, tarball).Combine(err)
+		}
+
+		pairs = append(pairs, Pair{Key: "/" + parts[1], Value: value})
+	}
+
+	return pairs, nil
+}
+
+// Restore writes the contents of tarball under sourcePrefix to store,
+// following opts. When existing keys make it fail, nothing is written.
+func Restore(store Store, tarball, sourcePrefix string, opts db.RestoreOptions) (*db.RestoreResult, error) {
+	pairs, err := Read(tarball)
+	if err != nil {
+		return nil, err
+	}
+
+	source := strings.Trim(sourcePrefix, "/") + "/"
+	restore := []Pair{}
+	result := &db.RestoreResult{Restored: []string{}, Skipped: []string{}}
+	existing := []string{}
+
+	for _, pair := range pairs {
+		key := strings.TrimPrefix(pair.Key, "/")
+		if !strings.HasPrefix(key, source) {
+			continue
+		}
+
+		key = strings.TrimPrefix(key, source)
+		if transient(key) {
+			result.Skipped = append(result.Skipped, key)
+			continue
+		}
+
+		if opts.Mode != db.RestoreOverwrite {
+			exists, err := store.Exists(key)
+			if err != nil {
+				return nil, err
+			}
+
+			if exists {
+				if opts.Mode == db.RestoreSkipExisting {
+					result.Skipped = append(result.Skipped, key)
+					continue
+				}
+
+				existing = append(existing, key)
+			}
+		}
+
+		restore = append(restore, Pair{Key: key, Value: pair.Value})
+		result.Restored = append(result.Restored, key)
+	}
+
+	if len(restore) == 0 && len(result.Skipped) == 0 {
+		return nil, errored.Errorf("Tarball %q has no keys under prefix %q", tarball, sourcePrefix)
+	}
+
+	if len(existing) > 0 {
+		return nil, errors.Exists.Combine(errored.Errorf("%d keys already exist, including %q; choose to overwrite or skip them", len(existing), existing[0]))
+	}
+
+	if opts.DryRun {
+		return result, nil
+	}
+
+	for _, pair := range restore {
+		if err := store.Put(pair.Key, pair.Value); err != nil {
+			return nil, errored.Errorf("Could not restore %q", pair.Key).Combine(err)
+		}
+	}
+
+	return result, nil
+}
@@ -10,6 +10,9 @@ import (
 	"time"
 
 	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db"
+	"github.com/contiv/volplugin/db/impl/dump"
+	"github.com/contiv/volplugin/errors"
 	"github.com/coreos/etcd/client"
 	"golang.org/x/net/context"
 )
@@ -103,3 +106,36 @@ func addNodeToTarball(node *client.Node, writer *tar.Writer, baseDirectory strin
 
 	return nil
 }
+
+// Restore loads a tarball made by Dump, or by any other client, back into
+// etcd, following opts.
+func (c *Client) Restore(tarball string, opts db.RestoreOptions) (*db.RestoreResult, error) {
+	source := opts.SourcePrefix
+	if source == "" {
+		source = c.prefix
+	}
+
+	return dump.Restore(restoreStore{c}, tarball, source, opts)
+}
+
+type restoreStore struct {
+	*Client
+}
+
+func (r restoreStore) Exists(key string) (bool, error) {
+	_, err := r.client.Get(context.Background(), r.qualified(key), &client.GetOptions{Quorum: true})
+	if err != nil {
+		if errors.EtcdToErrored(err) == errors.NotExists {
+			return false, nil
+		}
+
+		return false, errors.EtcdToErrored(err)
+	}
+
+	return true, nil
+}
+
+func (r restoreStore) Put(key string, value []byte) error {
+	_, err := r.client.Set(context.Background(), r.qualified(key), string(value), nil)
+	return errors.EtcdToErrored(err)
+}
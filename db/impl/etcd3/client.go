@@ -0,0 +1,358 @@
+package etcd3
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db"
+	"github.com/contiv/volplugin/db/jsonio"
+	"github.com/contiv/volplugin/errors"
+)
+
+// Client implements the db.Client interface on top of etcd v3. In addition
+// to the interface, it can write several entities atomically (see SetAll)
+// and hold use locks with leases (see AcquireUses).
+//
+// The daemons do not use Client: they are built on config.Client, which runs
+// on etcd v3 through NewKeysAPI.
+type Client struct {
+	prefix       string
+	kv           *KV
+	watchers     map[string]chan struct{}
+	watcherMutex sync.Mutex
+}
+
+// NewClient creates a new Client talking to the etcd v3 endpoints in hosts.
+// etcd v3 has no directories, so the prefix is only used to qualify keys.
+func NewClient(hosts []string, prefix string) (*Client, error) {
+	c := &Client{
+		kv:       NewKV(hosts),
+		prefix:   "/" + strings.Trim(prefix, "/"),
+		watchers: map[string]chan struct{}{},
+	}
+
+	// make sure the cluster is reachable.
+	if _, err := c.kv.Get(c.prefix); err != nil && err != errors.NotExists {
+		return nil, errored.New("Initial setup").Combine(err)
+	}
+
+	return c, nil
+}
+
+func (c *Client) qualified(path string) string {
+	return strings.Join([]string{c.prefix, path}, "/")
+}
+
+// Get retrieves the item from etcd's key/value store and then populates obj with its data.
+func (c *Client) Get(obj db.Entity) error {
+	if obj.Hooks().PreGet != nil {
+		if err := obj.Hooks().PreGet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	kv, err := c.kv.Get(c.qualified(path))
+	if err != nil {
+		return err
+	}
+
+	if err := jsonio.Read(obj, kv.Value); err != nil {
+		return err
+	}
+
+	if err := obj.SetKey(c.trimPath(string(kv.Key))); err != nil {
+		return err
+	}
+
+	if obj.Hooks().PostGet != nil {
+		if err := obj.Hooks().PostGet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	return obj.Validate()
+}
+
+// putOp validates the object, fires its PreSet hook, and yields the
+// operation writing it.
+func (c *Client) putOp(obj db.Entity) (*Op, error) {
+	if err := obj.Validate(); err != nil {
+		return nil, err
+	}
+
+	if obj.Hooks().PreSet != nil {
+		if err := obj.Hooks().PreSet(c, obj); err != nil {
+			return nil, err
+		}
+	}
+
+	content, err := jsonio.Write(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := obj.Path()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Op{Put: &PutRequest{Key: []byte(c.qualified(path)), Value: content}}, nil
+}
+
+// Set takes the object and commits it to the database.
+func (c *Client) Set(obj db.Entity) error {
+	return c.SetAll(obj)
+}
+
+// SetAll commits all the objects to the database in a single transaction:
+// either all of them are written, or none are. PostSet hooks are fired once
+// the transaction has committed.
+func (c *Client) SetAll(objs ...db.Entity) error {
+	txn := &TxnRequest{}
+
+	for _, obj := range objs {
+		op, err := c.putOp(obj)
+		if err != nil {
+			return err
+		}
+
+		txn.Success = append(txn.Success, op)
+	}
+
+	if _, err := c.kv.Txn(txn); err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		if obj.Hooks().PostSet != nil {
+			if err := obj.Hooks().PostSet(c, obj); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the object from the store.
+func (c *Client) Delete(obj db.Entity) error {
+	if obj.Hooks().PreDelete != nil {
+		if err := obj.Hooks().PreDelete(c, obj); err != nil {
+			return err
+		}
+	}
+
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	key := []byte(c.qualified(path))
+
+	// etcd v3 does not complain about missing keys; etcd v2 does, so we match it.
+	ok, err := c.kv.Txn(&TxnRequest{
+		Compare: []*Compare{{Result: "GREATER", Target: "CREATE", Key: key}},
+		Success: []*Op{{DeleteRange: &RangeRequest{Key: key}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errors.NotExists
+	}
+
+	if obj.Hooks().PostDelete != nil {
+		if err := obj.Hooks().PostDelete(c, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Prefix returns a copy of the string used to make the database prefix.
+func (c *Client) Prefix() string {
+	return c.prefix
+}
+
+// Watch watches a given object for changes.
+func (c *Client) Watch(obj db.Entity) (chan db.Entity, chan error) {
+	path, err := obj.Path()
+	if err != nil {
+		errChan := make(chan error, 1)
+		errChan <- err
+		return make(chan db.Entity), errChan
+	}
+
+	return c.watchPath(obj, path, false)
+}
+
+// WatchStop stops a watch for a given object.
+func (c *Client) WatchStop(obj db.Entity) error {
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	return c.watchStopPath(path)
+}
+
+// WatchPrefix watches all items under the given entity's prefix
+func (c *Client) WatchPrefix(obj db.Entity) (chan db.Entity, chan error) {
+	return c.watchPath(obj, obj.Prefix(), true)
+}
+
+// WatchPrefixStop stops a WatchPrefix.
+func (c *Client) WatchPrefixStop(obj db.Entity) error {
+	return c.watchStopPath(obj.Prefix())
+}
+
+// watchPath watches a path for changes. Deletions are not reported, like
+// with the etcd v2 client. If the watch breaks, it is resumed from the
+// revision after the last event seen, so no change is lost. Only one watch
+// for a given path may be active at a time.
+func (c *Client) watchPath(obj db.Entity, path string, recursive bool) (chan db.Entity, chan error) {
+	c.watcherMutex.Lock()
+	defer c.watcherMutex.Unlock()
+
+	stopChan := make(chan struct{})
+	retChan := make(chan db.Entity)
+	errChan := make(chan error, 1)
+
+	key := c.qualified(path)
+	if recursive {
+		key += "/"
+	}
+
+	go func() {
+		var revision int64
+
+		for {
+			events, watchErrs := c.kv.Watch(key, recursive, revision, stopChan)
+
+			for event := range events {
+				revision = int64(event.KV.ModRevision) + 1
+
+				if event.Type == "DELETE" {
+					continue
+				}
+
+				for _, entity := range c.traverse([]*KeyValue{event.KV}, obj) {
+					select {
+					case retChan <- entity:
+					case <-stopChan:
+						return
+					}
+				}
+			}
+
+			select {
+			case <-stopChan:
+				logrus.Debugf("watch for %q canceled", path)
+				return
+			default:
+			}
+
+			if err := <-watchErrs; err != nil {
+				errChan <- err
+			}
+
+			time.Sleep(time.Second)
+		}
+	}()
+
+	_, ok := c.watchers[path]
+	if ok {
+		close(c.watchers[path])
+	}
+	c.watchers[path] = stopChan
+
+	return retChan, errChan
+}
+
+// watchStopPath stops a watch given a path to stop the watch on.
+func (c *Client) watchStopPath(path string) error {
+	c.watcherMutex.Lock()
+	defer c.watcherMutex.Unlock()
+
+	stopChan, ok := c.watchers[path]
+	if !ok {
+		return errors.InvalidDBPath.Combine(errored.New("missing key during watch"))
+	}
+
+	close(stopChan)
+	delete(c.watchers, path)
+
+	return nil
+}
+
+func (c *Client) trimPath(key string) string {
+	return strings.Trim(strings.TrimPrefix(strings.Trim(key, "/"), strings.Trim(c.Prefix(), "/")), "/")
+}
+
+// traverse converts anything that looks like an entity into an entity and
+// returns it as part of the array. Keys ending in a slash are the
+// directories the keys API of NewKeysAPI creates, and are skipped.
+//
+// traverse will log & skip errors to ensure bad data will not break this routine.
+func (c *Client) traverse(kvs []*KeyValue, obj db.Entity) []db.Entity {
+	entities := []db.Entity{}
+
+	for _, kv := range kvs {
+		if strings.HasSuffix(string(kv.Key), "/") {
+			continue
+		}
+
+		copy := obj.Copy()
+
+		if err := jsonio.Read(copy, kv.Value); err != nil {
+			// This is kept this way so a buggy policy won't break listing all of them
+			logrus.Errorf("Received error retrieving value at path %q during list: %v", kv.Key, err)
+			continue
+		}
+
+		if err := copy.SetKey(c.trimPath(string(kv.Key))); err != nil {
+			logrus.Error(err)
+			continue
+		}
+
+		// same here. fire hooks to retrieve the full entity. only log but don't append on error.
+		if copy.Hooks().PostGet != nil {
+			if err := copy.Hooks().PostGet(c, copy); err != nil {
+				logrus.Errorf("Error received trying to run fetch hooks during %q list: %v", kv.Key, err)
+				continue
+			}
+		}
+
+		entities = append(entities, copy)
+	}
+
+	return entities
+}
+
+// List populates obj with the list of the db in the collection
+// corresponding to the entity.
+func (c *Client) List(obj db.Entity) ([]db.Entity, error) {
+	return c.ListPrefix("", obj)
+}
+
+// ListPrefix is used to list a subtree of an entity, such as listing volume by policy.
+func (c *Client) ListPrefix(prefix string, obj db.Entity) ([]db.Entity, error) {
+	// the trailing slash keeps "policy1" from matching "policy10".
+	kvs, _, err := c.kv.List(c.qualified(path.Join(obj.Prefix(), prefix)) + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	return c.traverse(kvs, obj), nil
+}
@@ -0,0 +1,262 @@
+package etcd3
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db/keysapi"
+	"github.com/coreos/etcd/client"
+)
+
+// NewKeysAPI returns an etcd v2 client.KeysAPI over the etcd v3 endpoints in
+// hosts, so config.Client and the daemons built on it run on etcd v3. The
+// keys are the same as those of the etcd v2 keyspace, and of Client.
+//
+// The keys API is a keysapi.Transactor and a keysapi.Leaser: config.Client
+// publishes policies in a transaction, and the lock package holds use locks
+// with leases. Keys written with a TTL are attached to a lease of their own.
+func NewKeysAPI(hosts []string) (client.KeysAPI, error) {
+	kv := NewKV(hosts)
+
+	// make sure the cluster is reachable.
+	if _, _, err := kv.GetRevision("/"); err != nil {
+		return nil, errored.New("Initial setup").Combine(err)
+	}
+
+	return keysapi.New(&keyStore{kv: kv}), nil
+}
+
+// keyStore is the keysapi.TxnStore of etcd v3. Store keys are etcd keys
+// without their leading slash, and the index of the store is its revision.
+type keyStore struct {
+	kv *KV
+}
+
+func etcdKey(key string) []byte {
+	return []byte("/" + key)
+}
+
+func storePair(kv *KeyValue) *keysapi.Pair {
+	if kv == nil {
+		return nil
+	}
+
+	return &keysapi.Pair{
+		Key:         strings.TrimPrefix(string(kv.Key), "/"),
+		Value:       string(kv.Value),
+		CreateIndex: uint64(kv.CreateRevision),
+		ModifyIndex: uint64(kv.ModRevision),
+	}
+}
+
+// compare returns the comparison for the condition of a write, or nil if it
+// has none.
+func compare(key []byte, index uint64) *Compare {
+	switch index {
+	case keysapi.Unconditional:
+		return nil
+	case 0:
+		return &Compare{Result: "EQUAL", Target: "CREATE", Key: key}
+	default:
+		return &Compare{Result: "EQUAL", Target: "MOD", Key: key, ModRevision: int64(index)}
+	}
+}
+
+func (s *keyStore) Get(key string) (*keysapi.Pair, uint64, error) {
+	kv, revision, err := s.kv.GetRevision(string(etcdKey(key)))
+	return storePair(kv), uint64(revision), err
+}
+
+func (s *keyStore) List(prefix string) ([]*keysapi.Pair, uint64, error) {
+	kvs, revision, err := s.kv.List(string(etcdKey(prefix)))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pairs := []*keysapi.Pair{}
+	for _, kv := range kvs {
+		pairs = append(pairs, storePair(kv))
+	}
+
+	return pairs, uint64(revision), nil
+}
+
+func (s *keyStore) Put(key, value string, index uint64, ttl time.Duration) (*keysapi.Pair, uint64, error) {
+	var lease int64
+	if ttl > 0 {
+		var err error
+		if lease, err = s.kv.Grant(ttl); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	k := etcdKey(key)
+	txn := &TxnRequest{
+		Success: []*Op{
+			{Put: &PutRequest{Key: k, Value: []byte(value), Lease: lease}},
+			{Range: &RangeRequest{Key: k}},
+		},
+	}
+
+	if cmp := compare(k, index); cmp != nil {
+		txn.Compare = []*Compare{cmp}
+	}
+
+	resp, err := s.kv.txn(txn)
+	if err != nil || !resp.Succeeded {
+		s.revoke(lease)
+		if err != nil {
+			return nil, 0, err
+		}
+		return nil, uint64(resp.Header.Revision), nil
+	}
+
+	var pair *keysapi.Pair
+	if len(resp.Responses) == 2 && resp.Responses[1].Range != nil && len(resp.Responses[1].Range.KVs) > 0 {
+		pair = storePair(resp.Responses[1].Range.KVs[0])
+	}
+
+	return pair, uint64(resp.Header.Revision), nil
+}
+
+func (s *keyStore) revoke(lease int64) {
+	if lease == 0 {
+		return
+	}
+
+	if err := s.kv.Revoke(lease); err != nil {
+		logrus.Errorf("Could not revoke lease %d: %v", lease, err)
+	}
+}
+
+func (s *keyStore) Delete(key string, index uint64) (bool, uint64, error) {
+	k := etcdKey(key)
+	txn := &TxnRequest{Success: []*Op{{DeleteRange: &RangeRequest{Key: k}}}}
+
+	if cmp := compare(k, index); cmp != nil {
+		txn.Compare = []*Compare{cmp}
+	}
+
+	resp, err := s.kv.txn(txn)
+	if err != nil {
+		return false, 0, err
+	}
+
+	return resp.Succeeded, uint64(resp.Header.Revision), nil
+}
+
+func (s *keyStore) DeletePrefix(prefix string) (uint64, error) {
+	revision, err := s.kv.DeleteRevision(string(etcdKey(prefix)), true)
+	return uint64(revision), err
+}
+
+func (s *keyStore) Txn(ops []*keysapi.Op) (bool, error) {
+	txn := &TxnRequest{}
+
+	for _, op := range ops {
+		k := etcdKey(op.Key)
+		if cmp := compare(k, op.Index); cmp != nil {
+			txn.Compare = append(txn.Compare, cmp)
+		}
+		txn.Success = append(txn.Success, &Op{Put: &PutRequest{Key: k, Value: []byte(op.Value), Lease: op.Lease}})
+	}
+
+	return s.kv.Txn(txn)
+}
+
+func (s *keyStore) Grant(ttl time.Duration) (int64, error) {
+	return s.kv.Grant(ttl)
+}
+
+func (s *keyStore) KeepAlive(lease int64) error {
+	return s.kv.KeepAliveOnce(lease)
+}
+
+func (s *keyStore) Revoke(lease int64) error {
+	return s.kv.Revoke(lease)
+}
+
+func (s *keyStore) Watch(prefix string, index uint64) keysapi.StoreWatcher {
+	w := &keyWatcher{kv: s.kv, key: string(etcdKey(prefix)), revision: int64(index)}
+
+	// watch from now: the revision of the store when the watch is created.
+	if w.revision == 0 {
+		if _, revision, err := s.kv.GetRevision(w.key); err == nil {
+			w.revision = revision
+		}
+	}
+
+	return w
+}
+
+// keyWatcher reports the changes after revision, one etcd watch response at
+// a time, so the changes of a transaction are reported together.
+type keyWatcher struct {
+	kv       *KV
+	key      string
+	revision int64
+}
+
+func (w *keyWatcher) Next(cancel <-chan struct{}) ([]*keysapi.Change, error) {
+	stopChan := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-cancel:
+		case <-done:
+		}
+		close(stopChan)
+	}()
+
+	start := w.revision + 1
+	if w.revision == 0 {
+		start = 0
+	}
+
+	batches, errChan := w.kv.WatchBatches(w.key, true, start, stopChan)
+
+	select {
+	case batch, ok := <-batches:
+		if !ok {
+			break
+		}
+
+		changes := []*keysapi.Change{}
+		for _, event := range batch {
+			change := &keysapi.Change{
+				Key:   strings.TrimPrefix(string(event.KV.Key), "/"),
+				Prev:  storePair(event.PrevKV),
+				Index: uint64(event.KV.ModRevision),
+			}
+
+			if event.Type != "DELETE" {
+				change.Pair = storePair(event.KV)
+			}
+
+			w.revision = int64(event.KV.ModRevision)
+			changes = append(changes, change)
+		}
+
+		return changes, nil
+	case <-cancel:
+		return nil, errored.Errorf("etcd watch on %q canceled", w.key)
+	}
+
+	err := <-errChan
+	if compacted, ok := err.(*CompactedError); ok {
+		// the changes before the compaction are gone; carry on from there,
+		// like etcd v2 watchers which fell out of the event history.
+		logrus.Warnf("Watch of %q missed changes: %v", w.key, err)
+		w.revision = compacted.Revision - 1
+	}
+
+	if err == nil {
+		err = errored.Errorf("etcd watch on %q: connection closed", w.key)
+	}
+
+	return nil, err
+}
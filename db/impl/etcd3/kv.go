@@ -0,0 +1,476 @@
+package etcd3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+)
+
+// The etcd v3 Go client needs grpc, which is not vendored. etcd serves the
+// same API as JSON through its gRPC gateway, so KV implements the parts of it
+// we need over plain HTTP. Keys and values are base64 encoded in the JSON,
+// which encoding/json does for []byte; 64-bit integers are encoded as strings.
+
+// gatewayPath is the path prefix of the gRPC gateway (etcd 3.4 and later).
+const gatewayPath = "/v3"
+
+// Int64 is an int64 which decodes from both JSON numbers and strings.
+type Int64 int64
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (i *Int64) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		*i = 0
+		return nil
+	}
+
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	*i = Int64(v)
+	return nil
+}
+
+// KeyValue is a key in etcd's key/value store.
+type KeyValue struct {
+	Key            []byte `json:"key"`
+	Value          []byte `json:"value"`
+	CreateRevision Int64  `json:"create_revision"`
+	ModRevision    Int64  `json:"mod_revision"`
+	Lease          Int64  `json:"lease"`
+}
+
+// Event is a change reported by a watch.
+type Event struct {
+	// Type is "DELETE" for deletions and empty for puts.
+	Type string    `json:"type"`
+	KV   *KeyValue `json:"kv"`
+	// PrevKV is the key before the change, if it existed.
+	PrevKV *KeyValue `json:"prev_kv"`
+}
+
+// Compare is a condition of a transaction. Target is one of "CREATE", "MOD",
+// "VALUE" or "VERSION"; Result is one of "EQUAL", "NOT_EQUAL", "GREATER" or
+// "LESS". Only the field matching Target is compared.
+type Compare struct {
+	Result         string `json:"result"`
+	Target         string `json:"target"`
+	Key            []byte `json:"key"`
+	CreateRevision int64  `json:"create_revision,omitempty"`
+	ModRevision    int64  `json:"mod_revision,omitempty"`
+	Value          []byte `json:"value,omitempty"`
+}
+
+// Op is an operation in a transaction. Exactly one field must be set.
+type Op struct {
+	Put         *PutRequest   `json:"request_put,omitempty"`
+	DeleteRange *RangeRequest `json:"request_delete_range,omitempty"`
+	Range       *RangeRequest `json:"request_range,omitempty"`
+	Txn         *TxnRequest   `json:"request_txn,omitempty"`
+}
+
+// PutRequest writes a key, optionally attached to a lease.
+type PutRequest struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+	Lease int64  `json:"lease,omitempty"`
+}
+
+// RangeRequest selects a key, or the keys from Key to RangeEnd.
+type RangeRequest struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+}
+
+// TxnRequest is an atomic transaction: if all Compares hold, Success is run,
+// otherwise Failure is.
+type TxnRequest struct {
+	Compare []*Compare `json:"compare,omitempty"`
+	Success []*Op      `json:"success,omitempty"`
+	Failure []*Op      `json:"failure,omitempty"`
+}
+
+type header struct {
+	Revision Int64 `json:"revision"`
+}
+
+type rangeResponse struct {
+	Header header      `json:"header"`
+	KVs    []*KeyValue `json:"kvs"`
+}
+
+type txnResponse struct {
+	Header    header `json:"header"`
+	Succeeded bool   `json:"succeeded"`
+	Responses []struct {
+		Range *rangeResponse `json:"response_range"`
+	} `json:"responses"`
+}
+
+type leaseResponse struct {
+	ID  Int64 `json:"ID"`
+	TTL Int64 `json:"TTL"`
+}
+
+type watchResponse struct {
+	Result struct {
+		Header   header   `json:"header"`
+		Created  bool     `json:"created"`
+		Canceled bool     `json:"canceled"`
+		Events   []*Event `json:"events"`
+		// CompactRevision is set when the watch was canceled because its
+		// start revision was compacted.
+		CompactRevision Int64 `json:"compact_revision"`
+	} `json:"result"`
+	Error *gatewayError `json:"error"`
+}
+
+type gatewayError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+// KV is a client for etcd's v3 key/value and lease API.
+type KV struct {
+	hosts  []string
+	client *http.Client
+}
+
+// NewKV returns a KV talking to the etcd endpoints in hosts.
+func NewKV(hosts []string) *KV {
+	trimmed := []string{}
+	for _, host := range hosts {
+		trimmed = append(trimmed, strings.TrimRight(host, "/"))
+	}
+
+	return &KV{hosts: trimmed, client: &http.Client{}}
+}
+
+// PrefixEnd returns the end of the range of keys prefixed with prefix.
+func PrefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+
+	// everything is 0xff; range to the end of the keyspace.
+	return []byte{0}
+}
+
+// post sends a request to the first host that answers.
+func (kv *KV) post(path string, body interface{}, cancel <-chan struct{}, timeout time.Duration) (*http.Response, error) {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+
+	for _, host := range kv.hosts {
+		req, err := http.NewRequest("POST", host+gatewayPath+path, bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		req.Cancel = cancel
+		req.Header.Set("Content-Type", "application/json")
+
+		client := kv.client
+		if timeout > 0 {
+			client = &http.Client{Timeout: timeout}
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			content, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			gwErr := &gatewayError{}
+			if json.Unmarshal(content, gwErr) != nil || gwErr.Message == "" {
+				gwErr.Message = strings.TrimSpace(string(content))
+			}
+			return nil, errored.Errorf("etcd %s: status %d: %s", path, resp.StatusCode, gwErr.Message)
+		}
+
+		return resp, nil
+	}
+
+	return nil, errored.Errorf("etcd %s: no host could be reached", path).Combine(lastErr)
+}
+
+func (kv *KV) call(path string, body interface{}, result interface{}) error {
+	resp, err := kv.post(path, body, nil, time.Minute)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if result == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return errored.Errorf("etcd %s: could not decode response", path).Combine(err)
+	}
+
+	return nil
+}
+
+// Get fetches a single key. errors.NotExists is returned if it is missing.
+func (kv *KV) Get(key string) (*KeyValue, error) {
+	value, _, err := kv.GetRevision(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if value == nil {
+		return nil, errors.NotExists
+	}
+
+	return value, nil
+}
+
+// GetRevision fetches a single key, or nil if it is missing, and the
+// revision of the store at the time.
+func (kv *KV) GetRevision(key string) (*KeyValue, int64, error) {
+	resp := &rangeResponse{}
+	if err := kv.call("/kv/range", &RangeRequest{Key: []byte(key)}, resp); err != nil {
+		return nil, 0, err
+	}
+
+	if len(resp.KVs) == 0 {
+		return nil, int64(resp.Header.Revision), nil
+	}
+
+	return resp.KVs[0], int64(resp.Header.Revision), nil
+}
+
+// List fetches all the keys starting with prefix, sorted by key, and the
+// revision of the store at the time.
+func (kv *KV) List(prefix string) ([]*KeyValue, int64, error) {
+	resp := &rangeResponse{}
+	if err := kv.call("/kv/range", &RangeRequest{Key: []byte(prefix), RangeEnd: PrefixEnd([]byte(prefix))}, resp); err != nil {
+		return nil, 0, err
+	}
+
+	return resp.KVs, int64(resp.Header.Revision), nil
+}
+
+// Put writes the key unconditionally. lease may be 0.
+func (kv *KV) Put(key string, value []byte, lease int64) error {
+	return kv.call("/kv/put", &PutRequest{Key: []byte(key), Value: value, Lease: lease}, nil)
+}
+
+// Delete removes the key, or every key starting with it if prefix is true.
+// Missing keys are not an error.
+func (kv *KV) Delete(key string, prefix bool) error {
+	_, err := kv.DeleteRevision(key, prefix)
+	return err
+}
+
+// DeleteRevision is Delete, returning the revision of the store after the
+// deletion.
+func (kv *KV) DeleteRevision(key string, prefix bool) (int64, error) {
+	req := &RangeRequest{Key: []byte(key)}
+	if prefix {
+		req.RangeEnd = PrefixEnd(req.Key)
+	}
+
+	resp := &rangeResponse{}
+	if err := kv.call("/kv/deleterange", req, resp); err != nil {
+		return 0, err
+	}
+
+	return int64(resp.Header.Revision), nil
+}
+
+// Txn runs a transaction and reports whether its comparisons held.
+func (kv *KV) Txn(txn *TxnRequest) (bool, error) {
+	resp, err := kv.txn(txn)
+	if err != nil {
+		return false, err
+	}
+
+	return resp.Succeeded, nil
+}
+
+// txn runs a transaction and returns the response, which holds the results
+// of the range operations that ran.
+func (kv *KV) txn(txn *TxnRequest) (*txnResponse, error) {
+	resp := &txnResponse{}
+	if err := kv.call("/kv/txn", txn, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Grant creates a lease which expires after ttl unless kept alive.
+func (kv *KV) Grant(ttl time.Duration) (int64, error) {
+	seconds := int64(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	resp := &leaseResponse{}
+	if err := kv.call("/lease/grant", map[string]int64{"TTL": seconds}, resp); err != nil {
+		return 0, err
+	}
+
+	return int64(resp.ID), nil
+}
+
+// KeepAliveOnce renews a lease. errors.NotExists is returned if the lease
+// already expired.
+func (kv *KV) KeepAliveOnce(id int64) error {
+	resp := &struct {
+		Result leaseResponse `json:"result"`
+	}{}
+
+	if err := kv.call("/lease/keepalive", map[string]int64{"ID": id}, resp); err != nil {
+		return err
+	}
+
+	if resp.Result.TTL <= 0 {
+		return errors.NotExists
+	}
+
+	return nil
+}
+
+// Revoke revokes a lease, deleting every key attached to it.
+func (kv *KV) Revoke(id int64) error {
+	return kv.call("/lease/revoke", map[string]int64{"ID": id}, nil)
+}
+
+// CompactedError is sent by watches whose start revision was compacted. The
+// watch may be resumed from Revision, missing the changes before it.
+type CompactedError struct {
+	Revision int64
+}
+
+func (e *CompactedError) Error() string {
+	return fmt.Sprintf("etcd watch: revision compacted; the oldest revision left is %d", e.Revision)
+}
+
+// Watch streams the events for key, or for every key starting with it if
+// prefix is true, from revision startRevision on (0 means from now). The
+// watch runs until cancel is closed or the connection breaks, in which case
+// an error is sent and both channels are closed; watches are resumed by
+// passing the revision after the last event seen.
+func (kv *KV) Watch(key string, prefix bool, startRevision int64, cancel <-chan struct{}) (chan *Event, chan error) {
+	eventChan := make(chan *Event)
+	batches, errChan := kv.WatchBatches(key, prefix, startRevision, cancel)
+
+	go func() {
+		defer close(eventChan)
+
+		for batch := range batches {
+			for _, event := range batch {
+				select {
+				case eventChan <- event:
+				case <-cancel:
+					return
+				}
+			}
+		}
+	}()
+
+	return eventChan, errChan
+}
+
+// WatchBatches is Watch, sending the events in the batches etcd reports them
+// in: all the changes of a revision, such as those of a transaction, are in
+// the same batch. The events carry the previous value of the keys.
+func (kv *KV) WatchBatches(key string, prefix bool, startRevision int64, cancel <-chan struct{}) (chan []*Event, chan error) {
+	batchChan := make(chan []*Event)
+	errChan := make(chan error, 1)
+
+	req := map[string]interface{}{"key": []byte(key), "prev_kv": true}
+	if prefix {
+		req["range_end"] = PrefixEnd([]byte(key))
+	}
+	if startRevision > 0 {
+		req["start_revision"] = startRevision
+	}
+
+	go func() {
+		defer close(batchChan)
+		defer close(errChan)
+
+		resp, err := kv.post("/watch", map[string]interface{}{"create_request": req}, cancel, 0)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+		for scanner.Scan() {
+			wr := &watchResponse{}
+			if err := json.Unmarshal(scanner.Bytes(), wr); err != nil {
+				errChan <- errored.Errorf("etcd watch: could not decode response").Combine(err)
+				return
+			}
+
+			if wr.Error != nil {
+				errChan <- errored.Errorf("etcd watch: %s", wr.Error.Message)
+				return
+			}
+
+			if wr.Result.Canceled {
+				if wr.Result.CompactRevision > 0 {
+					errChan <- &CompactedError{Revision: int64(wr.Result.CompactRevision)}
+					return
+				}
+
+				errChan <- errored.Errorf("etcd watch on %q canceled by the server", key)
+				return
+			}
+
+			if len(wr.Result.Events) == 0 {
+				continue
+			}
+
+			select {
+			case batchChan <- wr.Result.Events:
+			case <-cancel:
+				return
+			}
+		}
+
+		select {
+		case <-cancel:
+		default:
+			if err := scanner.Err(); err != nil {
+				errChan <- err
+			} else {
+				errChan <- errored.Errorf("etcd watch on %q: connection closed", key)
+			}
+		}
+	}()
+
+	return batchChan, errChan
+}
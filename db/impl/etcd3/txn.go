@@ -0,0 +1,140 @@
+package etcd3
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db"
+	"github.com/contiv/volplugin/errors"
+)
+
+// These paths match the ones used by config.Client, so the keyspace stays the
+// same whichever client writes it.
+const (
+	rootPolicyArchive = "policy-archives"
+	rootUse           = "users"
+)
+
+// PublishPolicy writes the policy and its revision entry in the policy
+// archive in a single transaction, so a policy is never published without
+// its revision being recorded, or the other way around.
+func (c *Client) PublishPolicy(policy *db.Policy) error {
+	op, err := c.putOp(policy)
+	if err != nil {
+		return err
+	}
+
+	revision := c.qualified(strings.Join([]string{rootPolicyArchive, policy.Name, fmt.Sprint(time.Now().Unix())}, "/"))
+	archive := &Op{Put: &PutRequest{Key: []byte(revision), Value: op.Put.Value}}
+
+	if _, err := c.kv.Txn(&TxnRequest{Success: []*Op{archive, op}}); err != nil {
+		return err
+	}
+
+	if policy.Hooks().PostSet != nil {
+		return policy.Hooks().PostSet(c, policy)
+	}
+
+	return nil
+}
+
+// Lease is a set of use locks held together. The locks are attached to an
+// etcd lease: they disappear all at once when the lease is released, or when
+// it is not kept alive within its TTL, for example because the holder died.
+type Lease struct {
+	ID  int64
+	TTL time.Duration
+
+	client   *Client
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+func (c *Client) use(ut db.UseLocker) string {
+	return c.qualified(strings.Join([]string{rootUse, ut.Type(), ut.GetVolume()}, "/"))
+}
+
+// AcquireUses acquires all the use locks in a single transaction; if any of
+// them is held by someone else, none are acquired and errors.LockFailed is
+// returned. Uses for which MayExist is true may already be held with the
+// same content, in which case they are taken over.
+//
+// Unlike the TTL refresh of the etcd v2 locks, which rewrites every lock key
+// periodically, only the lease needs refreshing: see KeepAlive.
+func (c *Client) AcquireUses(ttl time.Duration, uses ...db.UseLocker) (*Lease, error) {
+	id, err := c.kv.Grant(ttl)
+	if err != nil {
+		return nil, errors.LockFailed.Combine(err)
+	}
+
+	txn := &TxnRequest{}
+
+	for _, ut := range uses {
+		content, err := json.Marshal(ut)
+		if err != nil {
+			c.kv.Revoke(id)
+			return nil, err
+		}
+
+		key := []byte(c.use(ut))
+		compare := &Compare{Result: "EQUAL", Target: "CREATE", Key: key}
+
+		if ut.MayExist() {
+			if existing, err := c.kv.Get(string(key)); err == nil && string(existing.Value) == string(content) {
+				compare = &Compare{Result: "EQUAL", Target: "MOD", Key: key, ModRevision: int64(existing.ModRevision)}
+			}
+		}
+
+		txn.Compare = append(txn.Compare, compare)
+		txn.Success = append(txn.Success, &Op{Put: &PutRequest{Key: key, Value: content, Lease: id}})
+	}
+
+	ok, err := c.kv.Txn(txn)
+	if err != nil || !ok {
+		if err := c.kv.Revoke(id); err != nil {
+			logrus.Errorf("Could not revoke lease %d: %v", id, err)
+		}
+
+		if err != nil {
+			return nil, errors.LockFailed.Combine(err)
+		}
+
+		return nil, errors.LockFailed
+	}
+
+	return &Lease{ID: id, TTL: ttl, client: c, stopChan: make(chan struct{})}, nil
+}
+
+// KeepAlive renews the lease every third of its TTL until Release is called.
+// If the lease is lost, the error is sent on the returned channel and the
+// renewal stops.
+func (l *Lease) KeepAlive() chan error {
+	errChan := make(chan error, 1)
+
+	go func() {
+		for {
+			select {
+			case <-l.stopChan:
+				return
+			case <-time.After(l.TTL / 3):
+				if err := l.client.kv.KeepAliveOnce(l.ID); err != nil {
+					errChan <- errored.Errorf("Lost lease %d", l.ID).Combine(err)
+					return
+				}
+			}
+		}
+	}()
+
+	return errChan
+}
+
+// Release stops renewing the lease and revokes it, releasing all its locks.
+func (l *Lease) Release() error {
+	l.stopOnce.Do(func() { close(l.stopChan) })
+	return l.client.kv.Revoke(l.ID)
+}
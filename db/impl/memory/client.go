@@ -0,0 +1,398 @@
+// Package memory implements db.Client in memory, optionally persisted to a
+// file. It is used to test code built on db.Client without a running etcd.
+// Through KeysAPI, code built on the etcd keys API, like config.Client and
+// the lock and apiserver packages, runs on it too, within a single process.
+// The daemons run in separate processes and cannot share it; they need etcd
+// or consul.
+package memory
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db"
+	"github.com/contiv/volplugin/db/impl/dump"
+	"github.com/contiv/volplugin/db/jsonio"
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+)
+
+// Client implements the db.Client interface.
+type Client struct {
+	prefix string
+	file   string
+
+	mutex sync.Mutex
+	data  map[string]string
+
+	watchers     map[string]*watcher
+	watcherMutex sync.Mutex
+
+	// index, meta, dirs, events and changed back the etcd keys API; see
+	// keys.go. They are guarded by mutex.
+	index   uint64
+	meta    map[string]*keyMeta
+	dirs    map[string]*keyMeta
+	events  []*client.Response
+	changed chan struct{}
+}
+
+// NewClient creates a new, empty Client.
+func NewClient(prefix string) *Client {
+	return &Client{
+		prefix:   prefix,
+		data:     map[string]string{},
+		watchers: map[string]*watcher{},
+		meta:     map[string]*keyMeta{},
+		dirs:     map[string]*keyMeta{},
+		changed:  make(chan struct{}),
+	}
+}
+
+// NewPersistentClient creates a new Client persisted to file. The contents
+// of the file are loaded if it exists, and it is rewritten after every
+// change.
+func NewPersistentClient(prefix, file string) (*Client, error) {
+	c := NewClient(prefix)
+	c.file = file
+
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, c.persist()
+	} else if err != nil {
+		return nil, errored.Errorf("Could not read database file %q", file).Combine(err)
+	}
+
+	if err := json.Unmarshal(content, &c.data); err != nil {
+		return nil, errored.Errorf("Could not parse database file %q", file).Combine(err)
+	}
+
+	return c, nil
+}
+
+// persist writes the data to the file, if there is one. The data is written
+// to a temporary file which is then renamed, so a crash never leaves a
+// truncated database behind. Keys with a TTL are left out; they would have
+// expired by the time the file is loaded again. Must be called with the
+// mutex held.
+func (c *Client) persist() error {
+	if c.file == "" {
+		return nil
+	}
+
+	data := map[string]string{}
+	for key, value := range c.data {
+		if c.metaOf(key).expires.IsZero() {
+			data[key] = value
+		}
+	}
+
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(c.file), filepath.Base(c.file)+".")
+	if err != nil {
+		return errored.Errorf("Could not persist database to %q", c.file).Combine(err)
+	}
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return errored.Errorf("Could not persist database to %q", c.file).Combine(err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return errored.Errorf("Could not persist database to %q", c.file).Combine(err)
+	}
+
+	return os.Rename(tmp.Name(), c.file)
+}
+
+func (c *Client) qualified(path string) string {
+	return strings.Join([]string{strings.Trim(c.prefix, "/"), path}, "/")
+}
+
+// Get retrieves the item from memory and then populates obj with its data.
+func (c *Client) Get(obj db.Entity) error {
+	if obj.Hooks().PreGet != nil {
+		if err := obj.Hooks().PreGet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	value, ok := c.data[c.qualified(path)]
+	c.mutex.Unlock()
+
+	if !ok {
+		return errors.NotExists
+	}
+
+	if err := jsonio.Read(obj, []byte(value)); err != nil {
+		return err
+	}
+
+	if err := obj.SetKey(c.trimPath(c.qualified(path))); err != nil {
+		return err
+	}
+
+	if obj.Hooks().PostGet != nil {
+		if err := obj.Hooks().PostGet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	return obj.Validate()
+}
+
+// Set takes the object and commits it to memory.
+func (c *Client) Set(obj db.Entity) error {
+	if err := obj.Validate(); err != nil {
+		return err
+	}
+
+	if obj.Hooks().PreSet != nil {
+		if err := obj.Hooks().PreSet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	content, err := jsonio.Write(obj)
+	if err != nil {
+		return err
+	}
+
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	if err := c.put(c.qualified(path), string(content)); err != nil {
+		return err
+	}
+
+	if obj.Hooks().PostSet != nil {
+		if err := obj.Hooks().PostSet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// put writes the value at key, persists it and notifies the watchers.
+func (c *Client) put(key, value string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.expire()
+
+	var prev *client.Node
+	old, existed := c.data[key]
+	if existed {
+		prev = c.fileNode(key)
+	}
+
+	c.data[key] = value
+	if err := c.persist(); err != nil {
+		if existed {
+			c.data[key] = old
+		} else {
+			delete(c.data, key)
+		}
+		return err
+	}
+
+	c.index++
+	meta := &keyMeta{created: c.index, modified: c.index}
+	if existed {
+		meta.created = prev.CreatedIndex
+	}
+	c.meta[key] = meta
+	c.record("set", c.fileNode(key), prev)
+
+	c.notify(key, value)
+	return nil
+}
+
+// Delete removes the object from memory.
+func (c *Client) Delete(obj db.Entity) error {
+	if obj.Hooks().PreDelete != nil {
+		if err := obj.Hooks().PreDelete(c, obj); err != nil {
+			return err
+		}
+	}
+
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	key := c.qualified(path)
+
+	c.mutex.Lock()
+	c.expire()
+
+	old, ok := c.data[key]
+	if !ok {
+		c.mutex.Unlock()
+		return errors.NotExists
+	}
+
+	prev := c.fileNode(key)
+	delete(c.data, key)
+	if err := c.persist(); err != nil {
+		c.data[key] = old
+		c.mutex.Unlock()
+		return err
+	}
+
+	delete(c.meta, key)
+	c.index++
+	c.record("delete", &client.Node{Key: prev.Key, CreatedIndex: prev.CreatedIndex, ModifiedIndex: c.index}, prev)
+	c.mutex.Unlock()
+
+	if obj.Hooks().PostDelete != nil {
+		if err := obj.Hooks().PostDelete(c, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Prefix returns a copy of the string used to make the database prefix.
+func (c *Client) Prefix() string {
+	return c.prefix
+}
+
+func (c *Client) trimPath(key string) string {
+	return strings.Trim(strings.TrimPrefix(strings.Trim(key, "/"), strings.Trim(c.Prefix(), "/")), "/")
+}
+
+// traverse converts the keys into entities.
+//
+// traverse will log & skip errors to ensure bad data will not break this routine.
+func (c *Client) traverse(keys []string, values map[string]string, obj db.Entity) []db.Entity {
+	entities := []db.Entity{}
+
+	for _, key := range keys {
+		copy := obj.Copy()
+
+		if err := jsonio.Read(copy, []byte(values[key])); err != nil {
+			// This is kept this way so a buggy policy won't break listing all of them
+			logrus.Errorf("Received error retrieving value at path %q during list: %v", key, err)
+			continue
+		}
+
+		if err := copy.SetKey(c.trimPath(key)); err != nil {
+			logrus.Error(err)
+			continue
+		}
+
+		// same here. fire hooks to retrieve the full entity. only log but don't append on error.
+		if copy.Hooks().PostGet != nil {
+			if err := copy.Hooks().PostGet(c, copy); err != nil {
+				logrus.Errorf("Error received trying to run fetch hooks during %q list: %v", key, err)
+				continue
+			}
+		}
+
+		entities = append(entities, copy)
+	}
+
+	return entities
+}
+
+// List populates obj with the list of the db in the collection
+// corresponding to the entity.
+func (c *Client) List(obj db.Entity) ([]db.Entity, error) {
+	return c.ListPrefix("", obj)
+}
+
+// ListPrefix is used to list a subtree of an entity, such as listing volume by policy.
+func (c *Client) ListPrefix(prefix string, obj db.Entity) ([]db.Entity, error) {
+	// the trailing slash keeps "policy1" from matching "policy10".
+	dir := c.qualified(path.Join(obj.Prefix(), prefix)) + "/"
+
+	keys := []string{}
+	values := map[string]string{}
+
+	c.mutex.Lock()
+	for key, value := range c.data {
+		if strings.HasPrefix(key, dir) {
+			keys = append(keys, key)
+			values[key] = value
+		}
+	}
+	c.mutex.Unlock()
+
+	sort.Strings(keys)
+
+	return c.traverse(keys, values, obj), nil
+}
+
+// Dump yields a database dump of the keyspace we manage. It will be contained
+// in a tarball based on the timestamp of the dump. If a dir is provided, it
+// will be placed under that directory.
+func (c *Client) Dump(dir string) (string, error) {
+	c.mutex.Lock()
+	pairs := []dump.Pair{}
+	for key, value := range c.data {
+		pairs = append(pairs, dump.Pair{Key: key, Value: []byte(value)})
+	}
+	c.mutex.Unlock()
+
+	sort.Sort(pairsByKey(pairs))
+
+	return dump.Tarball(dir, "memory", pairs)
+}
+
+// Restore loads a tarball made by Dump, or by any other client, back into
+// memory, following opts.
+func (c *Client) Restore(tarball string, opts db.RestoreOptions) (*db.RestoreResult, error) {
+	source := opts.SourcePrefix
+	if source == "" {
+		source = c.prefix
+	}
+
+	return dump.Restore(restoreStore{c}, tarball, source, opts)
+}
+
+type restoreStore struct {
+	*Client
+}
+
+func (r restoreStore) Exists(key string) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	_, ok := r.data[r.qualified(key)]
+	return ok, nil
+}
+
+func (r restoreStore) Put(key string, value []byte) error {
+	return r.put(r.qualified(key), string(value))
+}
+
+type pairsByKey []dump.Pair
+
+func (p pairsByKey) Len() int           { return len(p) }
+func (p pairsByKey) Less(i, j int) bool { return p[i].Key < p[j].Key }
+func (p pairsByKey) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
@@ -0,0 +1,537 @@
+package memory
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/coreos/etcd/client"
+)
+
+// historySize is how many changes are kept for watchers which start at an
+// earlier index, like etcd's event history.
+const historySize = 1000
+
+// keyMeta is what etcd keeps about a key besides its value.
+type keyMeta struct {
+	created  uint64
+	modified uint64
+	// expires is when the key expires; zero if it has no TTL.
+	expires time.Time
+}
+
+// KeysAPI returns an etcd v2 client.KeysAPI over the data of the client, so
+// code written against etcd, such as config.Client and everything built on
+// it, runs in memory too. Keys written with a TTL expire like in etcd and are
+// not persisted.
+func (c *Client) KeysAPI() client.KeysAPI {
+	return &keysAPI{c}
+}
+
+type keysAPI struct {
+	c *Client
+}
+
+// normalize turns an etcd key into a key of the data.
+func normalize(key string) string {
+	return strings.Trim(path.Clean("/"+key), "/")
+}
+
+func keyError(code int, message, key string, index uint64) error {
+	return client.Error{Code: code, Message: message, Cause: "/" + key, Index: index}
+}
+
+// record appends a change to the history and wakes the watchers up. Must be
+// called with the mutex held, after incrementing the index.
+func (c *Client) record(action string, node, prevNode *client.Node) {
+	c.events = append(c.events, &client.Response{Action: action, Node: node, PrevNode: prevNode, Index: c.index})
+	if len(c.events) > historySize {
+		c.events = c.events[len(c.events)-historySize:]
+	}
+
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// metaOf returns the metadata of the key. Keys loaded from a file have none
+// until they are written. Must be called with the mutex held.
+func (c *Client) metaOf(key string) *keyMeta {
+	if meta, ok := c.meta[key]; ok {
+		return meta
+	}
+
+	return &keyMeta{}
+}
+
+// fileNode returns the node of the key, which must hold a value. Must be
+// called with the mutex held.
+func (c *Client) fileNode(key string) *client.Node {
+	node := &client.Node{Key: "/" + key, Value: c.data[key]}
+
+	meta := c.metaOf(key)
+	node.CreatedIndex = meta.created
+	node.ModifiedIndex = meta.modified
+
+	if !meta.expires.IsZero() {
+		expires := meta.expires
+		node.Expiration = &expires
+		node.TTL = int64(expires.Sub(time.Now())/time.Second) + 1
+	}
+
+	return node
+}
+
+// children returns the keys of the values and directories directly under
+// the directory. Must be called with the mutex held.
+func (c *Client) children(dir string) (files []string, dirs []string) {
+	prefix := dir + "/"
+	if dir == "" {
+		prefix = ""
+	}
+
+	seen := map[string]bool{}
+	add := func(key string) {
+		rest := strings.TrimPrefix(key, prefix)
+		if i := strings.Index(rest, "/"); i >= 0 {
+			child := prefix + rest[:i]
+			if !seen[child] {
+				seen[child] = true
+				dirs = append(dirs, child)
+			}
+			return
+		}
+
+		files = append(files, key)
+	}
+
+	for key := range c.data {
+		if strings.HasPrefix(key, prefix) {
+			add(key)
+		}
+	}
+
+	for key := range c.dirs {
+		if key != dir && strings.HasPrefix(key, prefix) {
+			add(key + "/")
+		}
+	}
+
+	sort.Strings(files)
+	sort.Strings(dirs)
+	return files, dirs
+}
+
+// isDir returns whether the key is a directory: the root, one created
+// explicitly or one holding values. Must be called with the mutex held.
+func (c *Client) isDir(key string) bool {
+	if key == "" {
+		return true
+	}
+
+	if _, ok := c.dirs[key]; ok {
+		return true
+	}
+
+	for k := range c.data {
+		if strings.HasPrefix(k, key+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dirNode returns the node of the directory, listing its children, and
+// theirs if recursive. Must be called with the mutex held.
+func (c *Client) dirNode(key string, recursive, list bool) *client.Node {
+	node := &client.Node{Key: "/" + key, Dir: true}
+	if meta, ok := c.dirs[key]; ok {
+		node.CreatedIndex = meta.created
+		node.ModifiedIndex = meta.modified
+	}
+
+	if !list {
+		return node
+	}
+
+	files, dirs := c.children(key)
+	for _, dir := range dirs {
+		node.Nodes = append(node.Nodes, c.dirNode(dir, recursive, recursive))
+	}
+
+	for _, file := range files {
+		node.Nodes = append(node.Nodes, c.fileNode(file))
+	}
+
+	sort.Sort(nodesByKey(node.Nodes))
+	return node
+}
+
+// expire removes the keys whose TTL passed. Must be called with the mutex
+// held.
+func (c *Client) expire() {
+	now := time.Now()
+	expired := []string{}
+
+	for key, meta := range c.meta {
+		if !meta.expires.IsZero() && !now.Before(meta.expires) {
+			expired = append(expired, key)
+		}
+	}
+
+	sort.Strings(expired)
+
+	for _, key := range expired {
+		prev := c.fileNode(key)
+		delete(c.data, key)
+		delete(c.meta, key)
+
+		c.index++
+		c.record("expire", &client.Node{Key: prev.Key, CreatedIndex: prev.CreatedIndex, ModifiedIndex: c.index}, prev)
+	}
+}
+
+// scheduleExpiry expires the key once its TTL passes, so watchers hear about
+// it without anyone reading the key.
+func (c *Client) scheduleExpiry(ttl time.Duration) {
+	time.AfterFunc(ttl, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.expire()
+	})
+}
+
+// backup returns a copy of the state the keys API changes, so a change which
+// cannot be persisted can be undone. Must be called with the mutex held.
+func (c *Client) backup() func() {
+	if c.file == "" {
+		return func() {}
+	}
+
+	data := map[string]string{}
+	for key, value := range c.data {
+		data[key] = value
+	}
+
+	meta := map[string]*keyMeta{}
+	for key, m := range c.meta {
+		meta[key] = m
+	}
+
+	return func() {
+		c.data = data
+		c.meta = meta
+	}
+}
+
+func (k *keysAPI) Get(ctx context.Context, key string, opts *client.GetOptions) (*client.Response, error) {
+	if opts == nil {
+		opts = &client.GetOptions{}
+	}
+
+	c := k.c
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.expire()
+	key = normalize(key)
+
+	if _, ok := c.data[key]; ok {
+		return &client.Response{Action: "get", Node: c.fileNode(key), Index: c.index}, nil
+	}
+
+	if c.isDir(key) {
+		return &client.Response{Action: "get", Node: c.dirNode(key, opts.Recursive, true), Index: c.index}, nil
+	}
+
+	return nil, keyError(client.ErrorCodeKeyNotFound, "Key not found", key, c.index)
+}
+
+func (k *keysAPI) Set(ctx context.Context, key, value string, opts *client.SetOptions) (*client.Response, error) {
+	if opts == nil {
+		opts = &client.SetOptions{}
+	}
+
+	c := k.c
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.expire()
+	key = normalize(key)
+
+	if key == "" {
+		return nil, keyError(client.ErrorCodeRootROnly, "Root is read only", key, c.index)
+	}
+
+	_, exists := c.data[key]
+	isDir := !exists && c.isDir(key)
+
+	switch {
+	case isDir:
+		return nil, keyError(client.ErrorCodeNotFile, "Not a file", key, c.index)
+	case opts.PrevExist == client.PrevNoExist && exists:
+		return nil, keyError(client.ErrorCodeNodeExist, "Key already exists", key, c.index)
+	case opts.PrevExist == client.PrevExist && !exists:
+		return nil, keyError(client.ErrorCodeKeyNotFound, "Key not found", key, c.index)
+	case (opts.PrevValue != "" || opts.PrevIndex != 0) && !exists:
+		return nil, keyError(client.ErrorCodeKeyNotFound, "Key not found", key, c.index)
+	case opts.PrevValue != "" && c.data[key] != opts.PrevValue:
+		return nil, keyError(client.ErrorCodeTestFailed, "Compare failed", key, c.index)
+	case opts.PrevIndex != 0 && c.metaOf(key).modified != opts.PrevIndex:
+		return nil, keyError(client.ErrorCodeTestFailed, "Compare failed", key, c.index)
+	}
+
+	for dir := path.Dir("/" + key); dir != "/"; dir = path.Dir(dir) {
+		if _, ok := c.data[strings.Trim(dir, "/")]; ok {
+			return nil, keyError(client.ErrorCodeNotDir, "Not a directory", strings.Trim(dir, "/"), c.index)
+		}
+	}
+
+	action := "set"
+	switch {
+	case opts.PrevValue != "" || opts.PrevIndex != 0:
+		action = "compareAndSwap"
+	case opts.PrevExist == client.PrevNoExist:
+		action = "create"
+	case opts.PrevExist == client.PrevExist:
+		action = "update"
+	}
+
+	if opts.Dir {
+		if exists {
+			return nil, keyError(client.ErrorCodeNotDir, "Not a directory", key, c.index)
+		}
+
+		c.index++
+		c.dirs[key] = &keyMeta{created: c.index, modified: c.index}
+		node := c.dirNode(key, false, false)
+		c.record(action, node, nil)
+		return &client.Response{Action: action, Node: node, Index: c.index}, nil
+	}
+
+	var prev *client.Node
+	if exists {
+		prev = c.fileNode(key)
+	}
+
+	restore := c.backup()
+
+	c.index++
+	meta := &keyMeta{created: c.index, modified: c.index}
+	if exists {
+		meta.created = c.metaOf(key).created
+	}
+
+	if opts.TTL > 0 {
+		meta.expires = time.Now().Add(opts.TTL)
+		c.scheduleExpiry(opts.TTL)
+	}
+
+	c.data[key] = value
+	c.meta[key] = meta
+
+	if err := c.persist(); err != nil {
+		restore()
+		c.index--
+		return nil, err
+	}
+
+	node := c.fileNode(key)
+	c.record(action, node, prev)
+	c.notify(key, value)
+
+	return &client.Response{Action: action, Node: node, PrevNode: prev, Index: c.index}, nil
+}
+
+func (k *keysAPI) Delete(ctx context.Context, key string, opts *client.DeleteOptions) (*client.Response, error) {
+	if opts == nil {
+		opts = &client.DeleteOptions{}
+	}
+
+	c := k.c
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.expire()
+	key = normalize(key)
+
+	action := "delete"
+	if opts.PrevValue != "" || opts.PrevIndex != 0 {
+		action = "compareAndDelete"
+	}
+
+	if _, ok := c.data[key]; ok {
+		switch {
+		case opts.PrevValue != "" && c.data[key] != opts.PrevValue:
+			return nil, keyError(client.ErrorCodeTestFailed, "Compare failed", key, c.index)
+		case opts.PrevIndex != 0 && c.metaOf(key).modified != opts.PrevIndex:
+			return nil, keyError(client.ErrorCodeTestFailed, "Compare failed", key, c.index)
+		}
+
+		prev := c.fileNode(key)
+		restore := c.backup()
+
+		delete(c.data, key)
+		delete(c.meta, key)
+
+		if err := c.persist(); err != nil {
+			restore()
+			return nil, err
+		}
+
+		c.index++
+		node := &client.Node{Key: prev.Key, CreatedIndex: prev.CreatedIndex, ModifiedIndex: c.index}
+		c.record(action, node, prev)
+		return &client.Response{Action: action, Node: node, PrevNode: prev, Index: c.index}, nil
+	}
+
+	if key == "" || !c.isDir(key) {
+		if key == "" {
+			return nil, keyError(client.ErrorCodeRootROnly, "Root is read only", key, c.index)
+		}
+		return nil, keyError(client.ErrorCodeKeyNotFound, "Key not found", key, c.index)
+	}
+
+	if !opts.Dir && !opts.Recursive {
+		return nil, keyError(client.ErrorCodeNotFile, "Not a file", key, c.index)
+	}
+
+	files, dirs := c.children(key)
+	if !opts.Recursive && (len(files) > 0 || len(dirs) > 0) {
+		return nil, keyError(client.ErrorCodeDirNotEmpty, "Directory not empty", key, c.index)
+	}
+
+	prev := c.dirNode(key, false, false)
+	restore := c.backup()
+
+	for k := range c.data {
+		if strings.HasPrefix(k, key+"/") {
+			delete(c.data, k)
+			delete(c.meta, k)
+		}
+	}
+
+	if err := c.persist(); err != nil {
+		restore()
+		return nil, err
+	}
+
+	for k := range c.dirs {
+		if k == key || strings.HasPrefix(k, key+"/") {
+			delete(c.dirs, k)
+		}
+	}
+
+	c.index++
+	node := &client.Node{Key: prev.Key, Dir: true, CreatedIndex: prev.CreatedIndex, ModifiedIndex: c.index}
+	c.record(action, node, prev)
+	return &client.Response{Action: action, Node: node, PrevNode: prev, Index: c.index}, nil
+}
+
+func (k *keysAPI) Create(ctx context.Context, key, value string) (*client.Response, error) {
+	return k.Set(ctx, key, value, &client.SetOptions{PrevExist: client.PrevNoExist})
+}
+
+func (k *keysAPI) Update(ctx context.Context, key, value string) (*client.Response, error) {
+	return k.Set(ctx, key, value, &client.SetOptions{PrevExist: client.PrevExist})
+}
+
+// CreateInOrder creates a key under dir named after the next index, like
+// etcd, so the keys sort in the order they were created.
+func (k *keysAPI) CreateInOrder(ctx context.Context, dir, value string, opts *client.CreateInOrderOptions) (*client.Response, error) {
+	setOpts := &client.SetOptions{PrevExist: client.PrevNoExist}
+	if opts != nil {
+		setOpts.TTL = opts.TTL
+	}
+
+	k.c.mutex.Lock()
+	key := fmt.Sprintf("%s/%020d", normalize(dir), k.c.index+1)
+	k.c.mutex.Unlock()
+
+	return k.Set(ctx, key, value, setOpts)
+}
+
+func (k *keysAPI) Watcher(key string, opts *client.WatcherOptions) client.Watcher {
+	if opts == nil {
+		opts = &client.WatcherOptions{}
+	}
+
+	w := &keysWatcher{c: k.c, key: normalize(key), recursive: opts.Recursive, after: opts.AfterIndex}
+	if w.after == 0 {
+		k.c.mutex.Lock()
+		w.after = k.c.index
+		k.c.mutex.Unlock()
+	}
+
+	return w
+}
+
+// keysWatcher returns the changes to a key, or to the keys under it, after
+// an index.
+type keysWatcher struct {
+	c         *Client
+	key       string
+	recursive bool
+	after     uint64
+}
+
+func (w *keysWatcher) matches(key string, dir bool) bool {
+	switch {
+	case key == w.key:
+		return true
+	case w.recursive && (w.key == "" || strings.HasPrefix(key, w.key+"/")):
+		return true
+	}
+
+	// removing a directory removes what is watched under it.
+	return dir && strings.HasPrefix(w.key, key+"/")
+}
+
+func (w *keysWatcher) Next(ctx context.Context) (*client.Response, error) {
+	for {
+		c := w.c
+		c.mutex.Lock()
+		c.expire()
+
+		if len(c.events) > 0 && w.after+1 < c.events[0].Index {
+			index := c.index
+			c.mutex.Unlock()
+			return nil, client.Error{
+				Code:    client.ErrorCodeEventIndexCleared,
+				Message: "The event in requested index is outdated and cleared",
+				Cause:   fmt.Sprintf("the requested history has been cleared [%d/%d]", c.events[0].Index, w.after+1),
+				Index:   index,
+			}
+		}
+
+		for _, event := range c.events {
+			if event.Index <= w.after {
+				continue
+			}
+
+			w.after = event.Index
+			if w.matches(strings.Trim(event.Node.Key, "/"), event.Node.Dir) {
+				c.mutex.Unlock()
+				return event, nil
+			}
+		}
+
+		changed := c.changed
+		c.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+type nodesByKey client.Nodes
+
+func (n nodesByKey) Len() int           { return len(n) }
+func (n nodesByKey) Less(i, j int) bool { return n[i].Key < n[j].Key }
+func (n nodesByKey) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
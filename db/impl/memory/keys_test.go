@@ -0,0 +1,140 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/coreos/etcd/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/coreos/etcd/client"
+
+	. "gopkg.in/check.v1"
+)
+
+func errorCode(err error) int {
+	if er, ok := err.(client.Error); ok {
+		return er.Code
+	}
+
+	return 0
+}
+
+func (s *memorySuite) TestKeysAPI(c *C) {
+	keys := s.client.KeysAPI()
+	ctx := context.Background()
+
+	_, err := keys.Get(ctx, "/volplugin/foo", nil)
+	c.Assert(errorCode(err), Equals, client.ErrorCodeKeyNotFound)
+
+	resp, err := keys.Create(ctx, "/volplugin/foo", "bar")
+	c.Assert(err, IsNil)
+	c.Assert(resp.Action, Equals, "create")
+
+	_, err = keys.Create(ctx, "/volplugin/foo", "baz")
+	c.Assert(errorCode(err), Equals, client.ErrorCodeNodeExist)
+
+	_, err = keys.Set(ctx, "/volplugin/foo", "baz", &client.SetOptions{PrevValue: "quux"})
+	c.Assert(errorCode(err), Equals, client.ErrorCodeTestFailed)
+
+	resp, err = keys.Set(ctx, "/volplugin/foo", "baz", &client.SetOptions{PrevValue: "bar"})
+	c.Assert(err, IsNil)
+	c.Assert(resp.Action, Equals, "compareAndSwap")
+	c.Assert(resp.PrevNode.Value, Equals, "bar")
+
+	_, err = keys.Update(ctx, "/volplugin/missing", "bar")
+	c.Assert(errorCode(err), Equals, client.ErrorCodeKeyNotFound)
+
+	_, err = keys.Set(ctx, "/volplugin/dir/one", "1", nil)
+	c.Assert(err, IsNil)
+	_, err = keys.Set(ctx, "/volplugin/dir/sub/two", "2", nil)
+	c.Assert(err, IsNil)
+
+	resp, err = keys.Get(ctx, "/volplugin/dir", &client.GetOptions{Recursive: true})
+	c.Assert(err, IsNil)
+	c.Assert(resp.Node.Dir, Equals, true)
+	c.Assert(len(resp.Node.Nodes), Equals, 2)
+	c.Assert(resp.Node.Nodes[0].Key, Equals, "/volplugin/dir/one")
+	c.Assert(resp.Node.Nodes[1].Key, Equals, "/volplugin/dir/sub")
+	c.Assert(resp.Node.Nodes[1].Nodes[0].Value, Equals, "2")
+
+	_, err = keys.Set(ctx, "/volplugin/dir", "value", nil)
+	c.Assert(errorCode(err), Equals, client.ErrorCodeNotFile)
+
+	_, err = keys.Delete(ctx, "/volplugin/dir", &client.DeleteOptions{Dir: true})
+	c.Assert(errorCode(err), Equals, client.ErrorCodeDirNotEmpty)
+
+	_, err = keys.Delete(ctx, "/volplugin/dir", &client.DeleteOptions{Recursive: true})
+	c.Assert(err, IsNil)
+	_, err = keys.Get(ctx, "/volplugin/dir/sub/two", nil)
+	c.Assert(errorCode(err), Equals, client.ErrorCodeKeyNotFound)
+
+	_, err = keys.Delete(ctx, "/volplugin/foo", &client.DeleteOptions{PrevValue: "bar"})
+	c.Assert(errorCode(err), Equals, client.ErrorCodeTestFailed)
+	_, err = keys.Delete(ctx, "/volplugin/foo", &client.DeleteOptions{PrevValue: "baz"})
+	c.Assert(err, IsNil)
+
+	first, err := keys.CreateInOrder(ctx, "/volplugin/queue", "first", nil)
+	c.Assert(err, IsNil)
+	second, err := keys.CreateInOrder(ctx, "/volplugin/queue", "second", nil)
+	c.Assert(err, IsNil)
+	c.Assert(first.Node.Key < second.Node.Key, Equals, true)
+}
+
+func (s *memorySuite) TestKeysAPITTL(c *C) {
+	keys := s.client.KeysAPI()
+	ctx := context.Background()
+
+	watcher := keys.Watcher("/volplugin/lock", nil)
+
+	_, err := keys.Set(ctx, "/volplugin/lock", "held", &client.SetOptions{TTL: 200 * time.Millisecond})
+	c.Assert(err, IsNil)
+
+	resp, err := keys.Get(ctx, "/volplugin/lock", nil)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Node.Expiration, NotNil)
+
+	resp, err = watcher.Next(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Action, Equals, "set")
+
+	// the expiry is seen by watchers without anyone reading the key.
+	resp, err = watcher.Next(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Action, Equals, "expire")
+	c.Assert(resp.PrevNode.Value, Equals, "held")
+
+	_, err = keys.Get(ctx, "/volplugin/lock", nil)
+	c.Assert(errorCode(err), Equals, client.ErrorCodeKeyNotFound)
+}
+
+func (s *memorySuite) TestKeysAPIWatch(c *C) {
+	keys := s.client.KeysAPI()
+	ctx := context.Background()
+
+	watcher := keys.Watcher("/volplugin/volumes", &client.WatcherOptions{Recursive: true})
+
+	_, err := keys.Set(ctx, "/volplugin/global-config", "{}", nil)
+	c.Assert(err, IsNil)
+	_, err = keys.Set(ctx, "/volplugin/volumes/policy1/foo", "{}", nil)
+	c.Assert(err, IsNil)
+	_, err = keys.Delete(ctx, "/volplugin/volumes/policy1/foo", nil)
+	c.Assert(err, IsNil)
+
+	resp, err := watcher.Next(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Action, Equals, "set")
+	c.Assert(resp.Node.Key, Equals, "/volplugin/volumes/policy1/foo")
+
+	resp, err = watcher.Next(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Action, Equals, "delete")
+
+	// watchers can start from an earlier index, like in etcd.
+	replay := keys.Watcher("/volplugin/volumes", &client.WatcherOptions{Recursive: true, AfterIndex: resp.Index - 1})
+	resp, err = replay.Next(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Action, Equals, "delete")
+
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err = watcher.Next(ctx)
+	c.Assert(err, Equals, context.DeadlineExceeded)
+}
@@ -0,0 +1,221 @@
+package memory
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "testing"
+	"time"
+
+	"github.com/contiv/volplugin/db"
+	"github.com/contiv/volplugin/errors"
+
+	. "gopkg.in/check.v1"
+)
+
+type memorySuite struct {
+	client *Client
+}
+
+var _ = Suite(&memorySuite{})
+
+func TestMemory(t *T) { TestingT(t) }
+
+func (s *memorySuite) SetUpTest(c *C) {
+	s.client = NewClient("volplugin")
+}
+
+func testPolicy(name string) *db.Policy {
+	policy := db.NewPolicy(name)
+	policy.Backend = "ceph"
+	policy.DriverOptions = map[string]string{"pool": "rbd"}
+	policy.CreateOptions = db.CreateOptions{Size: "10MB"}
+	policy.RuntimeOptions = &db.RuntimeOptions{}
+	return policy
+}
+
+func (s *memorySuite) TestCRUD(c *C) {
+	policy := testPolicy("policy1")
+	c.Assert(s.client.Get(db.NewPolicy("policy1")), Equals, errors.NotExists)
+	c.Assert(s.client.Set(policy), IsNil)
+
+	policy2 := db.NewPolicy("policy1")
+	c.Assert(s.client.Get(policy2), IsNil)
+	c.Assert(policy2, DeepEquals, policy)
+
+	c.Assert(s.client.Set(testPolicy("policy10")), IsNil)
+
+	policies, err := s.client.List(db.NewPolicy(""))
+	c.Assert(err, IsNil)
+	c.Assert(len(policies), Equals, 2)
+	c.Assert(policies[0].(*db.Policy).Name, Equals, "policy1")
+	c.Assert(policies[1].(*db.Policy).Name, Equals, "policy10")
+
+	c.Assert(s.client.Delete(policy), IsNil)
+	c.Assert(s.client.Delete(policy), Equals, errors.NotExists)
+	c.Assert(s.client.Get(policy2), Equals, errors.NotExists)
+
+	c.Assert(s.client.Set(db.NewPolicy("invalid")), NotNil)
+}
+
+func (s *memorySuite) TestHooks(c *C) {
+	triggered := []string{}
+	hook := func(name string) db.Hook {
+		return func(client db.Client, obj db.Entity) error {
+			triggered = append(triggered, name)
+			return nil
+		}
+	}
+
+	global := &hookedGlobal{Global: db.NewGlobal(), hooks: &db.Hooks{
+		PreSet:     hook("preset"),
+		PostSet:    hook("postset"),
+		PreGet:     hook("preget"),
+		PostGet:    hook("postget"),
+		PreDelete:  hook("predelete"),
+		PostDelete: hook("postdelete"),
+	}}
+
+	c.Assert(s.client.Set(global), IsNil)
+	c.Assert(s.client.Get(global), IsNil)
+	c.Assert(s.client.Delete(global), IsNil)
+	c.Assert(triggered, DeepEquals, []string{"preset", "postset", "preget", "postget", "predelete", "postdelete"})
+}
+
+type hookedGlobal struct {
+	*db.Global
+	hooks *db.Hooks
+}
+
+func (h *hookedGlobal) Hooks() *db.Hooks {
+	return h.hooks
+}
+
+func (s *memorySuite) TestWatch(c *C) {
+	global := db.NewGlobal()
+	globalChan, _ := s.client.Watch(global)
+	policyChan, _ := s.client.WatchPrefix(db.NewPolicy(""))
+
+	for i := 1; i <= 5; i++ {
+		global.TTL = time.Duration(i) * time.Minute
+		c.Assert(s.client.Set(global), IsNil)
+		c.Assert(s.client.Set(testPolicy(fmt.Sprintf("policy%d", i))), IsNil)
+	}
+
+	for i := 1; i <= 5; i++ {
+		c.Assert((<-globalChan).(*db.Global).TTL, Equals, time.Duration(i)*time.Minute)
+		c.Assert((<-policyChan).(*db.Policy).Name, Equals, fmt.Sprintf("policy%d", i))
+	}
+
+	c.Assert(s.client.WatchStop(global), IsNil)
+	c.Assert(s.client.WatchStop(global), NotNil)
+	c.Assert(s.client.WatchPrefixStop(db.NewPolicy("")), IsNil)
+
+	c.Assert(s.client.Set(global), IsNil)
+	select {
+	case <-globalChan:
+		c.Fatal("received an update after the watch was stopped")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func (s *memorySuite) TestPersistence(c *C) {
+	dir, err := ioutil.TempDir("", "memory")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "db.json")
+
+	client, err := NewPersistentClient("volplugin", file)
+	c.Assert(err, IsNil)
+	c.Assert(client.Set(testPolicy("policy1")), IsNil)
+	c.Assert(client.Set(testPolicy("policy2")), IsNil)
+	c.Assert(client.Delete(db.NewPolicy("policy2")), IsNil)
+
+	client, err = NewPersistentClient("volplugin", file)
+	c.Assert(err, IsNil)
+	c.Assert(client.Get(db.NewPolicy("policy1")), IsNil)
+	c.Assert(client.Get(db.NewPolicy("policy2")), Equals, errors.NotExists)
+
+	c.Assert(ioutil.WriteFile(file, []byte("garbage"), 0600), IsNil)
+	_, err = NewPersistentClient("volplugin", file)
+	c.Assert(err, NotNil)
+}
+
+func (s *memorySuite) TestDump(c *C) {
+	c.Assert(s.client.Set(testPolicy("policy1")), IsNil)
+
+	tarballPath, err := s.client.Dump("")
+	c.Assert(err, IsNil)
+	defer os.Remove(tarballPath)
+
+	file, err := os.Open(tarballPath)
+	c.Assert(err, IsNil)
+	defer file.Close()
+
+	gzReader, err := gzip.NewReader(file)
+	c.Assert(err, IsNil)
+	tarReader := tar.NewReader(gzReader)
+
+	base := filepath.Base(tarballPath)
+	base = base[:len(base)-len(".tar.gz")]
+
+	names := []string{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+		names = append(names, header.Name)
+	}
+
+	c.Assert(names, DeepEquals, []string{base + "/volplugin", base + "/volplugin/policies", base + "/volplugin/policies/policy1"})
+}
+
+func (s *memorySuite) TestRestore(c *C) {
+	c.Assert(s.client.Set(testPolicy("policy1")), IsNil)
+	c.Assert(s.client.Set(testPolicy("policy2")), IsNil)
+	s.client.data["volplugin/users/policy1/vol"] = "{}"
+	s.client.data["volplugin/stats/policy1/vol"] = "{}"
+	s.client.data["volplugin/freezes/policy1/vol"] = "{}"
+	s.client.data["volplugin/snapshots/policy1/vol"] = ""
+
+	tarballPath, err := s.client.Dump("")
+	c.Assert(err, IsNil)
+	defer os.Remove(tarballPath)
+
+	// restoring in place conflicts, unless told what to do with existing keys.
+	_, err = s.client.Restore(tarballPath, db.RestoreOptions{})
+	c.Assert(err, NotNil)
+
+	result, err := s.client.Restore(tarballPath, db.RestoreOptions{Mode: db.RestoreSkipExisting})
+	c.Assert(err, IsNil)
+	c.Assert(result.Restored, DeepEquals, []string{})
+	// keys which had a TTL in etcd, or signal the daemons, are never restored.
+	c.Assert(result.Skipped, DeepEquals, []string{"freezes/policy1/vol", "policies/policy1", "policies/policy2", "snapshots/policy1/vol", "stats/policy1/vol", "users/policy1/vol"})
+
+	// clone into another prefix.
+	staging := NewClient("staging")
+	c.Assert(staging.Set(testPolicy("policy2")), IsNil)
+
+	result, err = staging.Restore(tarballPath, db.RestoreOptions{SourcePrefix: "/volplugin", Mode: db.RestoreOverwrite, DryRun: true})
+	c.Assert(err, IsNil)
+	c.Assert(result.Restored, DeepEquals, []string{"policies/policy1", "policies/policy2"})
+	c.Assert(staging.Get(db.NewPolicy("policy1")), Equals, errors.NotExists)
+
+	_, err = staging.Restore(tarballPath, db.RestoreOptions{SourcePrefix: "/volplugin", Mode: db.RestoreOverwrite})
+	c.Assert(err, IsNil)
+
+	policy, restored := db.NewPolicy("policy1"), db.NewPolicy("policy1")
+	c.Assert(s.client.Get(policy), IsNil)
+	c.Assert(staging.Get(restored), IsNil)
+	c.Assert(restored, DeepEquals, policy)
+
+	_, err = staging.Restore(tarballPath, db.RestoreOptions{SourcePrefix: "nonexistent"})
+	c.Assert(err, NotNil)
+}
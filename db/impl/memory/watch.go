@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db"
+	"github.com/contiv/volplugin/errors"
+)
+
+// watcher delivers the changes to a key, or to the keys under it, in the
+// order they happened. Changes are queued so writers never wait on readers.
+type watcher struct {
+	key       string
+	recursive bool
+
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	queue    [][2]string
+	stopped  bool
+	stopChan chan struct{}
+}
+
+func (w *watcher) matches(key string) bool {
+	if w.recursive {
+		return strings.HasPrefix(key, w.key+"/")
+	}
+
+	return key == w.key
+}
+
+func (w *watcher) push(key, value string) {
+	w.mutex.Lock()
+	w.queue = append(w.queue, [2]string{key, value})
+	w.mutex.Unlock()
+	w.cond.Signal()
+}
+
+// pop waits for a change. It returns false once the watcher is stopped.
+func (w *watcher) pop() (string, string, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for len(w.queue) == 0 && !w.stopped {
+		w.cond.Wait()
+	}
+
+	if w.stopped {
+		return "", "", false
+	}
+
+	change := w.queue[0]
+	w.queue = w.queue[1:]
+	return change[0], change[1], true
+}
+
+func (w *watcher) stop() {
+	w.mutex.Lock()
+	w.stopped = true
+	w.mutex.Unlock()
+	w.cond.Broadcast()
+	close(w.stopChan)
+}
+
+// notify queues a change for the watchers interested in it. Deletions are
+// not reported, like with the etcd client.
+func (c *Client) notify(key, value string) {
+	c.watcherMutex.Lock()
+	defer c.watcherMutex.Unlock()
+
+	for _, w := range c.watchers {
+		if w.matches(key) {
+			w.push(key, value)
+		}
+	}
+}
+
+// Watch watches a given object for changes.
+func (c *Client) Watch(obj db.Entity) (chan db.Entity, chan error) {
+	path, err := obj.Path()
+	if err != nil {
+		errChan := make(chan error, 1)
+		errChan <- err
+		return make(chan db.Entity), errChan
+	}
+
+	return c.watchPath(obj, path, false)
+}
+
+// WatchStop stops a watch for a given object.
+func (c *Client) WatchStop(obj db.Entity) error {
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	return c.watchStopPath(path)
+}
+
+// WatchPrefix watches all items under the given entity's prefix
+func (c *Client) WatchPrefix(obj db.Entity) (chan db.Entity, chan error) {
+	return c.watchPath(obj, obj.Prefix(), true)
+}
+
+// WatchPrefixStop stops a WatchPrefix.
+func (c *Client) WatchPrefixStop(obj db.Entity) error {
+	return c.watchStopPath(obj.Prefix())
+}
+
+// watchPath watches a path for changes. Only one watch for a given path may
+// be active at a time.
+func (c *Client) watchPath(obj db.Entity, path string, recursive bool) (chan db.Entity, chan error) {
+	c.watcherMutex.Lock()
+	defer c.watcherMutex.Unlock()
+
+	w := &watcher{
+		key:       c.qualified(path),
+		recursive: recursive,
+		stopChan:  make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mutex)
+
+	retChan := make(chan db.Entity)
+	// no errors can happen in memory, but the interface requires the channel.
+	errChan := make(chan error, 1)
+
+	go func() {
+		for {
+			key, value, ok := w.pop()
+			if !ok {
+				return
+			}
+
+			for _, entity := range c.traverse([]string{key}, map[string]string{key: value}, obj) {
+				select {
+				case retChan <- entity:
+				case <-w.stopChan:
+					return
+				}
+			}
+		}
+	}()
+
+	if old, ok := c.watchers[path]; ok {
+		old.stop()
+	}
+	c.watchers[path] = w
+
+	return retChan, errChan
+}
+
+// watchStopPath stops a watch given a path to stop the watch on.
+func (c *Client) watchStopPath(path string) error {
+	c.watcherMutex.Lock()
+	defer c.watcherMutex.Unlock()
+
+	w, ok := c.watchers[path]
+	if !ok {
+		return errors.InvalidDBPath.Combine(errored.New("missing key during watch"))
+	}
+
+	w.stop()
+	delete(c.watchers, path)
+
+	return nil
+}
@@ -0,0 +1,491 @@
+// Package keysapi provides the etcd v2 keys API, which config.Client and
+// everything built on it are written against, on top of key/value stores
+// which do not speak it, such as consul and etcd v3.
+//
+// Stores only know flat keys. Directories are emulated: a directory exists
+// while keys exist under it, and directories created explicitly (with
+// SetOptions.Dir) are kept as a marker key, the name of the directory with a
+// trailing slash, which is also how consul's own tools create folders.
+//
+// Stores which can write several keys atomically, and attach keys to leases,
+// implement TxnStore; the keys API over them is then a Transactor and a
+// Leaser, which config.Client uses when it can.
+package keysapi
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/coreos/etcd/client"
+)
+
+// Unconditional is the index given to Store.Put and Store.Delete to write the
+// key whatever its current state.
+const Unconditional = ^uint64(0)
+
+// inOrderAttempts is how often CreateInOrder tries to find a free key when
+// other writers race it.
+const inOrderAttempts = 10
+
+// Pair is a key of a store.
+type Pair struct {
+	Key         string
+	Value       string
+	CreateIndex uint64
+	ModifyIndex uint64
+	// Expires is when the key is removed, if it was written with a TTL and
+	// the store knows it.
+	Expires time.Time
+}
+
+// Change is a change to a key reported by a store watch. Pair is nil if the
+// key was deleted, in which case Prev holds its last value if the store
+// knows it.
+type Change struct {
+	Key   string
+	Pair  *Pair
+	Prev  *Pair
+	Index uint64
+}
+
+// Store is a key/value store the keys API runs on. Keys never start with a
+// slash. Every method also returns the current index of the store.
+type Store interface {
+	// Get returns the key, or nil if it does not exist.
+	Get(key string) (*Pair, uint64, error)
+	// List returns the keys starting with prefix, sorted by key.
+	List(prefix string) ([]*Pair, uint64, error)
+	// Put writes the key if its ModifyIndex is still index; an index of 0
+	// only writes it if it does not exist, and Unconditional always does.
+	// If ttl is not zero, the key is removed once it passes, unless it is
+	// written again. The written key is returned, or nil if the condition
+	// did not hold.
+	Put(key, value string, index uint64, ttl time.Duration) (*Pair, uint64, error)
+	// Delete removes the key if its ModifyIndex is still index, and reports
+	// whether it did.
+	Delete(key string, index uint64) (bool, uint64, error)
+	// DeletePrefix removes all the keys starting with prefix.
+	DeletePrefix(prefix string) (uint64, error)
+	// Watch returns a watch of the keys starting with prefix, which reports
+	// the changes after index.
+	Watch(prefix string, index uint64) StoreWatcher
+}
+
+// StoreWatcher is a watch of a store.
+type StoreWatcher interface {
+	// Next blocks until there are changes, and returns them in order. It
+	// returns early with an error if cancel is closed.
+	Next(cancel <-chan struct{}) ([]*Change, error)
+}
+
+// New returns the keys API over the store. If the store is a TxnStore, the
+// keys API is a Transactor and a Leaser.
+func New(store Store) client.KeysAPI {
+	k := &keysAPI{store: store}
+
+	if ts, ok := store.(TxnStore); ok {
+		return &txnKeysAPI{keysAPI: k, store: ts}
+	}
+
+	return k
+}
+
+type keysAPI struct {
+	store Store
+}
+
+// normalize turns an etcd key into a key of the store.
+func normalize(key string) string {
+	return strings.Trim(path.Clean("/"+key), "/")
+}
+
+func keyError(code int, message, key string, index uint64) error {
+	return client.Error{Code: code, Message: message, Cause: "/" + key, Index: index}
+}
+
+// marker is the key which keeps the explicitly created directory dir.
+func marker(dir string) string {
+	return dir + "/"
+}
+
+// under returns the prefix of the keys under the directory.
+func under(dir string) string {
+	if dir == "" {
+		return ""
+	}
+
+	return dir + "/"
+}
+
+func fileNode(pair *Pair) *client.Node {
+	node := &client.Node{Key: "/" + pair.Key, Value: pair.Value, CreatedIndex: pair.CreateIndex, ModifiedIndex: pair.ModifyIndex}
+	if !pair.Expires.IsZero() {
+		expires := pair.Expires
+		node.Expiration = &expires
+		// etcd rounds the seconds left up.
+		node.TTL = int64((expires.Sub(time.Now()) + time.Second - 1) / time.Second)
+	}
+
+	return node
+}
+
+// dirNode builds the node of the directory from the keys under it, listing
+// its children, and theirs if recursive.
+func dirNode(dir string, pairs []*Pair, recursive bool) *client.Node {
+	node := &client.Node{Key: "/" + dir, Dir: true}
+	prefix := under(dir)
+
+	subdirs := map[string][]*Pair{}
+	names := []string{}
+
+	for _, pair := range pairs {
+		if pair.Key == marker(dir) {
+			node.CreatedIndex = pair.CreateIndex
+			node.ModifiedIndex = pair.ModifyIndex
+			continue
+		}
+
+		rest := strings.TrimPrefix(pair.Key, prefix)
+		if i := strings.Index(rest, "/"); i >= 0 {
+			name := prefix + rest[:i]
+			if _, ok := subdirs[name]; !ok {
+				names = append(names, name)
+			}
+			subdirs[name] = append(subdirs[name], pair)
+			continue
+		}
+
+		node.Nodes = append(node.Nodes, fileNode(pair))
+	}
+
+	for _, name := range names {
+		child := dirNode(name, subdirs[name], recursive)
+		if !recursive {
+			child.Nodes = nil
+		}
+		node.Nodes = append(node.Nodes, child)
+	}
+
+	sort.Sort(nodesByKey(node.Nodes))
+	return node
+}
+
+// lookup returns the key if it holds a value, or the keys under it if it is
+// a directory. Both are empty if it does not exist.
+func (k *keysAPI) lookup(key string) (*Pair, []*Pair, uint64, error) {
+	if key != "" {
+		pair, index, err := k.store.Get(key)
+		if err != nil || pair != nil {
+			return pair, nil, index, err
+		}
+	}
+
+	pairs, index, err := k.store.List(under(key))
+	return nil, pairs, index, err
+}
+
+func (k *keysAPI) Get(ctx context.Context, key string, opts *client.GetOptions) (*client.Response, error) {
+	if opts == nil {
+		opts = &client.GetOptions{}
+	}
+
+	key = normalize(key)
+
+	pair, pairs, index, err := k.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if pair != nil {
+		return &client.Response{Action: "get", Node: fileNode(pair), Index: index}, nil
+	}
+
+	if len(pairs) == 0 && key != "" {
+		return nil, keyError(client.ErrorCodeKeyNotFound, "Key not found", key, index)
+	}
+
+	return &client.Response{Action: "get", Node: dirNode(key, pairs, opts.Recursive), Index: index}, nil
+}
+
+func (k *keysAPI) Set(ctx context.Context, key, value string, opts *client.SetOptions) (*client.Response, error) {
+	if opts == nil {
+		opts = &client.SetOptions{}
+	}
+
+	key = normalize(key)
+	if key == "" {
+		return nil, keyError(client.ErrorCodeRootROnly, "Root is read only", key, 0)
+	}
+
+	prev, pairs, index, err := k.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+
+	exists := prev != nil
+
+	switch {
+	case len(pairs) > 0 && !opts.Dir:
+		return nil, keyError(client.ErrorCodeNotFile, "Not a file", key, index)
+	case opts.PrevExist == client.PrevNoExist && (exists || len(pairs) > 0):
+		return nil, keyError(client.ErrorCodeNodeExist, "Key already exists", key, index)
+	case opts.PrevExist == client.PrevExist && !exists:
+		return nil, keyError(client.ErrorCodeKeyNotFound, "Key not found", key, index)
+	case (opts.PrevValue != "" || opts.PrevIndex != 0) && !exists:
+		return nil, keyError(client.ErrorCodeKeyNotFound, "Key not found", key, index)
+	case opts.PrevValue != "" && prev.Value != opts.PrevValue:
+		return nil, keyError(client.ErrorCodeTestFailed, "Compare failed", key, index)
+	case opts.PrevIndex != 0 && prev.ModifyIndex != opts.PrevIndex:
+		return nil, keyError(client.ErrorCodeTestFailed, "Compare failed", key, index)
+	}
+
+	action := "set"
+	switch {
+	case opts.PrevValue != "" || opts.PrevIndex != 0:
+		action = "compareAndSwap"
+	case opts.PrevExist == client.PrevNoExist:
+		action = "create"
+	case opts.PrevExist == client.PrevExist:
+		action = "update"
+	}
+
+	if opts.Dir {
+		if exists {
+			return nil, keyError(client.ErrorCodeNotDir, "Not a directory", key, index)
+		}
+
+		if len(pairs) > 0 {
+			return nil, keyError(client.ErrorCodeNotFile, "Not a file", key, index)
+		}
+
+		dir, index, err := k.store.Put(marker(key), "", 0, opts.TTL)
+		if err != nil {
+			return nil, err
+		}
+
+		if dir == nil {
+			return nil, keyError(client.ErrorCodeNodeExist, "Key already exists", key, index)
+		}
+
+		return &client.Response{Action: action, Node: dirNode(key, []*Pair{dir}, false), Index: index}, nil
+	}
+
+	cond := Unconditional
+	switch {
+	case !exists:
+		cond = 0
+	case opts.PrevExist == client.PrevExist || opts.PrevValue != "" || opts.PrevIndex != 0:
+		cond = prev.ModifyIndex
+	}
+
+	pair, index, err := k.store.Put(key, value, cond, opts.TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	if pair == nil {
+		// someone else wrote the key since we looked at it.
+		if exists {
+			return nil, keyError(client.ErrorCodeTestFailed, "Compare failed", key, index)
+		}
+		return nil, keyError(client.ErrorCodeNodeExist, "Key already exists", key, index)
+	}
+
+	resp := &client.Response{Action: action, Node: fileNode(pair), Index: index}
+	if exists {
+		resp.PrevNode = fileNode(prev)
+	}
+
+	return resp, nil
+}
+
+func (k *keysAPI) Delete(ctx context.Context, key string, opts *client.DeleteOptions) (*client.Response, error) {
+	if opts == nil {
+		opts = &client.DeleteOptions{}
+	}
+
+	key = normalize(key)
+	if key == "" {
+		return nil, keyError(client.ErrorCodeRootROnly, "Root is read only", key, 0)
+	}
+
+	prev, pairs, index, err := k.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+
+	action := "delete"
+	if opts.PrevValue != "" || opts.PrevIndex != 0 {
+		action = "compareAndDelete"
+	}
+
+	if prev != nil {
+		switch {
+		case opts.PrevValue != "" && prev.Value != opts.PrevValue:
+			return nil, keyError(client.ErrorCodeTestFailed, "Compare failed", key, index)
+		case opts.PrevIndex != 0 && prev.ModifyIndex != opts.PrevIndex:
+			return nil, keyError(client.ErrorCodeTestFailed, "Compare failed", key, index)
+		}
+
+		ok, index, err := k.store.Delete(key, prev.ModifyIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			return nil, keyError(client.ErrorCodeTestFailed, "Compare failed", key, index)
+		}
+
+		node := &client.Node{Key: "/" + key, CreatedIndex: prev.CreateIndex, ModifiedIndex: index}
+		return &client.Response{Action: action, Node: node, PrevNode: fileNode(prev), Index: index}, nil
+	}
+
+	if len(pairs) == 0 {
+		return nil, keyError(client.ErrorCodeKeyNotFound, "Key not found", key, index)
+	}
+
+	if !opts.Dir && !opts.Recursive {
+		return nil, keyError(client.ErrorCodeNotFile, "Not a file", key, index)
+	}
+
+	if !opts.Recursive && (len(pairs) > 1 || pairs[0].Key != marker(key)) {
+		return nil, keyError(client.ErrorCodeDirNotEmpty, "Directory not empty", key, index)
+	}
+
+	prevDir := dirNode(key, pairs, false)
+	prevDir.Nodes = nil
+
+	index, err = k.store.DeletePrefix(under(key))
+	if err != nil {
+		return nil, err
+	}
+
+	node := &client.Node{Key: "/" + key, Dir: true, CreatedIndex: prevDir.CreatedIndex, ModifiedIndex: index}
+	return &client.Response{Action: action, Node: node, PrevNode: prevDir, Index: index}, nil
+}
+
+func (k *keysAPI) Create(ctx context.Context, key, value string) (*client.Response, error) {
+	return k.Set(ctx, key, value, &client.SetOptions{PrevExist: client.PrevNoExist})
+}
+
+func (k *keysAPI) Update(ctx context.Context, key, value string) (*client.Response, error) {
+	return k.Set(ctx, key, value, &client.SetOptions{PrevExist: client.PrevExist})
+}
+
+// CreateInOrder creates a key under dir named after the next index of the
+// store, like etcd, so the keys sort in the order they were created.
+func (k *keysAPI) CreateInOrder(ctx context.Context, dir, value string, opts *client.CreateInOrderOptions) (*client.Response, error) {
+	ttl := time.Duration(0)
+	if opts != nil {
+		ttl = opts.TTL
+	}
+
+	dir = normalize(dir)
+
+	for i := 0; i < inOrderAttempts; i++ {
+		_, index, err := k.store.Get(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		pair, index, err := k.store.Put(fmt.Sprintf("%s/%020d", dir, index+1), value, 0, ttl)
+		if err != nil {
+			return nil, err
+		}
+
+		if pair != nil {
+			return &client.Response{Action: "create", Node: fileNode(pair), Index: index}, nil
+		}
+	}
+
+	return nil, keyError(client.ErrorCodeNodeExist, "Key already exists", dir, 0)
+}
+
+func (k *keysAPI) Watcher(key string, opts *client.WatcherOptions) client.Watcher {
+	if opts == nil {
+		opts = &client.WatcherOptions{}
+	}
+
+	key = normalize(key)
+	return &watcher{
+		watch:     k.store.Watch(key, opts.AfterIndex),
+		key:       key,
+		recursive: opts.Recursive,
+	}
+}
+
+// watcher turns the changes of a store watch into etcd watch responses.
+type watcher struct {
+	watch     StoreWatcher
+	key       string
+	recursive bool
+	pending   []*client.Response
+}
+
+func (w *watcher) matches(key string) bool {
+	return key == w.key || key == marker(w.key) || (w.recursive && strings.HasPrefix(key, under(w.key)))
+}
+
+func changeResponse(change *Change) *client.Response {
+	resp := &client.Response{Action: "set", Index: change.Index}
+	if change.Pair == nil {
+		resp.Action = "delete"
+	}
+
+	key := change.Key
+	dir := strings.HasSuffix(key, "/")
+	if dir {
+		key = strings.TrimSuffix(key, "/")
+	}
+
+	resp.Node = &client.Node{Key: "/" + key, Dir: dir, ModifiedIndex: change.Index}
+	if change.Pair != nil {
+		resp.Node.CreatedIndex = change.Pair.CreateIndex
+		if !dir {
+			resp.Node.Value = change.Pair.Value
+		}
+	}
+
+	if change.Prev != nil {
+		resp.PrevNode = &client.Node{Key: "/" + key, Dir: dir, CreatedIndex: change.Prev.CreateIndex, ModifiedIndex: change.Prev.ModifyIndex}
+		if !dir {
+			resp.PrevNode.Value = change.Prev.Value
+		}
+		resp.Node.CreatedIndex = change.Prev.CreateIndex
+	}
+
+	return resp
+}
+
+func (w *watcher) Next(ctx context.Context) (*client.Response, error) {
+	for len(w.pending) == 0 {
+		changes, err := w.watch.Next(ctx.Done())
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, change := range changes {
+			if w.matches(change.Key) {
+				w.pending = append(w.pending, changeResponse(change))
+			}
+		}
+	}
+
+	resp := w.pending[0]
+	w.pending = w.pending[1:]
+	return resp, nil
+}
+
+type nodesByKey client.Nodes
+
+func (n nodesByKey) Len() int           { return len(n) }
+func (n nodesByKey) Less(i, j int) bool { return n[i].Key < n[j].Key }
+func (n nodesByKey) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
@@ -0,0 +1,397 @@
+package keysapi
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/coreos/etcd/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/coreos/etcd/client"
+
+	. "gopkg.in/check.v1"
+)
+
+type keysSuite struct {
+	store *mapStore
+	keys  client.KeysAPI
+}
+
+var _ = Suite(&keysSuite{})
+
+func TestKeysAPI(t *T) { TestingT(t) }
+
+func (s *keysSuite) SetUpTest(c *C) {
+	s.store = newMapStore()
+	s.keys = New(s.store)
+}
+
+// mapStore is a Store keeping its keys in a map, with the change history
+// for watches. TTLs are ignored.
+type mapStore struct {
+	mutex   sync.Mutex
+	index   uint64
+	pairs   map[string]*Pair
+	history []*Change
+	changed chan struct{}
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{pairs: map[string]*Pair{}, changed: make(chan struct{})}
+}
+
+func (m *mapStore) record(change *Change) {
+	m.history = append(m.history, change)
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+func (m *mapStore) Get(key string) (*Pair, uint64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.pairs[key], m.index, nil
+}
+
+func (m *mapStore) List(prefix string) ([]*Pair, uint64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	keys := []string{}
+	for key := range m.pairs {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	pairs := []*Pair{}
+	for _, key := range keys {
+		pairs = append(pairs, m.pairs[key])
+	}
+
+	return pairs, m.index, nil
+}
+
+func (m *mapStore) holds(key string, index uint64) bool {
+	pair, ok := m.pairs[key]
+	switch index {
+	case Unconditional:
+		return true
+	case 0:
+		return !ok
+	default:
+		return ok && pair.ModifyIndex == index
+	}
+}
+
+func (m *mapStore) Put(key, value string, index uint64, ttl time.Duration) (*Pair, uint64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.holds(key, index) {
+		return nil, m.index, nil
+	}
+
+	m.index++
+	prev := m.pairs[key]
+	pair := &Pair{Key: key, Value: value, CreateIndex: m.index, ModifyIndex: m.index}
+	if prev != nil {
+		pair.CreateIndex = prev.CreateIndex
+	}
+
+	m.pairs[key] = pair
+	m.record(&Change{Key: key, Pair: pair, Prev: prev, Index: m.index})
+	return pair, m.index, nil
+}
+
+func (m *mapStore) Delete(key string, index uint64) (bool, uint64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	prev, ok := m.pairs[key]
+	if !ok || !m.holds(key, index) {
+		return false, m.index, nil
+	}
+
+	m.index++
+	delete(m.pairs, key)
+	m.record(&Change{Key: key, Prev: prev, Index: m.index})
+	return true, m.index, nil
+}
+
+func (m *mapStore) DeletePrefix(prefix string) (uint64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.index++
+	for key, prev := range m.pairs {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.pairs, key)
+			m.record(&Change{Key: key, Prev: prev, Index: m.index})
+		}
+	}
+
+	return m.index, nil
+}
+
+func (m *mapStore) Watch(prefix string, index uint64) StoreWatcher {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if index == 0 {
+		index = m.index
+	}
+
+	return &mapWatcher{m: m, prefix: prefix, index: index}
+}
+
+type mapWatcher struct {
+	m      *mapStore
+	prefix string
+	index  uint64
+}
+
+func (w *mapWatcher) Next(cancel <-chan struct{}) ([]*Change, error) {
+	for {
+		w.m.mutex.Lock()
+		changes := []*Change{}
+		for _, change := range w.m.history {
+			if change.Index > w.index && strings.HasPrefix(change.Key, w.prefix) {
+				changes = append(changes, change)
+			}
+		}
+		w.index = w.m.index
+		changed := w.m.changed
+		w.m.mutex.Unlock()
+
+		if len(changes) > 0 {
+			return changes, nil
+		}
+
+		select {
+		case <-changed:
+		case <-cancel:
+			return nil, context.Canceled
+		}
+	}
+}
+
+func errorCode(err error) int {
+	if er, ok := err.(client.Error); ok {
+		return er.Code
+	}
+
+	return 0
+}
+
+func (s *keysSuite) TestKeys(c *C) {
+	ctx := context.Background()
+
+	_, err := s.keys.Get(ctx, "/volplugin/foo", nil)
+	c.Assert(errorCode(err), Equals, client.ErrorCodeKeyNotFound)
+
+	resp, err := s.keys.Create(ctx, "/volplugin/foo", "bar")
+	c.Assert(err, IsNil)
+	c.Assert(resp.Action, Equals, "create")
+	c.Assert(resp.Node.Key, Equals, "/volplugin/foo")
+	c.Assert(s.store.pairs["volplugin/foo"].Value, Equals, "bar")
+
+	_, err = s.keys.Create(ctx, "/volplugin/foo", "baz")
+	c.Assert(errorCode(err), Equals, client.ErrorCodeNodeExist)
+
+	_, err = s.keys.Set(ctx, "/volplugin/foo", "baz", &client.SetOptions{PrevValue: "quux"})
+	c.Assert(errorCode(err), Equals, client.ErrorCodeTestFailed)
+
+	resp, err = s.keys.Set(ctx, "/volplugin/foo", "baz", &client.SetOptions{PrevValue: "bar"})
+	c.Assert(err, IsNil)
+	c.Assert(resp.Action, Equals, "compareAndSwap")
+	c.Assert(resp.PrevNode.Value, Equals, "bar")
+
+	_, err = s.keys.Update(ctx, "/volplugin/missing", "bar")
+	c.Assert(errorCode(err), Equals, client.ErrorCodeKeyNotFound)
+
+	_, err = s.keys.Delete(ctx, "/volplugin/foo", &client.DeleteOptions{PrevValue: "bar"})
+	c.Assert(errorCode(err), Equals, client.ErrorCodeTestFailed)
+	resp, err = s.keys.Delete(ctx, "/volplugin/foo", &client.DeleteOptions{PrevValue: "baz"})
+	c.Assert(err, IsNil)
+	c.Assert(resp.Action, Equals, "compareAndDelete")
+	c.Assert(len(s.store.pairs), Equals, 0)
+}
+
+func (s *keysSuite) TestDirectories(c *C) {
+	ctx := context.Background()
+
+	// explicitly created directories exist while they are empty.
+	_, err := s.keys.Set(ctx, "/volplugin/volumes", "", &client.SetOptions{Dir: true})
+	c.Assert(err, IsNil)
+	c.Assert(s.store.pairs["volplugin/volumes/"], NotNil)
+
+	resp, err := s.keys.Get(ctx, "/volplugin/volumes", &client.GetOptions{Recursive: true})
+	c.Assert(err, IsNil)
+	c.Assert(resp.Node.Dir, Equals, true)
+	c.Assert(len(resp.Node.Nodes), Equals, 0)
+
+	_, err = s.keys.Set(ctx, "/volplugin/volumes", "value", nil)
+	c.Assert(errorCode(err), Equals, client.ErrorCodeNotFile)
+
+	_, err = s.keys.Set(ctx, "/volplugin/volumes/policy1/one/create", "1", nil)
+	c.Assert(err, IsNil)
+	_, err = s.keys.Set(ctx, "/volplugin/volumes/policy1/two/create", "2", nil)
+	c.Assert(err, IsNil)
+	_, err = s.keys.Set(ctx, "/volplugin/volumes/policy2", "", &client.SetOptions{Dir: true})
+	c.Assert(err, IsNil)
+
+	resp, err = s.keys.Get(ctx, "/volplugin/volumes", &client.GetOptions{Recursive: true})
+	c.Assert(err, IsNil)
+	c.Assert(len(resp.Node.Nodes), Equals, 2)
+	c.Assert(resp.Node.Nodes[0].Key, Equals, "/volplugin/volumes/policy1")
+	c.Assert(resp.Node.Nodes[0].Dir, Equals, true)
+	c.Assert(len(resp.Node.Nodes[0].Nodes), Equals, 2)
+	c.Assert(resp.Node.Nodes[0].Nodes[1].Nodes[0].Value, Equals, "2")
+	c.Assert(resp.Node.Nodes[1].Key, Equals, "/volplugin/volumes/policy2")
+	c.Assert(len(resp.Node.Nodes[1].Nodes), Equals, 0)
+
+	resp, err = s.keys.Get(ctx, "/volplugin/volumes", nil)
+	c.Assert(err, IsNil)
+	c.Assert(len(resp.Node.Nodes), Equals, 2)
+	c.Assert(resp.Node.Nodes[0].Nodes, IsNil)
+
+	_, err = s.keys.Delete(ctx, "/volplugin/volumes/policy1", nil)
+	c.Assert(errorCode(err), Equals, client.ErrorCodeNotFile)
+	_, err = s.keys.Delete(ctx, "/volplugin/volumes/policy1", &client.DeleteOptions{Dir: true})
+	c.Assert(errorCode(err), Equals, client.ErrorCodeDirNotEmpty)
+	_, err = s.keys.Delete(ctx, "/volplugin/volumes/policy2", &client.DeleteOptions{Dir: true})
+	c.Assert(err, IsNil)
+
+	resp, err = s.keys.Delete(ctx, "/volplugin/volumes/policy1", &client.DeleteOptions{Recursive: true})
+	c.Assert(err, IsNil)
+	c.Assert(resp.Node.Dir, Equals, true)
+
+	_, err = s.keys.Get(ctx, "/volplugin/volumes/policy1/one/create", nil)
+	c.Assert(errorCode(err), Equals, client.ErrorCodeKeyNotFound)
+	c.Assert(len(s.store.pairs), Equals, 1)
+}
+
+func (s *keysSuite) TestCreateInOrder(c *C) {
+	ctx := context.Background()
+
+	first, err := s.keys.CreateInOrder(ctx, "/volplugin/audit", "first", nil)
+	c.Assert(err, IsNil)
+	second, err := s.keys.CreateInOrder(ctx, "/volplugin/audit", "second", nil)
+	c.Assert(err, IsNil)
+	c.Assert(first.Node.Key < second.Node.Key, Equals, true)
+
+	resp, err := s.keys.Get(ctx, "/volplugin/audit", &client.GetOptions{Sort: true})
+	c.Assert(err, IsNil)
+	c.Assert(resp.Node.Nodes[0].Value, Equals, "first")
+	c.Assert(resp.Node.Nodes[1].Value, Equals, "second")
+}
+
+func (s *keysSuite) TestWatcher(c *C) {
+	ctx := context.Background()
+
+	watcher := s.keys.Watcher("/volplugin/volumes", &client.WatcherOptions{Recursive: true})
+	single := s.keys.Watcher("/volplugin/global-config", nil)
+
+	_, err := s.keys.Set(ctx, "/volplugin/global-config", "{}", nil)
+	c.Assert(err, IsNil)
+	_, err = s.keys.Set(ctx, "/volplugin/volumes/policy1/foo/create", "{}", nil)
+	c.Assert(err, IsNil)
+	_, err = s.keys.Delete(ctx, "/volplugin/volumes/policy1/foo/create", nil)
+	c.Assert(err, IsNil)
+
+	resp, err := watcher.Next(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Action, Equals, "set")
+	c.Assert(resp.Node.Key, Equals, "/volplugin/volumes/policy1/foo/create")
+	c.Assert(resp.Node.Value, Equals, "{}")
+
+	resp, err = watcher.Next(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Action, Equals, "delete")
+	c.Assert(resp.PrevNode.Value, Equals, "{}")
+
+	resp, err = single.Next(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Node.Key, Equals, "/volplugin/global-config")
+
+	// directory markers are reported as directories.
+	_, err = s.keys.Set(ctx, "/volplugin/volumes/policy2", "", &client.SetOptions{Dir: true})
+	c.Assert(err, IsNil)
+	resp, err = watcher.Next(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Node.Key, Equals, "/volplugin/volumes/policy2")
+	c.Assert(resp.Node.Dir, Equals, true)
+
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err = watcher.Next(ctx)
+	c.Assert(err, Equals, context.DeadlineExceeded)
+}
+
+// txnMapStore is a mapStore with transactions. Leases are handed out but
+// never expire.
+type txnMapStore struct {
+	*mapStore
+	lease int64
+}
+
+func (m *txnMapStore) Txn(ops []*Op) (bool, error) {
+	m.mutex.Lock()
+	for _, op := range ops {
+		if !m.holds(op.Key, op.Index) {
+			m.mutex.Unlock()
+			return false, nil
+		}
+	}
+	m.mutex.Unlock()
+
+	for _, op := range ops {
+		if _, _, err := m.Put(op.Key, op.Value, Unconditional, 0); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (m *txnMapStore) Grant(ttl time.Duration) (int64, error) {
+	m.lease++
+	return m.lease, nil
+}
+
+func (m *txnMapStore) KeepAlive(lease int64) error { return nil }
+func (m *txnMapStore) Revoke(lease int64) error    { return nil }
+
+func (s *keysSuite) TestTxn(c *C) {
+	_, ok := s.keys.(Transactor)
+	c.Assert(ok, Equals, false)
+
+	keys := New(&txnMapStore{mapStore: s.store})
+	txn, ok := keys.(Transactor)
+	c.Assert(ok, Equals, true)
+	_, ok = keys.(Leaser)
+	c.Assert(ok, Equals, true)
+
+	c.Assert(txn.Txn([]*Op{
+		{Key: "/volplugin/foo", Value: "bar", Index: 0},
+		{Key: "/volplugin/baz", Value: "quux", Index: Unconditional},
+	}), IsNil)
+	c.Assert(s.store.pairs["volplugin/foo"].Value, Equals, "bar")
+	c.Assert(s.store.pairs["volplugin/baz"].Value, Equals, "quux")
+
+	// foo exists, so none of the writes happen.
+	err := txn.Txn([]*Op{
+		{Key: "/volplugin/baz", Value: "changed", Index: Unconditional},
+		{Key: "/volplugin/foo", Value: "changed", Index: 0},
+	})
+	c.Assert(errorCode(err), Equals, client.ErrorCodeTestFailed)
+	c.Assert(s.store.pairs["volplugin/foo"].Value, Equals, "bar")
+	c.Assert(s.store.pairs["volplugin/baz"].Value, Equals, "quux")
+
+	c.Assert(txn.Txn([]*Op{
+		{Key: "/volplugin/foo", Value: "changed", Index: s.store.pairs["volplugin/foo"].ModifyIndex},
+	}), IsNil)
+	c.Assert(s.store.pairs["volplugin/foo"].Value, Equals, "changed")
+}
@@ -0,0 +1,82 @@
+package keysapi
+
+import (
+	"time"
+
+	"github.com/coreos/etcd/client"
+)
+
+// Op is a write of a transaction. Index is the condition of the write, like
+// for Store.Put. Lease attaches the key to a lease from Leaser.Grant; 0
+// attaches it to none.
+type Op struct {
+	Key   string
+	Value string
+	Index uint64
+	Lease int64
+}
+
+// Transactor is implemented by keys APIs which can write several keys
+// atomically. Txn applies all the writes if all their conditions hold, and
+// none otherwise, in which case it returns the etcd error
+// client.ErrorCodeTestFailed. The keys of the ops are etcd keys.
+type Transactor interface {
+	Txn(ops []*Op) error
+}
+
+// Leaser is implemented by stores, and keys APIs, which can attach keys to
+// leases. The keys attached to a lease are removed when it is revoked, or
+// when it is not kept alive within its TTL. KeepAlive fails once the lease
+// is gone.
+type Leaser interface {
+	Grant(ttl time.Duration) (int64, error)
+	KeepAlive(lease int64) error
+	Revoke(lease int64) error
+}
+
+// TxnStore is a Store with transactions and leases. The keys API over it is a
+// Transactor and a Leaser.
+type TxnStore interface {
+	Store
+	Leaser
+
+	// Txn applies all the writes if all their conditions hold, and reports
+	// whether it did.
+	Txn(ops []*Op) (bool, error)
+}
+
+// txnKeysAPI is the keys API over a TxnStore.
+type txnKeysAPI struct {
+	*keysAPI
+	store TxnStore
+}
+
+func (k *txnKeysAPI) Txn(ops []*Op) error {
+	storeOps := []*Op{}
+	for _, op := range ops {
+		storeOps = append(storeOps, &Op{Key: normalize(op.Key), Value: op.Value, Index: op.Index, Lease: op.Lease})
+	}
+
+	ok, err := k.store.Txn(storeOps)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return keyError(client.ErrorCodeTestFailed, "Compare failed", storeOps[0].Key, 0)
+	}
+
+	return nil
+}
+
+func (k *txnKeysAPI) Grant(ttl time.Duration) (int64, error) {
+	return k.store.Grant(ttl)
+}
+
+func (k *txnKeysAPI) KeepAlive(lease int64) error {
+	return k.store.KeepAlive(lease)
+}
+
+func (k *txnKeysAPI) Revoke(lease int64) error {
+	return k.store.Revoke(lease)
+}
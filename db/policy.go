@@ -5,6 +5,7 @@ import (
 
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/labels"
 )
 
 // NewPolicy creates a policy struct with the required parameters for using it.
@@ -56,6 +57,10 @@ func (p *Policy) Validate() error {
 		return errors.ErrJSONValidation.Combine(err)
 	}
 
+	if err := labels.Validate(p.Labels); err != nil {
+		return err
+	}
+
 	if p.Backends == nil { // backend should be defined and its validated
 		backends, ok := DefaultDrivers[p.Backend]
 
@@ -70,6 +75,18 @@ func (p *Policy) Validate() error {
 		return errored.Errorf("Size set to zero for non-empty CRUD backend %v", p.Backends.CRUD).Combine(err)
 	}
 
+	if p.Quota != nil {
+		if _, err := (&CreateOptions{Size: p.Quota.Size}).ActualSize(); err != nil {
+			return errored.Errorf("Invalid size quota %q", p.Quota.Size).Combine(err)
+		}
+
+		// the scheduled snapshots are pruned after a new one is taken, so there
+		// must be room for one more than are kept.
+		if p.RuntimeOptions != nil && p.RuntimeOptions.UseSnapshots && p.Quota.Snapshots > 0 && p.RuntimeOptions.Snapshot.Keep >= p.Quota.Snapshots {
+			return errored.Errorf("Policy keeps %d snapshots, but its quota only allows %d", p.RuntimeOptions.Snapshot.Keep, p.Quota.Snapshots)
+		}
+	}
+
 	return nil
 }
 
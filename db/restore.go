@@ -0,0 +1,34 @@
+package db
+
+// RestoreMode describes what Restore does with keys which already exist in
+// the database.
+type RestoreMode int
+
+const (
+	// RestoreFailExisting refuses to restore anything if any of the keys
+	// already exist. It is the default.
+	RestoreFailExisting RestoreMode = iota
+	// RestoreSkipExisting leaves the existing keys alone and restores the rest.
+	RestoreSkipExisting
+	// RestoreOverwrite replaces the existing keys with the tarball's contents.
+	RestoreOverwrite
+)
+
+// RestoreOptions are the options to Client.Restore.
+type RestoreOptions struct {
+	// SourcePrefix is the prefix the tarball was dumped from. Only the keys
+	// under it are restored, and it is rewritten to the client's prefix, so a
+	// dump may be cloned into another prefix. Defaults to the client's prefix.
+	SourcePrefix string
+	// Mode is what to do with existing keys.
+	Mode RestoreMode
+	// DryRun reports what would be restored without writing anything.
+	DryRun bool
+}
+
+// RestoreResult reports what Restore did, or would have done in a dry run.
+// Keys are relative to the client's prefix.
+type RestoreResult struct {
+	Restored []string `json:"restored"`
+	Skipped  []string `json:"skipped"`
+}
@@ -11,10 +11,26 @@ var (
 				"snapshot": {
 					"type": "object",
 					"properties": {
-						"frequency": { "type": "string", "pattern": "^[0-9]+.$", "minLength": 1 },
-						"keep": { "type": "number", "minimum": 1 }
+						"frequency": { "type": "string", "pattern": "^([0-9]+.)?$" },
+						"schedule": { "type": "string" },
+						"jitter": { "type": "string" },
+						"keep": { "type": "number", "minimum": 1 },
+						"keep-hourly": { "type": "number", "minimum": 0 },
+						"keep-daily": { "type": "number", "minimum": 0 },
+						"keep-weekly": { "type": "number", "minimum": 0 },
+						"keep-monthly": { "type": "number", "minimum": 0 },
+						"max-age": { "type": "string" },
+						"consistent": { "type": "boolean" },
+						"freeze-timeout": { "type": "string" },
+						"pre-hook": { "type": "string" },
+						"post-hook": { "type": "string" },
+						"hook-timeout": { "type": "string" }
 					},
-					"required": [ "frequency", "keep" ]
+					"anyOf": [
+						{ "properties": { "frequency": { "minLength": 1 } }, "required": [ "frequency" ] },
+						{ "properties": { "schedule": { "minLength": 1 } }, "required": [ "schedule" ] }
+					],
+					"required": [ "keep" ]
 				}
 			}
 			},
@@ -31,13 +47,13 @@ var (
 			"backends": {
 				"type": "object",
 				"properties": {
-					"mount": { "type": "string", "minLength": 1, "enum": [ "ceph", "nfs" ] },
-					"crud": { "type": "string", "enum": [ "ceph", "" ] },
-					"snapshot": { "type": "string", "enum": [ "ceph", "" ] }
+					"mount": { "type": "string", "minLength": 1, "enum": [ "ceph", "loopback", "lvm", "nfs" ] },
+					"crud": { "type": "string", "enum": [ "ceph", "loopback", "lvm", "" ] },
+					"snapshot": { "type": "string", "enum": [ "ceph", "loopback", "lvm", "" ] }
 				},
 				"required": [ "mount" ]
 			},
-			"backend": { "enum": [ "ceph", "nfs" ] }
+			"backend": { "enum": [ "ceph", "loopback", "lvm", "nfs" ] }
 		},
 		"anyOf": [
 			{ "required": [ "backend" ] },
@@ -56,9 +72,9 @@ var (
 			"backends": {
 				"type": "object",
 				"properties": {
-					"mount": { "type": "string", "minLength": 1, "enum": [ "ceph", "nfs" ] },
-					"crud": { "type": "string", "enum": [ "ceph", "" ] },
-					"snapshot": { "type": "string", "enum": [ "ceph", "" ] }
+					"mount": { "type": "string", "minLength": 1, "enum": [ "ceph", "loopback", "lvm", "nfs" ] },
+					"crud": { "type": "string", "enum": [ "ceph", "loopback", "lvm", "" ] },
+					"snapshot": { "type": "string", "enum": [ "ceph", "loopback", "lvm", "" ] }
 				},
 				"required": [ "mount" ]
 			}
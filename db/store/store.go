@@ -0,0 +1,138 @@
+// Package store parses the --store URLs accepted by the volplugin daemons and
+// tools, and yields the matching db.Client, or the config.Client the daemons
+// are built on.
+//
+// Store URLs take the form `etcd://host:port[,host:port...]` (etcd v2),
+// `etcd3://host:port[,host:port...]` or `consul://host:port`. The scheme may
+// be suffixed with `+https`, e.g. `etcd+https://host:2379`, to talk to the
+// store over TLS. `memory://` keeps the data in memory, and
+// `memory:///path/to/file` persists it to a file; it is only a db.Client,
+// since the daemons are separate processes and could not share it.
+package store
+
+import (
+	"strings"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/db"
+	"github.com/contiv/volplugin/db/impl/consul"
+	"github.com/contiv/volplugin/db/impl/etcd"
+	"github.com/contiv/volplugin/db/impl/etcd3"
+	"github.com/contiv/volplugin/db/impl/memory"
+)
+
+const (
+	// Etcd is the name of the etcd v2 store.
+	Etcd = "etcd"
+	// Etcd3 is the name of the etcd v3 store.
+	Etcd3 = "etcd3"
+	// Consul is the name of the consul store.
+	Consul = "consul"
+	// Memory is the name of the in-memory store.
+	Memory = "memory"
+)
+
+// Store is a parsed store URL.
+type Store struct {
+	// Name is the kind of store; Etcd, Etcd3, Consul or Memory.
+	Name string
+	// Hosts are the URLs of the store's endpoints.
+	Hosts []string
+	// File is where a Memory store is persisted; empty if it is not.
+	File string
+}
+
+// Parse parses a store URL.
+func Parse(url string) (*Store, error) {
+	parts := strings.SplitN(url, "://", 2)
+	if len(parts) == 2 && parts[0] == Memory {
+		return &Store{Name: Memory, File: parts[1]}, nil
+	}
+
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, errored.Errorf("Invalid store %q: must be of the form etcd://host:port, etcd3://host:port or consul://host:port", url)
+	}
+
+	name, scheme := parts[0], "http"
+	if strings.HasSuffix(name, "+https") {
+		name, scheme = strings.TrimSuffix(name, "+https"), "https"
+	}
+
+	switch name {
+	case Etcd, Etcd3, Consul:
+	default:
+		return nil, errored.Errorf("Invalid store %q: unknown store %q", url, name)
+	}
+
+	store := &Store{Name: name}
+	for _, host := range strings.Split(parts[1], ",") {
+		if host == "" {
+			return nil, errored.Errorf("Invalid store %q: empty host", url)
+		}
+
+		store.Hosts = append(store.Hosts, scheme+"://"+host)
+	}
+
+	if name == Consul && len(store.Hosts) > 1 {
+		return nil, errored.Errorf("Invalid store %q: consul takes the address of a single agent", url)
+	}
+
+	return store, nil
+}
+
+// NewClient returns a db.Client for the store.
+func (s *Store) NewClient(prefix string) (db.Client, error) {
+	switch s.Name {
+	case Consul:
+		return consul.NewClient(s.Hosts[0], prefix)
+	case Etcd3:
+		return etcd3.NewClient(s.Hosts, prefix)
+	case Memory:
+		if s.File == "" {
+			return memory.NewClient(prefix), nil
+		}
+		return memory.NewPersistentClient(prefix, s.File)
+	default:
+		return etcd.NewClient(s.Hosts, prefix)
+	}
+}
+
+// NewConfigClient returns the config.Client for the store URL, or for the
+// etcd hosts in fallback if the URL is empty. Stores other than etcd v2 are
+// reached through their etcd v2 keys API; see the NewKeysAPI functions of
+// their db clients.
+func NewConfigClient(url, prefix string, fallback []string) (*config.Client, error) {
+	if url == "" {
+		return config.NewClient(prefix, fallback)
+	}
+
+	s, err := Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	switch s.Name {
+	case Etcd:
+		return config.NewClient(prefix, s.Hosts)
+	case Consul:
+		keysAPI, err := consul.NewKeysAPI(s.Hosts[0])
+		if err != nil {
+			return nil, err
+		}
+		return config.NewClientFromKeysAPI(prefix, keysAPI), nil
+	case Etcd3:
+		keysAPI, err := etcd3.NewKeysAPI(s.Hosts)
+		if err != nil {
+			return nil, err
+		}
+		return config.NewClientFromKeysAPI(prefix, keysAPI), nil
+	case Memory:
+		// apiserver, volplugin and volsupervisor each run in their own process,
+		// and would each see their own copy of the data, or overwrite each
+		// other's file. Run them on etcd or consul, even on a single host.
+		return nil, errored.Errorf("Store %q cannot be shared between the daemons; use etcd or consul", s.Name)
+	default:
+		return nil, errored.Errorf("Store %q is not supported by the daemons yet", s.Name)
+	}
+}
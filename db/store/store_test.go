@@ -0,0 +1,59 @@
+package store
+
+import (
+	. "testing"
+
+	. "gopkg.in/check.v1"
+)
+
+type storeSuite struct{}
+
+var _ = Suite(&storeSuite{})
+
+func TestStore(t *T) { TestingT(t) }
+
+func (s *storeSuite) TestParse(c *C) {
+	store, err := Parse("etcd://host1:2379,host2:2379")
+	c.Assert(err, IsNil)
+	c.Assert(store.Name, Equals, Etcd)
+	c.Assert(store.Hosts, DeepEquals, []string{"http://host1:2379", "http://host2:2379"})
+
+	store, err = Parse("etcd3://host1:2379")
+	c.Assert(err, IsNil)
+	c.Assert(store.Name, Equals, Etcd3)
+	c.Assert(store.Hosts, DeepEquals, []string{"http://host1:2379"})
+
+	store, err = Parse("consul+https://localhost:8501")
+	c.Assert(err, IsNil)
+	c.Assert(store.Name, Equals, Consul)
+	c.Assert(store.Hosts, DeepEquals, []string{"https://localhost:8501"})
+
+	store, err = Parse("memory://")
+	c.Assert(err, IsNil)
+	c.Assert(store.Name, Equals, Memory)
+	c.Assert(store.File, Equals, "")
+
+	store, err = Parse("memory:///var/lib/volplugin/db.json")
+	c.Assert(err, IsNil)
+	c.Assert(store.File, Equals, "/var/lib/volplugin/db.json")
+
+	for _, url := range []string{"", "localhost:2379", "etcd://", "zookeeper://localhost:2181", "etcd://host1,", "consul://host1,host2"} {
+		_, err := Parse(url)
+		c.Assert(err, NotNil, Commentf("%q", url))
+	}
+}
+
+func (s *storeSuite) TestNewConfigClient(c *C) {
+	_, err := NewConfigClient("bogus", "/volplugin", nil)
+	c.Assert(err, NotNil)
+
+	_, err = NewConfigClient("memory:///var/lib/volplugin/db.json", "/volplugin", nil)
+	c.Assert(err, ErrorMatches, ".*cannot be shared between the daemons.*")
+
+	// nothing listens there.
+	_, err = NewConfigClient("consul://127.0.0.1:1", "/volplugin", nil)
+	c.Assert(err, ErrorMatches, "Initial setup.*")
+
+	_, err = NewConfigClient("etcd3://127.0.0.1:1", "/volplugin", nil)
+	c.Assert(err, ErrorMatches, "Initial setup.*")
+}
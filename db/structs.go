@@ -15,6 +15,20 @@ type Policy struct {
 	FileSystems    map[string]string `json:"filesystems"`
 	Backends       *BackendDrivers   `json:"backends,omitempty"`
 	Backend        string            `json:"backend,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty" merge:"label.*"`
+	Quota          *Quota            `json:"quota,omitempty"`
+}
+
+// Quota limits what the volumes of a policy may use. Zero values are
+// unlimited.
+type Quota struct {
+	// Volumes is the maximum number of volumes in the policy.
+	Volumes uint `json:"volumes,omitempty"`
+	// Size is the maximum total provisioned size of the volumes in the
+	// policy, e.g. "100GB".
+	Size string `json:"size,omitempty"`
+	// Snapshots is the maximum number of snapshots of each volume.
+	Snapshots uint `json:"snapshots,omitempty"`
 }
 
 // BackendDrivers is a struct containing all the drivers used under this policy
@@ -38,6 +52,15 @@ type Global struct {
 	Timeout   time.Duration
 	TTL       time.Duration
 	MountPath string
+	// PolicyRevisions is the number of revisions kept in the archive of each
+	// policy. 0 keeps them all.
+	PolicyRevisions uint
+	// PolicyRevisionDays is the number of days revisions are kept in the
+	// archive. 0 keeps them forever.
+	PolicyRevisionDays uint
+	// AuditDays is the number of days entries are kept in the audit log. 0
+	// keeps them forever.
+	AuditDays uint
 }
 
 // UseMount is the mount locking mechanism for users. Users are hosts,
@@ -81,6 +104,7 @@ type Volume struct {
 	CreateOptions  CreateOptions     `json:"create"`
 	RuntimeOptions *RuntimeOptions   `json:"runtime"`
 	Backends       *BackendDrivers   `json:"backends,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty" merge:"label.*"`
 }
 
 // CreateOptions are the set of options used by apiserver during the volume
@@ -109,6 +133,42 @@ type RateLimitConfig struct {
 
 // SnapshotConfig is the configuration for snapshots.
 type SnapshotConfig struct {
+	// Frequency takes a snapshot at every multiple of this duration since
+	// the Unix epoch. Schedule replaces it if both are set.
 	Frequency string `json:"frequency" merge:"snapshots.frequency"`
-	Keep      uint   `json:"keep" merge:"snapshots.keep"`
+	// Schedule is a cron expression of when to take snapshots, e.g.
+	// "0 2 * * *" for 02:00 daily, in the time zone of volsupervisor.
+	Schedule string `json:"schedule,omitempty" merge:"snapshots.schedule"`
+	// Jitter is the longest a snapshot may be delayed, so the snapshots of
+	// different volumes are spread out. Each volume is always delayed by the
+	// same amount. If empty, it is a tenth of the interval, and at most a
+	// minute.
+	Jitter string `json:"jitter,omitempty" merge:"snapshots.jitter"`
+	// Keep is how many of the newest snapshots are kept.
+	Keep uint `json:"keep" merge:"snapshots.keep"`
+	// KeepHourly, KeepDaily, KeepWeekly and KeepMonthly also keep the newest
+	// snapshot of each of the last that many hours, days, ISO weeks and
+	// months (in UTC) which have snapshots.
+	KeepHourly  uint `json:"keep-hourly,omitempty" merge:"snapshots.keep.hourly"`
+	KeepDaily   uint `json:"keep-daily,omitempty" merge:"snapshots.keep.daily"`
+	KeepWeekly  uint `json:"keep-weekly,omitempty" merge:"snapshots.keep.weekly"`
+	KeepMonthly uint `json:"keep-monthly,omitempty" merge:"snapshots.keep.monthly"`
+	// MaxAge is a duration after which snapshots are removed even if the
+	// tiers above keep them. The newest Keep snapshots are never removed for
+	// their age. Empty keeps them forever.
+	MaxAge string `json:"max-age,omitempty" merge:"snapshots.max-age"`
+	// Consistent freezes the filesystem of the volume on the host mounting it
+	// while the snapshot is taken, so the snapshot is consistent rather than
+	// only crash-consistent.
+	Consistent bool `json:"consistent,omitempty" merge:"snapshots.consistent"`
+	// FreezeTimeout is the longest the filesystem stays frozen; it is thawed
+	// after it even if the snapshot is not done. If empty, it is ten seconds.
+	FreezeTimeout string `json:"freeze-timeout,omitempty" merge:"snapshots.freeze-timeout"`
+	// PreHook and PostHook are shell commands run in each container using the
+	// volume, on the host mounting it, before and after the snapshot; e.g. to
+	// flush a database. The snapshot is not taken if PreHook fails.
+	PreHook  string `json:"pre-hook,omitempty" merge:"snapshots.pre-hook"`
+	PostHook string `json:"post-hook,omitempty" merge:"snapshots.post-hook"`
+	// HookTimeout is the longest each hook may run. If empty, it is thirty seconds.
+	HookTimeout string `json:"hook-timeout,omitempty" merge:"snapshots.hook-timeout"`
 }
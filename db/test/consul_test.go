@@ -0,0 +1,185 @@
+package test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/db/impl/consul"
+	"github.com/coreos/etcd/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/coreos/etcd/client"
+)
+
+// these tests require a local `consul agent -dev`.
+
+var consulAddress = "127.0.0.1:8500"
+
+type consulSuite struct {
+	client *consul.Client
+	kv     *consul.KV
+}
+
+var _ = Suite(&consulSuite{})
+
+func (s *consulSuite) SetUpTest(c *C) {
+	s.kv = consul.NewKV(consulAddress)
+	c.Assert(s.kv.Delete("volplugin", true), IsNil)
+
+	var err error
+	s.client, err = consul.NewClient(consulAddress, "/volplugin")
+	c.Assert(err, IsNil)
+	c.Assert(s.client.Prefix(), Equals, "volplugin")
+}
+
+func (s *consulSuite) TestCRUD(c *C) {
+	te := newTestEntity("test", "data")
+	c.Assert(s.client.Get(te), NotNil)
+	c.Assert(s.client.Set(te), IsNil)
+
+	te = newTestEntity("test", "")
+	c.Assert(s.client.Get(te), IsNil)
+	c.Assert(te.SomeData, Equals, "data")
+
+	pair, err := s.kv.Get("volplugin/test/test")
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(string(pair.Value), `"SomeData":"data"`), Equals, true)
+
+	// a key sharing the prefix of the entity collection must not be listed.
+	c.Assert(s.kv.Put("volplugin/testing", []byte("{}")), IsNil)
+
+	entities, err := s.client.List(te)
+	c.Assert(err, IsNil)
+	c.Assert(len(entities), Equals, 1)
+	c.Assert(entities[0].(*testEntity).Name, Equals, "test")
+	c.Assert(entities[0].(*testEntity).SomeData, Equals, "data")
+
+	c.Assert(s.client.Delete(te), IsNil)
+	c.Assert(s.client.Get(te), NotNil)
+	c.Assert(s.client.Delete(te), NotNil)
+
+	te.FailsValidation = true
+	c.Assert(s.client.Set(te), NotNil)
+}
+
+func (s *consulSuite) TestCAS(c *C) {
+	ok, err := s.kv.CAS("volplugin/cas", []byte("one"), 0)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+
+	ok, err = s.kv.CAS("volplugin/cas", []byte("two"), 0)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+
+	pair, err := s.kv.Get("volplugin/cas")
+	c.Assert(err, IsNil)
+
+	ok, err = s.kv.CAS("volplugin/cas", []byte("two"), pair.ModifyIndex)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+
+	ok, err = s.kv.CAS("volplugin/cas", []byte("three"), pair.ModifyIndex)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
+func (s *consulSuite) TestLongTTL(c *C) {
+	// sessions cannot hold keys for longer than a day.
+	_, err := s.kv.CreateSession(48 * time.Hour)
+	c.Assert(err, NotNil)
+
+	keys, err := consul.NewKeysAPI(consulAddress)
+	c.Assert(err, IsNil)
+
+	ttl := 30 * 24 * time.Hour
+	expires := time.Now().Add(ttl)
+
+	_, err = keys.CreateInOrder(context.Background(), "/volplugin/audit", "entry", &client.CreateInOrderOptions{TTL: ttl})
+	c.Assert(err, IsNil)
+
+	resp, err := keys.Get(context.Background(), "/volplugin/audit", &client.GetOptions{Recursive: true})
+	c.Assert(err, IsNil)
+	c.Assert(len(resp.Node.Nodes), Equals, 1)
+
+	node := resp.Node.Nodes[0]
+	c.Assert(node.Value, Equals, "entry")
+	c.Assert(node.Expiration, NotNil)
+	c.Assert(node.Expiration.Sub(expires) < time.Second && expires.Sub(*node.Expiration) < time.Second, Equals, true)
+	c.Assert(node.TTL > int64((ttl-time.Minute)/time.Second), Equals, true)
+
+	pair, err := s.kv.Get(strings.TrimPrefix(node.Key, "/"))
+	c.Assert(err, IsNil)
+	c.Assert(pair.Session, Equals, "")
+}
+
+func (s *consulSuite) TestWatch(c *C) {
+	te := newTestEntity("test", "")
+	c.Assert(s.client.Set(te), IsNil)
+
+	retChan, errChan := s.client.WatchPrefix(te)
+
+	for i := 0; i < 5; i++ {
+		te2 := te.Copy().(*testEntity)
+		te2.SomeData = fmt.Sprintf("data%d", i)
+		c.Assert(s.client.Set(te2), IsNil)
+
+		select {
+		case err := <-errChan:
+			c.Assert(err, IsNil, Commentf("select: %v", err)) // this will always fail, assert is just to raise the error.
+		case ent := <-retChan:
+			te, ok := ent.(*testEntity)
+			c.Assert(ok, Equals, true)
+			c.Assert(te.Name, Equals, "test")
+			c.Assert(te.SomeData, Equals, fmt.Sprintf("data%d", i))
+		}
+	}
+
+	c.Assert(s.client.WatchPrefixStop(te), IsNil)
+	c.Assert(s.client.WatchPrefixStop(te), NotNil)
+}
+
+func (s *consulSuite) TestDump(c *C) {
+	c.Assert(s.kv.Put("volplugin/foo/bar", []byte("baz")), IsNil)
+
+	tarballPath, err := s.client.Dump("")
+	c.Assert(err, IsNil)
+	defer os.Remove(tarballPath)
+
+	tarballFilename := filepath.Base(tarballPath)
+	dirName := tarballFilename[:strings.LastIndex(tarballFilename, ".tar.gz")]
+
+	file, err := os.Open(tarballPath)
+	c.Assert(err, IsNil)
+	defer file.Close()
+
+	gzReader, err := gzip.NewReader(file)
+	c.Assert(err, IsNil)
+	tarReader := tar.NewReader(gzReader)
+
+	names := map[string]string{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+
+		var b bytes.Buffer
+		_, err = io.Copy(&b, tarReader)
+		c.Assert(err, IsNil)
+		names[header.Name] = b.String()
+	}
+
+	c.Assert(names, DeepEquals, map[string]string{
+		dirName + "/volplugin":         "",
+		dirName + "/volplugin/foo":     "",
+		dirName + "/volplugin/foo/bar": "baz",
+	})
+}
@@ -0,0 +1,190 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/db"
+	"github.com/contiv/volplugin/db/impl/etcd3"
+	"github.com/contiv/volplugin/errors"
+)
+
+// these tests require etcd 3.4 or later, whose gRPC gateway serves /v3. The
+// VMs run etcd v2, so they are skipped unless ETCD3_HOSTS points at one, e.g.
+// ETCD3_HOSTS=http://127.0.0.1:2379.
+
+var etcd3Hosts = strings.Split(os.Getenv("ETCD3_HOSTS"), ",")
+
+type etcd3Suite struct {
+	client *etcd3.Client
+	kv     *etcd3.KV
+}
+
+var _ = Suite(&etcd3Suite{})
+
+type testUse struct {
+	Volume   string
+	Hostname string
+	mayExist bool
+}
+
+func (t *testUse) GetVolume() string { return t.Volume }
+func (t *testUse) GetReason() string { return "test" }
+func (t *testUse) Type() string      { return "mount" }
+func (t *testUse) MayExist() bool    { return t.mayExist }
+
+func (s *etcd3Suite) SetUpSuite(c *C) {
+	if os.Getenv("ETCD3_HOSTS") == "" {
+		c.Skip("ETCD3_HOSTS is not set")
+	}
+
+	if _, _, err := etcd3.NewKV(etcd3Hosts).GetRevision("/volplugin"); err != nil {
+		c.Skip(fmt.Sprintf("etcd v3 is unreachable at %v: %v", etcd3Hosts, err))
+	}
+}
+
+func (s *etcd3Suite) SetUpTest(c *C) {
+	s.kv = etcd3.NewKV(etcd3Hosts)
+	c.Assert(s.kv.Delete("/volplugin", true), IsNil)
+
+	var err error
+	s.client, err = etcd3.NewClient(etcd3Hosts, "volplugin")
+	c.Assert(err, IsNil)
+	c.Assert(s.client.Prefix(), Equals, "/volplugin")
+}
+
+func (s *etcd3Suite) TestPrefixEnd(c *C) {
+	c.Assert(etcd3.PrefixEnd([]byte("/volplugin/")), DeepEquals, []byte("/volplugin0"))
+	c.Assert(etcd3.PrefixEnd([]byte{'a', 0xff}), DeepEquals, []byte{'b'})
+	c.Assert(etcd3.PrefixEnd([]byte{0xff}), DeepEquals, []byte{0})
+}
+
+func (s *etcd3Suite) TestCRUD(c *C) {
+	te := newTestEntity("test", "data")
+	c.Assert(s.client.Get(te), NotNil)
+	c.Assert(s.client.Set(te), IsNil)
+
+	te = newTestEntity("test", "")
+	c.Assert(s.client.Get(te), IsNil)
+	c.Assert(te.SomeData, Equals, "data")
+
+	_, err := s.kv.Get("/volplugin/test/test")
+	c.Assert(err, IsNil)
+
+	entities, err := s.client.List(te)
+	c.Assert(err, IsNil)
+	c.Assert(len(entities), Equals, 1)
+	c.Assert(entities[0].(*testEntity).SomeData, Equals, "data")
+
+	c.Assert(s.client.Delete(te), IsNil)
+	c.Assert(s.client.Get(te), NotNil)
+	c.Assert(s.client.Delete(te), Equals, errors.NotExists)
+}
+
+func (s *etcd3Suite) TestSetAll(c *C) {
+	good := newTestEntity("good", "data")
+	bad := newTestEntity("bad", "data")
+	bad.FailsValidation = true
+
+	c.Assert(s.client.SetAll(good, bad), NotNil)
+	c.Assert(s.client.Get(newTestEntity("good", "")), NotNil)
+
+	other := newTestEntity("other", "data")
+	c.Assert(s.client.SetAll(good, other), IsNil)
+
+	entities, err := s.client.List(good)
+	c.Assert(err, IsNil)
+	c.Assert(len(entities), Equals, 2)
+}
+
+func (s *etcd3Suite) TestPublishPolicy(c *C) {
+	policy := testPolicies["basic"].Copy().(*db.Policy)
+	c.Assert(s.client.PublishPolicy(policy), IsNil)
+
+	c.Assert(s.client.Get(db.NewPolicy(policy.Name)), IsNil)
+
+	kvs, _, err := s.kv.List("/volplugin/policy-archives/" + policy.Name + "/")
+	c.Assert(err, IsNil)
+	c.Assert(len(kvs), Equals, 1)
+
+	bad := testPolicies["nobackend"].Copy().(*db.Policy)
+	bad.Name = policy.Name
+	c.Assert(s.client.PublishPolicy(bad), NotNil)
+
+	kvs, _, err = s.kv.List("/volplugin/policy-archives/" + policy.Name + "/")
+	c.Assert(err, IsNil)
+	c.Assert(len(kvs), Equals, 1)
+}
+
+func (s *etcd3Suite) TestAcquireUses(c *C) {
+	uses := []db.UseLocker{&testUse{Volume: "policy1/foo", Hostname: "mon0"}, &testUse{Volume: "policy1/bar", Hostname: "mon0"}}
+
+	lease, err := s.client.AcquireUses(2*time.Second, uses...)
+	c.Assert(err, IsNil)
+
+	// a second acquisition of either use must fail, and acquire nothing.
+	_, err = s.client.AcquireUses(2*time.Second, &testUse{Volume: "policy1/baz", Hostname: "mon1"}, &testUse{Volume: "policy1/bar", Hostname: "mon1"})
+	c.Assert(err, Equals, errors.LockFailed)
+	_, err = s.kv.Get("/volplugin/users/mount/policy1/baz")
+	c.Assert(err, Equals, errors.NotExists)
+
+	// identical uses which may exist are taken over.
+	takeover, err := s.client.AcquireUses(2*time.Second, &testUse{Volume: "policy1/foo", Hostname: "mon0", mayExist: true})
+	c.Assert(err, IsNil)
+	c.Assert(takeover.Release(), IsNil)
+	c.Assert(lease.Release(), IsNil)
+
+	// the lock survives past its TTL while kept alive.
+	lease, err = s.client.AcquireUses(2*time.Second, uses[1])
+	c.Assert(err, IsNil)
+	errChan := lease.KeepAlive()
+	time.Sleep(3 * time.Second)
+	select {
+	case err := <-errChan:
+		c.Fatal(err)
+	default:
+	}
+	_, err = s.kv.Get("/volplugin/users/mount/policy1/bar")
+	c.Assert(err, IsNil)
+
+	c.Assert(lease.Release(), IsNil)
+	_, err = s.kv.Get("/volplugin/users/mount/policy1/bar")
+	c.Assert(err, Equals, errors.NotExists)
+
+	// and expires without.
+	_, err = s.client.AcquireUses(time.Second, uses[0])
+	c.Assert(err, IsNil)
+	time.Sleep(3 * time.Second)
+	_, err = s.kv.Get("/volplugin/users/mount/policy1/foo")
+	c.Assert(err, Equals, errors.NotExists)
+}
+
+func (s *etcd3Suite) TestWatch(c *C) {
+	te := newTestEntity("test", "")
+	retChan, errChan := s.client.WatchPrefix(te)
+
+	// give the watch time to be established.
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		te2 := te.Copy().(*testEntity)
+		te2.SomeData = fmt.Sprintf("data%d", i)
+		c.Assert(s.client.Set(te2), IsNil)
+
+		select {
+		case err := <-errChan:
+			c.Assert(err, IsNil, Commentf("select: %v", err)) // this will always fail, assert is just to raise the error.
+		case ent := <-retChan:
+			te, ok := ent.(*testEntity)
+			c.Assert(ok, Equals, true)
+			c.Assert(te.Name, Equals, "test")
+			c.Assert(te.SomeData, Equals, fmt.Sprintf("data%d", i))
+		}
+	}
+
+	c.Assert(s.client.WatchPrefixStop(te), IsNil)
+}
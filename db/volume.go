@@ -7,6 +7,7 @@ import (
 
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/labels"
 	"github.com/contiv/volplugin/merge"
 	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/storage/backend"
@@ -55,6 +56,7 @@ func CreateVolume(vr *VolumeRequest) (*Volume, error) {
 		PolicyName:     vr.Policy.Name,
 		VolumeName:     vr.Name,
 		MountSource:    mount,
+		Labels:         vr.Policy.Labels,
 	}
 
 	if err := vc.Validate(); err != nil {
@@ -152,6 +154,10 @@ func (v *Volume) Validate() error {
 		return errors.ErrJSONValidation.Combine(err)
 	}
 
+	if err := labels.Validate(v.Labels); err != nil {
+		return err
+	}
+
 	return v.validateBackends() // calls ToDriverOptions.
 }
 
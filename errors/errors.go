@@ -66,6 +66,10 @@ var (
 	UnmarshalRequest = errored.New("Unmarshaling Request")
 	// MarshalResponse is used when a response failed to encode.
 	MarshalResponse = errored.New("Marshaling Response")
+	// Unauthorized is used when a request carries no valid credentials.
+	Unauthorized = errored.New("Not authenticated")
+	// Forbidden is used when the credentials of a request do not allow it.
+	Forbidden = errored.New("Permission denied")
 
 	// MarshalGlobal is used when failing to build global configuration
 	MarshalGlobal = errored.New("Marshaling global configuration")
@@ -82,8 +86,16 @@ var (
 	CannotCopyVolume = errored.New("Cannot copy volume")
 	// GetVolume is used when retrieving volumes.
 	GetVolume = errored.New("Retrieving Volume")
+	// GetStats is used when retrieving volume usage statistics.
+	GetStats = errored.New("Retrieving volume stats")
 	// InvalidVolume is used both when retrieving volumes and validating the names of volumes.
 	InvalidVolume = errored.New("Invalid volume name")
+	// QuotaExceeded is used when an operation would exceed a policy's quota.
+	QuotaExceeded = errored.New("Quota exceeded")
+	// InvalidLabel is used when the labels of a policy or volume are malformed.
+	InvalidLabel = errored.New("Invalid label")
+	// InvalidSelector is used when a label selector cannot be parsed.
+	InvalidSelector = errored.New("Invalid label selector")
 	// RemoveVolume is used when removing volumes.
 	RemoveVolume = errored.New("Removing volume")
 	// ClearVolume is used when just removing the volume information from etcd.
@@ -124,6 +136,18 @@ var (
 	ListPolicyRevision = errored.New("Listing policy revisions")
 	// ListPolicyRevision is used when getting a single policy revision.
 	GetPolicyRevision = errored.New("Getting policy revision")
+	// RollbackPolicy is used when publishing an old revision of a policy.
+	RollbackPolicy = errored.New("Rolling back policy")
+
+	// ResizeVolume is used when resizing volumes.
+	ResizeVolume = errored.New("Resizing volume")
+	// ResizeUnsupported is used when the backend does not support resizing.
+	ResizeUnsupported = errored.New("Backend does not support resizing")
+	// ResizeShrink is used when a volume is not shrunk: the resize was not
+	// forced, or the backend or the filesystem cannot shrink.
+	ResizeShrink = errored.New("Refusing to shrink volume")
+	// MissingSizeOption is used when the size option is missing for volume resizes.
+	MissingSizeOption = errored.New("Could not find size option in request: cannot resize.")
 
 	// RemoveImage is used when removing the underlying ceph RBD image.
 	RemoveImage = errored.New("Removing image")
@@ -134,6 +158,20 @@ var (
 	SnapshotsUnsupported = errored.New("Backend does not support snapshots")
 	// SnapshotFailed is used when failing to take a snapshot.
 	SnapshotFailed = errored.New("Failed to take snapshot")
+	// SnapshotRollback is used when failing to roll a volume back to a snapshot.
+	SnapshotRollback = errored.New("Failed to roll back snapshot")
+	// GetSnapshotResult is used when retrieving the result of the last snapshot
+	// of a volume fails.
+	GetSnapshotResult = errored.New("Retrieving snapshot result")
+	// SnapshotHook is used when a pre- or post-snapshot hook fails.
+	SnapshotHook = errored.New("Snapshot hook failed")
+	// SnapshotPrune is used when failing to prune the snapshots of a volume.
+	SnapshotPrune = errored.New("Failed to prune snapshots")
+	// NoSnapshotRetention is used when pruning the snapshots of a volume which
+	// does not take scheduled snapshots, and so has no retention rules.
+	NoSnapshotRetention = errored.New("Volume has no snapshot retention")
+	// MissingSnapshot is used when a snapshot name is required but not supplied.
+	MissingSnapshot = errored.New("Could not find snapshot name in request")
 	// MissingSnapshotOption is used when the snapshot option is missing for volume copies.
 	MissingSnapshotOption = errored.New("Could not find snapshot option in request, cannot copy.")
 	// MissingTargetOption is used when the target option is missing for volume copies.
@@ -147,6 +185,10 @@ var (
 	PublishMount = errored.New("Could not publish mount information")
 	// GetMount is used when retrieving mounts.
 	GetMount = errored.New("Retrieving mount")
+	// GetVolsupervisor is used when retrieving the volsupervisor lock.
+	GetVolsupervisor = errored.New("Retrieving volsupervisor leader")
+	// VolumeMounted is used when an operation requires an unmounted volume.
+	VolumeMounted = errored.New("Volume is mounted")
 	// MountFailed is used when mounts fail.
 	MountFailed = errored.New("Mount failed")
 	// UnmountFailed is used when unmounts fail.
@@ -159,4 +201,15 @@ var (
 
 	// ReadBody is used when reading the request body.
 	ReadBody = errored.New("Reading request body")
+
+	// ListAudit is used when listing the audit log.
+	ListAudit = errored.New("Listing audit log")
+	// RecordAudit is used when recording an operation in the audit log.
+	RecordAudit = errored.New("Recording in the audit log")
+
+	// WatchEvents is used when streaming events.
+	WatchEvents = errored.New("Watching events")
+	// InvalidEventFilter is used when an event stream is requested with an
+	// unknown type or a malformed index.
+	InvalidEventFilter = errored.New("Invalid event filter")
 )
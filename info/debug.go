@@ -12,6 +12,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/metrics"
 )
 
 func numFileDescriptors() int {
@@ -83,3 +84,16 @@ func HandleDumpTarballSignal(client *config.Client) {
 		}
 	}
 }
+
+// ServeDebug serves /metrics on the listen address. It does nothing if the
+// address is empty.
+func ServeDebug(listen string) {
+	if listen == "" {
+		return
+	}
+
+	logrus.Infof("Serving metrics on %q", listen)
+	if err := metrics.ListenAndServe(listen); err != nil {
+		logrus.Errorf("Could not serve metrics on %q: %v", listen, err)
+	}
+}
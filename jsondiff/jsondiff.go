@@ -0,0 +1,142 @@
+// Package jsondiff computes the structural differences between two JSON
+// documents: the fields and array elements which were added, removed or
+// modified, addressed by their path from the root, e.g. "create.size" or
+// "hosts[2]".
+package jsondiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ChangeType is the kind of a change.
+type ChangeType int
+
+const (
+	// Added is a path which only exists in the second document.
+	Added ChangeType = iota
+	// Removed is a path which only exists in the first document.
+	Removed
+	// Modified is a path whose value differs between the documents.
+	Modified
+)
+
+// Change is a difference between two documents. Old is unset for additions
+// and New for removals.
+type Change struct {
+	Type ChangeType
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+func (c Change) String() string {
+	switch c.Type {
+	case Added:
+		return fmt.Sprintf("+ %s: %s", c.Path, format(c.New))
+	case Removed:
+		return fmt.Sprintf("- %s: %s", c.Path, format(c.Old))
+	}
+
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, format(c.Old), format(c.New))
+}
+
+func format(v interface{}) string {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(content)
+}
+
+// Diff returns the changes which turn the JSON document a into b, ordered by
+// path. Objects are compared field by field and arrays element by element;
+// values of different types are a single modification.
+func Diff(a, b []byte) ([]Change, error) {
+	var va, vb interface{}
+
+	if err := json.Unmarshal(a, &va); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &vb); err != nil {
+		return nil, err
+	}
+
+	return diff("", va, vb, []Change{}), nil
+}
+
+func diff(path string, a, b interface{}, changes []Change) []Change {
+	switch va := a.(type) {
+	case map[string]interface{}:
+		if vb, ok := b.(map[string]interface{}); ok {
+			return diffObjects(path, va, vb, changes)
+		}
+	case []interface{}:
+		if vb, ok := b.([]interface{}); ok {
+			return diffArrays(path, va, vb, changes)
+		}
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		changes = append(changes, Change{Type: Modified, Path: path, Old: a, New: b})
+	}
+
+	return changes
+}
+
+func diffObjects(path string, a, b map[string]interface{}, changes []Change) []Change {
+	keys := []string{}
+	for key := range a {
+		keys = append(keys, key)
+	}
+
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+
+		va, inA := a[key]
+		vb, inB := b[key]
+
+		switch {
+		case !inA:
+			changes = append(changes, Change{Type: Added, Path: keyPath, New: vb})
+		case !inB:
+			changes = append(changes, Change{Type: Removed, Path: keyPath, Old: va})
+		default:
+			changes = diff(keyPath, va, vb, changes)
+		}
+	}
+
+	return changes
+}
+
+func diffArrays(path string, a, b []interface{}, changes []Change) []Change {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		indexPath := fmt.Sprintf("%s[%d]", path, i)
+
+		switch {
+		case i >= len(a):
+			changes = append(changes, Change{Type: Added, Path: indexPath, New: b[i]})
+		case i >= len(b):
+			changes = append(changes, Change{Type: Removed, Path: indexPath, Old: a[i]})
+		default:
+			changes = diff(indexPath, a[i], b[i], changes)
+		}
+	}
+
+	return changes
+}
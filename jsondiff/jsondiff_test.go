@@ -0,0 +1,45 @@
+package jsondiff
+
+import (
+	. "testing"
+
+	. "gopkg.in/check.v1"
+)
+
+type jsondiffSuite struct{}
+
+var _ = Suite(&jsondiffSuite{})
+
+func TestJSONDiff(t *T) { TestingT(t) }
+
+func (s *jsondiffSuite) TestDiff(c *C) {
+	changes, err := Diff(
+		[]byte(`{"name": "policy1", "create": {"size": "10MB", "filesystem": "ext4"}, "labels": {"team": "storage"}, "hosts": ["a", "b"], "unlocked": true}`),
+		[]byte(`{"name": "policy1", "create": {"size": "20MB", "filesystem": "ext4"}, "quota": {"volumes": 10}, "hosts": ["a"], "unlocked": "yes"}`),
+	)
+	c.Assert(err, IsNil)
+
+	lines := []string{}
+	for _, change := range changes {
+		lines = append(lines, change.String())
+	}
+
+	c.Assert(lines, DeepEquals, []string{
+		`~ create.size: "10MB" -> "20MB"`,
+		`- hosts[1]: "b"`,
+		`- labels: {"team":"storage"}`,
+		`+ quota: {"volumes":10}`,
+		`~ unlocked: true -> "yes"`,
+	})
+
+	changes, err = Diff([]byte(`{"a": [1, {"b": null}]}`), []byte(`{"a": [1, {"b": null}]}`))
+	c.Assert(err, IsNil)
+	c.Assert(changes, DeepEquals, []Change{})
+
+	changes, err = Diff([]byte(`1`), []byte(`2`))
+	c.Assert(err, IsNil)
+	c.Assert(changes, DeepEquals, []Change{{Type: Modified, Path: "", Old: float64(1), New: float64(2)}})
+
+	_, err = Diff([]byte(`{`), []byte(`{}`))
+	c.Assert(err, NotNil)
+}
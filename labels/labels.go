@@ -0,0 +1,152 @@
+// Package labels validates the free-form labels attached to policies and
+// volumes, and implements the selectors used to query volumes by label.
+//
+// A selector is a comma-separated list of requirements, all of which must be
+// met for the labels to match:
+//
+//	team=storage   the label "team" is "storage" ("==" also works)
+//	env!=prod      the label "env" is not "prod", or is not set
+//	backup         the label "backup" is set
+//	!backup        the label "backup" is not set
+//
+// The empty selector matches everything.
+package labels
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+)
+
+// MaxLength is the maximum length of a label's key or value.
+const MaxLength = 63
+
+var labelRegexp = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_./]*[A-Za-z0-9])?$`)
+
+// Validate ensures that the keys and values of labels are well formed. Keys
+// and values are made of alphanumerics, "-", "_", "." and "/", start and end
+// with an alphanumeric, and are at most MaxLength long. Values may be empty.
+func Validate(labels map[string]string) error {
+	for key, value := range labels {
+		if err := validate(key); err != nil {
+			return errors.InvalidLabel.Combine(errored.Errorf("Invalid key %q", key)).Combine(err)
+		}
+
+		if value == "" {
+			continue
+		}
+
+		if err := validate(value); err != nil {
+			return errors.InvalidLabel.Combine(errored.Errorf("Invalid value %q for key %q", value, key)).Combine(err)
+		}
+	}
+
+	return nil
+}
+
+func validate(str string) error {
+	if len(str) > MaxLength {
+		return errored.Errorf("longer than %d characters", MaxLength)
+	}
+
+	if !labelRegexp.MatchString(str) {
+		return errored.Errorf("must match %q", labelRegexp.String())
+	}
+
+	return nil
+}
+
+type operator int
+
+const (
+	equals operator = iota
+	notEquals
+	exists
+	notExists
+)
+
+type requirement struct {
+	key      string
+	operator operator
+	value    string
+}
+
+func (r requirement) matches(labels map[string]string) bool {
+	value, ok := labels[r.key]
+
+	switch r.operator {
+	case equals:
+		return ok && value == r.value
+	case notEquals:
+		return !ok || value != r.value
+	case exists:
+		return ok
+	case notExists:
+		return !ok
+	}
+
+	return false
+}
+
+// Selector is a parsed label selector.
+type Selector []requirement
+
+// Parse parses a selector. See the package documentation for the syntax.
+func Parse(selector string) (Selector, error) {
+	sel := Selector{}
+
+	if strings.TrimSpace(selector) == "" {
+		return sel, nil
+	}
+
+	for _, part := range strings.Split(selector, ",") {
+		part = strings.TrimSpace(part)
+
+		var req requirement
+
+		switch {
+		case strings.Contains(part, "!="):
+			kv := strings.SplitN(part, "!=", 2)
+			req = requirement{key: kv[0], operator: notEquals, value: kv[1]}
+		case strings.Contains(part, "=="):
+			kv := strings.SplitN(part, "==", 2)
+			req = requirement{key: kv[0], operator: equals, value: kv[1]}
+		case strings.Contains(part, "="):
+			kv := strings.SplitN(part, "=", 2)
+			req = requirement{key: kv[0], operator: equals, value: kv[1]}
+		case strings.HasPrefix(part, "!"):
+			req = requirement{key: strings.TrimPrefix(part, "!"), operator: notExists}
+		default:
+			req = requirement{key: part, operator: exists}
+		}
+
+		req.key, req.value = strings.TrimSpace(req.key), strings.TrimSpace(req.value)
+
+		if err := Validate(map[string]string{req.key: req.value}); err != nil {
+			return nil, errors.InvalidSelector.Combine(errored.Errorf("Invalid requirement %q in selector %q", part, selector)).Combine(err)
+		}
+
+		sel = append(sel, req)
+	}
+
+	return sel, nil
+}
+
+// Matches returns true if labels meet all the requirements of the selector.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, req := range s {
+		if !req.matches(labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Empty returns true if the selector has no requirements, so it matches
+// everything.
+func (s Selector) Empty() bool {
+	return len(s) == 0
+}
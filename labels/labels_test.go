@@ -0,0 +1,75 @@
+package labels
+
+import (
+	"strings"
+	. "testing"
+
+	. "gopkg.in/check.v1"
+)
+
+type labelsSuite struct{}
+
+var _ = Suite(&labelsSuite{})
+
+func TestLabels(t *T) { TestingT(t) }
+
+func (s *labelsSuite) TestValidate(c *C) {
+	valid := []map[string]string{
+		nil,
+		{"team": "storage"},
+		{"contiv.io/owner": "ops-team_1"},
+		{"backup": ""},
+	}
+
+	for _, labels := range valid {
+		c.Assert(Validate(labels), IsNil, Commentf("%v", labels))
+	}
+
+	invalid := []map[string]string{
+		{"": "storage"},
+		{"team!": "storage"},
+		{"-team": "storage"},
+		{"team": "storage "},
+		{"team": strings.Repeat("a", MaxLength+1)},
+	}
+
+	for _, labels := range invalid {
+		c.Assert(Validate(labels), NotNil, Commentf("%v", labels))
+	}
+}
+
+func (s *labelsSuite) TestSelector(c *C) {
+	labels := map[string]string{"team": "storage", "env": "staging", "backup": ""}
+
+	matches := map[string]bool{
+		"":                              true,
+		"team=storage":                  true,
+		"team==storage":                 true,
+		"team=network":                  false,
+		"env!=prod":                     true,
+		"env!=staging":                  false,
+		"owner!=ops":                    true,
+		"backup":                        true,
+		"owner":                         false,
+		"!owner":                        true,
+		"!backup":                       false,
+		"team=storage, env!=prod":       true,
+		"team=storage,env!=prod,!owner": true,
+		"team=storage,env=prod":         false,
+	}
+
+	for selector, match := range matches {
+		sel, err := Parse(selector)
+		c.Assert(err, IsNil, Commentf("%q", selector))
+		c.Assert(sel.Matches(labels), Equals, match, Commentf("%q", selector))
+	}
+
+	for _, selector := range []string{"team=storage,", "=storage", "!", "team=stor age", "env!=prod!"} {
+		_, err := Parse(selector)
+		c.Assert(err, NotNil, Commentf("%q", selector))
+	}
+
+	sel, err := Parse(" ")
+	c.Assert(err, IsNil)
+	c.Assert(sel.Empty(), Equals, true)
+}
@@ -6,6 +6,10 @@
 // exists for remove operations only.
 //
 // goroutine-safe functions to manage TTL-safe reporting also exist here.
+//
+// On stores which support leases (etcd v3), several locks are acquired in a
+// single transaction, and locks are kept alive by renewing their lease rather
+// than by rewriting them with a TTL.
 package lock
 
 import (
@@ -16,12 +20,16 @@ import (
 
 	"github.com/contiv/volplugin/config"
 	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/metrics"
 )
 
 var (
 	// Unlocked is a string indicating unlocked operation, this is typically used
 	// as a hostname for our locking system.
 	Unlocked = "-unlocked-"
+
+	lockAttempts = metrics.NewCounterVec("volplugin_lock_attempts_total", "Attempts to acquire a use lock.", "type", "reason")
+	lockFailures = metrics.NewCounterVec("volplugin_lock_failures_total", "Failures to acquire a use lock.", "type", "reason")
 )
 
 const (
@@ -39,10 +47,18 @@ const (
 
 	// ReasonCopy indicates a copy from snapshot operation.
 	ReasonCopy = "Copy"
+	// ReasonRollback indicates a rollback to snapshot operation.
+	ReasonRollback = "Rollback"
+	// ReasonResize indicates a volume resize operation.
+	ReasonResize = "Resize"
 	// ReasonMaintenance indicates that an operator is acquiring the lock.
 	ReasonMaintenance = "Maintenance"
 )
 
+// multiLockTTL is the TTL of the lease holding the locks of
+// ExecuteWithMultiUseLock, which is kept alive while the function runs.
+const multiLockTTL = 30 * time.Second
+
 // Driver is the top-level struct for lock objects
 type Driver struct {
 	Config *config.Client
@@ -56,7 +72,7 @@ func NewDriver(config *config.Client) *Driver {
 // ExecuteWithUseLock executes a function within a lock/context of the passed
 // *config.UseMount.
 func (d *Driver) ExecuteWithUseLock(uc config.UseLocker, runFunc func(d *Driver, uc config.UseLocker) error) error {
-	if err := d.Config.PublishUse(uc); err != nil {
+	if err := recordAcquire(uc, d.Config.PublishUse(uc)); err != nil {
 		logrus.Debugf("Could not publish use lock %#v: %v", uc, err)
 		return errors.ErrLockPublish
 	}
@@ -79,35 +95,125 @@ func (d *Driver) ClearLock(uc config.UseLocker, timeout time.Duration) error {
 // at the same time. If it fails, it returns an error. If timeout is zero, it
 // will not attempt to retry acquiring the lock. Otherwise, it will attempt to
 // wait for the provided timeout and only return an error if it fails to
-// acquire them in time.
+// acquire them in time. If the store supports leases, the locks are taken
+// atomically; otherwise they are taken one after the other.
 func (d *Driver) ExecuteWithMultiUseLock(ucs []config.UseLocker, timeout time.Duration, runFunc func(d *Driver, ucs []config.UseLocker) error) error {
+	if d.Config.SupportsLeases() {
+		return d.executeWithLease(ucs, timeout, runFunc)
+	}
+
 	acquired := []config.UseLocker{}
+	defer func() {
+		for _, uc := range acquired {
+			if err := d.Config.RemoveUse(uc, false); err != nil {
+				logrus.Errorf("Could not remove use lock %#v: %v", uc, err)
+			}
+		}
+	}()
 
+	// locks acquired before one which cannot be are released as well.
 	for _, uc := range ucs {
-		if err := d.acquire(uc, 0, timeout); err != nil {
+		if err := recordAcquire(uc, d.acquire(uc, 0, timeout)); err != nil {
 			return err
 		}
 		acquired = append(acquired, uc)
 	}
 
-	err := runFunc(d, ucs)
+	return runFunc(d, ucs)
+}
 
-	for _, uc := range acquired {
-		if err := d.Config.RemoveUse(uc, false); err != nil {
-			logrus.Errorf("Could not remove use lock %#v: %v", uc, err)
-		}
+// executeWithLease runs runFunc with the locks held by a lease, which is
+// renewed until runFunc returns.
+func (d *Driver) executeWithLease(ucs []config.UseLocker, timeout time.Duration, runFunc func(d *Driver, ucs []config.UseLocker) error) error {
+	lease, err := d.acquireLease(ucs, multiLockTTL, timeout)
+	if err != nil {
+		return err
+	}
+
+	stopChan := make(chan struct{})
+	done := d.keepAlive(lease, ucs, stopChan)
+
+	err = runFunc(d, ucs)
+	close(stopChan)
+	<-done
+
+	if err := lease.Release(); err != nil {
+		logrus.Errorf("Could not release the locks of lease %d: %v", lease.ID, err)
 	}
 
 	return err
 }
 
+// acquireLease acquires the locks with a lease, retrying like acquire until
+// timeout.
+func (d *Driver) acquireLease(ucs []config.UseLocker, ttl, timeout time.Duration) (*config.UseLease, error) {
+	now := time.Now()
+
+retry:
+	lease, err := d.Config.PublishUsesWithLease(ttl, ucs...)
+	for _, uc := range ucs {
+		recordAcquire(uc, err)
+	}
+
+	if err != nil {
+		logrus.Warnf("Could not acquire the locks %v: %v", ucs, err)
+		if ok, err := d.lockWait(ucs[0], timeout, now, "publish"); ok && err == nil {
+			goto retry
+		} else if err != nil {
+			return nil, err
+		}
+
+		return nil, errors.LockFailed.Combine(err)
+	}
+
+	return lease, nil
+}
+
+// keepAlive renews the lease every quarter of its TTL until stopChan is
+// closed, in a goroutine; the returned channel is closed once it stopped. If
+// the lease is lost, the locks are acquired again with a new lease, if
+// possible.
+func (d *Driver) keepAlive(lease *config.UseLease, ucs []config.UseLocker, stopChan chan struct{}) chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for {
+			select {
+			case <-stopChan:
+				return
+			case <-time.After(wait.Jitter(lease.TTL/4, 0)):
+				if err := lease.KeepAlive(); err != nil {
+					logrus.Errorf("Could not refresh the locks %v: %v", ucs, err)
+
+					newLease, err := d.Config.PublishUsesWithLease(lease.TTL, ucs...)
+					if err != nil {
+						logrus.Errorf("Could not acquire the locks %v again: %v", ucs, err)
+						continue
+					}
+
+					*lease = *newLease
+				}
+			}
+		}
+	}()
+
+	return done
+}
+
 // AcquireWithTTLRefresh accepts a UseLocker, and attempts to acquire the
 // lock. When it successfully does, it then spawns a goroutine to refresh the
 // lock after a timeout, returning a stop channel. Timeout is jittered to
-// mitigate thundering herd problems.
+// mitigate thundering herd problems. If the store supports leases, the lock
+// is held by a lease with the TTL, which the goroutine renews.
 func (d *Driver) AcquireWithTTLRefresh(uc config.UseLocker, ttl, timeout time.Duration) (chan struct{}, error) {
+	if d.Config.SupportsLeases() {
+		return d.acquireWithLease(uc, ttl)
+	}
+
 	// we acquire a permanent lock, then overwrite it with a TTL lock later.
-	if err := d.Config.PublishUse(uc); err != nil {
+	if err := recordAcquire(uc, d.Config.PublishUse(uc)); err != nil {
 		return nil, err
 	}
 
@@ -133,6 +239,30 @@ func (d *Driver) AcquireWithTTLRefresh(uc config.UseLocker, ttl, timeout time.Du
 	return stopChan, nil
 }
 
+func (d *Driver) acquireWithLease(uc config.UseLocker, ttl time.Duration) (chan struct{}, error) {
+	lease, err := d.Config.PublishUsesWithLease(ttl, uc)
+	if err := recordAcquire(uc, err); err != nil {
+		return nil, err
+	}
+
+	stopChan := make(chan struct{}, 1)
+	keepAliveStop := make(chan struct{})
+	done := d.keepAlive(lease, []config.UseLocker{uc}, keepAliveStop)
+
+	go func() {
+		<-stopChan
+		close(keepAliveStop)
+		<-done
+
+		logrus.Debugf("Clearing lock for %v", uc)
+		if err := lease.Release(); err != nil {
+			logrus.Errorf("Could not clear lock %v after stop received: %v", uc, err)
+		}
+	}()
+
+	return stopChan, nil
+}
+
 func (d *Driver) lockWait(uc config.UseLocker, timeout time.Duration, now time.Time, reason string) (bool, error) {
 	logrus.Warnf("Could not %s %q lock for %q", reason, uc.GetReason(), uc.GetVolume())
 	if timeout != 0 && (timeout == -1 || time.Since(now) < timeout) {
@@ -187,3 +317,15 @@ retry:
 
 	return nil
 }
+
+// recordAcquire counts an attempt to acquire the lock, and a failure if err
+// is not nil. err is returned unchanged. TTL refreshes of held locks are not
+// counted.
+func recordAcquire(uc config.UseLocker, err error) error {
+	lockAttempts.Inc(uc.Type(), uc.GetReason())
+	if err != nil {
+		lockFailures.Inc(uc.Type(), uc.GetReason())
+	}
+
+	return err
+}
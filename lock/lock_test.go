@@ -12,6 +12,7 @@ import (
 	. "gopkg.in/check.v1"
 
 	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/db/impl/memory"
 	"github.com/contiv/volplugin/errors"
 )
 
@@ -31,7 +32,10 @@ func (s *lockSuite) SetUpTest(c *C) {
 	}
 
 	s.tlc = tlc
+	s.publishPolicy(c)
+}
 
+func (s *lockSuite) publishPolicy(c *C) {
 	content, err := ioutil.ReadFile("policy.json")
 	c.Assert(err, IsNil)
 
@@ -42,6 +46,70 @@ func (s *lockSuite) SetUpTest(c *C) {
 	s.tlc.PublishPolicy("policy", policy)
 }
 
+// memoryLockSuite runs the lock tests against the in-memory keys API instead
+// of etcd.
+type memoryLockSuite struct {
+	lockSuite
+}
+
+var _ = Suite(&memoryLockSuite{})
+
+func (s *memoryLockSuite) SetUpTest(c *C) {
+	s.tlc = config.NewClientFromKeysAPI("/volplugin", memory.NewClient("/volplugin").KeysAPI())
+	s.publishPolicy(c)
+}
+
+func (s *memoryLockSuite) TestAcquireWithTTLRefresh(c *C) {
+	vol := &config.Volume{PolicyName: "policy", VolumeName: "foo"}
+	uc := &config.UseMount{Volume: vol.String(), Reason: ReasonMount, Hostname: "mon0"}
+	driver := NewDriver(s.tlc)
+
+	stopChan, err := driver.AcquireWithTTLRefresh(uc, 200*time.Millisecond, time.Second)
+	c.Assert(err, IsNil)
+
+	// the refreshes keep the lock past its TTL.
+	time.Sleep(500 * time.Millisecond)
+	c.Assert(s.tlc.PublishUse(&config.UseMount{Volume: "policy/foo", Reason: ReasonMount, Hostname: "mon1"}), NotNil)
+
+	stopChan <- struct{}{}
+
+	for i := 0; i < 50; i++ {
+		if err := s.tlc.GetUse(&config.UseMount{}, vol); err != nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.Fatal("the lock was not cleared after stopping the refreshes")
+}
+
+func (s *memoryLockSuite) TestLockExpires(c *C) {
+	uc := &config.UseMount{Volume: "policy/foo", Reason: ReasonMount, Hostname: "mon0"}
+	c.Assert(s.tlc.PublishUseWithTTL(uc, 100*time.Millisecond), IsNil)
+	c.Assert(NewDriver(s.tlc).ExecuteWithUseLock(&config.UseMount{Volume: "policy/foo", Reason: ReasonMount, Hostname: "mon1"}, func(ld *Driver, uc config.UseLocker) error {
+		return nil
+	}), Equals, errors.ErrLockPublish)
+
+	time.Sleep(200 * time.Millisecond)
+	c.Assert(NewDriver(s.tlc).ExecuteWithUseLock(&config.UseMount{Volume: "policy/foo", Reason: ReasonMount, Hostname: "mon1"}, func(ld *Driver, uc config.UseLocker) error {
+		return nil
+	}), IsNil)
+}
+
+func (s *memoryLockSuite) TestMultiUseLockReleasesOnFailure(c *C) {
+	vol := &config.Volume{PolicyName: "policy", VolumeName: "foo"}
+	c.Assert(s.tlc.PublishUse(&config.UseMount{Volume: vol.String(), Reason: ReasonMount, Hostname: "mon1"}), IsNil)
+
+	snap := &config.UseSnapshot{Volume: vol.String(), Reason: ReasonResize}
+	err := NewDriver(s.tlc).ExecuteWithMultiUseLock([]config.UseLocker{snap, &config.UseMount{Volume: vol.String(), Reason: ReasonResize, Hostname: "mon0"}}, 100*time.Millisecond, func(ld *Driver, ucs []config.UseLocker) error {
+		return nil
+	})
+	c.Assert(err, NotNil)
+
+	// the snapshot lock taken before the mount lock failed is released.
+	c.Assert(s.tlc.GetUse(&config.UseSnapshot{}, vol), NotNil)
+}
+
 func (s *lockSuite) TestExecuteWithUseLock(c *C) {
 	vc, err := s.tlc.CreateVolume(&config.VolumeRequest{Policy: "policy", Name: "foo"})
 	c.Assert(err, IsNil)
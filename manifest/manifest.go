@@ -0,0 +1,418 @@
+// Package manifest reads declarative descriptions of the global
+// configuration, policies and volumes, and plans the changes which make the
+// current state match them. It is the library behind `volcli apply`.
+//
+// A manifest is a JSON or YAML document with a "kind" of "global", "policy"
+// or "volume", alongside the fields of the object it describes:
+//
+//	kind: policy
+//	name: policy1
+//	backend: ceph
+//	driver:
+//	  pool: rbd
+//	create:
+//	  size: 10GB
+//	---
+//	kind: volume
+//	policy: policy1
+//	name: database
+//	options:
+//	  size: 20GB
+//
+// Globals use the published form shown by `volcli global get`. A JSON file
+// may hold a single manifest or an array of them, and a YAML file may hold
+// several documents separated by "---".
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/config"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// KindGlobal is the kind of the global configuration's manifest.
+	KindGlobal = "global"
+	// KindPolicy is the kind of a policy's manifest.
+	KindPolicy = "policy"
+	// KindVolume is the kind of a volume's manifest.
+	KindVolume = "volume"
+)
+
+// Volume is the manifest of a volume. Options are the same as those passed
+// to `volcli volume create`.
+type Volume struct {
+	Policy  string            `json:"policy"`
+	Name    string            `json:"name"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+func (v *Volume) String() string {
+	return strings.Join([]string{v.Policy, v.Name}, "/")
+}
+
+// Request returns the request which creates the volume.
+func (v *Volume) Request() *config.VolumeRequest {
+	options := v.Options
+	if options == nil {
+		options = map[string]string{}
+	}
+
+	return &config.VolumeRequest{Policy: v.Policy, Name: v.Name, Options: options}
+}
+
+// Set is a set of manifests. Global is nil if no manifest describes it.
+// Volumes are keyed by "policy/name".
+type Set struct {
+	Global   *config.Global
+	Policies map[string]*config.Policy
+	Volumes  map[string]*Volume
+}
+
+// NewSet returns an empty set.
+func NewSet() *Set {
+	return &Set{
+		Policies: map[string]*config.Policy{},
+		Volumes:  map[string]*Volume{},
+	}
+}
+
+// Load reads the manifests in path, which is either a file or a directory.
+// Only the files in a directory ending in .json, .yaml or .yml are read, in
+// lexical order; subdirectories are ignored.
+func Load(path string) (*Set, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, errored.Errorf("Could not read manifests in %q", path).Combine(err)
+	}
+
+	files := []string{path}
+
+	if fi.IsDir() {
+		infos, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, errored.Errorf("Could not read manifests in %q", path).Combine(err)
+		}
+
+		files = []string{}
+		for _, info := range infos {
+			if !info.IsDir() && isManifest(info.Name()) {
+				files = append(files, filepath.Join(path, info.Name()))
+			}
+		}
+
+		sort.Strings(files)
+	}
+
+	set := NewSet()
+
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errored.Errorf("Could not read manifest %q", file).Combine(err)
+		}
+
+		if err := set.add(file, content); err != nil {
+			return nil, errored.Errorf("Invalid manifest %q", file).Combine(err)
+		}
+	}
+
+	return set, nil
+}
+
+func isManifest(name string) bool {
+	switch filepath.Ext(name) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+
+	return false
+}
+
+// add adds the manifests in content to the set. Content is parsed as JSON
+// if file ends in .json, and as YAML otherwise.
+func (s *Set) add(file string, content []byte) error {
+	var docs []interface{}
+
+	if filepath.Ext(file) == ".json" {
+		var doc interface{}
+		if err := json.Unmarshal(content, &doc); err != nil {
+			return err
+		}
+
+		if list, ok := doc.([]interface{}); ok {
+			docs = list
+		} else {
+			docs = []interface{}{doc}
+		}
+	} else {
+		var err error
+		if docs, err = parseYAML(content); err != nil {
+			return err
+		}
+	}
+
+	for i, doc := range docs {
+		if err := s.addDocument(doc); err != nil {
+			return errored.Errorf("Document %d", i+1).Combine(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Set) addDocument(doc interface{}) error {
+	fields, ok := doc.(map[string]interface{})
+	if !ok {
+		return errored.New("Manifest is not a mapping")
+	}
+
+	kind, _ := fields["kind"].(string)
+	delete(fields, "kind")
+
+	content, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case KindGlobal:
+		if s.Global != nil {
+			return errored.New("The global configuration is described more than once")
+		}
+
+		global := config.NewGlobalConfig()
+		if err := decode(content, global); err != nil {
+			return err
+		}
+
+		s.Global = global.SetEmpty()
+	case KindPolicy:
+		policy := config.NewPolicy()
+		if err := decode(content, policy); err != nil {
+			return err
+		}
+
+		if policy.Name == "" {
+			return errored.New("Policy has no name")
+		}
+
+		if _, ok := s.Policies[policy.Name]; ok {
+			return errored.Errorf("Policy %q is described more than once", policy.Name)
+		}
+
+		if err := policy.Validate(); err != nil {
+			return errored.Errorf("Policy %q is invalid", policy.Name).Combine(err)
+		}
+
+		s.Policies[policy.Name] = policy
+	case KindVolume:
+		volume := &Volume{}
+		if err := decode(content, volume); err != nil {
+			return err
+		}
+
+		if volume.Policy == "" || volume.Name == "" || strings.Contains(volume.Name, "/") {
+			return errored.Errorf("Volume %q must have a policy and a name without slashes", volume)
+		}
+
+		if _, ok := s.Volumes[volume.String()]; ok {
+			return errored.Errorf("Volume %q is described more than once", volume)
+		}
+
+		s.Volumes[volume.String()] = volume
+	default:
+		return errored.Errorf("Unknown kind %q; must be %q, %q or %q", kind, KindGlobal, KindPolicy, KindVolume)
+	}
+
+	return nil
+}
+
+// decode unmarshals content into v, rejecting unknown fields so typos are
+// not silently ignored.
+func decode(content []byte, v interface{}) error {
+	var doc interface{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return err
+	}
+
+	if field := unknownField(doc, reflect.TypeOf(v)); field != "" {
+		return errored.Errorf("Unknown field %q", field)
+	}
+
+	return json.Unmarshal(content, v)
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// unknownField returns the path of the first field of doc which unmarshalling
+// it into typ would ignore, or "" if there is none. Types which unmarshal
+// themselves are not looked into.
+func unknownField(doc interface{}, typ reflect.Type) string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	if reflect.PtrTo(typ).Implements(unmarshalerType) {
+		return ""
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct, reflect.Map:
+		fields, ok := doc.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+
+		names := []string{}
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			var valueType reflect.Type
+			if typ.Kind() == reflect.Struct {
+				field, ok := jsonField(typ, name)
+				if !ok {
+					return name
+				}
+				valueType = field.Type
+			} else {
+				valueType = typ.Elem()
+			}
+
+			if inner := unknownField(fields[name], valueType); inner != "" {
+				return name + "." + inner
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		list, _ := doc.([]interface{})
+		for i, value := range list {
+			if inner := unknownField(value, typ.Elem()); inner != "" {
+				return fmt.Sprintf("%d.%s", i, inner)
+			}
+		}
+	}
+
+	return ""
+}
+
+// jsonField returns the field of the struct type which encoding/json
+// unmarshals the key name into.
+func jsonField(typ reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+
+		if field.Anonymous && tag == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+
+			if embedded.Kind() == reflect.Struct {
+				if found, ok := jsonField(embedded, name); ok {
+					return found, true
+				}
+				continue
+			}
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if tag == "" {
+			tag = field.Name
+		}
+
+		if strings.EqualFold(tag, name) {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// parseYAML unmarshals the "---" separated documents in content, with
+// mappings keyed by strings so they can be decoded like JSON manifests.
+func parseYAML(content []byte) ([]interface{}, error) {
+	docs := []interface{}{}
+
+	for _, document := range splitDocuments(content) {
+		var doc interface{}
+		if err := yaml.Unmarshal(document, &doc); err != nil {
+			return nil, err
+		}
+
+		if doc != nil {
+			docs = append(docs, jsonValue(doc))
+		}
+	}
+
+	return docs, nil
+}
+
+// splitDocuments splits content at the lines which start or end a YAML
+// document.
+func splitDocuments(content []byte) [][]byte {
+	documents := [][]byte{}
+	current := &bytes.Buffer{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := bytes.TrimRight(scanner.Bytes(), " \t\r")
+		if bytes.Equal(line, []byte("---")) || bytes.HasPrefix(line, []byte("--- ")) || bytes.Equal(line, []byte("...")) {
+			documents = append(documents, current.Bytes())
+			current = &bytes.Buffer{}
+
+			// content may follow the start of a document on the same line.
+			if bytes.HasPrefix(line, []byte("--- ")) {
+				current.Write(line[4:])
+				current.WriteByte('\n')
+			}
+			continue
+		}
+
+		current.Write(scanner.Bytes())
+		current.WriteByte('\n')
+	}
+
+	return append(documents, current.Bytes())
+}
+
+// jsonValue converts the mappings yaml.v2 produces, which may have keys of
+// any type, to the map[string]interface{} of encoding/json.
+func jsonValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		result := map[string]interface{}{}
+		for key, item := range value {
+			result[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			result[i] = jsonValue(item)
+		}
+		return result
+	default:
+		return value
+	}
+}
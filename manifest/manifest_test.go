@@ -0,0 +1,280 @@
+package manifest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	. "testing"
+	"time"
+
+	"github.com/contiv/volplugin/config"
+
+	. "gopkg.in/check.v1"
+)
+
+type manifestSuite struct{}
+
+var _ = Suite(&manifestSuite{})
+
+func TestManifest(t *T) { TestingT(t) }
+
+const policyYAML = `
+# the default policy
+kind: policy
+name: policy1
+backend: ceph
+driver:
+  pool: rbd
+create:
+  size: 10MB
+  filesystem: ext4
+runtime:
+  snapshots: true
+  snapshot:
+    frequency: 30m
+    keep: 20
+labels: {team: storage, "env": 'prod'}
+---
+kind: volume
+policy: policy1
+name: db
+options:
+  size: 20MB
+  label.tier: "1"
+`
+
+const globalJSON = `{"kind": "global", "TTL": 60, "Timeout": 5, "Debug": true}`
+
+const volumesJSON = `[
+  {"kind": "volume", "policy": "policy1", "name": "logs"},
+  {"kind": "volume", "policy": "policy2", "name": "scratch"}
+]`
+
+const policy2YAML = `
+kind: policy
+name: policy2
+backend: nfs
+create:
+  filesystem: ext4
+`
+
+func writeManifests(c *C, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "manifest")
+	c.Assert(err, IsNil)
+
+	for name, content := range files {
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600), IsNil)
+	}
+
+	return dir
+}
+
+func (s *manifestSuite) TestYAML(c *C) {
+	docs, err := parseYAML([]byte(`
+key: value # comment
+"quoted key": 'it''s'
+number: 1.5
+int: -3
+truth: true
+none: ~
+list:
+- one
+- "two # not a comment"
+items:
+  - name: first
+    size: 1
+flow: [a, {b: 1}]
+literal: |
+  line 1
+   line 2
+...
+---
+- just a list
+--- {inline: document}
+---
+`))
+	c.Assert(err, IsNil)
+	c.Assert(docs, DeepEquals, []interface{}{
+		map[string]interface{}{
+			"key":        "value",
+			"quoted key": "it's",
+			"number":     1.5,
+			"int":        -3,
+			"truth":      true,
+			"none":       nil,
+			"list":       []interface{}{"one", "two # not a comment"},
+			"items": []interface{}{
+				map[string]interface{}{"name": "first", "size": 1},
+			},
+			"flow":    []interface{}{"a", map[string]interface{}{"b": 1}},
+			"literal": "line 1\n line 2\n",
+		},
+		[]interface{}{"just a list"},
+		map[string]interface{}{"inline": "document"},
+	})
+
+	for _, invalid := range []string{
+		"key: value\n  indented: too far",
+		"key: 'unterminated",
+		"key: [a, b",
+		"key: {a: 1",
+	} {
+		_, err := parseYAML([]byte(invalid))
+		c.Assert(err, NotNil, Commentf("%q", invalid))
+	}
+}
+
+func (s *manifestSuite) TestLoad(c *C) {
+	dir := writeManifests(c, map[string]string{
+		"policies.yaml": policyYAML,
+		"policy2.yml":   policy2YAML,
+		"global.json":   globalJSON,
+		"volumes.json":  volumesJSON,
+		"README.md":     "not a manifest",
+	})
+	defer os.RemoveAll(dir)
+
+	set, err := Load(dir)
+	c.Assert(err, IsNil)
+
+	c.Assert(set.Global.TTL, Equals, time.Duration(60))
+	c.Assert(set.Global.Timeout, Equals, time.Duration(5))
+	c.Assert(set.Global.Debug, Equals, true)
+	c.Assert(set.Global.MountPath, Equals, config.NewGlobalConfig().MountPath)
+
+	c.Assert(len(set.Policies), Equals, 2)
+	policy := set.Policies["policy1"]
+	c.Assert(policy.DriverOptions, DeepEquals, map[string]string{"pool": "rbd"})
+	c.Assert(policy.CreateOptions.Size, Equals, "10MB")
+	c.Assert(policy.RuntimeOptions.Snapshot.Keep, Equals, uint(20))
+	c.Assert(policy.Labels, DeepEquals, map[string]string{"team": "storage", "env": "prod"})
+	c.Assert(policy.Backends, NotNil)
+
+	c.Assert(set.Volumes, DeepEquals, map[string]*Volume{
+		"policy1/db":      {Policy: "policy1", Name: "db", Options: map[string]string{"size": "20MB", "label.tier": "1"}},
+		"policy1/logs":    {Policy: "policy1", Name: "logs"},
+		"policy2/scratch": {Policy: "policy2", Name: "scratch"},
+	})
+
+	set, err = Load(filepath.Join(dir, "policy2.yml"))
+	c.Assert(err, IsNil)
+	c.Assert(len(set.Policies), Equals, 1)
+	c.Assert(set.Global, IsNil)
+
+	for name, content := range map[string]string{
+		"unknown kind":     `{"kind": "tenant", "name": "foo"}`,
+		"unknown field":    `{"kind": "policy", "name": "foo", "backend": "ceph", "size": "10MB"}`,
+		"unknown subfield": `{"kind": "policy", "name": "foo", "backend": "ceph", "create": {"size": "10MB", "sise": "10MB"}}`,
+		"invalid policy":   `{"kind": "policy", "name": "foo", "backend": "nonexistent"}`,
+		"nameless policy":  `{"kind": "policy", "backend": "nfs"}`,
+		"duplicate policy": `[` + strings.Repeat(`{"kind": "policy", "name": "foo", "backend": "nfs"},`, 2) + `{"kind": "global"}]`,
+		"duplicate global": `[{"kind": "global"}, {"kind": "global"}]`,
+		"invalid volume":   `{"kind": "volume", "policy": "policy1", "name": "a/b"}`,
+		"not a mapping":    `["policy"]`,
+	} {
+		dir := writeManifests(c, map[string]string{"manifest.json": content})
+		_, err := Load(dir)
+		os.RemoveAll(dir)
+		c.Assert(err, NotNil, Commentf("%s", name))
+	}
+
+	_, err = Load(filepath.Join(dir, "nonexistent"))
+	c.Assert(err, NotNil)
+}
+
+func (s *manifestSuite) TestPlan(c *C) {
+	dir := writeManifests(c, map[string]string{"policies.yaml": policyYAML, "global.json": globalJSON})
+	defer os.RemoveAll(dir)
+
+	desired, err := Load(dir)
+	c.Assert(err, IsNil)
+
+	// an empty store gets everything created.
+	changes, err := Plan(desired, NewSet(), false)
+	c.Assert(err, IsNil)
+	c.Assert(actions(changes), DeepEquals, []string{"create global global", "create policy policy1", "create volume policy1/db"})
+	c.Assert(strings.Contains(changes[1].Diff, `+   "name": "policy1",`), Equals, true, Commentf("%s", changes[1].Diff))
+
+	// the current state as returned by the apiserver: the published global,
+	// unvalidated policies and bare volumes.
+	current := NewSet()
+	current.Global = config.NewGlobalConfig().Published()
+	current.Global.TTL = 60
+	current.Global.Timeout = 5
+	current.Global.Debug = true
+
+	policy := *desired.Policies["policy1"]
+	policy.FileSystems = nil
+	policy.Backends = nil
+	current.Policies["policy1"] = &policy
+	current.Policies["old"] = &config.Policy{Name: "old", Backend: "nfs"}
+	current.Volumes["policy1/db"] = &Volume{Policy: "policy1", Name: "db"}
+	current.Volumes["old/data"] = &Volume{Policy: "old", Name: "data"}
+
+	changes, err = Plan(desired, current, false)
+	c.Assert(err, IsNil)
+	c.Assert(actions(changes), DeepEquals, []string{"no-op global global", "no-op policy policy1", "no-op volume policy1/db"})
+
+	for _, change := range changes {
+		c.Assert(change.Diff, Equals, "")
+	}
+
+	changes, err = Plan(desired, current, true)
+	c.Assert(err, IsNil)
+	c.Assert(actions(changes), DeepEquals, []string{
+		"no-op global global",
+		"no-op policy policy1",
+		"no-op volume policy1/db",
+		"delete volume old/data",
+		"delete policy old",
+	})
+
+	// updates only show what changed.
+	desired.Global.TTL = 90
+	desired.Policies["policy1"].RuntimeOptions.Snapshot.Keep = 10
+
+	changes, err = Plan(desired, current, false)
+	c.Assert(err, IsNil)
+	c.Assert(actions(changes), DeepEquals, []string{"update global global", "update policy policy1", "no-op volume policy1/db"})
+	c.Assert(changes[0].Global.TTL, Equals, time.Duration(90))
+	c.Assert(changes[0].Diff, Equals, `  {
+    "Debug": true,
+    "Timeout": 5,
+-   "TTL": 60,
++   "TTL": 90,
+    "MountPath": "/mnt/ceph",
+    "PolicyRevisions": 0,
+    "PolicyRevisionDays": 0,
+    "AuditDays": 30
+  }`)
+	c.Assert(strings.Contains(changes[1].Diff, "-       \"keep\": 20\n+       \"keep\": 10"), Equals, true, Commentf("%s", changes[1].Diff))
+
+	// volumes need a policy that will exist.
+	desired.Volumes["old/data"] = &Volume{Policy: "old", Name: "data"}
+	_, err = Plan(desired, current, true)
+	c.Assert(err, NotNil)
+
+	changes, err = Plan(desired, current, false)
+	c.Assert(err, IsNil)
+	c.Assert(actions(changes)[2], Equals, "no-op volume old/data")
+
+	desired.Volumes["missing/data"] = &Volume{Policy: "missing", Name: "data"}
+	_, err = Plan(desired, current, false)
+	c.Assert(err, NotNil)
+}
+
+func actions(changes []*Change) []string {
+	result := []string{}
+	for _, change := range changes {
+		result = append(result, change.String())
+	}
+
+	return result
+}
+
+func (s *manifestSuite) TestDiff(c *C) {
+	c.Assert(diff("", ""), Equals, "")
+	c.Assert(diff("a\nb", ""), Equals, "- a\n- b")
+	c.Assert(diff("a\nb\nc", "a\nc\nd"), Equals, "  a\n- b\n  c\n+ d")
+}
@@ -0,0 +1,282 @@
+package manifest
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/config"
+)
+
+// Action is what applying a change does to its object.
+type Action string
+
+const (
+	// ActionCreate creates an object which does not exist yet.
+	ActionCreate Action = "create"
+	// ActionUpdate replaces an object which differs from its manifest.
+	ActionUpdate Action = "update"
+	// ActionNone leaves an object which matches its manifest alone.
+	ActionNone Action = "no-op"
+	// ActionDelete removes an object which has no manifest. It is only
+	// planned when pruning.
+	ActionDelete Action = "delete"
+)
+
+// Change is a step of a plan. Exactly one of Global, Policy and Volume is
+// set, to the desired object, or the current one for deletions.
+type Change struct {
+	Action Action
+	Kind   string
+	Name   string
+	// Diff is a line diff of the current and desired objects in their
+	// published JSON form. It is empty for no-ops.
+	Diff string
+
+	Global *config.Global
+	Policy *config.Policy
+	Volume *Volume
+}
+
+func (c *Change) String() string {
+	return string(c.Action) + " " + c.Kind + " " + c.Name
+}
+
+// Plan returns the changes which make current match desired, in the order
+// they should be applied: the global configuration, then policies, new
+// volumes, removed volumes and last removed policies. Objects only present
+// in current are removed if prune is true, and left alone otherwise.
+// Volumes are never updated, as their properties are fixed at creation.
+func Plan(desired, current *Set, prune bool) ([]*Change, error) {
+	if err := checkPolicies(desired, current, prune); err != nil {
+		return nil, err
+	}
+
+	changes := []*Change{}
+
+	if desired.Global != nil {
+		change, err := planGlobal(desired.Global, current.Global)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, change)
+	}
+
+	for _, name := range policyNames(desired.Policies) {
+		change, err := planPolicy(desired.Policies[name], current.Policies[name])
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, change)
+	}
+
+	for _, name := range volumeNames(desired.Volumes) {
+		change := &Change{Action: ActionNone, Kind: KindVolume, Name: name, Volume: desired.Volumes[name]}
+
+		if _, ok := current.Volumes[name]; !ok {
+			content, err := marshal(desired.Volumes[name])
+			if err != nil {
+				return nil, err
+			}
+
+			change.Action = ActionCreate
+			change.Diff = diff("", content)
+		}
+
+		changes = append(changes, change)
+	}
+
+	if !prune {
+		return changes, nil
+	}
+
+	for _, name := range volumeNames(current.Volumes) {
+		if _, ok := desired.Volumes[name]; ok {
+			continue
+		}
+
+		content, err := marshal(current.Volumes[name])
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, &Change{Action: ActionDelete, Kind: KindVolume, Name: name, Diff: diff(content, ""), Volume: current.Volumes[name]})
+	}
+
+	for _, name := range policyNames(current.Policies) {
+		if _, ok := desired.Policies[name]; ok {
+			continue
+		}
+
+		content, err := marshal(current.Policies[name])
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, &Change{Action: ActionDelete, Kind: KindPolicy, Name: name, Diff: diff(content, ""), Policy: current.Policies[name]})
+	}
+
+	return changes, nil
+}
+
+// checkPolicies ensures that every volume left after applying the plan has a
+// policy.
+func checkPolicies(desired, current *Set, prune bool) error {
+	policyExists := func(name string) bool {
+		if _, ok := desired.Policies[name]; ok {
+			return true
+		}
+
+		_, ok := current.Policies[name]
+		return ok && !prune
+	}
+
+	for _, name := range volumeNames(desired.Volumes) {
+		if volume := desired.Volumes[name]; !policyExists(volume.Policy) {
+			return errored.Errorf("Volume %q uses policy %q, which has no manifest and does not exist", name, volume.Policy)
+		}
+	}
+
+	return nil
+}
+
+func planGlobal(desired, current *config.Global) (*Change, error) {
+	change := &Change{Action: ActionNone, Kind: KindGlobal, Name: KindGlobal, Global: desired.Canonical().Published()}
+
+	after, err := marshal(change.Global)
+	if err != nil {
+		return nil, err
+	}
+
+	before := ""
+	if current != nil {
+		if before, err = marshal(current.Canonical().Published()); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case current == nil:
+		change.Action = ActionCreate
+	case before != after:
+		change.Action = ActionUpdate
+	default:
+		return change, nil
+	}
+
+	change.Diff = diff(before, after)
+	return change, nil
+}
+
+func planPolicy(desired, current *config.Policy) (*Change, error) {
+	change := &Change{Action: ActionNone, Kind: KindPolicy, Name: desired.Name, Policy: desired}
+
+	after, err := marshal(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	before := ""
+	if current != nil {
+		// fill in the defaults the same way the desired policy's were.
+		validated := *current
+		validated.Validate()
+
+		if before, err = marshal(&validated); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case current == nil:
+		change.Action = ActionCreate
+	case before != after:
+		change.Action = ActionUpdate
+	default:
+		return change, nil
+	}
+
+	change.Diff = diff(before, after)
+	return change, nil
+}
+
+func marshal(v interface{}) (string, error) {
+	content, err := json.MarshalIndent(v, "", "  ")
+	return string(content), err
+}
+
+func policyNames(policies map[string]*config.Policy) []string {
+	names := []string{}
+	for name := range policies {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func volumeNames(volumes map[string]*Volume) []string {
+	names := []string{}
+	for name := range volumes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// diff returns a line diff of before and after, with removed lines prefixed
+// by "-", added lines by "+" and common lines by a space.
+func diff(before, after string) string {
+	a, b := splitLines(before), splitLines(after)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := []string{}
+	i, j := 0, 0
+
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func splitLines(str string) []string {
+	if str == "" {
+		return []string{}
+	}
+
+	return strings.Split(str, "\n")
+}
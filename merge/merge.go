@@ -2,6 +2,7 @@ package merge
 
 import (
 	"reflect"
+	"strings"
 
 	"github.com/contiv/errored"
 )
@@ -54,8 +55,26 @@ func setKey(typeinfo reflect.Type, valinfo *reflect.Value, key string, value str
 			}
 		}
 
+		tag := field.Tag.Get("merge")
+
+		// tags ending in ".*" route all keys with the prefix to a map, keyed by
+		// the rest of the key. e.g. "label.team" sets "team" in `merge:"label.*"`.
+		if strings.HasSuffix(tag, ".*") && field.Type.Kind() == reflect.Map {
+			prefix := strings.TrimSuffix(tag, "*")
+			if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+				var valfield reflect.Value
+
+				if valinfo.Kind() == reflect.Ptr {
+					valfield = valinfo.Elem().Field(x)
+				} else {
+					valfield = valinfo.Field(x)
+				}
+				return setMapValue(&valfield, strings.TrimPrefix(key, prefix), value)
+			}
+		}
+
 		// merge tag handling, see mergeOpts comments.
-		if field.Tag.Get("merge") == key {
+		if tag == key {
 			var valfield reflect.Value
 
 			// some of the values will be pointers, and some won't. The reflect
@@ -73,6 +92,23 @@ func setKey(typeinfo reflect.Type, valinfo *reflect.Value, key string, value str
 	return errored.Errorf("Key not found: %q", key)
 }
 
+func setMapValue(field *reflect.Value, key, val string) error {
+	if !field.CanSet() {
+		return errored.Errorf("Cannot set key %q for struct element %q", key, field.Kind().String())
+	}
+
+	if field.Type().Key().Kind() != reflect.String || field.Type().Elem().Kind() != reflect.String {
+		return errored.Errorf("Could not find appropriate type %q", field.Type().String())
+	}
+
+	if field.IsNil() {
+		field.Set(reflect.MakeMap(field.Type()))
+	}
+
+	field.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(val))
+	return nil
+}
+
 func setValueWithType(field *reflect.Value, val string) error {
 	if !field.CanSet() {
 		return errored.Errorf("Cannot set value %q for struct element %q", val, field.Kind().String())
@@ -13,9 +13,10 @@ var _ = Suite(&mergeSuite{})
 func TestMerge(t *T) { TestingT(t) }
 
 type mergeExample struct {
-	Size           string `merge:"size"`
-	FileSystem     string `merge:"filesystem"`
-	Unlocked       bool   `merge:"unlocked"`
+	Size           string            `merge:"size"`
+	FileSystem     string            `merge:"filesystem"`
+	Unlocked       bool              `merge:"unlocked"`
+	Labels         map[string]string `merge:"label.*"`
 	RuntimeOptions struct {
 		UseSnapshots bool `merge:"snapshots"`
 		Snapshot     struct {
@@ -33,6 +34,8 @@ func (s *mergeSuite) TestMerge(c *C) {
 		"snapshots.frequency": "10m",
 		"snapshots.keep":      "20",
 		"unlocked":            "true",
+		"label.team":          "storage",
+		"label.contiv.io/env": "prod",
 	}
 
 	c.Assert(Opts(v, opts), IsNil)
@@ -41,4 +44,7 @@ func (s *mergeSuite) TestMerge(c *C) {
 	c.Assert(v.RuntimeOptions.Snapshot.Keep, Equals, uint(20))
 	c.Assert(v.RuntimeOptions.Snapshot.Frequency, Equals, "10m")
 	c.Assert(v.Unlocked, Equals, true)
+	c.Assert(v.Labels, DeepEquals, map[string]string{"team": "storage", "contiv.io/env": "prod"})
+
+	c.Assert(Opts(v, map[string]string{"label.": "empty"}), NotNil)
 }
@@ -0,0 +1,359 @@
+// Package metrics implements the small subset of the Prometheus data model
+// volplugin needs: labeled counters, gauges and histograms, exposed in the
+// Prometheus text format.
+//
+// Metrics are registered with the process-wide registry when they are
+// created, so packages usually declare them as package variables. Label
+// values are passed positionally in the order the label names were declared.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the histogram buckets, in seconds, used for durations.
+// They range from a millisecond to a couple of minutes, which covers both
+// HTTP requests and slow storage operations like formatting a volume.
+var DefaultBuckets = []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30, 60, 120}
+
+// labelSeparator joins label values into map keys. It cannot appear in
+// valid UTF-8 strings.
+const labelSeparator = "\xff"
+
+type metric interface {
+	name() string
+	write(io.Writer)
+}
+
+var (
+	registry      = map[string]metric{}
+	registryMutex sync.Mutex
+)
+
+func register(m metric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, ok := registry[m.name()]; ok {
+		panic(fmt.Sprintf("metric %q registered twice", m.name()))
+	}
+
+	registry[m.name()] = m
+}
+
+// WriteTo writes all registered metrics in the Prometheus text format,
+// sorted by name.
+func WriteTo(w io.Writer) {
+	registryMutex.Lock()
+	metrics := []metric{}
+	for _, m := range registry {
+		metrics = append(metrics, m)
+	}
+	registryMutex.Unlock()
+
+	sort.Sort(byName(metrics))
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// Handler returns an http.Handler serving the registered metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := new(bytes.Buffer)
+		WriteTo(buf)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(buf.Bytes())
+	})
+}
+
+// ListenAndServe serves /metrics on the address. It is used by the daemons
+// that do not have an HTTP listener of their own.
+func ListenAndServe(listen string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	return http.ListenAndServe(listen, mux)
+}
+
+type byName []metric
+
+func (b byName) Len() int           { return len(b) }
+func (b byName) Less(i, j int) bool { return b[i].name() < b[j].name() }
+func (b byName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// vec is the labeled storage shared by all metric types.
+type vec struct {
+	metricName string
+	help       string
+	typ        string
+	labels     []string
+
+	mutex  sync.Mutex
+	values map[string]interface{}
+}
+
+func newVec(name, help, typ string, labels []string) vec {
+	return vec{
+		metricName: name,
+		help:       help,
+		typ:        typ,
+		labels:     labels,
+		values:     map[string]interface{}{},
+	}
+}
+
+func (v *vec) name() string {
+	return v.metricName
+}
+
+func (v *vec) key(labelValues []string) string {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %q takes %d label values, got %d", v.metricName, len(v.labels), len(labelValues)))
+	}
+
+	return strings.Join(labelValues, labelSeparator)
+}
+
+// sortedKeys must be called with the mutex held.
+func (v *vec) sortedKeys() []string {
+	keys := []string{}
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (v *vec) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.metricName, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.metricName, v.typ)
+}
+
+// labelString formats the labels of a key, with optional extra label pairs
+// appended (used for histogram buckets).
+func (v *vec) labelString(key string, extra ...string) string {
+	pairs := []string{}
+
+	if len(v.labels) > 0 {
+		for i, value := range strings.Split(key, labelSeparator) {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", v.labels[i], value))
+		}
+	}
+
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extra[i], extra[i+1]))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	vec
+}
+
+// NewCounterVec creates and registers a counter.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: newVec(name, help, "counter", labels)}
+	register(c)
+	return c
+}
+
+// Inc increments the counter for the label values by one.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds n to the counter for the label values.
+func (c *CounterVec) Add(n float64, labelValues ...string) {
+	key := c.key(labelValues)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	value, _ := c.values[key].(float64)
+	c.values[key] = value + n
+}
+
+// Get returns the current value of the counter for the label values.
+func (c *CounterVec) Get(labelValues ...string) float64 {
+	key := c.key(labelValues)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	value, _ := c.values[key].(float64)
+	return value
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.writeHeader(w)
+	for _, key := range c.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, c.labelString(key), formatFloat(c.values[key].(float64)))
+	}
+}
+
+// GaugeVec is a set of gauges partitioned by label values.
+type GaugeVec struct {
+	vec
+}
+
+// NewGaugeVec creates and registers a gauge.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec: newVec(name, help, "gauge", labels)}
+	register(g)
+	return g
+}
+
+// Set sets the gauge for the label values.
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	key := g.key(labelValues)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.values[key] = value
+}
+
+// Delete removes the gauge for the label values, so it is no longer
+// reported.
+func (g *GaugeVec) Delete(labelValues ...string) {
+	key := g.key(labelValues)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	delete(g.values, key)
+}
+
+// Get returns the current value of the gauge for the label values.
+func (g *GaugeVec) Get(labelValues ...string) float64 {
+	key := g.key(labelValues)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	value, _ := g.values[key].(float64)
+	return value
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.writeHeader(w)
+	for _, key := range g.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", g.metricName, g.labelString(key), formatFloat(g.values[key].(float64)))
+	}
+}
+
+// HistogramVec is a set of histograms partitioned by label values.
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec creates and registers a histogram. If buckets is nil,
+// DefaultBuckets is used.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+
+	h := &HistogramVec{vec: newVec(name, help, "histogram", labels), buckets: buckets}
+	register(h)
+	return h
+}
+
+// Observe records a value for the label values.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	hist, ok := h.values[key].(*histogram)
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hist
+	}
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			hist.counts[i]++
+			break
+		}
+	}
+
+	hist.count++
+	hist.sum += value
+}
+
+// Since records the time elapsed since start, in seconds.
+func (h *HistogramVec) Since(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Count returns the number of observations for the label values.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	key := h.key(labelValues)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if hist, ok := h.values[key].(*histogram); ok {
+		return hist.count
+	}
+
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.writeHeader(w)
+	for _, key := range h.sortedKeys() {
+		hist := h.values[key].(*histogram)
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelString(key, "le", formatFloat(bound)), cumulative)
+		}
+
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelString(key, "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, h.labelString(key), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, h.labelString(key), hist.count)
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	. "testing"
+
+	. "gopkg.in/check.v1"
+)
+
+type metricsSuite struct{}
+
+var _ = Suite(&metricsSuite{})
+
+func TestMetrics(t *T) { TestingT(t) }
+
+func (s *metricsSuite) TestCounter(c *C) {
+	counter := NewCounterVec("test_counter_total", "A test counter.", "op", "result")
+	counter.Inc("create", "success")
+	counter.Inc("create", "success")
+	counter.Add(3, "create", "failure")
+
+	c.Assert(counter.Get("create", "success"), Equals, float64(2))
+	c.Assert(counter.Get("create", "failure"), Equals, float64(3))
+	c.Assert(counter.Get("remove", "success"), Equals, float64(0))
+
+	buf := new(bytes.Buffer)
+	counter.write(buf)
+	c.Assert(buf.String(), Equals, `# HELP test_counter_total A test counter.
+# TYPE test_counter_total counter
+test_counter_total{op="create",result="failure"} 3
+test_counter_total{op="create",result="success"} 2
+`)
+
+	c.Assert(func() { counter.Inc("create") }, PanicMatches, `metric "test_counter_total" takes 2 label values, got 1`)
+	c.Assert(func() { NewCounterVec("test_counter_total", "") }, PanicMatches, `metric "test_counter_total" registered twice`)
+}
+
+func (s *metricsSuite) TestGauge(c *C) {
+	gauge := NewGaugeVec("test_gauge", "A test gauge.", "volume")
+	gauge.Set(2, "policy1/foo")
+	gauge.Set(1, `policy1/"quoted"`)
+	c.Assert(gauge.Get("policy1/foo"), Equals, float64(2))
+
+	buf := new(bytes.Buffer)
+	gauge.write(buf)
+	c.Assert(buf.String(), Equals, `# HELP test_gauge A test gauge.
+# TYPE test_gauge gauge
+test_gauge{volume="policy1/\"quoted\""} 1
+test_gauge{volume="policy1/foo"} 2
+`)
+
+	gauge.Delete("policy1/foo")
+	gauge.Delete(`policy1/"quoted"`)
+	buf.Reset()
+	gauge.write(buf)
+	c.Assert(strings.Contains(buf.String(), "policy1"), Equals, false)
+}
+
+func (s *metricsSuite) TestHistogram(c *C) {
+	hist := NewHistogramVec("test_duration_seconds", "A test histogram.", []float64{1, 5}, "backend")
+	hist.Observe(0.5, "ceph")
+	hist.Observe(2, "ceph")
+	hist.Observe(10, "ceph")
+	c.Assert(hist.Count("ceph"), Equals, uint64(3))
+	c.Assert(hist.Count("nfs"), Equals, uint64(0))
+
+	buf := new(bytes.Buffer)
+	hist.write(buf)
+	c.Assert(buf.String(), Equals, `# HELP test_duration_seconds A test histogram.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{backend="ceph",le="1"} 1
+test_duration_seconds_bucket{backend="ceph",le="5"} 2
+test_duration_seconds_bucket{backend="ceph",le="+Inf"} 3
+test_duration_seconds_sum{backend="ceph"} 12.5
+test_duration_seconds_count{backend="ceph"} 3
+`)
+}
+
+func (s *metricsSuite) TestHandler(c *C) {
+	NewCounterVec("test_unlabeled_total", "An unlabeled counter.").Inc()
+
+	r, err := http.NewRequest("GET", "/metrics", nil)
+	c.Assert(err, IsNil)
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, 200)
+	c.Assert(w.Header().Get("Content-Type"), Equals, "text/plain; version=0.0.4")
+
+	content, err := ioutil.ReadAll(w.Body)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(string(content), "\ntest_unlabeled_total 1\n"), Equals, true)
+}
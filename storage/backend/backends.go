@@ -4,6 +4,8 @@ import (
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/storage/backend/ceph"
+	"github.com/contiv/volplugin/storage/backend/loopback"
+	"github.com/contiv/volplugin/storage/backend/lvm"
 	"github.com/contiv/volplugin/storage/backend/nfs"
 )
 
@@ -17,18 +19,36 @@ var (
 
 // MountDrivers is the map of string to storage.MountDriver.
 var MountDrivers = map[string]func(string) (storage.MountDriver, error){
-	ceph.BackendName: ceph.NewMountDriver,
-	nfs.BackendName:  nfs.NewMountDriver,
+	ceph.BackendName:     ceph.NewMountDriver,
+	loopback.BackendName: loopback.NewMountDriver,
+	lvm.BackendName:      lvm.NewMountDriver,
+	nfs.BackendName:      nfs.NewMountDriver,
 }
 
 // CRUDDrivers is the map of string to storage.CRUDDriver.
 var CRUDDrivers = map[string]func() (storage.CRUDDriver, error){
-	ceph.BackendName: ceph.NewCRUDDriver,
+	ceph.BackendName:     ceph.NewCRUDDriver,
+	loopback.BackendName: loopback.NewCRUDDriver,
+	lvm.BackendName:      lvm.NewCRUDDriver,
 }
 
 // SnapshotDrivers is the map of string to storage.SnapshotDriver.
 var SnapshotDrivers = map[string]func() (storage.SnapshotDriver, error){
-	ceph.BackendName: ceph.NewSnapshotDriver,
+	ceph.BackendName:     ceph.NewSnapshotDriver,
+	loopback.BackendName: loopback.NewSnapshotDriver,
+	lvm.BackendName:      lvm.NewSnapshotDriver,
+}
+
+// ResizeDrivers is the map of string to storage.ResizeDriver.
+var ResizeDrivers = map[string]func() (storage.ResizeDriver, error){
+	ceph.BackendName: ceph.NewResizeDriver,
+}
+
+// StatsDrivers is the map of string to storage.StatsDriver.
+var StatsDrivers = map[string]func() (storage.StatsDriver, error){
+	ceph.BackendName:     ceph.NewStatsDriver,
+	loopback.BackendName: loopback.NewStatsDriver,
+	lvm.BackendName:      lvm.NewStatsDriver,
 }
 
 // NewMountDriver instantiates and return a mount driver instance of the
@@ -43,7 +63,12 @@ func NewMountDriver(backend, mountpath string) (storage.MountDriver, error) {
 		return nil, errored.Errorf("mount path not specified, cannot continue")
 	}
 
-	return f(mountpath)
+	driver, err := f(mountpath)
+	if err != nil {
+		return nil, err
+	}
+
+	return timedMountDriver{driver}, nil
 }
 
 // NewCRUDDriver instantiates a CRUD Driver.
@@ -53,7 +78,12 @@ func NewCRUDDriver(backend string) (storage.CRUDDriver, error) {
 		return nil, errored.Errorf("invalid CRUD driver backend: %q", backend)
 	}
 
-	return f()
+	driver, err := f()
+	if err != nil {
+		return nil, err
+	}
+
+	return timedCRUDDriver{driver}, nil
 }
 
 // NewSnapshotDriver creates a SnapshotDriver based on the backend name.
@@ -63,5 +93,40 @@ func NewSnapshotDriver(backend string) (storage.SnapshotDriver, error) {
 		return nil, errored.Errorf("invalid snapshot driver backend: %q", backend)
 	}
 
-	return f()
+	driver, err := f()
+	if err != nil {
+		return nil, err
+	}
+
+	return timedSnapshotDriver{driver}, nil
+}
+
+// NewResizeDriver creates a ResizeDriver based on the backend name.
+func NewResizeDriver(backend string) (storage.ResizeDriver, error) {
+	f, ok := ResizeDrivers[backend]
+	if !ok {
+		return nil, errored.Errorf("invalid resize driver backend: %q", backend)
+	}
+
+	driver, err := f()
+	if err != nil {
+		return nil, err
+	}
+
+	return timedResizeDriver{driver}, nil
+}
+
+// NewStatsDriver creates a StatsDriver based on the backend name.
+func NewStatsDriver(backend string) (storage.StatsDriver, error) {
+	f, ok := StatsDrivers[backend]
+	if !ok {
+		return nil, errored.Errorf("invalid stats driver backend: %q", backend)
+	}
+
+	driver, err := f()
+	if err != nil {
+		return nil, err
+	}
+
+	return timedStatsDriver{driver}, nil
 }
@@ -80,6 +80,18 @@ func NewSnapshotDriver() (storage.SnapshotDriver, error) {
 	return &Driver{}, nil
 }
 
+// NewResizeDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewResizeDriver() (storage.ResizeDriver, error) {
+	return &Driver{}, nil
+}
+
+// NewStatsDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewStatsDriver() (storage.StatsDriver, error) {
+	return &Driver{}, nil
+}
+
 // Name returns the ceph backend string
 func (c *Driver) Name() string {
 	return BackendName
@@ -249,6 +261,12 @@ func (c *Driver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
 		return nil, errored.Errorf("Failed to mount RBD dev %q: %v", devName, err)
 	}
 
+	// The image may have been resized while it was not mounted here; catch the
+	// filesystem up with it. This is a no-op if they are already the same size.
+	if err := storage.GrowFilesystem(do.FSOptions.Type, devName, volumePath, do.Timeout); err != nil {
+		logrus.Warnf("Could not grow filesystem on %q: %v", devName, err)
+	}
+
 	return &storage.Mount{
 		Device:   devName,
 		Path:     volumePath,
@@ -363,6 +381,29 @@ func (c *Driver) RemoveSnapshot(snapName string, do storage.DriverOptions) error
 	return nil
 }
 
+// RollbackSnapshot restores the image to the named snapshot. The image must
+// not be mapped anywhere. Any error will be returned.
+func (c *Driver) RollbackSnapshot(snapName string, do storage.DriverOptions) error {
+	intName, err := c.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	poolName := do.Volume.Params["pool"]
+
+	cmd := exec.Command("rbd", "snap", "rollback", mkpool(poolName, intName), "--snap", snapName)
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if err != nil {
+		return err
+	}
+
+	if er.ExitStatus != 0 {
+		return errored.Errorf("Rolling back snapshot %q (volume %q): %v", snapName, intName, er)
+	}
+
+	return nil
+}
+
 // ListSnapshots returns an array of snapshot names provided a maximum number
 // of snapshots to be returned. Any error will be returned.
 func (c *Driver) ListSnapshots(do storage.DriverOptions) ([]string, error) {
@@ -503,6 +544,101 @@ func (c *Driver) CopySnapshot(do storage.DriverOptions, snapName, newName string
 	return nil
 }
 
+// Resize grows the image to the size in the DriverOptions. If the image is
+// mounted on this host, the filesystem is grown online; elsewhere, volplugin
+// grows it when asked to, or at the next mount. Images are only shrunk when
+// forced, after their filesystem, which must be unmounted, is shrunk to fit.
+func (c *Driver) Resize(do storage.DriverOptions) error {
+	intName, err := c.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	poolName := do.Volume.Params["pool"]
+
+	size, err := c.imageSize(poolName, intName, do.Timeout)
+	if err != nil {
+		return err
+	}
+
+	mounts, err := c.Mounted(do.Timeout)
+	if err != nil {
+		return err
+	}
+
+	var mount *storage.Mount
+	for _, m := range mounts {
+		if m.Volume.Name == do.Volume.Name && m.Volume.Params["pool"] == poolName {
+			mount = m
+		}
+	}
+
+	args := []string{"resize", mkpool(poolName, intName), "--size", strconv.FormatUint(do.Volume.Size, 10)}
+
+	if do.Volume.Size*1024*1024 < size {
+		if err := c.shrinkFilesystem(do, mount); err != nil {
+			return err
+		}
+
+		args = append(args, "--allow-shrink")
+	}
+
+	er, err := runWithTimeout(exec.Command("rbd", args...), do.Timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return errored.Errorf("Resizing disk %q to %dMB: %v (%v)", intName, do.Volume.Size, er, err)
+	}
+
+	if mount != nil && do.Volume.Size*1024*1024 > size {
+		return storage.GrowFilesystem(do.FSOptions.Type, mount.Device, mount.Path, do.Timeout)
+	}
+
+	return nil
+}
+
+// shrinkFilesystem shrinks the filesystem of the unmounted image to the size
+// in the DriverOptions, if the resize is forced.
+func (c *Driver) shrinkFilesystem(do storage.DriverOptions, mount *storage.Mount) error {
+	if do.Options["force"] != "true" {
+		return errors.ResizeShrink.Combine(errored.Errorf("%q is not forced", do.Volume.Name))
+	}
+
+	if mount != nil {
+		return errors.ResizeShrink.Combine(errored.Errorf("%q is mounted at %q", do.Volume.Name, mount.Path))
+	}
+
+	device, err := c.mapImage(do)
+	if err != nil {
+		return err
+	}
+
+	shrinkErr := storage.ShrinkFilesystem(do.FSOptions.Type, device, do.Volume.Size, do.Timeout)
+
+	if err := c.unmapImage(do); err != nil {
+		return err
+	}
+
+	return shrinkErr
+}
+
+// Stats reports the provisioned and used size of the image through `rbd du`.
+// Snapshots are not counted against the image.
+func (c *Driver) Stats(do storage.DriverOptions) (*storage.VolumeStats, error) {
+	intName, err := c.internalName(do.Volume.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	poolName := do.Volume.Params["pool"]
+
+	cmd := exec.Command("rbd", "du", mkpool(poolName, intName), "--format", "json")
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return nil, errored.Errorf("Retrieving disk usage for %q: %v (%v)", intName, er, err)
+	}
+
+	return parseDiskUsage(intName, er.Stdout)
+}
+
 // Mounted describes all the volumes currently mapped on to the host.
 func (c *Driver) Mounted(timeout time.Duration) ([]*storage.Mount, error) {
 	mounts := []*storage.Mount{}
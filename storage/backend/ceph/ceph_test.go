@@ -3,10 +3,13 @@ package ceph
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	. "testing"
 	"time"
 
@@ -156,6 +159,113 @@ again:
 	goto again
 }
 
+func (s *cephSuite) TestResize(c *C) {
+	crudDrv, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	mountDrv, err := NewMountDriver(myMountpath)
+	c.Assert(err, IsNil)
+	resizeDrv, err := NewResizeDriver()
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	defer crudDrv.Destroy(driverOpts)
+	defer mountDrv.Unmount(driverOpts)
+
+	c.Assert(crudDrv.Create(driverOpts), IsNil)
+	c.Assert(crudDrv.Format(driverOpts), IsNil)
+	_, err = mountDrv.Mount(driverOpts)
+	c.Assert(err, IsNil)
+
+	mp, err := mountDrv.MountPath(driverOpts)
+	c.Assert(err, IsNil)
+
+	var before syscall.Statfs_t
+	c.Assert(syscall.Statfs(mp, &before), IsNil)
+
+	driverOpts.Volume.Size = 20
+	c.Assert(resizeDrv.Resize(driverOpts), IsNil)
+
+	out, err := exec.Command("rbd", "info", "rbd/test.pithos", "--format", "json").Output()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(string(out), `"size":20971520`), Equals, true)
+
+	// the filesystem was mounted, so it must have grown online.
+	var after syscall.Statfs_t
+	c.Assert(syscall.Statfs(mp, &after), IsNil)
+	c.Assert(after.Blocks > before.Blocks, Equals, true)
+	s.readWriteTest(c, mp)
+
+	// shrinking is refused unless forced, and while mounted.
+	driverOpts.Volume.Size = 16
+	c.Assert(resizeDrv.Resize(driverOpts), NotNil)
+	driverOpts.Options = map[string]string{"force": "true"}
+	c.Assert(resizeDrv.Resize(driverOpts), NotNil)
+
+	// unmounted, the filesystem is shrunk before the image.
+	c.Assert(mountDrv.Unmount(driverOpts), IsNil)
+	c.Assert(resizeDrv.Resize(driverOpts), IsNil)
+
+	out, err = exec.Command("rbd", "info", "rbd/test.pithos", "--format", "json").Output()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(string(out), `"size":16777216`), Equals, true)
+
+	_, err = mountDrv.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	s.readWriteTest(c, mp)
+
+	c.Assert(mountDrv.Unmount(driverOpts), IsNil)
+	c.Assert(crudDrv.Destroy(driverOpts), IsNil)
+}
+
+func (s *cephSuite) TestStats(c *C) {
+	crudDrv, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	statsDrv, err := NewStatsDriver()
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	defer crudDrv.Destroy(driverOpts)
+
+	c.Assert(crudDrv.Create(driverOpts), IsNil)
+	c.Assert(crudDrv.Format(driverOpts), IsNil)
+
+	stats, err := statsDrv.Stats(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(stats.Provisioned, Equals, uint64(10485760))
+	c.Assert(stats.Allocated > 0, Equals, true)
+	c.Assert(stats.Allocated <= stats.Provisioned, Equals, true)
+
+	c.Assert(crudDrv.Destroy(driverOpts), IsNil)
+
+	_, err = statsDrv.Stats(driverOpts)
+	c.Assert(err, NotNil)
+}
+
+func (s *cephSuite) TestParseDiskUsage(c *C) {
+	out := `{"images":[{"name":"test.pithos","snapshot":"snap1","provisioned_size":10485760,"used_size":4194304},{"name":"test.pithos","provisioned_size":10485760,"used_size":8388608}],"total_provisioned_size":10485760,"total_used_size":12582912}`
+
+	stats, err := parseDiskUsage("test.pithos", out)
+	c.Assert(err, IsNil)
+	c.Assert(stats.Provisioned, Equals, uint64(10485760))
+	c.Assert(stats.Allocated, Equals, uint64(8388608))
+
+	_, err = parseDiskUsage("test.other", out)
+	c.Assert(err, NotNil)
+
+	_, err = parseDiskUsage("test.pithos", "garbage")
+	c.Assert(err, NotNil)
+}
+
 func (s *cephSuite) TestSnapshots(c *C) {
 	snapDrv, err := NewSnapshotDriver()
 	c.Assert(err, IsNil)
@@ -250,15 +360,6 @@ again:
 	goto again
 }
 
-func (s *cephSuite) TestTemplateFSCmd(c *C) {
-	c.Assert(templateFSCmd("%", "foo"), Equals, "foo")
-	c.Assert(templateFSCmd("%%", "foo"), Equals, "%%")
-	c.Assert(templateFSCmd("%%%", "foo"), Equals, "%%foo")
-	c.Assert(templateFSCmd("% test % test %", "foo"), Equals, "foo test foo test foo")
-	c.Assert(templateFSCmd("% %% %", "foo"), Equals, "foo %% foo")
-	c.Assert(templateFSCmd("mkfs.ext4 -m0 %", "/dev/sda1"), Equals, "mkfs.ext4 -m0 /dev/sda1")
-}
-
 func (s *cephSuite) TestMounted(c *C) {
 	crudDrv, err := NewCRUDDriver()
 	c.Assert(err, IsNil)
@@ -462,3 +563,54 @@ func (s *cephSuite) TestMountSource(c *C) {
 		c.Assert(found, Equals, true)
 	}
 }
+
+func (s *cephSuite) TestSnapshotRollback(c *C) {
+	snapDrv, err := NewSnapshotDriver()
+	c.Assert(err, IsNil)
+	crudDrv, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	mountDrv, err := NewMountDriver(myMountpath)
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	c.Assert(crudDrv.Create(driverOpts), IsNil)
+	defer crudDrv.Destroy(driverOpts)
+	c.Assert(crudDrv.Format(driverOpts), IsNil)
+
+	mp, err := mountDrv.MountPath(driverOpts)
+	c.Assert(err, IsNil)
+
+	_, err = mountDrv.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(mp, "test.txt"), []byte("before"), 0644), IsNil)
+	c.Assert(mountDrv.Unmount(driverOpts), IsNil)
+
+	c.Assert(snapDrv.CreateSnapshot("snap", driverOpts), IsNil)
+
+	_, err = mountDrv.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(mp, "test.txt"), []byte("after"), 0644), IsNil)
+	c.Assert(mountDrv.Unmount(driverOpts), IsNil)
+
+	c.Assert(snapDrv.RollbackSnapshot("snap", driverOpts), IsNil)
+	c.Assert(snapDrv.RollbackSnapshot("missing", driverOpts), NotNil)
+
+	_, err = mountDrv.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadFile(filepath.Join(mp, "test.txt"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "before")
+	c.Assert(mountDrv.Unmount(driverOpts), IsNil)
+
+	// the snapshot must survive the rollback.
+	list, err := snapDrv.ListSnapshots(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []string{"snap"})
+
+	c.Assert(crudDrv.Destroy(driverOpts), IsNil)
+}
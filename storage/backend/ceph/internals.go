@@ -22,6 +22,54 @@ type rbdMap map[string]struct {
 	Device string `json:"device"`
 }
 
+// rbdDiskUsage is the output of `rbd du --format json`. Snapshots of the image
+// are listed as separate entries carrying the snapshot name.
+type rbdDiskUsage struct {
+	Images []struct {
+		Name            string `json:"name"`
+		Snapshot        string `json:"snapshot"`
+		ProvisionedSize uint64 `json:"provisioned_size"`
+		UsedSize        uint64 `json:"used_size"`
+	} `json:"images"`
+}
+
+// rbdInfo is the part of the output of `rbd info --format json` we use.
+type rbdInfo struct {
+	Size uint64 `json:"size"`
+}
+
+// imageSize returns the size of the image in bytes.
+func (c *Driver) imageSize(poolName, intName string, timeout time.Duration) (uint64, error) {
+	cmd := exec.Command("rbd", "info", mkpool(poolName, intName), "--format", "json")
+	er, err := runWithTimeout(cmd, timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return 0, errored.Errorf("Retrieving size of %q: %v (%v)", intName, er, err)
+	}
+
+	info := rbdInfo{}
+	if err := json.Unmarshal([]byte(er.Stdout), &info); err != nil {
+		return 0, errored.Errorf("Could not parse RBD info for %q", intName).Combine(err)
+	}
+
+	return info.Size, nil
+}
+
+func parseDiskUsage(intName, out string) (*storage.VolumeStats, error) {
+	du := rbdDiskUsage{}
+
+	if err := json.Unmarshal([]byte(out), &du); err != nil {
+		return nil, errored.Errorf("Could not parse RBD disk usage for %q", intName).Combine(err)
+	}
+
+	for _, image := range du.Images {
+		if image.Name == intName && image.Snapshot == "" {
+			return &storage.VolumeStats{Provisioned: image.ProvisionedSize, Allocated: image.UsedSize}, nil
+		}
+	}
+
+	return nil, errored.Errorf("Image %q not found in RBD disk usage", intName)
+}
+
 func (c *Driver) mapImage(do storage.DriverOptions) (string, error) {
 	poolName := do.Volume.Params["pool"]
 	intName, err := c.internalName(do.Volume.Name)
@@ -68,7 +116,7 @@ retry:
 }
 
 func (c *Driver) mkfsVolume(fscmd, devicePath string, timeout time.Duration) error {
-	cmd := exec.Command("/bin/sh", "-c", templateFSCmd(fscmd, devicePath))
+	cmd := exec.Command("/bin/sh", "-c", storage.TemplateFSCmd(fscmd, devicePath))
 	er, err := runWithTimeout(cmd, timeout)
 	if err != nil || er.ExitStatus != 0 {
 		return errored.Errorf("Error creating filesystem on %s with cmd: %q. Error: %v (%v) (%v) (%v)", devicePath, fscmd, er, err, strings.TrimSpace(er.Stdout), strings.TrimSpace(er.Stderr))
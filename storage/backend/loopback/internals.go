@@ -0,0 +1,150 @@
+package loopback
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/executor"
+	"github.com/contiv/volplugin/storage"
+)
+
+func runWithTimeout(cmd *exec.Cmd, timeout time.Duration) (*executor.ExecResult, error) {
+	ctx, _ := context.WithTimeout(context.Background(), timeout)
+	return executor.NewCapture(cmd).Run(ctx)
+}
+
+// imagePath yields the image file for the `policy/volume` name inside the
+// directory passed as `path`.
+func (d *Driver) imagePath(name string, params storage.Params) (string, error) {
+	policy, volume, err := storage.SplitName(name)
+	if err != nil {
+		return "", err
+	}
+
+	root := params["path"]
+	if root == "" {
+		return "", errored.Errorf("Image path is missing in loopback storage driver.")
+	}
+
+	image := filepath.Join(root, policy, volume+imageSuffix)
+	rel, err := filepath.Rel(root, image)
+	if err != nil || strings.Contains(rel, "..") {
+		return "", errored.Errorf("Calculated image path would escape subdir jail: %v", image)
+	}
+
+	return image, nil
+}
+
+// snapshotPath yields the file a snapshot of the image is stored in. Spaces
+// and slashes are replaced, as volsupervisor uses timestamps for names.
+func snapshotPath(image, snapName string) string {
+	snapName = strings.NewReplacer(" ", "-", "/", "-").Replace(snapName)
+	return filepath.Join(image+snapshotSuffix, snapName+imageSuffix)
+}
+
+// loopDevices returns the loop devices the image is currently attached to.
+func loopDevices(image string, timeout time.Duration) ([]string, error) {
+	cmd := exec.Command("losetup", "-j", image)
+	er, err := runWithTimeout(cmd, timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return nil, errored.Errorf("Could not list loop devices for %q: %v (%v)", image, er, err)
+	}
+
+	return parseLosetup(er.Stdout), nil
+}
+
+// parseLosetup parses `losetup -j` output, which looks like:
+//
+//	/dev/loop0: [64769]:1234 (/var/lib/volplugin/policy/volume.img)
+func parseLosetup(out string) []string {
+	devices := []string{}
+
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			continue
+		}
+
+		devices = append(devices, parts[0])
+	}
+
+	return devices
+}
+
+func attach(image string, timeout time.Duration) (string, error) {
+	devices, err := loopDevices(image, timeout)
+	if err != nil {
+		return "", err
+	}
+
+	if len(devices) > 0 {
+		return devices[0], nil
+	}
+
+	cmd := exec.Command("losetup", "-f", "--show", image)
+	er, err := runWithTimeout(cmd, timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return "", errored.Errorf("Could not attach %q: %v (%v)", image, er, err)
+	}
+
+	device := strings.TrimSpace(er.Stdout)
+	logrus.Debugf("attached image %q as %q", image, device)
+
+	return device, nil
+}
+
+func detach(image string, timeout time.Duration) error {
+	devices, err := loopDevices(image, timeout)
+	if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		cmd := exec.Command("losetup", "-d", device)
+		er, err := runWithTimeout(cmd, timeout)
+		if err != nil || er.ExitStatus != 0 {
+			return errored.Errorf("Could not detach %q (device %q): %v (%v)", image, device, er, err)
+		}
+	}
+
+	return nil
+}
+
+// backingFile returns the image file a loop device is attached to.
+func backingFile(device string) (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join("/sys/block", filepath.Base(device), "loop", "backing_file"))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+// copyImage copies an image, sharing blocks with the source if the
+// filesystem supports reflinks and keeping it sparse otherwise.
+func copyImage(source, target string, timeout time.Duration) error {
+	cmd := exec.Command("cp", "--reflink=auto", "--sparse=always", source, target)
+	er, err := runWithTimeout(cmd, timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return errored.Errorf("Could not copy %q to %q: %v (%v)", source, target, er, err)
+	}
+
+	return nil
+}
+
+func mkfsVolume(fscmd, devicePath string, timeout time.Duration) error {
+	cmd := exec.Command("/bin/sh", "-c", storage.TemplateFSCmd(fscmd, devicePath))
+	er, err := runWithTimeout(cmd, timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return errored.Errorf("Error creating filesystem on %s with cmd: %q. Error: %v (%v)", devicePath, fscmd, er, err)
+	}
+
+	return nil
+}
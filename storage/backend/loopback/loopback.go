@@ -0,0 +1,504 @@
+package loopback
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/mountscan"
+)
+
+const (
+	// BackendName is string for loopback storage backend
+	BackendName = "loopback"
+
+	imageSuffix    = ".img"
+	snapshotSuffix = ".snapshots"
+)
+
+// Driver implements a loopback file backed storage driver for volplugin. It
+// is intended for single hosts and CI, where no shared storage is available.
+//
+// -- Image layout
+//
+// Images are sparse files stored in the directory specified as `path` in the
+// driver options of the policy, as `<path>/<policy>/<volume>.img`. Snapshots
+// are copies of the image (reflinked if the filesystem supports it) stored in
+// `<path>/<policy>/<volume>.snapshots/<snapshot>.img`.
+type Driver struct {
+	mountpath string
+}
+
+// NewMountDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewMountDriver(mountpath string) (storage.MountDriver, error) {
+	return &Driver{mountpath: mountpath}, nil
+}
+
+// NewCRUDDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewCRUDDriver() (storage.CRUDDriver, error) {
+	return &Driver{}, nil
+}
+
+// NewSnapshotDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewSnapshotDriver() (storage.SnapshotDriver, error) {
+	return &Driver{}, nil
+}
+
+// NewStatsDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewStatsDriver() (storage.StatsDriver, error) {
+	return &Driver{}, nil
+}
+
+// Name returns the loopback backend string
+func (d *Driver) Name() string {
+	return BackendName
+}
+
+// Create a volume.
+func (d *Driver) Create(do storage.DriverOptions) error {
+	image, err := d.imagePath(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(image), 0700); err != nil {
+		return errored.Errorf("Creating image directory for %q: %v", do.Volume.Name, err)
+	}
+
+	f, err := os.OpenFile(image, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return storage.ErrVolumeExist
+		}
+		return errored.Errorf("Creating image %q: %v", image, err)
+	}
+	defer f.Close()
+
+	if err := f.Truncate(int64(do.Volume.Size) * 1024 * 1024); err != nil {
+		os.Remove(image)
+		return errored.Errorf("Sizing image %q: %v", image, err)
+	}
+
+	return nil
+}
+
+// Format formats a created volume.
+func (d *Driver) Format(do storage.DriverOptions) error {
+	image, err := d.imagePath(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	device, err := attach(image, do.Timeout)
+	if err != nil {
+		return err
+	}
+
+	if err := mkfsVolume(do.FSOptions.CreateCommand, device, do.Timeout); err != nil {
+		if err := detach(image, do.Timeout); err != nil {
+			logrus.Errorf("Error while trying to detach after failed filesystem creation: %v", err)
+		}
+		return err
+	}
+
+	return detach(image, do.Timeout)
+}
+
+// Destroy a volume.
+func (d *Driver) Destroy(do storage.DriverOptions) error {
+	image, err := d.imagePath(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(image + snapshotSuffix); err != nil {
+		return errored.Errorf("Destroying snapshots for disk %q: %v", do.Volume.Name, err)
+	}
+
+	if err := os.Remove(image); err != nil {
+		return errored.Errorf("Destroying disk %q: %v", do.Volume.Name, err)
+	}
+
+	return nil
+}
+
+// List all volumes.
+func (d *Driver) List(lo storage.ListOptions) ([]storage.Volume, error) {
+	root := lo.Params["path"]
+
+	policies, err := ioutil.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []storage.Volume{}, nil
+		}
+		return nil, errored.Errorf("Listing %q: %v", root, err)
+	}
+
+	list := []storage.Volume{}
+
+	for _, policy := range policies {
+		if !policy.IsDir() {
+			continue
+		}
+
+		images, err := ioutil.ReadDir(filepath.Join(root, policy.Name()))
+		if err != nil {
+			return nil, errored.Errorf("Listing %q: %v", filepath.Join(root, policy.Name()), err)
+		}
+
+		for _, image := range images {
+			if image.IsDir() || !strings.HasSuffix(image.Name(), imageSuffix) {
+				continue
+			}
+
+			list = append(list, storage.Volume{
+				Name:   strings.Join([]string{policy.Name(), strings.TrimSuffix(image.Name(), imageSuffix)}, "/"),
+				Params: storage.Params{"path": root},
+			})
+		}
+	}
+
+	return list, nil
+}
+
+// Mount a volume. Returns the loop device and mounted filesystem path.
+func (d *Driver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
+	image, err := d.imagePath(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	volumePath, err := d.MountPath(do)
+	if err != nil {
+		return nil, err
+	}
+
+	devName, err := attach(image, do.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	mount, err := d.mountDevice(devName, volumePath, do)
+	if err != nil {
+		if err := detach(image, do.Timeout); err != nil {
+			logrus.Errorf("Could not detach %q after failed mount: %v", image, err)
+		}
+		return nil, err
+	}
+
+	return mount, nil
+}
+
+// mountDevice mounts an attached loop device at volumePath.
+func (d *Driver) mountDevice(devName, volumePath string, do storage.DriverOptions) (*storage.Mount, error) {
+	if err := os.MkdirAll(volumePath, 0700); err != nil && !os.IsExist(err) {
+		return nil, errored.Errorf("error creating %q directory: %v", volumePath, err)
+	}
+
+	// Obtain the major and minor node information about the device we're mounting.
+	// This is critical for tuning cgroups and obtaining metrics for this device only.
+	fi, err := os.Stat(devName)
+	if err != nil {
+		return nil, errored.Errorf("Failed to stat loop device %q: %v", devName, err)
+	}
+
+	major, minor := storage.SplitDev(uint64(fi.Sys().(*syscall.Stat_t).Rdev))
+
+	if err := unix.Mount(devName, volumePath, do.FSOptions.Type, 0, ""); err != nil {
+		return nil, errored.Errorf("Failed to mount loop dev %q: %v", devName, err)
+	}
+
+	return &storage.Mount{
+		Device:   devName,
+		Path:     volumePath,
+		Volume:   do.Volume,
+		DevMajor: major,
+		DevMinor: minor,
+	}, nil
+}
+
+// Unmount a volume.
+func (d *Driver) Unmount(do storage.DriverOptions) error {
+	image, err := d.imagePath(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	volumeDir, err := d.MountPath(do)
+	if err != nil {
+		return err
+	}
+
+	var retries int
+	var lastErr error
+
+retry:
+	if retries < 3 {
+		if err := unix.Unmount(volumeDir, 0); err != nil && err != unix.ENOENT && err != unix.EINVAL {
+			lastErr = errored.Errorf("Failed to unmount %q (retrying): %v", volumeDir, err)
+			logrus.Error(lastErr)
+			retries++
+			time.Sleep(100 * time.Millisecond)
+			goto retry
+		}
+	} else {
+		return errored.Errorf("Failed to umount after 3 retries").Combine(lastErr.(*errored.Error))
+	}
+
+	if err := os.Remove(volumeDir); err != nil && !os.IsNotExist(err) {
+		return errored.Errorf("error removing %q directory: %v", volumeDir, err)
+	}
+
+	return detach(image, do.Timeout)
+}
+
+// Exists returns true if the volume already exists.
+func (d *Driver) Exists(do storage.DriverOptions) (bool, error) {
+	image, err := d.imagePath(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := os.Stat(image); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Stats reports the apparent size of the image and the blocks allocated for
+// it on the host filesystem. Images are sparse, so the latter is usually
+// much smaller.
+func (d *Driver) Stats(do storage.DriverOptions) (*storage.VolumeStats, error) {
+	image, err := d.imagePath(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(image)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.NotExists.Combine(errored.New(image))
+		}
+		return nil, err
+	}
+
+	stats := &storage.VolumeStats{Provisioned: uint64(fi.Size())}
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		// st_blocks is always in 512 byte units, regardless of the block size.
+		stats.Allocated = uint64(stat.Blocks) * 512
+	}
+
+	return stats, nil
+}
+
+// CreateSnapshot creates a named snapshot for the volume. Any error will be returned.
+func (d *Driver) CreateSnapshot(snapName string, do storage.DriverOptions) error {
+	image, err := d.imagePath(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	snapPath := snapshotPath(image, snapName)
+
+	if _, err := os.Stat(snapPath); err == nil {
+		return errored.Errorf("Creating snapshot %q (volume %q): snapshot already exists", snapName, do.Volume.Name).Combine(errors.Exists)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(snapPath), 0700); err != nil {
+		return errored.Errorf("Creating snapshot directory for %q: %v", do.Volume.Name, err)
+	}
+
+	if err := copyImage(image, snapPath, do.Timeout); err != nil {
+		return errored.Errorf("Creating snapshot %q (volume %q)", snapName, do.Volume.Name).Combine(err.(*errored.Error))
+	}
+
+	return nil
+}
+
+// RemoveSnapshot removes a named snapshot for the volume. Any error will be returned.
+func (d *Driver) RemoveSnapshot(snapName string, do storage.DriverOptions) error {
+	image, err := d.imagePath(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(snapshotPath(image, snapName)); err != nil {
+		return errored.Errorf("Removing snapshot %q (volume %q): %v", snapName, do.Volume.Name, err)
+	}
+
+	return nil
+}
+
+// RollbackSnapshot replaces the image with a copy of the named snapshot. The
+// image must not be attached. Any error will be returned.
+func (d *Driver) RollbackSnapshot(snapName string, do storage.DriverOptions) error {
+	image, err := d.imagePath(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	snapPath := snapshotPath(image, snapName)
+
+	if _, err := os.Stat(snapPath); err != nil {
+		return errored.Errorf("Snapshot %q (volume %q) does not exist", snapName, do.Volume.Name).Combine(errors.NotExists)
+	}
+
+	// copy aside first so a failed copy never leaves a half-written image.
+	tmpImage := image + ".rollback"
+	if err := copyImage(snapPath, tmpImage, do.Timeout); err != nil {
+		os.Remove(tmpImage)
+		return errored.Errorf("Rolling back snapshot %q (volume %q)", snapName, do.Volume.Name).Combine(err.(*errored.Error))
+	}
+
+	if err := os.Rename(tmpImage, image); err != nil {
+		os.Remove(tmpImage)
+		return errored.Errorf("Rolling back snapshot %q (volume %q): %v", snapName, do.Volume.Name, err)
+	}
+
+	return nil
+}
+
+// ListSnapshots returns an array of snapshot names provided a maximum number
+// of snapshots to be returned. Any error will be returned.
+func (d *Driver) ListSnapshots(do storage.DriverOptions) ([]string, error) {
+	image, err := d.imagePath(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+
+	snaps, err := ioutil.ReadDir(image + snapshotSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return names, nil
+		}
+		return nil, errored.Errorf("Listing snapshots for (volume %q): %v", do.Volume.Name, err)
+	}
+
+	for _, snap := range snaps {
+		if strings.HasSuffix(snap.Name(), imageSuffix) {
+			names = append(names, strings.TrimSuffix(snap.Name(), imageSuffix))
+		}
+	}
+
+	return names, nil
+}
+
+// CopySnapshot copies a snapshot into a new volume. Takes a DriverOptions,
+// snap and volume name (string). Returns error on failure.
+func (d *Driver) CopySnapshot(do storage.DriverOptions, snapName, newName string) error {
+	image, err := d.imagePath(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	newImage, err := d.imagePath(newName, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	snapPath := snapshotPath(image, snapName)
+
+	if _, err := os.Stat(snapPath); err != nil {
+		return errored.Errorf("Snapshot %q (volume %q) does not exist", snapName, do.Volume.Name).Combine(errors.SnapshotCopy)
+	}
+
+	if _, err := os.Stat(newImage); err == nil {
+		return errored.Errorf("Volume %q already exists", newName).Combine(errors.Exists)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(newImage), 0700); err != nil {
+		return errored.Errorf("Creating image directory for %q: %v", newName, err).Combine(errors.SnapshotCopy)
+	}
+
+	if err := copyImage(snapPath, newImage, do.Timeout); err != nil {
+		os.Remove(newImage)
+		return errored.Errorf("Cloning snapshot to volume (volume %q, snapshot %q)", do.Volume.Name, snapName).Combine(err.(*errored.Error)).Combine(errors.SnapshotCopy)
+	}
+
+	return nil
+}
+
+// Mounted describes all the volumes currently mounted on the host.
+func (d *Driver) Mounted(timeout time.Duration) ([]*storage.Mount, error) {
+	mounts := []*storage.Mount{}
+
+	hostMounts, err := mountscan.GetMounts(&mountscan.GetMountsRequest{DriverName: BackendName, KernelDriver: "loop"})
+	if err != nil {
+		if newerr, ok := err.(*errored.Error); ok && newerr.Contains(errors.ErrDevNotFound) {
+			return mounts, nil
+		}
+		return nil, err
+	}
+
+	for _, hostMount := range hostMounts {
+		logrus.Debugf("Host mounts: %#v", hostMount)
+
+		image, err := backingFile(hostMount.MountSource)
+		if err != nil {
+			logrus.Debugf("Skipping mount %q: %v", hostMount.MountPoint, err)
+			continue
+		}
+
+		if !strings.HasSuffix(image, imageSuffix) {
+			continue
+		}
+
+		policy := filepath.Base(filepath.Dir(image))
+		volName := strings.Join([]string{policy, strings.TrimSuffix(filepath.Base(image), imageSuffix)}, "/")
+
+		if hostMount.MountPoint != filepath.Join(d.mountpath, volName) {
+			continue
+		}
+
+		mounts = append(mounts, &storage.Mount{
+			Device:   hostMount.MountSource,
+			DevMajor: hostMount.DeviceNumber.Major,
+			DevMinor: hostMount.DeviceNumber.Minor,
+			Path:     hostMount.MountPoint,
+			Volume: storage.Volume{
+				Name:   volName,
+				Params: storage.Params{"path": filepath.Dir(filepath.Dir(image))},
+			},
+		})
+	}
+
+	return mounts, nil
+}
+
+// Validate validates the driver options to ensure they are compatible with the
+// loopback storage driver.
+func (d *Driver) Validate(do *storage.DriverOptions) error {
+	// XXX check this first to guard against nil pointers ahead of time.
+	if err := do.Validate(); err != nil {
+		return err
+	}
+
+	if do.Volume.Params["path"] == "" {
+		return errored.Errorf("Image path is missing in loopback storage driver.")
+	}
+
+	if !filepath.IsAbs(do.Volume.Params["path"]) {
+		return errored.Errorf("Image path %q must be absolute in loopback storage driver.", do.Volume.Params["path"])
+	}
+
+	return nil
+}
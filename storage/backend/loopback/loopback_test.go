@@ -0,0 +1,373 @@
+package loopback
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	. "testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/volplugin/storage"
+)
+
+const (
+	myMountpath = "/mnt/loopback"
+	imagePath   = "/tmp/volplugin-loopback"
+)
+
+var filesystems = map[string]storage.FSOptions{
+	"ext4": {
+		Type:          "ext4",
+		CreateCommand: "mkfs.ext4 -m0 %",
+	},
+}
+
+var volumeSpec = storage.Volume{
+	Name:   "test/pithos",
+	Size:   10,
+	Params: storage.Params{"path": imagePath},
+}
+
+type loopbackSuite struct{}
+
+var _ = Suite(&loopbackSuite{})
+
+func TestLoopback(t *T) { TestingT(t) }
+
+func (s *loopbackSuite) SetUpTest(c *C) {
+	if os.Getenv("DEBUG") != "" {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+
+	c.Assert(os.RemoveAll(imagePath), IsNil)
+}
+
+func (s *loopbackSuite) TearDownSuite(c *C) {
+	c.Assert(os.RemoveAll(imagePath), IsNil)
+}
+
+func (s *loopbackSuite) readWriteTest(c *C, mountDir string) {
+	c.Assert(ioutil.WriteFile(filepath.Join(mountDir, "test.txt"), []byte("Test string\n"), 0644), IsNil)
+	content, err := ioutil.ReadFile(filepath.Join(mountDir, "test.txt"))
+	c.Assert(err, IsNil)
+	c.Assert(strings.TrimSpace(string(content)), Equals, "Test string")
+}
+
+func (s *loopbackSuite) TestPaths(c *C) {
+	driver := &Driver{mountpath: myMountpath}
+
+	image, err := driver.imagePath("policy/volume", storage.Params{"path": imagePath})
+	c.Assert(err, IsNil)
+	c.Assert(image, Equals, filepath.Join(imagePath, "policy", "volume.img"))
+
+	for _, name := range []string{"policy", "policy/", "/volume", "policy/volume/extra"} {
+		_, err := driver.imagePath(name, storage.Params{"path": imagePath})
+		c.Assert(err, NotNil, Commentf("%s", name))
+	}
+
+	_, err = driver.imagePath("policy/volume", storage.Params{})
+	c.Assert(err, NotNil)
+
+	c.Assert(snapshotPath(image, "2016-01-02 15:04:05"), Equals, filepath.Join(imagePath, "policy", "volume.img.snapshots", "2016-01-02-15:04:05.img"))
+
+	mp, err := driver.MountPath(storage.DriverOptions{Volume: storage.Volume{Name: "policy/volume"}})
+	c.Assert(err, IsNil)
+	c.Assert(mp, Equals, filepath.Join(myMountpath, "policy", "volume"))
+}
+
+func (s *loopbackSuite) TestParseLosetup(c *C) {
+	out := `/dev/loop0: [64769]:1234 (/tmp/volplugin-loopback/test/pithos.img)
+/dev/loop3: [64769]:1234 (/tmp/volplugin-loopback/test/pithos.img)
+`
+	c.Assert(parseLosetup(out), DeepEquals, []string{"/dev/loop0", "/dev/loop3"})
+	c.Assert(parseLosetup(""), DeepEquals, []string{})
+}
+
+func (s *loopbackSuite) TestValidate(c *C) {
+	driver := &Driver{}
+
+	do := storage.DriverOptions{Volume: volumeSpec, FSOptions: filesystems["ext4"], Timeout: 5 * time.Second}
+	c.Assert(driver.Validate(&do), IsNil)
+
+	do.Volume.Params = storage.Params{}
+	c.Assert(driver.Validate(&do), NotNil)
+	do.Volume.Params = storage.Params{"path": "relative/path"}
+	c.Assert(driver.Validate(&do), NotNil)
+}
+
+func (s *loopbackSuite) TestCreateListDestroy(c *C) {
+	crudDrv, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	list, err := crudDrv.List(storage.ListOptions{Params: volumeSpec.Params})
+	c.Assert(err, IsNil)
+	c.Assert(len(list), Equals, 0)
+
+	c.Assert(crudDrv.Create(driverOpts), IsNil)
+	c.Assert(crudDrv.Create(driverOpts), Equals, storage.ErrVolumeExist)
+
+	fi, err := os.Stat(filepath.Join(imagePath, "test", "pithos.img"))
+	c.Assert(err, IsNil)
+	c.Assert(fi.Size(), Equals, int64(10*1024*1024))
+
+	exists, err := crudDrv.Exists(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+
+	list, err = crudDrv.List(storage.ListOptions{Params: volumeSpec.Params})
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []storage.Volume{{Name: "test/pithos", Params: volumeSpec.Params}})
+
+	c.Assert(crudDrv.Destroy(driverOpts), IsNil)
+
+	exists, err = crudDrv.Exists(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *loopbackSuite) TestStats(c *C) {
+	crudDrv, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	statsDrv, err := NewStatsDriver()
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	defer crudDrv.Destroy(driverOpts)
+
+	c.Assert(crudDrv.Create(driverOpts), IsNil)
+
+	// freshly created images are entirely sparse.
+	stats, err := statsDrv.Stats(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(stats.Provisioned, Equals, uint64(10*1024*1024))
+	c.Assert(stats.Allocated, Equals, uint64(0))
+
+	c.Assert(crudDrv.Format(driverOpts), IsNil)
+
+	stats, err = statsDrv.Stats(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(stats.Allocated > 0, Equals, true)
+	c.Assert(stats.Allocated <= stats.Provisioned, Equals, true)
+
+	c.Assert(crudDrv.Destroy(driverOpts), IsNil)
+
+	_, err = statsDrv.Stats(driverOpts)
+	c.Assert(err, NotNil)
+}
+
+func (s *loopbackSuite) TestMountUnmountVolume(c *C) {
+	crudDrv, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	mountDrv, err := NewMountDriver(myMountpath)
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	defer crudDrv.Destroy(driverOpts)
+	defer mountDrv.Unmount(driverOpts)
+
+	c.Assert(crudDrv.Create(driverOpts), IsNil)
+	c.Assert(crudDrv.Format(driverOpts), IsNil)
+
+	ms, err := mountDrv.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(ms.Volume, DeepEquals, driverOpts.Volume)
+	c.Assert(strings.HasPrefix(ms.Device, "/dev/loop"), Equals, true)
+	c.Assert(ms.DevMajor, Equals, uint(7))
+	c.Assert(fmt.Sprintf("/dev/loop%d", ms.DevMinor), Equals, ms.Device)
+
+	mp, err := mountDrv.MountPath(driverOpts)
+	c.Assert(err, IsNil)
+	s.readWriteTest(c, mp)
+
+	mounts, err := mountDrv.Mounted(5 * time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 1)
+	// the size is not known from the mount.
+	c.Assert(mounts[0].Volume.Name, Equals, driverOpts.Volume.Name)
+	c.Assert(mounts[0].Volume.Params, DeepEquals, driverOpts.Volume.Params)
+	c.Assert(mounts[0].Path, Equals, mp)
+	c.Assert(mounts[0].Device, Equals, ms.Device)
+
+	c.Assert(mountDrv.Unmount(driverOpts), IsNil)
+
+	devices, err := loopDevices(filepath.Join(imagePath, "test", "pithos.img"), 5*time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(len(devices), Equals, 0)
+
+	mounts, err = mountDrv.Mounted(5 * time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 0)
+
+	// a failed mount must not leave the image attached.
+	badOpts := driverOpts
+	badOpts.FSOptions.Type = "nonexistent"
+	_, err = mountDrv.Mount(badOpts)
+	c.Assert(err, NotNil)
+
+	devices, err = loopDevices(filepath.Join(imagePath, "test", "pithos.img"), 5*time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(len(devices), Equals, 0)
+
+	c.Assert(crudDrv.Destroy(driverOpts), IsNil)
+}
+
+func (s *loopbackSuite) TestSnapshots(c *C) {
+	snapDrv, err := NewSnapshotDriver()
+	c.Assert(err, IsNil)
+	crudDrv, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	c.Assert(crudDrv.Create(driverOpts), IsNil)
+	defer crudDrv.Destroy(driverOpts)
+	c.Assert(snapDrv.CreateSnapshot("hello", driverOpts), IsNil)
+	c.Assert(snapDrv.CreateSnapshot("hello", driverOpts), NotNil)
+
+	list, err := snapDrv.ListSnapshots(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []string{"hello"})
+
+	// snapshots must not show up as volumes
+	vols, err := crudDrv.List(storage.ListOptions{Params: volumeSpec.Params})
+	c.Assert(err, IsNil)
+	c.Assert(len(vols), Equals, 1)
+
+	c.Assert(snapDrv.RemoveSnapshot("hello", driverOpts), IsNil)
+	c.Assert(snapDrv.RemoveSnapshot("hello", driverOpts), NotNil)
+
+	list, err = snapDrv.ListSnapshots(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(len(list), Equals, 0)
+
+	c.Assert(snapDrv.CreateSnapshot("hello", driverOpts), IsNil)
+	c.Assert(crudDrv.Destroy(driverOpts), IsNil)
+	_, err = os.Stat(filepath.Join(imagePath, "test", "pithos.img.snapshots"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *loopbackSuite) TestSnapshotClone(c *C) {
+	snapDrv, err := NewSnapshotDriver()
+	c.Assert(err, IsNil)
+	crudDrv, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	mountDrv, err := NewMountDriver(myMountpath)
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	cloneOpts := storage.DriverOptions{
+		Volume:    storage.Volume{Name: "test/pithos-clone", Params: volumeSpec.Params},
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	c.Assert(crudDrv.Create(driverOpts), IsNil)
+	defer crudDrv.Destroy(driverOpts)
+	c.Assert(crudDrv.Format(driverOpts), IsNil)
+
+	_, err = mountDrv.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	mp, err := mountDrv.MountPath(driverOpts)
+	c.Assert(err, IsNil)
+	s.readWriteTest(c, mp)
+	c.Assert(mountDrv.Unmount(driverOpts), IsNil)
+
+	c.Assert(snapDrv.CreateSnapshot("snap", driverOpts), IsNil)
+	c.Assert(snapDrv.CopySnapshot(driverOpts, "snap", "test/pithos-clone"), IsNil)
+	defer crudDrv.Destroy(cloneOpts)
+	c.Assert(snapDrv.CopySnapshot(driverOpts, "snap", "test/pithos-clone"), NotNil)
+	c.Assert(snapDrv.CopySnapshot(driverOpts, "missing", "test/pithos-other"), NotNil)
+
+	_, err = mountDrv.Mount(cloneOpts)
+	c.Assert(err, IsNil)
+	mp, err = mountDrv.MountPath(cloneOpts)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadFile(filepath.Join(mp, "test.txt"))
+	c.Assert(err, IsNil)
+	c.Assert(strings.TrimSpace(string(content)), Equals, "Test string")
+	c.Assert(mountDrv.Unmount(cloneOpts), IsNil)
+
+	c.Assert(crudDrv.Destroy(cloneOpts), IsNil)
+	c.Assert(crudDrv.Destroy(driverOpts), IsNil)
+}
+
+func (s *loopbackSuite) TestSnapshotRollback(c *C) {
+	snapDrv, err := NewSnapshotDriver()
+	c.Assert(err, IsNil)
+	crudDrv, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	mountDrv, err := NewMountDriver(myMountpath)
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	c.Assert(crudDrv.Create(driverOpts), IsNil)
+	defer crudDrv.Destroy(driverOpts)
+	c.Assert(crudDrv.Format(driverOpts), IsNil)
+
+	mp, err := mountDrv.MountPath(driverOpts)
+	c.Assert(err, IsNil)
+
+	_, err = mountDrv.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(mp, "test.txt"), []byte("before"), 0644), IsNil)
+	c.Assert(mountDrv.Unmount(driverOpts), IsNil)
+
+	c.Assert(snapDrv.CreateSnapshot("snap", driverOpts), IsNil)
+
+	_, err = mountDrv.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(mp, "test.txt"), []byte("after"), 0644), IsNil)
+	c.Assert(mountDrv.Unmount(driverOpts), IsNil)
+
+	c.Assert(snapDrv.RollbackSnapshot("snap", driverOpts), IsNil)
+	c.Assert(snapDrv.RollbackSnapshot("missing", driverOpts), NotNil)
+
+	_, err = mountDrv.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadFile(filepath.Join(mp, "test.txt"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "before")
+	c.Assert(mountDrv.Unmount(driverOpts), IsNil)
+
+	// the snapshot must survive the rollback.
+	list, err := snapDrv.ListSnapshots(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []string{"snap"})
+
+	c.Assert(crudDrv.Destroy(driverOpts), IsNil)
+}
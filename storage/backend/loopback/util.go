@@ -0,0 +1,25 @@
+package loopback
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+)
+
+// MountPath returns the path of a mount for a policy/volume.
+func (d *Driver) MountPath(do storage.DriverOptions) (string, error) {
+	if _, _, err := storage.SplitName(do.Volume.Name); err != nil {
+		return "", err
+	}
+
+	volumePath := filepath.Join(d.mountpath, do.Volume.Name)
+	rel, err := filepath.Rel(d.mountpath, volumePath)
+	if err != nil || strings.Contains(rel, "..") {
+		return "", errors.MountFailed.Combine(errored.Errorf("Calculated volume path would escape subdir jail: %v", volumePath))
+	}
+
+	return volumePath, nil
+}
@@ -0,0 +1,186 @@
+package lvm
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/executor"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+)
+
+type lvInfo struct {
+	Name   string
+	Pool   string
+	Origin string
+}
+
+func runWithTimeout(cmd *exec.Cmd, timeout time.Duration) (*executor.ExecResult, error) {
+	ctx, _ := context.WithTimeout(context.Background(), timeout)
+	return executor.NewCapture(cmd).Run(ctx)
+}
+
+func mklv(group, name string) string {
+	return fmt.Sprintf("%s/%s", group, name)
+}
+
+// mksnap yields the logical volume name of a snapshot. LVM only allows a
+// small set of characters in names, so anything else in the snapshot name
+// (like the spaces and colons volsupervisor uses) is replaced.
+func mksnap(intName, snapName string) string {
+	return fmt.Sprintf("%s.%s", intName, sanitizeName(snapName))
+}
+
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '+', r == '_', r == '.', r == '-':
+			return r
+		default:
+			return '-'
+		}
+	}, name)
+}
+
+// devicePath returns the device mapper node for the logical volume. dashes in
+// the group and volume names are doubled by device mapper.
+func devicePath(group, name string) string {
+	escape := func(s string) string { return strings.Replace(s, "-", "--", -1) }
+	return filepath.Join("/dev/mapper", escape(group)+"-"+escape(name))
+}
+
+func (d *Driver) mkMountPath(group, intName string) (string, error) {
+	// Directory to mount the volume
+	volumePath := filepath.Join(d.mountpath, group, intName)
+	rel, err := filepath.Rel(d.mountpath, volumePath)
+	if err != nil || strings.Contains(rel, "..") {
+		return "", errors.MountFailed.Combine(errored.Errorf("Calculated volume path would escape subdir jail: %v", volumePath))
+	}
+
+	return volumePath, nil
+}
+
+func (d *Driver) listLVs(group string, timeout time.Duration) ([]lvInfo, error) {
+	cmd := exec.Command("lvs", "--noheadings", "--separator", "|", "-o", "lv_name,pool_lv,origin", group)
+
+	var (
+		er  *executor.ExecResult
+		err error
+	)
+
+	if timeout == 0 {
+		er, err = executor.NewCapture(cmd).Run(context.Background())
+	} else {
+		er, err = runWithTimeout(cmd, timeout)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if er.ExitStatus != 0 {
+		return nil, errored.Errorf("Listing volume group %q: %v", group, er)
+	}
+
+	return parseLVs(er.Stdout), nil
+}
+
+func parseLVs(out string) []lvInfo {
+	lvs := []lvInfo{}
+
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.Split(strings.TrimSpace(line), "|")
+		if len(parts) != 3 || parts[0] == "" {
+			continue
+		}
+
+		lvs = append(lvs, lvInfo{
+			Name:   strings.TrimSpace(parts[0]),
+			Pool:   strings.TrimSpace(parts[1]),
+			Origin: strings.TrimSpace(parts[2]),
+		})
+	}
+
+	return lvs
+}
+
+// parseLVStats parses the `lv_size,data_percent` columns of a single thin
+// volume, which look like:
+//
+//	10485760|12.50
+func parseLVStats(out string) (*storage.VolumeStats, error) {
+	parts := strings.Split(strings.TrimSpace(out), "|")
+	if len(parts) != 2 {
+		return nil, errored.Errorf("Could not parse logical volume usage %q", out)
+	}
+
+	size, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil {
+		return nil, errored.Errorf("Could not parse logical volume size %q", parts[0]).Combine(err)
+	}
+
+	percent, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return nil, errored.Errorf("Could not parse logical volume data usage %q", parts[1]).Combine(err)
+	}
+
+	return &storage.VolumeStats{
+		Provisioned: size,
+		Allocated:   uint64(float64(size) * percent / 100),
+	}, nil
+}
+
+func (d *Driver) activate(do storage.DriverOptions) (string, error) {
+	group := do.Volume.Params["group"]
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command("lvchange", "--activate", "y", "--ignoreactivationskip", mklv(group, intName))
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return "", errored.Errorf("Could not activate %q: %v (%v)", intName, er, err)
+	}
+
+	device := devicePath(group, intName)
+	logrus.Debugf("activated volume %q as %q", intName, device)
+
+	return device, nil
+}
+
+func (d *Driver) deactivate(do storage.DriverOptions) error {
+	group := do.Volume.Params["group"]
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("lvchange", "--activate", "n", mklv(group, intName))
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return errored.Errorf("Could not deactivate %q: %v (%v)", intName, er, err)
+	}
+
+	return nil
+}
+
+func (d *Driver) mkfsVolume(fscmd, devicePath string, timeout time.Duration) error {
+	cmd := exec.Command("/bin/sh", "-c", storage.TemplateFSCmd(fscmd, devicePath))
+	er, err := runWithTimeout(cmd, timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return errored.Errorf("Error creating filesystem on %s with cmd: %q. Error: %v (%v)", devicePath, fscmd, er, err)
+	}
+
+	return nil
+}
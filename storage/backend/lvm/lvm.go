@@ -0,0 +1,515 @@
+package lvm
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/mountscan"
+)
+
+const (
+	// BackendName is string for lvm storage backend
+	BackendName = "lvm"
+
+	// rollbackSuffix names the old volume while a rollback is in progress.
+	rollbackSuffix = ".rollback"
+)
+
+// Driver implements a LVM thin-pool backed storage driver for volplugin.
+//
+// -- Group and pool naming
+//
+// All LVM operations require a volume group (specified as `group`) and a
+// thin pool inside that group (specified as `pool`) in the driver options of
+// the policy. The thin pool must already exist; volplugin will not create it.
+//
+// -- Snapshots
+//
+// Snapshots are thin snapshots of the volume, named `<policy>.<volume>.<snapshot>`.
+// They are not activated unless copied into a new volume.
+type Driver struct {
+	mountpath string
+}
+
+// NewMountDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewMountDriver(mountpath string) (storage.MountDriver, error) {
+	return &Driver{mountpath: mountpath}, nil
+}
+
+// NewCRUDDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewCRUDDriver() (storage.CRUDDriver, error) {
+	return &Driver{}, nil
+}
+
+// NewSnapshotDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewSnapshotDriver() (storage.SnapshotDriver, error) {
+	return &Driver{}, nil
+}
+
+// NewStatsDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewStatsDriver() (storage.StatsDriver, error) {
+	return &Driver{}, nil
+}
+
+// Name returns the lvm backend string
+func (d *Driver) Name() string {
+	return BackendName
+}
+
+func (d *Driver) externalName(s string) string {
+	return strings.Join(strings.SplitN(s, ".", 2), "/")
+}
+
+// internalName translates a volplugin `tenant/volume` name to a logical
+// volume name. Yields an error if impossible.
+func (d *Driver) internalName(s string) (string, error) {
+	strs := strings.SplitN(s, "/", 2)
+	if len(strs) != 2 {
+		return "", errored.Errorf("Invalid volume name %q, must be two parts", s)
+	}
+
+	if strings.Contains(strs[0], ".") {
+		return "", errored.Errorf("Invalid policy name %q, cannot contain '.'", strs[0])
+	}
+
+	if strings.Contains(strs[1], "/") || strings.Contains(strs[1], ".") {
+		return "", errored.Errorf("Invalid volume name %q, cannot contain '/' or '.'", strs[1])
+	}
+
+	name := strings.Join(strs, ".")
+	if sanitizeName(name) != name || strings.HasPrefix(name, "-") {
+		return "", errored.Errorf("Invalid volume name %q, contains characters not allowed by LVM", s)
+	}
+
+	return name, nil
+}
+
+// Create a volume.
+func (d *Driver) Create(do storage.DriverOptions) error {
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	exists, err := d.Exists(do)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return storage.ErrVolumeExist
+	}
+
+	group, pool := do.Volume.Params["group"], do.Volume.Params["pool"]
+
+	cmd := exec.Command("lvcreate", "--thin", "--virtualsize", strconv.FormatUint(do.Volume.Size, 10)+"M", "--name", intName, mklv(group, pool))
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return errored.Errorf("Creating disk %q: %v (%v)", intName, er, err)
+	}
+
+	return nil
+}
+
+// Format formats a created volume.
+func (d *Driver) Format(do storage.DriverOptions) error {
+	device, err := d.activate(do)
+	if err != nil {
+		return err
+	}
+
+	if err := d.mkfsVolume(do.FSOptions.CreateCommand, device, do.Timeout); err != nil {
+		if err := d.deactivate(do); err != nil {
+			logrus.Errorf("Error while trying to deactivate after failed filesystem creation: %v", err)
+		}
+		return err
+	}
+
+	return d.deactivate(do)
+}
+
+// Destroy a volume.
+func (d *Driver) Destroy(do storage.DriverOptions) error {
+	group := do.Volume.Params["group"]
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	snaps, err := d.ListSnapshots(do)
+	if err != nil {
+		return err
+	}
+
+	for _, snap := range snaps {
+		if err := d.RemoveSnapshot(snap, do); err != nil {
+			return errored.Errorf("Destroying snapshots for disk %q", intName).Combine(err.(*errored.Error))
+		}
+	}
+
+	cmd := exec.Command("lvremove", "-f", mklv(group, intName))
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return errored.Errorf("Destroying disk %q: %v (%v)", intName, er, err)
+	}
+
+	return nil
+}
+
+// List all volumes in the thin pool.
+func (d *Driver) List(lo storage.ListOptions) ([]storage.Volume, error) {
+	group, pool := lo.Params["group"], lo.Params["pool"]
+
+	lvs, err := d.listLVs(group, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []storage.Volume{}
+
+	for _, lv := range lvs {
+		// snapshots carry a third part in their name, and live in the same pool.
+		if lv.Pool != pool || strings.Count(lv.Name, ".") != 1 {
+			continue
+		}
+
+		list = append(list, storage.Volume{Name: d.externalName(lv.Name), Params: storage.Params{"group": group, "pool": pool}})
+	}
+
+	return list, nil
+}
+
+// Mount a volume. Returns the device mapper path and mounted filesystem path.
+func (d *Driver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	volumePath, err := d.mkMountPath(do.Volume.Params["group"], intName)
+	if err != nil {
+		return nil, err
+	}
+
+	devName, err := d.activate(do)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create directory to mount
+	if err := os.MkdirAll(d.mountpath, 0700); err != nil && !os.IsExist(err) {
+		return nil, errored.Errorf("error creating %q directory: %v", d.mountpath, err)
+	}
+
+	if err := os.MkdirAll(volumePath, 0700); err != nil && !os.IsExist(err) {
+		return nil, errored.Errorf("error creating %q directory: %v", volumePath, err)
+	}
+
+	// Obtain the major and minor node information about the device we're mounting.
+	// This is critical for tuning cgroups and obtaining metrics for this device only.
+	fi, err := os.Stat(devName)
+	if err != nil {
+		return nil, errored.Errorf("Failed to stat lvm device %q: %v", devName, err)
+	}
+
+	major, minor := storage.SplitDev(uint64(fi.Sys().(*syscall.Stat_t).Rdev))
+
+	if err := unix.Mount(devName, volumePath, do.FSOptions.Type, 0, ""); err != nil {
+		return nil, errored.Errorf("Failed to mount lvm dev %q: %v", devName, err)
+	}
+
+	return &storage.Mount{
+		Device:   devName,
+		Path:     volumePath,
+		Volume:   do.Volume,
+		DevMajor: major,
+		DevMinor: minor,
+	}, nil
+}
+
+// Unmount a volume.
+func (d *Driver) Unmount(do storage.DriverOptions) error {
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	volumeDir, err := d.mkMountPath(do.Volume.Params["group"], intName)
+	if err != nil {
+		return err
+	}
+
+	var retries int
+	var lastErr error
+
+retry:
+	if retries < 3 {
+		if err := unix.Unmount(volumeDir, 0); err != nil && err != unix.ENOENT && err != unix.EINVAL {
+			lastErr = errored.Errorf("Failed to unmount %q (retrying): %v", volumeDir, err)
+			logrus.Error(lastErr)
+			retries++
+			time.Sleep(100 * time.Millisecond)
+			goto retry
+		}
+	} else {
+		return errored.Errorf("Failed to umount after 3 retries").Combine(lastErr.(*errored.Error))
+	}
+
+	if err := os.Remove(volumeDir); err != nil && !os.IsNotExist(err) {
+		return errored.Errorf("error removing %q directory: %v", volumeDir, err)
+	}
+
+	return d.deactivate(do)
+}
+
+// Exists returns true if the volume already exists.
+func (d *Driver) Exists(do storage.DriverOptions) (bool, error) {
+	volumes, err := d.List(storage.ListOptions{Params: do.Volume.Params})
+	if err != nil {
+		return false, err
+	}
+
+	for _, vol := range volumes {
+		if vol.Name == do.Volume.Name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Stats reports the virtual size of the thin volume and how much of the thin
+// pool it has allocated.
+func (d *Driver) Stats(do storage.DriverOptions) (*storage.VolumeStats, error) {
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("lvs", "--noheadings", "--units", "b", "--nosuffix", "--separator", "|", "-o", "lv_size,data_percent", mklv(do.Volume.Params["group"], intName))
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return nil, errored.Errorf("Retrieving usage for %q: %v (%v)", intName, er, err)
+	}
+
+	return parseLVStats(er.Stdout)
+}
+
+// CreateSnapshot creates a named snapshot for the volume. Any error will be returned.
+func (d *Driver) CreateSnapshot(snapName string, do storage.DriverOptions) error {
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	snapLV := mksnap(intName, snapName)
+	if snapLV == mksnap(intName, rollbackSuffix) {
+		return errored.Errorf("Creating snapshot %q (volume %q): name is reserved for rollbacks", snapName, intName)
+	}
+
+	cmd := exec.Command("lvcreate", "--snapshot", "--name", snapLV, mklv(do.Volume.Params["group"], intName))
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return errored.Errorf("Creating snapshot %q (volume %q): %v (%v)", snapName, intName, er, err)
+	}
+
+	return nil
+}
+
+// RemoveSnapshot removes a named snapshot for the volume. Any error will be returned.
+func (d *Driver) RemoveSnapshot(snapName string, do storage.DriverOptions) error {
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("lvremove", "-f", mklv(do.Volume.Params["group"], mksnap(intName, snapName)))
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return errored.Errorf("Removing snapshot %q (volume %q): %v (%v)", snapName, intName, er, err)
+	}
+
+	return nil
+}
+
+// RollbackSnapshot replaces the volume with a thin snapshot of the named
+// snapshot. The old volume is renamed aside until the new one exists, so a
+// failure leaves the volume untouched. The volume must not be mounted.
+func (d *Driver) RollbackSnapshot(snapName string, do storage.DriverOptions) error {
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	group := do.Volume.Params["group"]
+	snapLV := mksnap(intName, snapName)
+	asideLV := mksnap(intName, rollbackSuffix)
+
+	cmd := exec.Command("lvrename", group, intName, asideLV)
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return errored.Errorf("Rolling back snapshot %q (volume %q): %v (%v)", snapName, intName, er, err)
+	}
+
+	cmd = exec.Command("lvcreate", "--snapshot", "--setactivationskip", "n", "--name", intName, mklv(group, snapLV))
+	er, err = runWithTimeout(cmd, do.Timeout)
+	if err != nil || er.ExitStatus != 0 {
+		newerr := errored.Errorf("Rolling back snapshot %q (volume %q): %v (%v)", snapName, intName, er, err)
+
+		cmd = exec.Command("lvrename", group, asideLV, intName)
+		if er, err := runWithTimeout(cmd, do.Timeout); err != nil || er.ExitStatus != 0 {
+			logrus.Errorf("Could not restore volume %q from %q after failed rollback: %v (%v)", intName, asideLV, er, err)
+		}
+
+		return newerr
+	}
+
+	cmd = exec.Command("lvremove", "-f", mklv(group, asideLV))
+	if er, err := runWithTimeout(cmd, do.Timeout); err != nil || er.ExitStatus != 0 {
+		logrus.Errorf("Rolled back volume %q, but could not remove its old contents %q: %v (%v)", intName, asideLV, er, err)
+	}
+
+	return nil
+}
+
+// ListSnapshots returns an array of snapshot names provided a maximum number
+// of snapshots to be returned. Any error will be returned.
+func (d *Driver) ListSnapshots(do storage.DriverOptions) ([]string, error) {
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	lvs, err := d.listLVs(do.Volume.Params["group"], do.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+
+	for _, lv := range lvs {
+		// the origin is not checked, as it changes when the volume is rolled back.
+		// volume names cannot contain dots, so the prefix is unambiguous. the
+		// old volume set aside by a rollback is not a snapshot.
+		if strings.HasPrefix(lv.Name, intName+".") && lv.Name != mksnap(intName, rollbackSuffix) {
+			names = append(names, strings.TrimPrefix(lv.Name, intName+"."))
+		}
+	}
+
+	return names, nil
+}
+
+// CopySnapshot copies a snapshot into a new volume. Takes a DriverOptions,
+// snap and volume name (string). Returns error on failure.
+func (d *Driver) CopySnapshot(do storage.DriverOptions, snapName, newName string) error {
+	intOrigName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	intNewName, err := d.internalName(newName)
+	if err != nil {
+		return err
+	}
+
+	group := do.Volume.Params["group"]
+
+	exists, err := d.Exists(storage.DriverOptions{Volume: storage.Volume{Name: newName, Params: do.Volume.Params}})
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return errored.Errorf("Volume %q already exists", newName).Combine(errors.Exists)
+	}
+
+	// a thin snapshot of the snapshot is a writable copy; --setactivationskip n
+	// allows it to be activated like any other volume.
+	cmd := exec.Command("lvcreate", "--snapshot", "--setactivationskip", "n", "--name", intNewName, mklv(group, mksnap(intOrigName, snapName)))
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if err != nil || er.ExitStatus != 0 {
+		return errored.Errorf("Cloning snapshot to volume (volume %q, snapshot %q): %v (%v)", intOrigName, snapName, er, err).Combine(errors.SnapshotCopy)
+	}
+
+	return nil
+}
+
+// Mounted describes all the volumes currently mounted on the host.
+func (d *Driver) Mounted(timeout time.Duration) ([]*storage.Mount, error) {
+	mounts := []*storage.Mount{}
+
+	hostMounts, err := mountscan.GetMounts(&mountscan.GetMountsRequest{DriverName: BackendName, KernelDriver: "device-mapper"})
+	if err != nil {
+		if newerr, ok := err.(*errored.Error); ok && newerr.Contains(errors.ErrDevNotFound) {
+			return mounts, nil
+		}
+		return nil, err
+	}
+
+	for _, hostMount := range hostMounts {
+		logrus.Debugf("Host mounts: %#v", hostMount)
+
+		rel, err := filepath.Rel(d.mountpath, hostMount.MountPoint)
+		if err != nil || strings.Contains(rel, "..") {
+			continue
+		}
+
+		parts := strings.Split(rel, "/")
+		if len(parts) != 2 || strings.Count(parts[1], ".") != 1 {
+			continue
+		}
+
+		group, intName := parts[0], parts[1]
+
+		if hostMount.MountSource != devicePath(group, intName) && hostMount.MountSource != filepath.Join("/dev", group, intName) {
+			continue
+		}
+
+		mounts = append(mounts, &storage.Mount{
+			Device:   hostMount.MountSource,
+			DevMajor: hostMount.DeviceNumber.Major,
+			DevMinor: hostMount.DeviceNumber.Minor,
+			Path:     hostMount.MountPoint,
+			Volume: storage.Volume{
+				Name:   d.externalName(intName),
+				Params: storage.Params{"group": group},
+			},
+		})
+	}
+
+	return mounts, nil
+}
+
+// Validate validates the driver options to ensure they are compatible with the
+// LVM storage driver.
+func (d *Driver) Validate(do *storage.DriverOptions) error {
+	// XXX check this first to guard against nil pointers ahead of time.
+	if err := do.Validate(); err != nil {
+		return err
+	}
+
+	if do.Volume.Params["group"] == "" {
+		return errored.Errorf("Volume group is missing in lvm storage driver.")
+	}
+
+	if do.Volume.Params["pool"] == "" {
+		return errored.Errorf("Thin pool is missing in lvm storage driver.")
+	}
+
+	return nil
+}
@@ -0,0 +1,372 @@
+package lvm
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	. "testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/volplugin/storage"
+)
+
+const (
+	myMountpath = "/mnt/lvm"
+	testGroup   = "volplugin-test"
+	testPool    = "thinpool"
+	testImage   = "/tmp/volplugin-lvm-test.img"
+)
+
+var filesystems = map[string]storage.FSOptions{
+	"ext4": {
+		Type:          "ext4",
+		CreateCommand: "mkfs.ext4 -m0 %",
+	},
+}
+
+var volumeSpec = storage.Volume{
+	Name:   "test/pithos",
+	Size:   10,
+	Params: storage.Params{"group": testGroup, "pool": testPool},
+}
+
+type lvmSuite struct{}
+
+var _ = Suite(&lvmSuite{})
+
+func TestLVM(t *T) { TestingT(t) }
+
+func (s *lvmSuite) SetUpSuite(c *C) {
+	if os.Getenv("DEBUG") != "" {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+
+	// the volume group lives on a sparse loopback device, much like the ceph
+	// tests rely on the rbd pool.
+	script := `
+set -e
+truncate -s 1G ` + testImage + `
+dev=$(losetup -f --show ` + testImage + `)
+pvcreate -ff -y $dev
+vgcreate ` + testGroup + ` $dev
+lvcreate --type thin-pool -L 500M --name ` + testPool + ` ` + testGroup
+
+	out, err := exec.Command("sh", "-c", script).CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", out))
+}
+
+func (s *lvmSuite) TearDownSuite(c *C) {
+	script := `
+vgremove -f ` + testGroup + `
+for dev in $(losetup -j ` + testImage + ` | cut -d: -f1); do losetup -d $dev; done
+rm -f ` + testImage
+
+	out, err := exec.Command("sh", "-c", script).CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", out))
+}
+
+func (s *lvmSuite) readWriteTest(c *C, mountDir string) {
+	c.Assert(ioutil.WriteFile(filepath.Join(mountDir, "test.txt"), []byte("Test string\n"), 0644), IsNil)
+	content, err := ioutil.ReadFile(filepath.Join(mountDir, "test.txt"))
+	c.Assert(err, IsNil)
+	c.Assert(strings.TrimSpace(string(content)), Equals, "Test string")
+}
+
+func (s *lvmSuite) TestExternalInternalNames(c *C) {
+	driver := &Driver{}
+
+	intName, err := driver.internalName("policy/volume")
+	c.Assert(err, IsNil)
+	c.Assert(intName, Equals, "policy.volume")
+	c.Assert(driver.externalName(intName), Equals, "policy/volume")
+
+	for _, name := range []string{"policy", "pol.icy/volume", "policy/vol.ume", "policy/vol ume"} {
+		_, err := driver.internalName(name)
+		c.Assert(err, NotNil, Commentf("%s", name))
+	}
+
+	c.Assert(mksnap("policy.volume", "2016-01-02 15:04:05 +0000 UTC"), Equals, "policy.volume.2016-01-02-15-04-05-+0000-UTC")
+	c.Assert(devicePath("volplugin-test", "policy.volume"), Equals, "/dev/mapper/volplugin--test-policy.volume")
+}
+
+func (s *lvmSuite) TestParseLVs(c *C) {
+	out := `  policy.volume|thinpool|
+  policy.volume.snap|thinpool|policy.volume
+  thinpool||
+`
+	c.Assert(parseLVs(out), DeepEquals, []lvInfo{
+		{Name: "policy.volume", Pool: "thinpool"},
+		{Name: "policy.volume.snap", Pool: "thinpool", Origin: "policy.volume"},
+		{Name: "thinpool"},
+	})
+}
+
+func (s *lvmSuite) TestParseLVStats(c *C) {
+	stats, err := parseLVStats("  10485760|12.50\n")
+	c.Assert(err, IsNil)
+	c.Assert(stats, DeepEquals, &storage.VolumeStats{Provisioned: 10485760, Allocated: 1310720})
+
+	for _, out := range []string{"", "10485760", "ten|12.50", "10485760|lots"} {
+		_, err := parseLVStats(out)
+		c.Assert(err, NotNil, Commentf("%s", out))
+	}
+}
+
+func (s *lvmSuite) TestStats(c *C) {
+	crudDrv, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	statsDrv, err := NewStatsDriver()
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	defer crudDrv.Destroy(driverOpts)
+
+	c.Assert(crudDrv.Create(driverOpts), IsNil)
+	c.Assert(crudDrv.Format(driverOpts), IsNil)
+
+	stats, err := statsDrv.Stats(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(stats.Provisioned, Equals, uint64(10485760))
+	c.Assert(stats.Allocated > 0, Equals, true)
+	c.Assert(stats.Allocated <= stats.Provisioned, Equals, true)
+}
+
+func (s *lvmSuite) TestValidate(c *C) {
+	driver := &Driver{}
+
+	do := storage.DriverOptions{Volume: volumeSpec, FSOptions: filesystems["ext4"], Timeout: 5 * time.Second}
+	c.Assert(driver.Validate(&do), IsNil)
+
+	do.Volume.Params = storage.Params{"group": testGroup}
+	c.Assert(driver.Validate(&do), NotNil)
+	do.Volume.Params = storage.Params{"pool": testPool}
+	c.Assert(driver.Validate(&do), NotNil)
+}
+
+func (s *lvmSuite) TestCreateListDestroy(c *C) {
+	crudDrv, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	defer crudDrv.Destroy(driverOpts)
+
+	c.Assert(crudDrv.Create(driverOpts), IsNil)
+	c.Assert(crudDrv.Create(driverOpts), Equals, storage.ErrVolumeExist)
+
+	exists, err := crudDrv.Exists(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+
+	list, err := crudDrv.List(storage.ListOptions{Params: volumeSpec.Params})
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []storage.Volume{{Name: "test/pithos", Params: volumeSpec.Params}})
+
+	c.Assert(crudDrv.Destroy(driverOpts), IsNil)
+
+	exists, err = crudDrv.Exists(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *lvmSuite) TestMountUnmountVolume(c *C) {
+	crudDrv, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	mountDrv, err := NewMountDriver(myMountpath)
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	defer crudDrv.Destroy(driverOpts)
+	defer mountDrv.Unmount(driverOpts)
+
+	c.Assert(crudDrv.Create(driverOpts), IsNil)
+	c.Assert(crudDrv.Format(driverOpts), IsNil)
+
+	ms, err := mountDrv.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(ms.Volume, DeepEquals, driverOpts.Volume)
+	c.Assert(ms.Device, Equals, devicePath(testGroup, "test.pithos"))
+
+	mp, err := mountDrv.MountPath(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(mp, Equals, filepath.Join(myMountpath, testGroup, "test.pithos"))
+	s.readWriteTest(c, mp)
+
+	mounts, err := mountDrv.Mounted(5 * time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 1)
+	c.Assert(mounts[0].Volume.Name, Equals, volumeSpec.Name)
+	c.Assert(mounts[0].Path, Equals, mp)
+	c.Assert(mounts[0].DevMajor, Equals, ms.DevMajor)
+	c.Assert(mounts[0].DevMinor, Equals, ms.DevMinor)
+
+	c.Assert(mountDrv.Unmount(driverOpts), IsNil)
+
+	mounts, err = mountDrv.Mounted(5 * time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 0)
+
+	c.Assert(crudDrv.Destroy(driverOpts), IsNil)
+}
+
+func (s *lvmSuite) TestSnapshots(c *C) {
+	snapDrv, err := NewSnapshotDriver()
+	c.Assert(err, IsNil)
+	crudDrv, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	c.Assert(crudDrv.Create(driverOpts), IsNil)
+	defer crudDrv.Destroy(driverOpts)
+	c.Assert(snapDrv.CreateSnapshot("hello", driverOpts), IsNil)
+	c.Assert(snapDrv.CreateSnapshot("hello", driverOpts), NotNil)
+
+	list, err := snapDrv.ListSnapshots(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []string{"hello"})
+
+	// snapshots must not show up as volumes
+	vols, err := crudDrv.List(storage.ListOptions{Params: volumeSpec.Params})
+	c.Assert(err, IsNil)
+	c.Assert(len(vols), Equals, 1)
+
+	c.Assert(snapDrv.RemoveSnapshot("hello", driverOpts), IsNil)
+	c.Assert(snapDrv.RemoveSnapshot("hello", driverOpts), NotNil)
+
+	list, err = snapDrv.ListSnapshots(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(len(list), Equals, 0)
+
+	// destroy must take the snapshots along with the volume.
+	c.Assert(snapDrv.CreateSnapshot("hello", driverOpts), IsNil)
+	c.Assert(crudDrv.Destroy(driverOpts), IsNil)
+	lvs, err := (&Driver{}).listLVs(testGroup, 5*time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(len(lvs), Equals, 1) // just the pool
+}
+
+func (s *lvmSuite) TestSnapshotClone(c *C) {
+	snapDrv, err := NewSnapshotDriver()
+	c.Assert(err, IsNil)
+	crudDrv, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	mountDrv, err := NewMountDriver(myMountpath)
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	cloneOpts := storage.DriverOptions{
+		Volume:    storage.Volume{Name: "test/pithos-clone", Params: volumeSpec.Params},
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	c.Assert(crudDrv.Create(driverOpts), IsNil)
+	defer crudDrv.Destroy(driverOpts)
+	c.Assert(crudDrv.Format(driverOpts), IsNil)
+
+	_, err = mountDrv.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	mp, err := mountDrv.MountPath(driverOpts)
+	c.Assert(err, IsNil)
+	s.readWriteTest(c, mp)
+	c.Assert(mountDrv.Unmount(driverOpts), IsNil)
+
+	c.Assert(snapDrv.CreateSnapshot("snap", driverOpts), IsNil)
+	c.Assert(snapDrv.CopySnapshot(driverOpts, "snap", "test/pithos-clone"), IsNil)
+	defer crudDrv.Destroy(cloneOpts)
+	c.Assert(snapDrv.CopySnapshot(driverOpts, "snap", "test/pithos-clone"), NotNil)
+
+	_, err = mountDrv.Mount(cloneOpts)
+	c.Assert(err, IsNil)
+	mp, err = mountDrv.MountPath(cloneOpts)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadFile(filepath.Join(mp, "test.txt"))
+	c.Assert(err, IsNil)
+	c.Assert(strings.TrimSpace(string(content)), Equals, "Test string")
+	c.Assert(mountDrv.Unmount(cloneOpts), IsNil)
+
+	c.Assert(crudDrv.Destroy(cloneOpts), IsNil)
+	c.Assert(crudDrv.Destroy(driverOpts), IsNil)
+}
+
+func (s *lvmSuite) TestSnapshotRollback(c *C) {
+	snapDrv, err := NewSnapshotDriver()
+	c.Assert(err, IsNil)
+	crudDrv, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	mountDrv, err := NewMountDriver(myMountpath)
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	c.Assert(crudDrv.Create(driverOpts), IsNil)
+	defer crudDrv.Destroy(driverOpts)
+	c.Assert(crudDrv.Format(driverOpts), IsNil)
+
+	mp, err := mountDrv.MountPath(driverOpts)
+	c.Assert(err, IsNil)
+
+	_, err = mountDrv.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(mp, "test.txt"), []byte("before"), 0644), IsNil)
+	c.Assert(mountDrv.Unmount(driverOpts), IsNil)
+
+	c.Assert(snapDrv.CreateSnapshot("snap", driverOpts), IsNil)
+	// the name of the volume set aside during a rollback is reserved.
+	c.Assert(snapDrv.CreateSnapshot(rollbackSuffix, driverOpts), NotNil)
+
+	_, err = mountDrv.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(mp, "test.txt"), []byte("after"), 0644), IsNil)
+	c.Assert(mountDrv.Unmount(driverOpts), IsNil)
+
+	c.Assert(snapDrv.RollbackSnapshot("snap", driverOpts), IsNil)
+	c.Assert(snapDrv.RollbackSnapshot("missing", driverOpts), NotNil)
+
+	_, err = mountDrv.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadFile(filepath.Join(mp, "test.txt"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "before")
+	c.Assert(mountDrv.Unmount(driverOpts), IsNil)
+
+	// the snapshot must survive the rollback.
+	list, err := snapDrv.ListSnapshots(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []string{"snap"})
+
+	c.Assert(crudDrv.Destroy(driverOpts), IsNil)
+}
@@ -0,0 +1,16 @@
+package lvm
+
+import (
+	"path/filepath"
+
+	"github.com/contiv/volplugin/storage"
+)
+
+// MountPath returns the path of a mount for a group/volume.
+func (d *Driver) MountPath(do storage.DriverOptions) (string, error) {
+	volName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d.mountpath, do.Volume.Params["group"], volName), nil
+}
@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"time"
+
+	"github.com/contiv/volplugin/metrics"
+	"github.com/contiv/volplugin/storage"
+)
+
+var driverDuration = metrics.NewHistogramVec("volplugin_storage_operation_duration_seconds", "Time taken by storage driver operations.", nil, "backend", "operation")
+
+// The timed drivers wrap the drivers yielded by the New*Driver functions and
+// record how long each operation takes, by backend. Name and Validate are
+// cheap and are passed through untimed.
+
+type timedMountDriver struct {
+	storage.MountDriver
+}
+
+func (t timedMountDriver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
+	defer driverDuration.Since(time.Now(), t.Name(), "mount")
+	return t.MountDriver.Mount(do)
+}
+
+func (t timedMountDriver) Unmount(do storage.DriverOptions) error {
+	defer driverDuration.Since(time.Now(), t.Name(), "unmount")
+	return t.MountDriver.Unmount(do)
+}
+
+func (t timedMountDriver) Mounted(timeout time.Duration) ([]*storage.Mount, error) {
+	defer driverDuration.Since(time.Now(), t.Name(), "mounted")
+	return t.MountDriver.Mounted(timeout)
+}
+
+type timedCRUDDriver struct {
+	storage.CRUDDriver
+}
+
+func (t timedCRUDDriver) Create(do storage.DriverOptions) error {
+	defer driverDuration.Since(time.Now(), t.Name(), "create")
+	return t.CRUDDriver.Create(do)
+}
+
+func (t timedCRUDDriver) Format(do storage.DriverOptions) error {
+	defer driverDuration.Since(time.Now(), t.Name(), "format")
+	return t.CRUDDriver.Format(do)
+}
+
+func (t timedCRUDDriver) Destroy(do storage.DriverOptions) error {
+	defer driverDuration.Since(time.Now(), t.Name(), "destroy")
+	return t.CRUDDriver.Destroy(do)
+}
+
+func (t timedCRUDDriver) List(lo storage.ListOptions) ([]storage.Volume, error) {
+	defer driverDuration.Since(time.Now(), t.Name(), "list")
+	return t.CRUDDriver.List(lo)
+}
+
+func (t timedCRUDDriver) Exists(do storage.DriverOptions) (bool, error) {
+	defer driverDuration.Since(time.Now(), t.Name(), "exists")
+	return t.CRUDDriver.Exists(do)
+}
+
+type timedSnapshotDriver struct {
+	storage.SnapshotDriver
+}
+
+func (t timedSnapshotDriver) CreateSnapshot(snapName string, do storage.DriverOptions) error {
+	defer driverDuration.Since(time.Now(), t.Name(), "create_snapshot")
+	return t.SnapshotDriver.CreateSnapshot(snapName, do)
+}
+
+func (t timedSnapshotDriver) RemoveSnapshot(snapName string, do storage.DriverOptions) error {
+	defer driverDuration.Since(time.Now(), t.Name(), "remove_snapshot")
+	return t.SnapshotDriver.RemoveSnapshot(snapName, do)
+}
+
+func (t timedSnapshotDriver) ListSnapshots(do storage.DriverOptions) ([]string, error) {
+	defer driverDuration.Since(time.Now(), t.Name(), "list_snapshots")
+	return t.SnapshotDriver.ListSnapshots(do)
+}
+
+func (t timedSnapshotDriver) CopySnapshot(do storage.DriverOptions, snapName, newName string) error {
+	defer driverDuration.Since(time.Now(), t.Name(), "copy_snapshot")
+	return t.SnapshotDriver.CopySnapshot(do, snapName, newName)
+}
+
+func (t timedSnapshotDriver) RollbackSnapshot(snapName string, do storage.DriverOptions) error {
+	defer driverDuration.Since(time.Now(), t.Name(), "rollback_snapshot")
+	return t.SnapshotDriver.RollbackSnapshot(snapName, do)
+}
+
+type timedResizeDriver struct {
+	storage.ResizeDriver
+}
+
+func (t timedResizeDriver) Resize(do storage.DriverOptions) error {
+	defer driverDuration.Since(time.Now(), t.Name(), "resize")
+	return t.ResizeDriver.Resize(do)
+}
+
+type timedStatsDriver struct {
+	storage.StatsDriver
+}
+
+func (t timedStatsDriver) Stats(do storage.DriverOptions) (*storage.VolumeStats, error) {
+	defer driverDuration.Since(time.Now(), t.Name(), "stats")
+	return t.StatsDriver.Stats(do)
+}
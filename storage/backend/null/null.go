@@ -85,6 +85,11 @@ func (d *Driver) CopySnapshot(storage.DriverOptions, string, string) error {
 	return nil
 }
 
+// RollbackSnapshot rolls back nothing.
+func (d *Driver) RollbackSnapshot(string, storage.DriverOptions) error {
+	return nil
+}
+
 // Validate validates storaage.DriverOptions
 func (d *Driver) Validate(storage.DriverOptions) error {
 	return nil
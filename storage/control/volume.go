@@ -1,6 +1,7 @@
 package control
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -129,3 +130,37 @@ func RemoveVolume(config *config.Volume, timeout time.Duration) error {
 
 	return driver.Destroy(driverOpts)
 }
+
+// ResizeVolume resizes a volume to the size (in MB) provided. force lets
+// the driver shrink it, if it can.
+func ResizeVolume(config *config.Volume, size uint64, force bool, timeout time.Duration) error {
+	if config.Backends.CRUD == "" {
+		return errors.ResizeUnsupported.Combine(errored.Errorf("volume %q has no CRUD backend", config))
+	}
+
+	if _, ok := backend.ResizeDrivers[config.Backends.CRUD]; !ok {
+		return errors.ResizeUnsupported.Combine(errored.New(config.Backends.CRUD))
+	}
+
+	driver, err := backend.NewResizeDriver(config.Backends.CRUD)
+	if err != nil {
+		return err
+	}
+
+	driverOpts := storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   config.String(),
+			Size:   size,
+			Params: config.DriverOptions,
+		},
+		FSOptions: storage.FSOptions{
+			Type: config.CreateOptions.FileSystem,
+		},
+		Timeout: timeout,
+		Options: map[string]string{"force": strconv.FormatBool(force)},
+	}
+
+	logrus.Infof("Resizing volume %v to size %d", config, size)
+
+	return driver.Resize(driverOpts)
+}
@@ -52,6 +52,14 @@ type Volume struct {
 	Params Params
 }
 
+// VolumeStats describes how much of a volume is in use. Sizes are in bytes.
+type VolumeStats struct {
+	// Provisioned is the size the volume was created with.
+	Provisioned uint64 `json:"provisioned"`
+	// Allocated is the space actually consumed by the volume.
+	Allocated uint64 `json:"allocated"`
+}
+
 // NamedDriver is a named driver and has a method called Name()
 type NamedDriver interface {
 	// Name returns the string associated with the storage backed of the driver
@@ -121,6 +129,34 @@ type SnapshotDriver interface {
 	// CopySnapshot copies a snapshot into a new volume. Takes a DriverOptions,
 	// snap and volume name (string). Returns error on failure.
 	CopySnapshot(DriverOptions, string, string) error
+
+	// RollbackSnapshot restores the volume in place to the contents of the
+	// named snapshot. The volume must not be mounted. Any error will be returned.
+	RollbackSnapshot(string, DriverOptions) error
+}
+
+// ResizeDriver resizes volumes.
+type ResizeDriver interface {
+	NamedDriver
+	ValidatingDriver
+
+	// Resize changes the size of the volume to the size in the DriverOptions.
+	// If the volume is mounted on this host, its filesystem is grown to match.
+	// A smaller size is only asked for when the resize is forced, with
+	// Options["force"] set to "true", and the volume unmounted everywhere.
+	// Drivers which cannot shrink the filesystem and then the volume return
+	// errors.ResizeShrink.
+	Resize(DriverOptions) error
+}
+
+// StatsDriver reports volume usage.
+type StatsDriver interface {
+	NamedDriver
+	ValidatingDriver
+
+	// Stats returns the provisioned and allocated size of the volume as seen
+	// by the storage backend. Any error will be returned.
+	Stats(DriverOptions) (*VolumeStats, error)
 }
 
 // Validate validates driver options to ensure they are compatible with all
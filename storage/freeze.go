@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"os/exec"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/executor"
+)
+
+// FreezeFilesystem freezes the filesystem mounted at path with fsfreeze(8),
+// so it is consistent on disk: writes to it block until it is thawed.
+func FreezeFilesystem(path string, timeout time.Duration) error {
+	return fsfreeze("--freeze", path, timeout)
+}
+
+// ThawFilesystem thaws a filesystem frozen by FreezeFilesystem.
+func ThawFilesystem(path string, timeout time.Duration) error {
+	return fsfreeze("--unfreeze", path, timeout)
+}
+
+func fsfreeze(flag, path string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	er, err := executor.NewCapture(exec.Command("fsfreeze", flag, path)).Run(ctx)
+	if err != nil || er.ExitStatus != 0 {
+		return errored.Errorf("Could not run fsfreeze %s on %q: %v (%v)", flag, path, er, err)
+	}
+
+	return nil
+}
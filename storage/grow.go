@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"fmt"
+	"os/exec"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/executor"
+	"github.com/contiv/volplugin/errors"
+)
+
+// GrowFilesystem grows the filesystem of type fstype on device, mounted at
+// path, online to the size of the device. This is a no-op if they are already
+// the same size.
+func GrowFilesystem(fstype, device, path string, timeout time.Duration) error {
+	var cmd *exec.Cmd
+
+	switch fstype {
+	case "ext2", "ext3", "ext4":
+		cmd = exec.Command("resize2fs", device)
+	case "xfs":
+		cmd = exec.Command("xfs_growfs", path)
+	default:
+		return errored.Errorf("Cannot grow filesystem of type %q on %s", fstype, device)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	er, err := executor.NewCapture(cmd).Run(ctx)
+	if err != nil || er.ExitStatus != 0 {
+		return errored.Errorf("Error growing filesystem on %s: %v (%v)", device, er, err)
+	}
+
+	return nil
+}
+
+// ShrinkFilesystem shrinks the filesystem of type fstype on device, which
+// must not be mounted, to size megabytes, so the device can be shrunk to that
+// size afterwards. Only ext filesystems can be shrunk; errors.ResizeShrink is
+// returned for the others, such as xfs.
+func ShrinkFilesystem(fstype, device string, size uint64, timeout time.Duration) error {
+	switch fstype {
+	case "ext2", "ext3", "ext4":
+	default:
+		return errors.ResizeShrink.Combine(errored.Errorf("Cannot shrink filesystem of type %q on %s", fstype, device))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// resize2fs refuses to shrink filesystems which were not checked since
+	// they were last mounted. e2fsck exits with 1 when it fixed errors.
+	er, err := executor.NewCapture(exec.Command("e2fsck", "-f", "-y", device)).Run(ctx)
+	if err != nil || er.ExitStatus > 1 {
+		return errored.Errorf("Error checking filesystem on %s: %v (%v)", device, er, err)
+	}
+
+	er, err = executor.NewCapture(exec.Command("resize2fs", device, fmt.Sprintf("%dM", size))).Run(ctx)
+	if err != nil || er.ExitStatus != 0 {
+		return errored.Errorf("Error shrinking filesystem on %s: %v (%v)", device, er, err)
+	}
+
+	return nil
+}
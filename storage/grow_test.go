@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+)
+
+func (s *storageSuite) TestShrinkFilesystem(c *C) {
+	f, err := ioutil.TempFile("", "shrink")
+	c.Assert(err, IsNil)
+	defer os.Remove(f.Name())
+	c.Assert(f.Truncate(20*1024*1024), IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	c.Assert(exec.Command("mkfs.ext4", "-q", "-F", "-m0", f.Name()).Run(), IsNil)
+	c.Assert(ShrinkFilesystem("ext4", f.Name(), 12, time.Minute), IsNil)
+
+	out, err := exec.Command("dumpe2fs", "-h", f.Name()).Output()
+	c.Assert(err, IsNil)
+	blocks, err := strconv.ParseUint(regexp.MustCompile(`Block count:\s+(\d+)`).FindStringSubmatch(string(out))[1], 10, 64)
+	c.Assert(err, IsNil)
+	blockSize, err := strconv.ParseUint(regexp.MustCompile(`Block size:\s+(\d+)`).FindStringSubmatch(string(out))[1], 10, 64)
+	c.Assert(err, IsNil)
+	c.Assert(blocks*blockSize, Equals, uint64(12*1024*1024))
+
+	err = ShrinkFilesystem("xfs", f.Name(), 10, time.Minute)
+	c.Assert(err, NotNil)
+	c.Assert(err.(*errored.Error).Contains(errors.ResizeShrink), Equals, true)
+}
@@ -11,10 +11,10 @@ import (
 )
 
 const (
-	mountInfoFile           = "/proc/self/mountinfo"
-	deviceInfoFile          = "/proc/devices"
-	nfsMajorID              = 0
-	totalMountInfoFieldsNum = 10
+	mountInfoFile         = "/proc/self/mountinfo"
+	deviceInfoFile        = "/proc/devices"
+	nfsMajorID            = 0
+	minMountInfoFieldsNum = 9
 )
 
 // GetMountsRequest captures all the params required for scanning mountinfo
@@ -52,7 +52,13 @@ func getDevID(kernelDriver string) (uint, error) {
 		return 0, err
 	}
 
-	lines := strings.Split(string(content), "\n")
+	return parseDevID(string(content), kernelDriver)
+}
+
+// parseDevID finds the kernel driver in the block devices section of
+// /proc/devices. Major numbers are right-aligned, e.g. "  7 loop".
+func parseDevID(content, kernelDriver string) (uint, error) {
+	lines := strings.Split(content, "\n")
 	blockDevs := false
 	for _, line := range lines {
 		if !blockDevs {
@@ -60,12 +66,16 @@ func getDevID(kernelDriver string) (uint, error) {
 			continue
 		}
 
-		if strings.HasSuffix(line, kernelDriver) {
-			parts := strings.Split(line, " ")
-			if len(parts) != 2 {
-				return 0, errored.Errorf("Invalid input from file %q", deviceInfoFile)
-			}
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
 
+		if len(parts) != 2 {
+			return 0, errored.Errorf("Invalid input from file %q", deviceInfoFile)
+		}
+
+		if parts[1] == kernelDriver {
 			majorID, err := convertToUint(parts[0])
 			if err != nil {
 				return 0, errored.Errorf("Invalid deviceID %q from device info file for kernel driver %q", parts, kernelDriver).Combine(err)
@@ -80,14 +90,24 @@ func getDevID(kernelDriver string) (uint, error) {
 func convertToMountInfo(mountinfo string) (*MountInfo, error) {
 	parts := strings.Split(mountinfo, " ")
 
+	// there are zero or more optional fields, terminated by a single hyphen.
+	sep := 6
+	for sep < len(parts) && parts[sep] != "-" {
+		sep++
+	}
+
+	if sep+2 >= len(parts) {
+		return nil, errored.Errorf("Invalid mount info %q", mountinfo)
+	}
+
 	mountDetails := &MountInfo{
 		Root:           parts[3],
 		MountPoint:     parts[4],
 		MountOptions:   parts[5],
-		OptionalFields: parts[6],
-		Separator:      parts[7],
-		FilesystemType: parts[8],
-		MountSource:    parts[9],
+		OptionalFields: strings.Join(parts[6:sep], " "),
+		Separator:      parts[sep],
+		FilesystemType: parts[sep+1],
+		MountSource:    parts[sep+2],
 	}
 
 	mountID, err := convertToUint(parts[0])
@@ -172,7 +192,7 @@ func GetMounts(request *GetMountsRequest) ([]*MountInfo, error) {
 	lines := strings.Split(string(content), "\n")
 	for _, line := range lines {
 		if !isEmpty(line) {
-			if len(strings.Split(line, " ")) < totalMountInfoFieldsNum {
+			if len(strings.Split(line, " ")) < minMountInfoFieldsNum {
 				logrus.Debugf("Insufficient mount info data: %q", line)
 				continue
 			}
@@ -66,3 +66,56 @@ func (s *mountscanSuite) TestGetMountsInput(c *C) {
 	_, err = GetMounts(&GetMountsRequest{DriverName: "ceph"})
 	c.Assert(err, ErrorMatches, ".*Kernel driver is required.*")
 }
+
+func (s *mountscanSuite) TestParseDevID(c *C) {
+	content := `Character devices:
+  1 mem
+  4 tty
+
+Block devices:
+  7 loop
+  8 sd
+252 rbd
+253 device-mapper
+`
+
+	major, err := parseDevID(content, "loop")
+	c.Assert(err, IsNil)
+	c.Assert(major, Equals, uint(7))
+
+	major, err = parseDevID(content, "device-mapper")
+	c.Assert(err, IsNil)
+	c.Assert(major, Equals, uint(253))
+
+	// drivers must match exactly, not by suffix.
+	_, err = parseDevID(content, "mapper")
+	c.Assert(err, ErrorMatches, ".*Invalid kernel driver.*")
+
+	_, err = parseDevID(content, "mem")
+	c.Assert(err, ErrorMatches, ".*Invalid kernel driver.*")
+}
+
+func (s *mountscanSuite) TestConvertToMountInfo(c *C) {
+	mount, err := convertToMountInfo("36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue")
+	c.Assert(err, IsNil)
+	c.Assert(mount.MountPoint, Equals, "/mnt2")
+	c.Assert(mount.OptionalFields, Equals, "master:1")
+	c.Assert(mount.FilesystemType, Equals, "ext3")
+	c.Assert(mount.MountSource, Equals, "/dev/root")
+	c.Assert(*mount.DeviceNumber, DeepEquals, DeviceNumber{Major: 98, Minor: 0})
+
+	// optional fields may be missing or repeated.
+	mount, err = convertToMountInfo("43 28 7:0 / /mnt/loopback/test/pithos rw,relatime - ext4 /dev/loop0 rw")
+	c.Assert(err, IsNil)
+	c.Assert(mount.OptionalFields, Equals, "")
+	c.Assert(mount.FilesystemType, Equals, "ext4")
+	c.Assert(mount.MountSource, Equals, "/dev/loop0")
+
+	mount, err = convertToMountInfo("43 28 7:0 / /mnt rw shared:2 master:1 - ext4 /dev/loop0 rw")
+	c.Assert(err, IsNil)
+	c.Assert(mount.OptionalFields, Equals, "shared:2 master:1")
+	c.Assert(mount.MountSource, Equals, "/dev/loop0")
+
+	_, err = convertToMountInfo("43 28 7:0 / /mnt rw shared:2 master:1")
+	c.Assert(err, NotNil)
+}
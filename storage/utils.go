@@ -1,8 +1,11 @@
 package storage
 
 import (
+	"fmt"
 	"strings"
 
+	"golang.org/x/sys/unix"
+
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/errors"
 )
@@ -20,3 +23,57 @@ func SplitName(name string) (string, string, error) {
 
 	return parts[0], parts[1], nil
 }
+
+// TemplateFSCmd replaces each single % in the filesystem command with the
+// device path. %% is left as-is.
+func TemplateFSCmd(fscmd, devicePath string) string {
+	for idx := 0; idx < len(fscmd); idx++ {
+		if fscmd[idx] == '%' {
+			if idx < len(fscmd)-1 && fscmd[idx+1] == '%' {
+				idx++
+				continue
+			}
+			var lhs, rhs string
+
+			switch {
+			case idx == 0:
+				lhs = ""
+				rhs = fscmd[1:]
+			case idx == len(fscmd)-1:
+				lhs = fscmd[:idx]
+				rhs = ""
+			default:
+				lhs = fscmd[:idx]
+				rhs = fscmd[idx+1:]
+			}
+
+			fscmd = fmt.Sprintf("%s%s%s", lhs, devicePath, rhs)
+		}
+	}
+
+	return fscmd
+}
+
+// FilesystemStats returns the usage of the filesystem mounted at path, as
+// reported by statfs(2).
+func FilesystemStats(path string) (*VolumeStats, error) {
+	var stat unix.Statfs_t
+
+	if err := unix.Statfs(path, &stat); err != nil {
+		return nil, errored.Errorf("Could not stat filesystem at %q", path).Combine(err)
+	}
+
+	return &VolumeStats{
+		Provisioned: stat.Blocks * uint64(stat.Bsize),
+		Allocated:   (stat.Blocks - stat.Bfree) * uint64(stat.Bsize),
+	}, nil
+}
+
+// SplitDev splits a Linux device number, such as the Rdev of a device node,
+// into its major and minor numbers, the way glibc's gnu_dev_major and
+// gnu_dev_minor do.
+func SplitDev(rdev uint64) (uint, uint) {
+	major := (rdev>>8)&0x00000fff | (rdev>>32)&0xfffff000
+	minor := rdev&0x000000ff | (rdev>>12)&0xffffff00
+	return uint(major), uint(minor)
+}
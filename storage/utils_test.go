@@ -36,3 +36,39 @@ func (s *storageSuite) TestSplitName(c *C) {
 		c.Assert(volume, Equals, results[1])
 	}
 }
+
+func (s *storageSuite) TestTemplateFSCmd(c *C) {
+	c.Assert(TemplateFSCmd("%", "foo"), Equals, "foo")
+	c.Assert(TemplateFSCmd("%%", "foo"), Equals, "%%")
+	c.Assert(TemplateFSCmd("%%%", "foo"), Equals, "%%foo")
+	c.Assert(TemplateFSCmd("% test % test %", "foo"), Equals, "foo test foo test foo")
+	c.Assert(TemplateFSCmd("% %% %", "foo"), Equals, "foo %% foo")
+	c.Assert(TemplateFSCmd("mkfs.ext4 -m0 %", "/dev/sda1"), Equals, "mkfs.ext4 -m0 /dev/sda1")
+}
+
+func (s *storageSuite) TestSplitDev(c *C) {
+	for _, dev := range []struct {
+		rdev         uint64
+		major, minor uint
+	}{
+		{0x801, 8, 1},             // sda1
+		{0x700, 7, 0},             // loop0
+		{0x100700, 7, 256},        // loop256
+		{0x10fd2c, 253, 300},      // a dm thin volume
+		{0x100000000100, 4097, 0}, // a major above 4095
+	} {
+		major, minor := SplitDev(dev.rdev)
+		c.Assert(major, Equals, dev.major, Commentf("%#x", dev.rdev))
+		c.Assert(minor, Equals, dev.minor, Commentf("%#x", dev.rdev))
+	}
+}
+
+func (s *storageSuite) TestFilesystemStats(c *C) {
+	stats, err := FilesystemStats("/")
+	c.Assert(err, IsNil)
+	c.Assert(stats.Provisioned > 0, Equals, true)
+	c.Assert(stats.Allocated <= stats.Provisioned, Equals, true)
+
+	_, err = FilesystemStats("/nonexistent-path")
+	c.Assert(err, NotNil)
+}
@@ -3,8 +3,12 @@ package systemtests
 import (
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"strings"
+	"time"
 
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/apiserver/client"
 	"github.com/contiv/volplugin/config"
 	. "gopkg.in/check.v1"
 )
@@ -40,10 +44,7 @@ func (s *systemtestSuite) TestAPIServerGlobalConfigUpdate(c *C) {
 
 	c.Assert(s.uploadGlobal("global1"), IsNil)
 
-	out, err := s.volcli("global get")
-	c.Assert(err, IsNil)
-
-	global, err := config.NewGlobalConfigFromJSON([]byte(out))
+	global, err := s.apiClient().GetGlobal()
 	c.Assert(err, IsNil)
 
 	c.Assert(globalBase1, DeepEquals, global)
@@ -51,16 +52,76 @@ func (s *systemtestSuite) TestAPIServerGlobalConfigUpdate(c *C) {
 
 	c.Assert(s.uploadGlobal("global2"), IsNil)
 
-	out, err = s.volcli("global get")
-	c.Assert(err, IsNil)
-
-	global, err = config.NewGlobalConfigFromJSON([]byte(out))
+	global, err = s.apiClient().GetGlobal()
 	c.Assert(err, IsNil)
 
 	c.Assert(globalBase1, Not(DeepEquals), global)
 	c.Assert(globalBase2, DeepEquals, global)
 }
 
+func (s *systemtestSuite) TestAPIServerClient(c *C) {
+	apiClient := s.apiClient()
+
+	volume := genRandomVolume()
+	c.Assert(s.createVolume("mon0", fqVolume("policy1", volume), nil), IsNil)
+
+	volumes, err := apiClient.ListVolumes("policy1", "")
+	c.Assert(err, IsNil)
+	c.Assert(len(volumes), Equals, 1)
+	c.Assert(volumes[0].VolumeName, Equals, volume)
+
+	runtime, err := apiClient.GetRuntime("policy1", volume)
+	c.Assert(err, IsNil)
+	c.Assert(runtime, DeepEquals, &volumes[0].RuntimeOptions)
+
+	c.Assert(apiClient.RemoveVolume("policy1", volume, 0, false), IsNil)
+
+	_, err = apiClient.GetVolume("policy1", volume)
+	c.Assert(err, NotNil)
+
+	herr, ok := err.(*api.HTTPError)
+	c.Assert(ok, Equals, true, Commentf("%v", err))
+	c.Assert(herr.Code, Equals, api.CodeNotExists)
+	c.Assert(herr.Status, Equals, http.StatusNotFound)
+
+	_, err = apiClient.GetPolicy("nonexistent")
+	c.Assert(err.(*api.HTTPError).Code, Equals, api.CodeNotExists)
+}
+
+func (s *systemtestSuite) TestAPIServerEvents(c *C) {
+	volume := genRandomVolume()
+	events := make(chan *config.Event)
+	errs := make(chan error, 1)
+
+	go func() {
+		opts := &client.EventOptions{Types: []string{config.EventVolume}, Volume: fqVolume("policy1", volume)}
+		errs <- s.apiClient().Events(opts, func(event *config.Event) bool {
+			events <- event
+			return event.Action != "delete"
+		})
+	}()
+
+	// give the stream time to start.
+	time.Sleep(time.Second)
+
+	c.Assert(s.createVolume("mon0", fqVolume("policy1", volume), nil), IsNil)
+	c.Assert(s.apiClient().RemoveVolume("policy1", volume, 0, false), IsNil)
+
+	for _, action := range []string{"create", "delete"} {
+		select {
+		case event := <-events:
+			c.Assert(event.Action, Equals, action)
+			c.Assert(event.Volume, Equals, fqVolume("policy1", volume))
+		case err := <-errs:
+			c.Fatal(err)
+		case <-time.After(30 * time.Second):
+			c.Fatalf("timed out waiting for the %s event of %s", action, volume)
+		}
+	}
+
+	c.Assert(<-errs, IsNil)
+}
+
 func (s *systemtestSuite) TestAPIServerMultiRemove(c *C) {
 	if !cephDriver() {
 		c.Skip("Only ceph driver supports CRUD operations")
@@ -57,13 +57,14 @@ func (s *systemtestSuite) SetUpSuite(c *C) {
 	s.vagrant = remotessh.Vagrant{}
 	c.Assert(s.vagrant.Setup(false, []string{}, 3), IsNil)
 
+	ip, err := s.mon0cmd(`ip addr show dev enp0s8 | grep inet | head -1 | awk "{ print \$2 }" | awk -F/ "{ print \$1 }"`)
+	logrus.Infof("mon0's ip is %s", strings.TrimSpace(ip))
+	c.Assert(err, IsNil)
+	s.mon0ip = strings.TrimSpace(ip)
+
 	if nfsDriver() {
 		logrus.Info("NFS Driver detected: configuring exports.")
 		c.Assert(s.createExports(), IsNil)
-		ip, err := s.mon0cmd(`ip addr show dev enp0s8 | grep inet | head -1 | awk "{ print \$2 }" | awk -F/ "{ print \$1 }"`)
-		logrus.Infof("mon0's ip is %s", strings.TrimSpace(ip))
-		c.Assert(err, IsNil)
-		s.mon0ip = strings.TrimSpace(ip)
 	}
 
 	c.Assert(s.clearContainers(), IsNil)
@@ -1,7 +1,6 @@
 package systemtests
 
 import (
-	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
@@ -10,7 +9,6 @@ import (
 	. "gopkg.in/check.v1"
 
 	"github.com/Sirupsen/logrus"
-	"github.com/contiv/volplugin/config"
 )
 
 func (s *systemtestSuite) TestIntegratedUseMountLock(c *C) {
@@ -60,15 +58,14 @@ func (s *systemtestSuite) TestIntegratedMultiPool(c *C) {
 	_, err = s.uploadIntent("testpool", "testpool")
 	c.Assert(err, IsNil)
 
-	volName := fqVolume("testpool", genRandomVolume())
+	volume := genRandomVolume()
+	volName := fqVolume("testpool", volume)
 
 	c.Assert(s.createVolume("mon0", volName, nil), IsNil)
 
-	out, err := s.volcli("volume get " + volName)
+	vc, err := s.apiClient().GetVolume("testpool", volume)
 	c.Assert(err, IsNil)
 
-	vc := &config.Volume{}
-	c.Assert(json.Unmarshal([]byte(out), vc), IsNil)
 	actualSize, err := vc.CreateOptions.ActualSize()
 	c.Assert(err, IsNil)
 	c.Assert(actualSize, Equals, uint64(10))
@@ -80,7 +77,8 @@ func (s *systemtestSuite) TestIntegratedDriverOptions(c *C) {
 		return
 	}
 
-	volName := fqVolume("policy1", genRandomVolume())
+	volume := genRandomVolume()
+	volName := fqVolume("policy1", volume)
 
 	opts := map[string]string{
 		"size":                "200MB",
@@ -93,12 +91,9 @@ func (s *systemtestSuite) TestIntegratedDriverOptions(c *C) {
 
 	defer s.purgeVolume("mon0", volName)
 
-	out, err := s.volcli("volume get " + volName)
+	vc, err := s.apiClient().GetVolume("policy1", volume)
 	c.Assert(err, IsNil)
 
-	vc := &config.Volume{}
-	c.Assert(json.Unmarshal([]byte(out), vc), IsNil)
-
 	actualSize, err := vc.CreateOptions.ActualSize()
 	c.Assert(err, IsNil)
 	c.Assert(actualSize, Equals, uint64(200))
@@ -13,6 +13,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
 	"github.com/contiv/remotessh"
+	"github.com/contiv/volplugin/apiserver/client"
 	"github.com/contiv/volplugin/config"
 )
 
@@ -160,6 +161,11 @@ func (s *systemtestSuite) volcli(command string) (string, error) {
 	return s.mon0cmd("volcli " + command)
 }
 
+// apiClient returns a client of the apiserver on mon0.
+func (s *systemtestSuite) apiClient() *client.Client {
+	return client.New(s.mon0ip+":9005", time.Minute)
+}
+
 func (s *systemtestSuite) readIntent(fn string) (*config.Policy, error) {
 	content, err := ioutil.ReadFile(fn)
 	if err != nil {
@@ -236,8 +242,8 @@ func (s *systemtestSuite) createVolume(host, volume string, opts map[string]stri
 		return err
 	}
 
-	if out, err := s.volcli(fmt.Sprintf("volume get %s/%s", policy, name)); err != nil {
-		logrus.Error(out)
+	if _, err := s.apiClient().GetVolume(policy, name); err != nil {
+		logrus.Error(err)
 		return err
 	}
 
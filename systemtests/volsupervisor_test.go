@@ -1,10 +1,13 @@
 package systemtests
 
 import (
+	"encoding/json"
 	"strings"
 	"time"
 
 	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/config"
 )
 
 func (s *systemtestSuite) TestVolsupervisorSnapLockedVolume(c *C) {
@@ -159,8 +162,28 @@ func (s *systemtestSuite) TestVolsupervisorSignal(c *C) {
 	c.Assert(len(strings.TrimSpace(out)), Not(Equals), 0, Commentf(out))
 }
 
-func (s *systemtestSuite) TestVolsupervisorStartLock(c *C) {
-	// this fails because it's already running on mon0 because of the rebootstrap call.
-	c.Assert(s.vagrant.GetNode("mon1").RunCommand("sudo volsupervisor"), NotNil)
-	defer s.vagrant.GetNode("mon1").RunCommand("docker kill volsupervisor")
+func (s *systemtestSuite) TestVolsupervisorStandby(c *C) {
+	// the volsupervisor on mon0, started by the rebootstrap call, leads; the one
+	// on mon1 stands by.
+	c.Assert(startVolsupervisor(s.vagrant.GetNode("mon1")), IsNil)
+	defer stopVolsupervisor(s.vagrant.GetNode("mon1"))
+
+	time.Sleep(5 * time.Second)
+
+	leader := &config.UseVolsupervisor{}
+	out, err := s.volcli("use volsupervisor")
+	c.Assert(err, IsNil, Commentf("output: %s", out))
+	c.Assert(json.Unmarshal([]byte(out), leader), IsNil)
+	c.Assert(leader.Hostname, Equals, "mon0")
+
+	// stopping the leader hands the lock off right away.
+	c.Assert(stopVolsupervisor(s.vagrant.GetNode("mon0")), IsNil)
+	defer startVolsupervisor(s.vagrant.GetNode("mon0"))
+
+	time.Sleep(5 * time.Second)
+
+	out, err = s.volcli("use volsupervisor")
+	c.Assert(err, IsNil, Commentf("output: %s", out))
+	c.Assert(json.Unmarshal([]byte(out), leader), IsNil)
+	c.Assert(leader.Hostname, Equals, "mon1")
 }
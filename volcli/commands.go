@@ -1,6 +1,9 @@
 package volcli
 
-import "github.com/codegangsta/cli"
+import (
+	"github.com/codegangsta/cli"
+	"github.com/contiv/volplugin/apiserver/client"
+)
 
 // GlobalFlags are required global flags for the operation of volcli.
 var GlobalFlags = []cli.Flag{
@@ -14,11 +17,50 @@ var GlobalFlags = []cli.Flag{
 		Usage: "URL for etcd",
 		Value: &cli.StringSlice{"http://localhost:2379"},
 	},
+	cli.StringFlag{
+		Name:   "store",
+		Usage:  "URL of the data store, e.g. consul://localhost:8500; overrides --etcd",
+		EnvVar: "STORE",
+	},
 	cli.StringFlag{
 		Name:  "apiserver",
 		Usage: "address of apiserver process",
 		Value: "127.0.0.1:9005",
 	},
+	cli.DurationFlag{
+		Name:  "apiserver-timeout",
+		Usage: "timeout of requests to the apiserver",
+		Value: client.DefaultTimeout,
+	},
+	cli.StringFlag{
+		Name:   "apiserver-token",
+		Usage:  "bearer token to authenticate to the apiserver with",
+		EnvVar: "APISERVER_TOKEN",
+	},
+	cli.BoolFlag{
+		Name:  "apiserver-tls",
+		Usage: "talk HTTPS to the apiserver; implied by the other --apiserver-tls flags",
+	},
+	cli.StringFlag{
+		Name:   "apiserver-tls-ca",
+		Usage:  "PEM file of the CAs to verify the apiserver's certificate with, instead of the system's",
+		EnvVar: "APISERVER_TLS_CA",
+	},
+	cli.StringFlag{
+		Name:   "apiserver-tls-cert",
+		Usage:  "PEM file of the client certificate to present to the apiserver",
+		EnvVar: "APISERVER_TLS_CERT",
+	},
+	cli.StringFlag{
+		Name:   "apiserver-tls-key",
+		Usage:  "PEM file of the key of the client certificate",
+		EnvVar: "APISERVER_TLS_KEY",
+	},
+}
+
+var selectorFlag = cli.StringFlag{
+	Name:  "selector, l",
+	Usage: "only list the volumes whose labels match, e.g. team=storage,env!=prod",
 }
 
 // Commands is the data structure which describes the command hierarchy
@@ -95,6 +137,20 @@ var Commands = []cli.Command{
 						Usage:       "List all revisions of a policy",
 						Action:      PolicyListRevisions,
 					},
+					{
+						Name:        "diff",
+						ArgsUsage:   "[policy name] [revision] [revision (optional)]",
+						Description: "Show the differences between two revisions of a policy, or between a revision and the current policy",
+						Usage:       "Compare revisions of a policy",
+						Action:      PolicyDiffRevisions,
+					},
+					{
+						Name:        "rollback",
+						ArgsUsage:   "[policy name] [revision]",
+						Description: "Publish a revision of a policy as the current policy, recording it as a new revision",
+						Usage:       "Roll a policy back to a revision",
+						Action:      PolicyRollback,
+					},
 				},
 			},
 			{
@@ -122,10 +178,16 @@ var Commands = []cli.Command{
 				Action:      VolumeCreate,
 			},
 			{
-				Name:        "get",
+				Name: "get",
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "stats, s",
+						Usage: "Show the usage of the volume instead of its configuration",
+					},
+				},
 				ArgsUsage:   "[policy name]/[volume name]",
 				Usage:       "Get JSON configuration for a volume",
-				Description: "Obtain the JSON configuration for the volume",
+				Description: "Obtain the JSON configuration for the volume. With --stats, shows the provisioned and allocated bytes reported by the storage backend and, if the volume is mounted, the filesystem usage reported by the volplugin that mounted it.",
 				Action:      VolumeGet,
 			},
 			{
@@ -133,6 +195,7 @@ var Commands = []cli.Command{
 				ArgsUsage:   "[policy name]",
 				Description: "Given a policy name, produces a newline-delimited list of volumes.",
 				Usage:       "List all volumes for a given policy",
+				Flags:       []cli.Flag{selectorFlag},
 				Action:      VolumeList,
 			},
 			{
@@ -140,6 +203,7 @@ var Commands = []cli.Command{
 				ArgsUsage:   "",
 				Description: "Produces a newline-delimited list of policy/volume combinations.",
 				Usage:       "List all volumes across policies",
+				Flags:       []cli.Flag{selectorFlag},
 				Action:      VolumeListAll,
 			},
 			{
@@ -166,6 +230,19 @@ var Commands = []cli.Command{
 				Usage:       "Remove a volume and its contents",
 				Action:      VolumeRemove,
 			},
+			{
+				Name: "resize",
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "force, f",
+						Usage: "Allow the volume to shrink. The volume must not be mounted",
+					},
+				},
+				ArgsUsage:   "[policy name]/[volume name] [size]",
+				Description: "Resize the volume to the size given, e.g. 20GB. Filesystems of mounted volumes are grown online by the volplugin mounting them. Shrinking a volume is refused unless forced; it requires the volume to be unmounted, and only ceph volumes with ext filesystems can be shrunk.",
+				Usage:       "Resize a volume",
+				Action:      VolumeResize,
+			},
 			{
 				Name:        "snapshot",
 				Description: "Snapshot management tools",
@@ -192,6 +269,33 @@ var Commands = []cli.Command{
 						Usage:       "Copy a volume snapshot to a new volume",
 						Action:      VolumeSnapshotCopy,
 					},
+					{
+						Name:        "rollback",
+						ArgsUsage:   "[policy name]/[volume name] [snapshot name]",
+						Description: "Restores the volume in place to the contents of the given snapshot. The volume must not be mounted; the snapshot itself is kept.",
+						Usage:       "Roll a volume back to a snapshot",
+						Action:      VolumeSnapshotRollback,
+					},
+					{
+						Name:        "prune",
+						ArgsUsage:   "[policy name]/[volume name]",
+						Description: "Removes the snapshots the retention rules of the volume do not keep, as volsupervisor does after each scheduled snapshot. Prints each snapshot, newest first, with whether it is kept and the rules keeping or removing it.",
+						Usage:       "Prune the snapshots of a volume now",
+						Action:      VolumeSnapshotPrune,
+						Flags: []cli.Flag{
+							cli.BoolFlag{
+								Name:  "dry-run, n",
+								Usage: "Only show what would be removed",
+							},
+						},
+					},
+					{
+						Name:        "result",
+						ArgsUsage:   "[policy name]/[volume name]",
+						Description: "Shows the outcome of the last scheduled snapshot of the volume: the snapshot taken, or why it was not, and warnings such as failed post-snapshot hooks.",
+						Usage:       "Show the result of the last snapshot of a volume",
+						Action:      VolumeSnapshotResult,
+					},
 				},
 			},
 			{
@@ -247,6 +351,13 @@ var Commands = []cli.Command{
 				},
 				Action: UseGet,
 			},
+			{
+				Name:        "volsupervisor",
+				Usage:       "Get the leading volsupervisor",
+				Description: "Obtains the volsupervisor lock, which names the host of the volsupervisor taking snapshots and when it started.",
+				ArgsUsage:   "",
+				Action:      UseVolsupervisor,
+			},
 			{
 				Name:        "force-remove",
 				ArgsUsage:   "[policy name]/[volume name]",
@@ -263,4 +374,107 @@ var Commands = []cli.Command{
 			},
 		},
 	},
+	{
+		Name:      "apply",
+		ArgsUsage: "-f [file or directory]",
+		Usage:     "Apply global, policy and volume manifests",
+		Description: "Reads the JSON or YAML manifests in a file or directory, prints the changes which make the current " +
+			"state match them, and applies the changes through the apiserver. Volumes are only ever created or removed.",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "file, f",
+				Usage: "manifest file, or directory of .json, .yaml and .yml manifests",
+			},
+			cli.BoolFlag{
+				Name:  "prune",
+				Usage: "remove the policies and volumes which have no manifest",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run, n",
+				Usage: "only print the changes",
+			},
+		},
+		Action: Apply,
+	},
+	{
+		Name:      "events",
+		ArgsUsage: "",
+		Usage:     "Tail the events of the cluster",
+		Description: "Streams changes to policies, volumes, runtime options, use locks and snapshot signals from the apiserver, " +
+			"one per line: index, type, action and policy or volume. Pass the index of the last event seen to --index to resume.",
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{
+				Name:  "type, t",
+				Usage: "only stream these types of events: policy, volume, runtime, use, snapshot",
+			},
+			cli.StringFlag{
+				Name:  "volume",
+				Usage: "only stream the events about this volume, as [policy name]/[volume name]",
+			},
+			cli.IntFlag{
+				Name:  "index",
+				Usage: "resume after the event with this index",
+			},
+			cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the events as JSON",
+			},
+		},
+		Action: Events,
+	},
+	{
+		Name:  "audit",
+		Usage: "Query the audit log",
+		Subcommands: []cli.Command{
+			{
+				Name:        "list",
+				Usage:       "List the audit log",
+				Description: "Lists the mutating operations done through the apiserver and volcli, oldest first: time, caller, operation, target and result.",
+				ArgsUsage:   "",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "since",
+						Usage: "only list operations since this duration ago (e.g. 24h) or RFC3339 time",
+					},
+					cli.StringFlag{
+						Name:  "volume",
+						Usage: "only list operations on this volume, as [policy name]/[volume name]",
+					},
+				},
+				Action: AuditList,
+			},
+		},
+	},
+	{
+		Name:  "db",
+		Usage: "Manage the database",
+		Subcommands: []cli.Command{
+			{
+				Name:      "restore",
+				ArgsUsage: "[tarball]",
+				Usage:     "Restore a database dump",
+				Description: "Restores a tarball made by a database dump (e.g. by sending SIGUSR2 to apiserver) under --prefix. " +
+					"Use locks, stats, freezes, snapshot requests and audit entries are never restored. By default nothing is restored if any of the keys already exist. Restores, but not dry runs, are recorded in the audit log.",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "source-prefix",
+						Usage: "prefix the tarball was dumped from, if not --prefix; it is rewritten to --prefix",
+					},
+					cli.BoolFlag{
+						Name:  "overwrite",
+						Usage: "overwrite existing keys",
+					},
+					cli.BoolFlag{
+						Name:  "skip-existing",
+						Usage: "leave existing keys alone and restore the rest",
+					},
+					cli.BoolFlag{
+						Name:  "dry-run, n",
+						Usage: "only report what would be restored",
+					},
+				},
+				Action: DBRestore,
+			},
+		},
+	},
 }
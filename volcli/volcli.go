@@ -1,24 +1,29 @@
 package volcli
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
+	"os/user"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/apiserver/client"
 	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/db"
+	"github.com/contiv/volplugin/db/store"
 	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/jsondiff"
 	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/manifest"
 	"github.com/contiv/volplugin/watch"
 	"github.com/kr/pty"
 )
@@ -41,14 +46,71 @@ func splitVolume(ctx *cli.Context) (string, string, error) {
 	return volumeparts[0], volumeparts[1], nil
 }
 
+// newDBClient returns the db.Client of --store, or of --etcd if it is not
+// set.
+func newDBClient(ctx *cli.Context) (db.Client, error) {
+	if ctx.GlobalString("store") == "" {
+		s := &store.Store{Name: store.Etcd, Hosts: ctx.GlobalStringSlice("etcd")}
+		return s.NewClient(ctx.GlobalString("prefix"))
+	}
+
+	s, err := store.Parse(ctx.GlobalString("store"))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.NewClient(ctx.GlobalString("prefix"))
+}
+
+// exitCodes are the exit statuses for the error codes of the apiserver, so
+// scripts can tell failures apart. Other errors exit with 1.
+var exitCodes = map[string]int{
+	api.CodeNotExists:     2,
+	api.CodeExists:        3,
+	api.CodeLocked:        4,
+	api.CodeConflict:      5,
+	api.CodeInvalid:       6,
+	api.CodeQuotaExceeded: 7,
+	api.CodeUnsupported:   8,
+	api.CodeUnavailable:   9,
+	api.CodeUnauthorized:  10,
+	api.CodeForbidden:     11,
+}
+
 func errExit(ctx *cli.Context, err error, help bool) {
 	fmt.Fprintf(os.Stderr, "\nError: %v\n\n", err)
 	if help {
 		cli.ShowAppHelp(ctx)
 	}
+
+	if herr := findHTTPError(err); herr != nil {
+		fmt.Fprintf(os.Stderr, "Error code: %s (HTTP status %d)\n\n", herr.Code, herr.Status)
+		if code, ok := exitCodes[herr.Code]; ok {
+			os.Exit(code)
+		}
+	}
+
 	os.Exit(1)
 }
 
+// findHTTPError returns the error the apiserver responded with, if it caused
+// err.
+func findHTTPError(err error) *api.HTTPError {
+	if herr, ok := err.(*api.HTTPError); ok {
+		return herr
+	}
+
+	var herr *api.HTTPError
+	if erd, ok := err.(*errored.Error); ok {
+		erd.ContainsFunc(func(cause error) bool {
+			herr, ok = cause.(*api.HTTPError)
+			return ok
+		})
+	}
+
+	return herr
+}
+
 func execCliAndExit(ctx *cli.Context, f func(ctx *cli.Context) (bool, error)) {
 	if showHelp, err := f(ctx); err != nil {
 		errExit(ctx, err, showHelp)
@@ -59,39 +121,44 @@ func ppJSON(v interface{}) ([]byte, error) {
 	return json.MarshalIndent(v, "", "  ")
 }
 
-func deleteRequest(url string, bodyType string, body io.Reader) (resp *http.Response, err error) {
-	req, err := http.NewRequest("DELETE", url, body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to prepare request: %v", err)
+func newAPIClient(ctx *cli.Context) (*client.Client, error) {
+	apiClient := client.New(ctx.GlobalString("apiserver"), ctx.GlobalDuration("apiserver-timeout"))
+	apiClient.SetToken(ctx.GlobalString("apiserver-token"))
+
+	caFile := ctx.GlobalString("apiserver-tls-ca")
+	certFile := ctx.GlobalString("apiserver-tls-cert")
+	keyFile := ctx.GlobalString("apiserver-tls-key")
+
+	if ctx.GlobalBool("apiserver-tls") || caFile != "" || certFile != "" || keyFile != "" {
+		tlsConfig, err := client.TLSConfig(caFile, certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		apiClient.SetTLS(tlsConfig)
 	}
-	req.Header.Set("Content-Type", bodyType)
 
-	return http.DefaultClient.Do(req)
+	return apiClient, nil
 }
 
-// GlobalGet retrives the global configuration and displays it on standard output.
-func GlobalGet(ctx *cli.Context) {
-	execCliAndExit(ctx, globalGet)
+// volumeError wraps an error the apiserver returned for a volume.
+func volumeError(policy, volume string, err error) error {
+	return errored.Errorf("Volume %v/%v", policy, volume).Combine(err)
 }
 
-func queryGlobalConfig(ctx *cli.Context) (*config.Global, error) {
-	resp, err := http.Get(fmt.Sprintf("http://%s/global", ctx.GlobalString("apiserver")))
-	if err != nil {
-		return nil, err
-	}
-
-	content, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+// missingVolumeError is volumeError for commands on volumes which should
+// exist.
+func missingVolumeError(policy, volume string, err error) error {
+	if herr, ok := err.(*api.HTTPError); ok && herr.Code == api.CodeNotExists {
+		return errored.Errorf("Volume %v/%v no longer exists.", policy, volume).Combine(err)
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, errored.Errorf("Status code was %d not 200: %s", resp.StatusCode, string(content))
-	}
+	return volumeError(policy, volume, err)
+}
 
-	// rebuild and divide the contents so they are cast out of their internal
-	// representation.
-	return config.NewGlobalConfigFromJSON(content)
+// GlobalGet retrives the global configuration and displays it on standard output.
+func GlobalGet(ctx *cli.Context) {
+	execCliAndExit(ctx, globalGet)
 }
 
 func globalGet(ctx *cli.Context) (bool, error) {
@@ -99,7 +166,12 @@ func globalGet(ctx *cli.Context) (bool, error) {
 		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
 	}
 
-	global, err := queryGlobalConfig(ctx)
+	apiClient, err := newAPIClient(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	global, err := apiClient.GetGlobal()
 	if err != nil {
 		return false, err
 	}
@@ -133,19 +205,12 @@ func globalUpload(ctx *cli.Context) (bool, error) {
 		return false, err
 	}
 
-	resp, err := http.Post(fmt.Sprintf("http://%s/global", ctx.GlobalString("apiserver")), "application/json", bytes.NewBuffer(content))
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	if resp.StatusCode != 200 {
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\nResponse Status Code was %d, not 200", err, resp.StatusCode)
-		}
-		return false, errored.Errorf("Response Status Code was %d, not 200", resp.StatusCode)
-	}
-
-	return false, nil
+	return false, apiClient.UploadGlobal(global)
 }
 
 // PolicyUpload uploads a Policy intent from stdin.
@@ -170,19 +235,12 @@ func policyUpload(ctx *cli.Context) (bool, error) {
 		return false, err
 	}
 
-	resp, err := http.Post(fmt.Sprintf("http://%s/policies/%s", ctx.GlobalString("apiserver"), policyName), "application/json", bytes.NewBuffer(content))
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	if resp.StatusCode != 200 {
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\nResponse Status Code was %d, not 200", err, resp.StatusCode)
-		}
-		return false, errored.Errorf("Response Status Code was %d, not 200", resp.StatusCode)
-	}
-
-	return false, nil
+	return false, apiClient.UploadPolicy(policyName, policy)
 }
 
 // PolicyDelete removes a policy supplied as an argument.
@@ -197,16 +255,13 @@ func policyDelete(ctx *cli.Context) (bool, error) {
 
 	policy := ctx.Args()[0]
 
-	resp, err := deleteRequest(fmt.Sprintf("http://%s/policies/%s", ctx.GlobalString("apiserver"), policy), "application/json", nil)
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	if resp.StatusCode != 200 {
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\nResponse Status Code was %d, not 200", err, resp.StatusCode)
-		}
-		return false, errored.Errorf("Response Status Code was %d, not 200", resp.StatusCode)
+	if err := apiClient.DeletePolicy(policy); err != nil {
+		return false, err
 	}
 
 	fmt.Printf("%q removed!\n", policy)
@@ -226,20 +281,34 @@ func policyGet(ctx *cli.Context) (bool, error) {
 	}
 
 	policy := ctx.Args()[0]
+	apiClient, err := newAPIClient(ctx)
+	if err != nil {
+		return false, err
+	}
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/policies/%s", ctx.GlobalString("apiserver"), policy))
+	policyObj, err := apiClient.GetPolicy(policy)
 	if err != nil {
 		return false, err
 	}
 
-	if resp.StatusCode != 200 {
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\nResponse Status Code was %d, not 200", err, resp.StatusCode)
-		}
-		return false, errored.Errorf("Response Status Code was %d, not 200", resp.StatusCode)
+	usage, err := apiClient.PolicyUsage(policy)
+	if err != nil {
+		return false, errored.Errorf("Retrieving usage of policy %q", policy).Combine(err)
+	}
+
+	content, err := json.Marshal(policyObj)
+	if err != nil {
+		return false, err
 	}
 
-	content, err := ioutil.ReadAll(resp.Body)
+	// the usage is added to the policy so the output can still be uploaded.
+	output := map[string]interface{}{}
+	if err := json.Unmarshal(content, &output); err != nil {
+		return false, err
+	}
+	output["usage"] = usage
+
+	content, err = ppJSON(output)
 	if err != nil {
 		return false, err
 	}
@@ -255,32 +324,20 @@ func PolicyList(ctx *cli.Context) {
 }
 
 func policyList(ctx *cli.Context) (bool, error) {
-	var policies []config.Policy
 	if len(ctx.Args()) != 0 {
 		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
 	}
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/policies", ctx.GlobalString("apiserver")))
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	if resp.StatusCode != 200 {
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\nResponse Status Code was %d, not 200", err, resp.StatusCode)
-		}
-		return false, errored.Errorf("Response Status Code was %d, not 200", resp.StatusCode)
-	}
-
-	content, err := ioutil.ReadAll(resp.Body)
+	policies, err := apiClient.ListPolicies()
 	if err != nil {
 		return false, err
 	}
 
-	if err := json.Unmarshal(content, &policies); err != nil {
-		return false, err
-	}
-
 	for _, policy := range policies {
 		fmt.Println(policy.Name)
 	}
@@ -301,23 +358,17 @@ func policyGetRevision(ctx *cli.Context) (bool, error) {
 	name := ctx.Args()[0]
 	revision := ctx.Args()[1]
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/policy-archives/%s/%s",
-		ctx.GlobalString("apiserver"),
-		name,
-		revision,
-	))
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	if resp.StatusCode != 200 {
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\nResponse Status Code was %d, not 200", err, resp.StatusCode)
-		}
-		return false, errored.Errorf("Response Status Code was %d, not 200", resp.StatusCode)
+	policy, err := apiClient.GetPolicyRevision(name, revision)
+	if err != nil {
+		return false, err
 	}
 
-	content, err := ioutil.ReadAll(resp.Body)
+	content, err := ppJSON(policy)
 	if err != nil {
 		return false, err
 	}
@@ -333,45 +384,115 @@ func PolicyListRevisions(ctx *cli.Context) {
 }
 
 func policyListRevisions(ctx *cli.Context) (bool, error) {
-	var revisions []string
-
 	if len(ctx.Args()) != 1 {
 		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
 	}
 
 	name := ctx.Args()[0]
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/policy-archives/%s",
-		ctx.GlobalString("apiserver"),
-		name,
-	))
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	if resp.StatusCode != 200 {
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\nResponse Status Code was %d, not 200", err, resp.StatusCode)
-		}
-		return false, errored.Errorf("Response Status Code was %d, not 200", resp.StatusCode)
+	revisions, err := apiClient.ListPolicyRevisions(name)
+	if err != nil {
+		return false, err
 	}
 
-	content, err := ioutil.ReadAll(resp.Body)
+	for _, revision := range revisions {
+		fmt.Println(revision)
+	}
+
+	return false, nil
+}
+
+// PolicyDiffRevisions prints the differences between two revisions of a
+// policy, or between a revision and the current policy.
+func PolicyDiffRevisions(ctx *cli.Context) {
+	execCliAndExit(ctx, policyDiffRevisions)
+}
+
+func policyDiffRevisions(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 2 && len(ctx.Args()) != 3 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 2, ctx.Args())
+	}
+
+	name := ctx.Args()[0]
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	if err := json.Unmarshal(content, &revisions); err != nil {
+	before, err := apiClient.GetPolicyRevision(name, ctx.Args()[1])
+	if err != nil {
 		return false, err
 	}
 
-	for _, revision := range revisions {
-		fmt.Println(revision)
+	var after *config.Policy
+	if len(ctx.Args()) == 3 {
+		after, err = apiClient.GetPolicyRevision(name, ctx.Args()[2])
+	} else {
+		after, err = apiClient.GetPolicy(name)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	beforeContent, err := json.Marshal(before)
+	if err != nil {
+		return false, err
+	}
+
+	afterContent, err := json.Marshal(after)
+	if err != nil {
+		return false, err
+	}
+
+	changes, err := jsondiff.Diff(beforeContent, afterContent)
+	if err != nil {
+		return false, err
+	}
+
+	if len(changes) == 0 {
+		fmt.Println("No differences")
+	}
+
+	for _, change := range changes {
+		fmt.Println(change)
 	}
 
 	return false, nil
 }
 
+// PolicyRollback publishes an old revision of a policy as the current one.
+func PolicyRollback(ctx *cli.Context) {
+	execCliAndExit(ctx, policyRollback)
+}
+
+func policyRollback(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 2 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 2, ctx.Args())
+	}
+
+	name := ctx.Args()[0]
+	revision := ctx.Args()[1]
+
+	apiClient, err := newAPIClient(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := apiClient.RollbackPolicy(name, revision); err != nil {
+		return false, err
+	}
+
+	fmt.Printf("%q rolled back to revision %s\n", name, revision)
+
+	return false, nil
+}
+
 // PolicyWatch watches etcd for policy changes and prints the name and revision when a policy is uploaded.
 func PolicyWatch(ctx *cli.Context) {
 	execCliAndExit(ctx, policyWatch)
@@ -382,7 +503,7 @@ func policyWatch(ctx *cli.Context) (bool, error) {
 		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
 	}
 
-	cfg, err := config.NewClient(ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
+	cfg, err := store.NewConfigClient(ctx.GlobalString("store"), ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
 	if err != nil {
 		return false, err
 	}
@@ -435,28 +556,19 @@ func volumeCreate(ctx *cli.Context) (bool, error) {
 		Options: opts,
 	}
 
-	content, err := json.Marshal(tc)
-	if err != nil {
-		return false, errored.Errorf("Could not create request JSON: %v", err)
-	}
-
-	resp, err := http.Post(fmt.Sprintf("http://%s/volumes/create", ctx.GlobalString("apiserver")), "application/json", bytes.NewBuffer(content))
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
-		return false, errored.Errorf("Error in request: %v - %v", err, resp.Status)
+		return false, err
 	}
 
-	if resp.StatusCode != 200 {
-		qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume)
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
-		}
-		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	if _, err := apiClient.CreateVolume(tc); err != nil {
+		return false, volumeError(policy, volume, err)
 	}
 
 	return false, nil
 }
 
-// VolumeGet retrieves the metadata for a volume and prints it.
+// VolumeGet retrieves the metadata or the usage stats for a volume and prints it.
 func VolumeGet(ctx *cli.Context) {
 	execCliAndExit(ctx, volumeGet)
 }
@@ -471,35 +583,58 @@ func volumeGet(ctx *cli.Context) (bool, error) {
 		return true, err
 	}
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/volumes/%s/%s", ctx.GlobalString("apiserver"), policy, volume))
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	if resp.StatusCode == 404 {
-		return false, errored.Errorf("Volume %v/%v no longer exists.", policy, volume)
+	var result interface{}
+	if ctx.Bool("stats") {
+		result, err = apiClient.VolumeStats(policy, volume)
+	} else {
+		result, err = apiClient.GetVolume(policy, volume)
 	}
 
-	if resp.StatusCode != 200 {
-		qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume)
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
-		}
-		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	if err != nil {
+		return false, missingVolumeError(policy, volume, err)
 	}
 
-	content, err := ioutil.ReadAll(resp.Body)
+	content, err := ppJSON(result)
 	if err != nil {
 		return false, err
 	}
 
-	var vol config.Volume
+	fmt.Println(string(content))
+
+	return false, nil
+}
+
+// VolumeResize changes the size of a volume.
+func VolumeResize(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeResize)
+}
+
+func volumeResize(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 2 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 2, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
 
-	if err := json.Unmarshal(content, &vol); err != nil {
+	apiClient, err := newAPIClient(ctx)
+	if err != nil {
 		return false, err
 	}
 
-	content, err = ppJSON(vol)
+	vol, err := apiClient.ResizeVolume(policy, volume, ctx.Args()[1], ctx.Bool("force"))
+	if err != nil {
+		return false, volumeError(policy, volume, err)
+	}
+
+	content, err := ppJSON(vol)
 	if err != nil {
 		return false, err
 	}
@@ -524,32 +659,13 @@ func volumeForceRemove(ctx *cli.Context) (bool, error) {
 		return true, err
 	}
 
-	request := config.VolumeRequest{
-		Policy: policy,
-		Name:   volume,
-	}
-
-	content, err := json.Marshal(request)
-	if err != nil {
-		return false, err
-	}
-
-	resp, err := deleteRequest(fmt.Sprintf("http://%s/volumes/removeforce", ctx.GlobalString("apiserver")), "application/json", bytes.NewBuffer(content))
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	qualifiedVolume := strings.Join([]string{policy, volume}, "/")
-
-	if resp.StatusCode == 404 {
-		return false, errored.Errorf("Volume %v no longer exists.", qualifiedVolume)
-	}
-
-	if resp.StatusCode != 200 {
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
-		}
-		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	if err := apiClient.ForceRemoveVolume(policy, volume); err != nil {
+		return false, missingVolumeError(policy, volume, err)
 	}
 
 	return false, nil
@@ -570,41 +686,20 @@ func volumeRemove(ctx *cli.Context) (bool, error) {
 		return true, err
 	}
 
-	timeout := ctx.String("timeout")
-	if _, err = time.ParseDuration(timeout); err != nil && timeout != "" {
-		return false, errored.Errorf("%v is not a valid timeout", ctx.String("timeout"))
-	}
-
-	request := config.VolumeRequest{
-		Policy: policy,
-		Name:   volume,
-		Options: map[string]string{
-			"timeout": timeout,
-			"force":   fmt.Sprintf("%v", ctx.Bool("force")),
-		},
+	var timeout time.Duration
+	if ctx.String("timeout") != "" {
+		if timeout, err = time.ParseDuration(ctx.String("timeout")); err != nil {
+			return false, errored.Errorf("%v is not a valid timeout", ctx.String("timeout"))
+		}
 	}
 
-	content, err := json.Marshal(request)
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	resp, err := deleteRequest(fmt.Sprintf("http://%s/volumes/remove", ctx.GlobalString("apiserver")), "application/json", bytes.NewBuffer(content))
-	if err != nil {
-		return false, err
-	}
-
-	qualifiedVolume := strings.Join([]string{policy, volume}, "/")
-
-	if resp.StatusCode == 404 {
-		return false, errored.Errorf("Volume %v no longer exists.", qualifiedVolume)
-	}
-
-	if resp.StatusCode != 200 {
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
-		}
-		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	if err := apiClient.RemoveVolume(policy, volume, timeout, ctx.Bool("force")); err != nil {
+		return false, missingVolumeError(policy, volume, err)
 	}
 
 	return false, nil
@@ -616,34 +711,20 @@ func VolumeList(ctx *cli.Context) {
 }
 
 func volumeList(ctx *cli.Context) (bool, error) {
-	var volumes []config.Volume
 	if len(ctx.Args()) != 1 {
 		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
 	}
 
-	policy := ctx.Args()[0]
-
-	resp, err := http.Get(fmt.Sprintf("http://%s/volumes/%s", ctx.GlobalString("apiserver"), policy))
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	if resp.StatusCode != 200 {
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\nResponse Status Code was %d, not 200", err, resp.StatusCode)
-		}
-		return false, errored.Errorf("Response Status Code was %d, not 200", resp.StatusCode)
-	}
-
-	content, err := ioutil.ReadAll(resp.Body)
+	volumes, err := apiClient.ListVolumes(ctx.Args()[0], ctx.String("selector"))
 	if err != nil {
 		return false, err
 	}
 
-	if err := json.Unmarshal(content, &volumes); err != nil {
-		return false, err
-	}
-
 	for _, volume := range volumes {
 		fmt.Println(volume.VolumeName)
 	}
@@ -666,17 +747,13 @@ func volumeSnapshotTake(ctx *cli.Context) (bool, error) {
 		return true, err
 	}
 
-	resp, err := http.Post(fmt.Sprintf("http://%s/snapshots/take/%s/%s", ctx.GlobalString("apiserver"), policy, volume), "application/json", nil)
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	if resp.StatusCode != 200 {
-		qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume)
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
-		}
-		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	if err := apiClient.TakeSnapshot(policy, volume); err != nil {
+		return false, volumeError(policy, volume, err)
 	}
 
 	return false, nil
@@ -700,54 +777,98 @@ func volumeSnapshotCopy(ctx *cli.Context) (bool, error) {
 	snapName := ctx.Args()[1]
 	volume2 := ctx.Args()[2]
 
-	req := &config.VolumeRequest{
-		Name:   volume1,
-		Policy: policy,
-		Options: map[string]string{
-			"target":   volume2,
-			"snapshot": snapName,
-		},
+	apiClient, err := newAPIClient(ctx)
+	if err != nil {
+		return false, err
 	}
 
-	content, err := json.Marshal(req)
+	vol, err := apiClient.CopyVolume(policy, volume1, snapName, volume2)
 	if err != nil {
-		return false, errored.Errorf("Could not create request JSON: %v", err)
+		return false, volumeError(policy, volume1, err)
 	}
 
-	resp, err := http.Post(fmt.Sprintf("http://%s/volumes/copy", ctx.GlobalString("apiserver")), "application/json", bytes.NewBuffer(content))
+	fmt.Println(strings.Join([]string{vol.PolicyName, vol.VolumeName}, "/"))
+
+	return false, nil
+}
+
+// VolumeSnapshotRollback rolls a volume back to one of its snapshots.
+func VolumeSnapshotRollback(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeSnapshotRollback)
+}
+
+func volumeSnapshotRollback(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 2 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 2, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	if resp.StatusCode != 200 {
-		qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume1)
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
-		}
-		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	if err := apiClient.RollbackSnapshot(policy, volume, ctx.Args()[1]); err != nil {
+		return false, volumeError(policy, volume, err)
 	}
 
-	content, err = ioutil.ReadAll(resp.Body)
+	return false, nil
+}
+
+// VolumeSnapshotPrune applies the snapshot retention of a volume.
+func VolumeSnapshotPrune(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeSnapshotPrune)
+}
+
+func volumeSnapshotPrune(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
 	if err != nil {
-		return false, errored.New("Reading body processing response").Combine(err)
+		return true, err
 	}
 
-	vol := &config.Volume{}
-	if err := json.Unmarshal(content, vol); err != nil {
-		return false, errors.UnmarshalVolume.Combine(err)
+	apiClient, err := newAPIClient(ctx)
+	if err != nil {
+		return false, err
 	}
 
-	fmt.Println(strings.Join([]string{vol.PolicyName, vol.VolumeName}, "/"))
+	dryRun := ctx.Bool("dry-run")
+
+	verdicts, err := apiClient.PruneSnapshots(policy, volume, dryRun)
+	if err != nil {
+		return false, volumeError(policy, volume, err)
+	}
+
+	for _, verdict := range verdicts {
+		action := "kept"
+		switch {
+		case verdict.Keep && dryRun:
+			action = "keep"
+		case !verdict.Keep && dryRun:
+			action = "remove"
+		case !verdict.Keep:
+			action = "removed"
+		}
+
+		fmt.Printf("%s\t%s\t%s\n", action, verdict.Name, strings.Join(verdict.Reasons, ","))
+	}
 
 	return false, nil
 }
 
-// VolumeSnapshotList lists all snapshots for a given volume.
-func VolumeSnapshotList(ctx *cli.Context) {
-	execCliAndExit(ctx, volumeSnapshotList)
+// VolumeSnapshotResult shows the outcome of the last snapshot of a volume.
+func VolumeSnapshotResult(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeSnapshotResult)
 }
 
-func volumeSnapshotList(ctx *cli.Context) (bool, error) {
+func volumeSnapshotResult(ctx *cli.Context) (bool, error) {
 	if len(ctx.Args()) != 1 {
 		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
 	}
@@ -757,30 +878,51 @@ func volumeSnapshotList(ctx *cli.Context) (bool, error) {
 		return true, err
 	}
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/snapshots/%s/%s", ctx.GlobalString("apiserver"), policy, volume))
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	if resp.StatusCode != 200 {
-		qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume)
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
-		}
-		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	result, err := apiClient.GetSnapshotResult(policy, volume)
+	if err != nil {
+		return false, volumeError(policy, volume, err)
 	}
 
-	content, err := ioutil.ReadAll(resp.Body)
+	content, err := ppJSON(result)
 	if err != nil {
 		return false, err
 	}
 
-	var results []string
+	fmt.Println(string(content))
+
+	return false, nil
+}
 
-	if err := json.Unmarshal(content, &results); err != nil {
+// VolumeSnapshotList lists all snapshots for a given volume.
+func VolumeSnapshotList(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeSnapshotList)
+}
+
+func volumeSnapshotList(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	apiClient, err := newAPIClient(ctx)
+	if err != nil {
 		return false, err
 	}
 
+	results, err := apiClient.ListSnapshots(policy, volume)
+	if err != nil {
+		return false, volumeError(policy, volume, err)
+	}
+
 	for _, result := range results {
 		fmt.Println(result)
 	}
@@ -794,32 +936,20 @@ func VolumeListAll(ctx *cli.Context) {
 }
 
 func volumeListAll(ctx *cli.Context) (bool, error) {
-	var volumes []config.Volume
 	if len(ctx.Args()) != 0 {
 		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
 	}
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/volumes/", ctx.GlobalString("apiserver")))
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	if resp.StatusCode != 200 {
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\nResponse Status Code was %d, not 200", err, resp.StatusCode)
-		}
-		return false, errored.Errorf("Response Status Code was %d, not 200", resp.StatusCode)
-	}
-
-	content, err := ioutil.ReadAll(resp.Body)
+	volumes, err := apiClient.ListAllVolumes(ctx.String("selector"))
 	if err != nil {
 		return false, err
 	}
 
-	if err := json.Unmarshal(content, &volumes); err != nil {
-		return false, err
-	}
-
 	for _, volume := range volumes {
 		fmt.Printf("%v/%v\n", volume.PolicyName, volume.VolumeName)
 	}
@@ -837,7 +967,7 @@ func useList(ctx *cli.Context) (bool, error) {
 		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
 	}
 
-	cfg, err := config.NewClient(ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
+	cfg, err := store.NewConfigClient(ctx.GlobalString("store"), ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
 	if err != nil {
 		return false, err
 	}
@@ -875,25 +1005,20 @@ func useGet(ctx *cli.Context) (bool, error) {
 		return true, err
 	}
 
-	cfg, err := config.NewClient(ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	vc := &config.Volume{
-		PolicyName: policy,
-		VolumeName: volume,
-	}
-
 	var ul config.UseLocker
 
 	if ctx.Bool("snapshot") {
-		ul = &config.UseSnapshot{}
+		ul, err = apiClient.GetSnapshotUse(policy, volume)
 	} else {
-		ul = &config.UseMount{}
+		ul, err = apiClient.GetMountUse(policy, volume)
 	}
 
-	if err := cfg.GetUse(ul, vc); err != nil {
+	if err != nil {
 		return false, err
 	}
 
@@ -907,6 +1032,37 @@ func useGet(ctx *cli.Context) (bool, error) {
 	return false, nil
 }
 
+// UseVolsupervisor retrieves the JSON information for the leading
+// volsupervisor.
+func UseVolsupervisor(ctx *cli.Context) {
+	execCliAndExit(ctx, useVolsupervisor)
+}
+
+func useVolsupervisor(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 0 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+	}
+
+	apiClient, err := newAPIClient(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	use, err := apiClient.GetVolsupervisorUse()
+	if err != nil {
+		return false, err
+	}
+
+	content, err := ppJSON(use)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Println(string(content))
+
+	return false, nil
+}
+
 // UseTheForce deletes the use entry from etcd; useful for clearing a
 // stale mount.
 func UseTheForce(ctx *cli.Context) {
@@ -923,7 +1079,7 @@ func useTheForce(ctx *cli.Context) (bool, error) {
 		return true, err
 	}
 
-	cfg, err := config.NewClient(ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
+	cfg, err := store.NewConfigClient(ctx.GlobalString("store"), ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
 	if err != nil {
 		return false, err
 	}
@@ -933,15 +1089,64 @@ func useTheForce(ctx *cli.Context) (bool, error) {
 		VolumeName: volume,
 	}
 
+	entry := &config.AuditEntry{
+		Time:      time.Now(),
+		Caller:    localCaller(),
+		Operation: "use force-remove",
+		Target:    vc.String(),
+		Success:   true,
+	}
+
+	failures := []string{}
+
 	if err := cfg.RemoveUse(&config.UseMount{Volume: vc.String()}, true); err != nil {
 		fmt.Fprintf(os.Stderr, "Trouble removing mount lock (may be harmless) for %q: %v", vc, err)
+		failures = append(failures, fmt.Sprintf("mount lock: %v", err))
 	}
 
 	if err := cfg.RemoveUse(&config.UseSnapshot{Volume: vc.String()}, true); err != nil {
 		fmt.Fprintf(os.Stderr, "Trouble removing snapshot lock (may be harmless) for %q: %v", vc, err)
+		failures = append(failures, fmt.Sprintf("snapshot lock: %v", err))
 	}
 
-	return false, nil
+	if len(failures) > 0 {
+		entry.Success = false
+		entry.Error = strings.Join(failures, "; ")
+	}
+
+	return false, recordAudit(cfg, entry)
+}
+
+// recordAudit records an operation volcli did on its own, without the
+// apiserver, in the audit log, for as long as the global configuration keeps
+// entries.
+func recordAudit(cfg *config.Client, entry *config.AuditEntry) error {
+	global, err := cfg.GetGlobal()
+	if err != nil {
+		global = config.NewGlobalConfig()
+	}
+
+	if err := cfg.RecordAudit(entry, global.AuditRetention()); err != nil {
+		return errors.RecordAudit.Combine(err)
+	}
+
+	return nil
+}
+
+// localCaller identifies the user running volcli in the audit log, as
+// volcli:user@host.
+func localCaller() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("volcli:%s@%s", name, host)
 }
 
 // UseExec acquires a lock (waiting if necessary) and executes a command when it takes it.
@@ -959,7 +1164,7 @@ func useExec(ctx *cli.Context) (bool, error) {
 		return true, err
 	}
 
-	cfg, err := config.NewClient(ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
+	cfg, err := store.NewConfigClient(ctx.GlobalString("store"), ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
 	if err != nil {
 		return false, err
 	}
@@ -1029,31 +1234,17 @@ func volumeRuntimeGet(ctx *cli.Context) (bool, error) {
 		return true, err
 	}
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/runtime/%s/%s", ctx.GlobalString("apiserver"), policy, volume))
+	apiClient, err := newAPIClient(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	if resp.StatusCode != 200 {
-		qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume)
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
-		}
-		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
-	}
-
-	content, err := ioutil.ReadAll(resp.Body)
+	runtime, err := apiClient.GetRuntime(policy, volume)
 	if err != nil {
-		return false, err
-	}
-
-	runtime := config.RuntimeOptions{}
-
-	if err := json.Unmarshal(content, &runtime); err != nil {
-		return false, err
+		return false, volumeError(policy, volume, err)
 	}
 
-	content, err = ppJSON(runtime)
+	content, err := ppJSON(runtime)
 	if err != nil {
 		return false, err
 	}
@@ -1083,24 +1274,345 @@ func volumeRuntimeUpload(ctx *cli.Context) (bool, error) {
 		return false, err
 	}
 
-	runtime := config.RuntimeOptions{}
+	runtime := &config.RuntimeOptions{}
+
+	if err := json.Unmarshal(content, runtime); err != nil {
+		return false, err
+	}
+
+	apiClient, err := newAPIClient(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if err := apiClient.UploadRuntime(policy, volume, runtime); err != nil {
+		return false, volumeError(policy, volume, err)
+	}
+
+	return false, nil
+}
+
+// AuditList lists the audit log.
+func AuditList(ctx *cli.Context) {
+	execCliAndExit(ctx, auditList)
+}
+
+func auditList(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 0 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+	}
+
+	since, err := parseSince(ctx.String("since"))
+	if err != nil {
+		return true, err
+	}
+
+	apiClient, err := newAPIClient(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	entries, err := apiClient.ListAudit(since, ctx.String("volume"))
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		result := "ok"
+		if !entry.Success {
+			result = "failed: " + entry.Error
+		}
+
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", entry.Time.Format(time.RFC3339), entry.Caller, entry.Operation, entry.Target, result)
+	}
+
+	return false, nil
+}
+
+// parseSince parses --since, which is either a duration back from now or an
+// RFC3339 time.
+func parseSince(since string) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(since); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return time.Time{}, errored.Errorf("%q is not a duration (e.g. 24h) or an RFC3339 time", since)
+	}
+
+	return t, nil
+}
+
+// Events tails the event stream of the apiserver.
+func Events(ctx *cli.Context) {
+	execCliAndExit(ctx, events)
+}
+
+func events(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 0 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+	}
+
+	opts := &client.EventOptions{
+		Volume:     ctx.String("volume"),
+		AfterIndex: uint64(ctx.Int("index")),
+	}
+
+	for _, typ := range ctx.StringSlice("type") {
+		opts.Types = append(opts.Types, strings.Split(typ, ",")...)
+	}
+
+	apiClient, err := newAPIClient(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var printErr error
+
+	err = apiClient.Events(opts, func(event *config.Event) bool {
+		if ctx.Bool("json") {
+			content, err := json.Marshal(event)
+			if err != nil {
+				printErr = err
+				return false
+			}
+
+			fmt.Println(string(content))
+			return true
+		}
+
+		target := event.Volume
+		if target == "" {
+			target = event.Policy
+		}
+
+		fmt.Printf("%d\t%s\t%s\t%s\n", event.Index, event.Type, event.Action, target)
+		return true
+	})
+
+	if printErr != nil {
+		return false, printErr
+	}
+
+	return false, err
+}
+
+// DBRestore restores a database dump.
+func DBRestore(ctx *cli.Context) {
+	execCliAndExit(ctx, dbRestore)
+}
+
+func dbRestore(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
+
+	opts := db.RestoreOptions{
+		SourcePrefix: ctx.String("source-prefix"),
+		DryRun:       ctx.Bool("dry-run"),
+	}
+
+	switch {
+	case ctx.Bool("overwrite") && ctx.Bool("skip-existing"):
+		return true, errored.Errorf("--overwrite and --skip-existing are mutually exclusive")
+	case ctx.Bool("overwrite"):
+		opts.Mode = db.RestoreOverwrite
+	case ctx.Bool("skip-existing"):
+		opts.Mode = db.RestoreSkipExisting
+	}
+
+	client, err := newDBClient(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := client.Restore(ctx.Args()[0], opts)
+
+	if !opts.DryRun {
+		if auditErr := recordRestore(ctx, opts, result, err); auditErr != nil && err == nil {
+			err = auditErr
+		}
+	}
 
-	if err := json.Unmarshal(content, &runtime); err != nil {
+	if result == nil {
 		return false, err
 	}
 
-	resp, err := http.Post(fmt.Sprintf("http://%s/runtime/%s/%s", ctx.GlobalString("apiserver"), policy, volume), "application/json", bytes.NewBuffer(content))
+	restored := "restored"
+	if opts.DryRun {
+		restored = "would restore"
+	}
+
+	for _, key := range result.Restored {
+		fmt.Printf("%s %s\n", restored, key)
+	}
+
+	for _, key := range result.Skipped {
+		fmt.Printf("skipped %s\n", key)
+	}
+
+	return false, err
+}
+
+// recordRestore records a restore in the audit log: the dump and the prefix
+// it was taken from, and how many keys were restored and skipped, or why the
+// restore failed.
+func recordRestore(ctx *cli.Context, opts db.RestoreOptions, result *db.RestoreResult, restoreErr error) error {
+	cfg, err := store.NewConfigClient(ctx.GlobalString("store"), ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
+	if err != nil {
+		return errors.RecordAudit.Combine(err)
+	}
+
+	// like the stores, restore from the prefix of the store if none was given.
+	source := opts.SourcePrefix
+	if source == "" {
+		source = ctx.GlobalString("prefix")
+	}
+
+	entry := &config.AuditEntry{
+		Time:      time.Now(),
+		Caller:    localCaller(),
+		Operation: "db restore",
+		Target:    ctx.Args()[0],
+		Details:   map[string]string{"source-prefix": source},
+		Success:   restoreErr == nil,
+	}
+
+	if restoreErr != nil {
+		entry.Error = restoreErr.Error()
+	}
+
+	if result != nil {
+		entry.Details["restored"] = strconv.Itoa(len(result.Restored))
+		entry.Details["skipped"] = strconv.Itoa(len(result.Skipped))
+	}
+
+	return recordAudit(cfg, entry)
+}
+
+// Apply makes the global configuration, policies and volumes match a set of
+// manifests.
+func Apply(ctx *cli.Context) {
+	execCliAndExit(ctx, apply)
+}
+
+func apply(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 0 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+	}
+
+	if ctx.String("file") == "" {
+		return true, errored.Errorf("--file is required")
+	}
+
+	desired, err := manifest.Load(ctx.String("file"))
+	if err != nil {
+		return false, err
+	}
+
+	current, err := queryState(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	if resp.StatusCode != 200 {
-		qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume)
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
+	changes, err := manifest.Plan(desired, current, ctx.Bool("prune"))
+	if err != nil {
+		return false, err
+	}
+
+	counts := map[manifest.Action]int{}
+	for _, change := range changes {
+		counts[change.Action]++
+		fmt.Println(change)
+		if change.Diff != "" {
+			fmt.Println(change.Diff)
+		}
+	}
+
+	fmt.Printf("Plan: %d to create, %d to update, %d to delete, %d unchanged.\n",
+		counts[manifest.ActionCreate], counts[manifest.ActionUpdate], counts[manifest.ActionDelete], counts[manifest.ActionNone])
+
+	if ctx.Bool("dry-run") {
+		return false, nil
+	}
+
+	for _, change := range changes {
+		if err := applyChange(ctx, change); err != nil {
+			return false, errored.Errorf("Could not %s", change).Combine(err)
 		}
-		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
 	}
 
 	return false, nil
 }
+
+// queryState fetches the global configuration, policies and volumes from
+// the apiserver.
+func queryState(ctx *cli.Context) (*manifest.Set, error) {
+	state := manifest.NewSet()
+	apiClient, err := newAPIClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	global, err := apiClient.GetGlobal()
+	if err != nil {
+		return nil, err
+	}
+
+	state.Global = global
+
+	policies, err := apiClient.ListPolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, policy := range policies {
+		state.Policies[policy.Name] = policy
+	}
+
+	volumes, err := apiClient.ListAllVolumes("")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, volume := range volumes {
+		vol := &manifest.Volume{Policy: volume.PolicyName, Name: volume.VolumeName}
+		state.Volumes[vol.String()] = vol
+	}
+
+	return state, nil
+}
+
+func applyChange(ctx *cli.Context, change *manifest.Change) error {
+	apiClient, err := newAPIClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case change.Action == manifest.ActionNone:
+		return nil
+	case change.Global != nil:
+		err = apiClient.UploadGlobal(change.Global)
+	case change.Policy != nil && change.Action == manifest.ActionDelete:
+		err = apiClient.DeletePolicy(change.Name)
+	case change.Policy != nil:
+		err = apiClient.UploadPolicy(change.Name, change.Policy)
+	case change.Action == manifest.ActionDelete:
+		err = apiClient.RemoveVolume(change.Volume.Policy, change.Volume.Name, 0, false)
+	default:
+		_, err = apiClient.CreateVolume(change.Volume.Request())
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: done\n", change)
+	return nil
+}
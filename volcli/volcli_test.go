@@ -97,6 +97,36 @@ func (s *volcliSuite) TestErrorReturns(c *C) {
 			args: []string{"foo"},
 			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
 		},
+		"volumeResize": {
+			f:    volumeResize,
+			args: []string{"foo/bar"},
+			err:  errorInvalidArgCount(1, 2, []string{"foo/bar"}),
+		},
+		"volumeResizeInvalidPolicy": {
+			f:    volumeResize,
+			args: []string{"foo", "10GB"},
+			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
+		},
+		"volumeSnapshotRollback": {
+			f:    volumeSnapshotRollback,
+			args: []string{"foo/bar"},
+			err:  errorInvalidArgCount(1, 2, []string{"foo/bar"}),
+		},
+		"volumeSnapshotPrune": {
+			f:    volumeSnapshotPrune,
+			args: []string{"foo/bar", "baz"},
+			err:  errorInvalidArgCount(2, 1, []string{"foo/bar", "baz"}),
+		},
+		"volumeSnapshotResult": {
+			f:    volumeSnapshotResult,
+			args: []string{},
+			err:  errorInvalidArgCount(0, 1, []string{}),
+		},
+		"volumeSnapshotRollbackInvalidPolicy": {
+			f:    volumeSnapshotRollback,
+			args: []string{"foo", "snap"},
+			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
+		},
 		"volumeList": {
 			f:    volumeList,
 			args: []string{},
@@ -122,6 +152,11 @@ func (s *volcliSuite) TestErrorReturns(c *C) {
 			args: []string{"foo"},
 			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
 		},
+		"useVolsupervisor": {
+			f:    useVolsupervisor,
+			args: []string{"foo"},
+			err:  errorInvalidArgCount(1, 0, []string{"foo"}),
+		},
 		"useTheForce": {
 			f:    useTheForce,
 			args: []string{},
@@ -142,6 +177,36 @@ func (s *volcliSuite) TestErrorReturns(c *C) {
 			args: []string{"foo"},
 			err:  errorInvalidArgCount(1, 0, []string{"foo"}),
 		},
+		"policyDiffRevisions": {
+			f:    policyDiffRevisions,
+			args: []string{"foo"},
+			err:  errorInvalidArgCount(1, 2, []string{"foo"}),
+		},
+		"policyRollback": {
+			f:    policyRollback,
+			args: []string{"foo", "1", "2"},
+			err:  errorInvalidArgCount(3, 2, []string{"foo", "1", "2"}),
+		},
+		"apply": {
+			f:    apply,
+			args: []string{"foo"},
+			err:  errorInvalidArgCount(1, 0, []string{"foo"}),
+		},
+		"events": {
+			f:    events,
+			args: []string{"foo"},
+			err:  errorInvalidArgCount(1, 0, []string{"foo"}),
+		},
+		"auditList": {
+			f:    auditList,
+			args: []string{"foo"},
+			err:  errorInvalidArgCount(1, 0, []string{"foo"}),
+		},
+		"dbRestore": {
+			f:    dbRestore,
+			args: []string{},
+			err:  errorInvalidArgCount(0, 1, []string{}),
+		},
 	}
 
 	for key, test := range testMap {
@@ -0,0 +1,130 @@
+package consul
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db/impl/consul"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/volmigrate/backend"
+)
+
+// New creates a new consul migration engine.
+func New(prefix string, address string) *Engine {
+	return &Engine{
+		kv:     consul.NewKV(address),
+		prefix: prefix,
+	}
+}
+
+// Engine is a migration engine for a consul datastore.
+type Engine struct {
+	kv     *consul.KV
+	prefix string
+}
+
+// CurrentSchemaVersion returns the version of the last migration which was successfully run.
+// If no previous migrations have been run, the schema version is 0.
+// If there's any error besides "key doesn't exist", execution is aborted.
+func (e *Engine) CurrentSchemaVersion() int64 {
+	pair, err := e.kv.Get(path.Join(e.prefix, backend.SchemaVersionKey))
+	if err == errors.NotExists {
+		return 0 // no key = schema version 0
+	} else if err != nil {
+		logrus.Fatalf("Unexpected error when looking up schema version: %v\n", err)
+	}
+
+	i, err := strconv.Atoi(string(pair.Value))
+	if err != nil {
+		logrus.Fatalf("Got back unexpected schema version data: %v\n", string(pair.Value))
+	}
+
+	return int64(i)
+}
+
+// CreateDirectory creates a directory at the target path. Consul has no
+// directories; like its UI, we create a key with a trailing slash.
+func (e *Engine) CreateDirectory(target string) error {
+	fmt.Println("Creating directory: " + target)
+
+	if _, err := e.kv.Get(path.Join(e.prefix, target)); err == nil {
+		return errored.Errorf("Failed to create directory: %q is a key", target)
+	}
+
+	if err := e.kv.Put(path.Join(e.prefix, target)+"/", nil); err != nil {
+		return errored.Errorf("Failed to create directory: %s", err)
+	}
+
+	return nil
+}
+
+// CreateKey will create a key at the target location.
+func (e *Engine) CreateKey(target string, contents []byte) error {
+	fmt.Println("Creating key: " + target)
+
+	ok, err := e.kv.CAS(path.Join(e.prefix, target), contents, 0)
+	if err != nil {
+		return errored.Errorf("Failed to create key: %s", err)
+	}
+
+	if !ok {
+		return errored.Errorf("Failed to create key: %q already exists", target)
+	}
+
+	return nil
+}
+
+// DeleteDirectory will recursively delete a target directory.
+func (e *Engine) DeleteDirectory(target string) error {
+	fmt.Println("Deleting directory: " + target)
+
+	if _, err := e.kv.Get(path.Join(e.prefix, target)); err == nil {
+		return errored.Errorf("Failed to delete directory: %q is a key", target)
+	}
+
+	if err := e.kv.Delete(path.Join(e.prefix, target)+"/", true); err != nil {
+		return errored.Errorf("Failed to delete directory: %s", err)
+	}
+
+	return nil
+}
+
+// DeleteKey will delete the target key if it exists.
+func (e *Engine) DeleteKey(target string) error {
+	fmt.Println("Deleting key: " + target)
+
+	if err := e.kv.Delete(path.Join(e.prefix, target), false); err != nil {
+		return errored.Errorf("Failed to delete key: %s", err)
+	}
+
+	return nil
+}
+
+// Name returns the name of the engine ("etcd2", "etcd3", "consul", etc.)
+func (e *Engine) Name() string {
+	return "consul"
+}
+
+// UpdateSchemaVersion records the version number of the latest migration which successfully ran.
+// If the new version number is <= the current version number, it will log a fatal error.
+func (e *Engine) UpdateSchemaVersion(newVersion int64) error {
+	fmt.Printf("Updating schema version key to: %d\n", newVersion)
+
+	currentVersion := e.CurrentSchemaVersion()
+
+	// sanity check to make sure the version number is actually increasing
+	if newVersion <= currentVersion {
+		logrus.Fatalf("Cowardly refusing to update schema version to a version <= the current version.  Current: %d, Desired: %d\n", currentVersion, newVersion)
+	}
+
+	data := strconv.Itoa(int(newVersion))
+
+	if err := e.kv.Put(path.Join(e.prefix, backend.SchemaVersionKey), []byte(data)); err != nil {
+		return errored.Errorf("Failed to update schema version key to %d: %s", newVersion, err)
+	}
+
+	return nil
+}
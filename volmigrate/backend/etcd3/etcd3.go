@@ -0,0 +1,194 @@
+package etcd3
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db/impl/etcd3"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/volmigrate/backend"
+	"github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+// New creates a new etcd3 migration engine.
+func New(prefix string, etcdHosts []string) *Engine {
+	return &Engine{
+		kv:     etcd3.NewKV(etcdHosts),
+		prefix: "/" + strings.Trim(prefix, "/"),
+	}
+}
+
+// Engine is a migration engine for an etcd v3 datastore.
+type Engine struct {
+	kv     *etcd3.KV
+	prefix string
+}
+
+// CurrentSchemaVersion returns the version of the last migration which was successfully run.
+// If no previous migrations have been run, the schema version is 0.
+// If there's any error besides "key doesn't exist", execution is aborted.
+func (e *Engine) CurrentSchemaVersion() int64 {
+	kv, err := e.kv.Get(path.Join(e.prefix, backend.SchemaVersionKey))
+	if err == errors.NotExists {
+		return 0 // no key = schema version 0
+	} else if err != nil {
+		logrus.Fatalf("Unexpected error when looking up schema version: %v\n", err)
+	}
+
+	i, err := strconv.Atoi(string(kv.Value))
+	if err != nil {
+		logrus.Fatalf("Got back unexpected schema version data: %v\n", string(kv.Value))
+	}
+
+	return int64(i)
+}
+
+// CreateDirectory creates a directory at the target path. etcd v3 has no
+// directories, so this only checks that the path is not a key.
+func (e *Engine) CreateDirectory(target string) error {
+	fmt.Println("Creating directory: " + target)
+
+	if _, err := e.kv.Get(path.Join(e.prefix, target)); err == nil {
+		return errored.Errorf("Failed to create directory: %q is a key", target)
+	} else if err != errors.NotExists {
+		return errored.Errorf("Failed to create directory: %s", err)
+	}
+
+	return nil
+}
+
+// CreateKey will create a key at the target location.
+func (e *Engine) CreateKey(target string, contents []byte) error {
+	fmt.Println("Creating key: " + target)
+
+	key := []byte(path.Join(e.prefix, target))
+
+	ok, err := e.kv.Txn(&etcd3.TxnRequest{
+		Compare: []*etcd3.Compare{{Result: "EQUAL", Target: "CREATE", Key: key}},
+		Success: []*etcd3.Op{{Put: &etcd3.PutRequest{Key: key, Value: contents}}},
+	})
+	if err != nil {
+		return errored.Errorf("Failed to create key: %s", err)
+	}
+
+	if !ok {
+		return errored.Errorf("Failed to create key: %q already exists", target)
+	}
+
+	return nil
+}
+
+// DeleteDirectory will recursively delete a target directory.
+func (e *Engine) DeleteDirectory(target string) error {
+	fmt.Println("Deleting directory: " + target)
+
+	if _, err := e.kv.Get(path.Join(e.prefix, target)); err == nil {
+		return errored.Errorf("Failed to delete directory: %q is a key", target)
+	}
+
+	if err := e.kv.Delete(path.Join(e.prefix, target)+"/", true); err != nil {
+		return errored.Errorf("Failed to delete directory: %s", err)
+	}
+
+	return nil
+}
+
+// DeleteKey will delete the target key if it exists.
+func (e *Engine) DeleteKey(target string) error {
+	fmt.Println("Deleting key: " + target)
+
+	if err := e.kv.Delete(path.Join(e.prefix, target), false); err != nil {
+		return errored.Errorf("Failed to delete key: %s", err)
+	}
+
+	return nil
+}
+
+// Name returns the name of the engine ("etcd2", "etcd3", "consul", etc.)
+func (e *Engine) Name() string {
+	return "etcd3"
+}
+
+// UpdateSchemaVersion records the version number of the latest migration which successfully ran.
+// If the new version number is <= the current version number, it will log a fatal error.
+func (e *Engine) UpdateSchemaVersion(newVersion int64) error {
+	fmt.Printf("Updating schema version key to: %d\n", newVersion)
+
+	currentVersion := e.CurrentSchemaVersion()
+
+	// sanity check to make sure the version number is actually increasing
+	if newVersion <= currentVersion {
+		logrus.Fatalf("Cowardly refusing to update schema version to a version <= the current version.  Current: %d, Desired: %d\n", currentVersion, newVersion)
+	}
+
+	data := strconv.Itoa(int(newVersion))
+
+	if err := e.kv.Put(path.Join(e.prefix, backend.SchemaVersionKey), []byte(data), 0); err != nil {
+		return errored.Errorf("Failed to update schema version key to %d: %s", newVersion, err)
+	}
+
+	return nil
+}
+
+// ImportV2 copies the keyspace under the prefix from the etcd v2 store at
+// v2Hosts. Directories have no equivalent in etcd v3 and are skipped, as are
+// keys with a TTL: those are use locks and stats, which their holders
+// publish again. Keys which already exist in etcd v3 are left alone, so the
+// import can be run again after an interruption. It returns the number of
+// keys copied.
+func (e *Engine) ImportV2(v2Hosts []string) (int, error) {
+	ec, err := client.New(client.Config{Endpoints: v2Hosts})
+	if err != nil {
+		return 0, errored.Errorf("Failed to create etcd v2 client").Combine(err)
+	}
+
+	resp, err := client.NewKeysAPI(ec).Get(context.Background(), e.prefix, &client.GetOptions{Recursive: true, Sort: true, Quorum: true})
+	if err != nil {
+		return 0, errored.Errorf("Failed to read %q from etcd v2", e.prefix).Combine(errors.EtcdToErrored(err))
+	}
+
+	return e.importNode(resp.Node)
+}
+
+func (e *Engine) importNode(node *client.Node) (int, error) {
+	if node.Dir {
+		count := 0
+		for _, inner := range node.Nodes {
+			c, err := e.importNode(inner)
+			count += c
+			if err != nil {
+				return count, err
+			}
+		}
+
+		return count, nil
+	}
+
+	if node.TTL > 0 {
+		fmt.Println("Skipping key with TTL: " + node.Key)
+		return 0, nil
+	}
+
+	key := []byte(node.Key)
+
+	ok, err := e.kv.Txn(&etcd3.TxnRequest{
+		Compare: []*etcd3.Compare{{Result: "EQUAL", Target: "CREATE", Key: key}},
+		Success: []*etcd3.Op{{Put: &etcd3.PutRequest{Key: key, Value: []byte(node.Value)}}},
+	})
+	if err != nil {
+		return 0, errored.Errorf("Failed to import %q", node.Key).Combine(err)
+	}
+
+	if !ok {
+		fmt.Println("Skipping existing key: " + node.Key)
+		return 0, nil
+	}
+
+	fmt.Println("Imported key: " + node.Key)
+	return 1, nil
+}
@@ -18,10 +18,22 @@ var GlobalFlags = []cli.Flag{
 		Usage: "URL for etcd",
 		Value: &cli.StringSlice{"http://localhost:2379"},
 	},
+	cli.StringFlag{
+		Name:   "store",
+		Usage:  "URL of the data store, e.g. consul://localhost:8500; overrides --etcd",
+		EnvVar: "STORE",
+	},
 }
 
 // Commands is the data structure which describes the command hierarchy for volmigrate.
 var Commands = []cli.Command{
+	{
+		Name:        "import-etcd2",
+		ArgsUsage:   "",
+		Usage:       "Copies the keyspace from etcd v2 into etcd v3",
+		Description: "Copies the keyspace from the etcd v2 store given with --etcd into the etcd v3 store given with --store. Use locks and other keys with a TTL are not copied.",
+		Action:      ImportEtcd2,
+	},
 	{
 		Name:        "list",
 		ArgsUsage:   "",
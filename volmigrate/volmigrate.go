@@ -10,8 +10,11 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db/store"
 	"github.com/contiv/volplugin/volmigrate/backend"
+	"github.com/contiv/volplugin/volmigrate/backend/consul"
 	"github.com/contiv/volplugin/volmigrate/backend/etcd2"
+	"github.com/contiv/volplugin/volmigrate/backend/etcd3"
 )
 
 // -------------------------------------------------------------------------------------------------
@@ -41,6 +44,28 @@ func errorInvalidArgCount(rcvd, exptd int, args []string) error {
 
 // -------------------------------------------------------------------------------------------------
 
+// newBackend returns the migration engine for --store, or for --etcd if no
+// store was given.
+func newBackend(ctx *cli.Context) (backend.Backend, error) {
+	if ctx.GlobalString("store") == "" {
+		return etcd2.New(ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd")), nil
+	}
+
+	s, err := store.Parse(ctx.GlobalString("store"))
+	if err != nil {
+		return nil, err
+	}
+
+	switch s.Name {
+	case store.Consul:
+		return consul.New(ctx.GlobalString("prefix"), s.Hosts[0]), nil
+	case store.Etcd3:
+		return etcd3.New(ctx.GlobalString("prefix"), s.Hosts), nil
+	default:
+		return etcd2.New(ctx.GlobalString("prefix"), s.Hosts), nil
+	}
+}
+
 func promptBeforeRunning(ctx *cli.Context, msg string) {
 	if ctx.GlobalBool("silent") {
 		return
@@ -90,7 +115,10 @@ func RunMigrations(ctx *cli.Context) {
 }
 
 func runMigrations(ctx *cli.Context) (bool, error) {
-	e := etcd2.New(ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
+	e, err := newBackend(ctx)
+	if err != nil {
+		return false, err
+	}
 
 	if len(ctx.Args()) > 0 {
 		i, err := strconv.Atoi(ctx.Args()[0])
@@ -160,10 +188,46 @@ func showVersions(ctx *cli.Context) (bool, error) {
 		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
 	}
 
-	e := etcd2.New(ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
+	e, err := newBackend(ctx)
+	if err != nil {
+		return false, err
+	}
 
 	fmt.Printf("Current local schema version: %d\n", e.CurrentSchemaVersion())
 	fmt.Printf("Newest available schema version: %d\n", latestMigrationVersion)
 
 	return false, nil
 }
+
+// ImportEtcd2 copies the keyspace from the etcd v2 store given with --etcd
+// into the etcd v3 store given with --store.
+func ImportEtcd2(ctx *cli.Context) {
+	execCliAndExit(ctx, importEtcd2)
+}
+
+func importEtcd2(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 0 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+	}
+
+	e, err := newBackend(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	e3, ok := e.(*etcd3.Engine)
+	if !ok {
+		return true, errored.Errorf("--store must be an etcd3:// store to import into")
+	}
+
+	promptBeforeRunning(ctx, fmt.Sprintf("You have requested to copy %q from etcd v2 at %v to etcd v3.", ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd")))
+
+	count, err := e3.ImportV2(ctx.GlobalStringSlice("etcd"))
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf("Imported %d keys.\n", count)
+
+	return false, nil
+}
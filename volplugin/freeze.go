@@ -0,0 +1,285 @@
+package volplugin
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/watch"
+)
+
+// frozenVolume is a volume prepared for a consistent snapshot: its
+// pre-snapshot hook has run and its filesystem may be frozen. timer thaws it
+// once the freeze timeout passes. mutex serializes freezing and thawing it,
+// which may take as long as the hooks run.
+type frozenVolume struct {
+	mutex  sync.Mutex
+	freeze *config.Freeze
+	path   string
+	frozen bool
+	thawed bool
+	// expired is set if the timer thawed the volume.
+	expired bool
+	timer   *time.Timer
+}
+
+var (
+	frozen = map[string]*frozenVolume{}
+	// pendingFreezes are the freeze requests of each volume not handled yet;
+	// a goroutine per volume handles them in order while there are any.
+	pendingFreezes = map[string][]*watch.Watch{}
+	frozenMutex    = &sync.Mutex{}
+)
+
+// watchFreezes prepares the volumes mounted on this host for consistent
+// snapshots when volsupervisor asks to, and thaws them when it asks to,
+// removes the request or once the freeze timeout passes, whichever comes
+// first. Requests for different volumes are handled concurrently, so a slow
+// hook of one volume does not hold up the thaw of another.
+func (dc *DaemonConfig) watchFreezes() {
+	dc.thawStale()
+
+	activity := make(chan *watch.Watch)
+	dc.Client.WatchFreezes(activity)
+
+	for {
+		dc.queueFreeze(<-activity)
+	}
+}
+
+// queueFreeze queues the request for its volume, starting the goroutine
+// which handles them if it does not run.
+func (dc *DaemonConfig) queueFreeze(freezeWatch *watch.Watch) {
+	frozenMutex.Lock()
+	defer frozenMutex.Unlock()
+
+	volume := freezeWatch.Key
+	pendingFreezes[volume] = append(pendingFreezes[volume], freezeWatch)
+	if len(pendingFreezes[volume]) == 1 {
+		go dc.handleFreezes(volume)
+	}
+}
+
+// handleFreezes handles the queued requests of the volume until there are
+// none left.
+func (dc *DaemonConfig) handleFreezes(volume string) {
+	for {
+		frozenMutex.Lock()
+		freezeWatch := pendingFreezes[volume][0]
+		frozenMutex.Unlock()
+
+		dc.handleFreeze(freezeWatch)
+
+		frozenMutex.Lock()
+		pendingFreezes[volume] = pendingFreezes[volume][1:]
+		if len(pendingFreezes[volume]) == 0 {
+			delete(pendingFreezes, volume)
+			frozenMutex.Unlock()
+			return
+		}
+		frozenMutex.Unlock()
+	}
+}
+
+// handleFreeze freezes or thaws the volume as the request asks, and
+// publishes how it went.
+func (dc *DaemonConfig) handleFreeze(freezeWatch *watch.Watch) {
+	if freezeWatch.Config == nil {
+		dc.thaw(freezeWatch.Key)
+		frozenMutex.Lock()
+		delete(frozen, freezeWatch.Key)
+		frozenMutex.Unlock()
+		return
+	}
+
+	freeze, ok := freezeWatch.Config.(*config.Freeze)
+	if !ok || freeze.Hostname != dc.Hostname {
+		return
+	}
+
+	switch freeze.State {
+	case config.FreezeRequested:
+		dc.freeze(freeze)
+	case config.FreezeThaw:
+		dc.thawForSnapshot(freeze)
+	default:
+		return
+	}
+
+	if err := dc.Client.PublishFreeze(freeze); err != nil {
+		// volsupervisor has given up already; it will not ask for a thaw.
+		logrus.Errorf("Could not publish the freeze of volume %q: %v", freeze.Volume, err)
+		dc.thaw(freeze.Volume)
+	}
+}
+
+// freeze runs the pre-snapshot hook and freezes the filesystem of the
+// volume, setting the state of the freeze to how it went.
+func (dc *DaemonConfig) freeze(freeze *config.Freeze) {
+	freeze.State = config.FreezeFailed
+
+	mc, err := dc.API.MountCollection.Get(freeze.Volume)
+	if err != nil {
+		freeze.Error = err.Error()
+		return
+	}
+
+	frozenMutex.Lock()
+	if _, ok := frozen[freeze.Volume]; ok {
+		frozenMutex.Unlock()
+		freeze.Error = "Volume is already frozen"
+		return
+	}
+
+	// from here on, the post-snapshot hook runs on thaw whatever happens. The
+	// timer may thaw the volume while the freeze is published, so it keeps its
+	// own copy.
+	own := *freeze
+	fv := &frozenVolume{freeze: &own, path: mc.Path}
+	fv.mutex.Lock()
+	defer fv.mutex.Unlock()
+
+	frozen[freeze.Volume] = fv
+	frozenMutex.Unlock()
+
+	if freeze.PreHook != "" {
+		logrus.Infof("Running pre-snapshot hook of volume %q", freeze.Volume)
+		if err := dc.runHook(freeze.Volume, freeze.PreHook, freeze.HookTimeout); err != nil {
+			logrus.Errorf("Pre-snapshot hook of volume %q failed: %v", freeze.Volume, err)
+			freeze.HookError = err.Error()
+			return
+		}
+	}
+
+	if freeze.Filesystem {
+		logrus.Infof("Freezing volume %q at %q for at most %v", freeze.Volume, mc.Path, freeze.Timeout)
+
+		if err := storage.FreezeFilesystem(mc.Path, freeze.Timeout); err != nil {
+			logrus.Errorf("Could not freeze volume %q for a consistent snapshot: %v", freeze.Volume, err)
+			freeze.Error = err.Error()
+
+			// fsfreeze may have been killed after freezing the filesystem.
+			if thawErr := storage.ThawFilesystem(mc.Path, dc.Global.Timeout); thawErr != nil {
+				logrus.Debugf("Could not thaw volume %q after failing to freeze it: %v", freeze.Volume, thawErr)
+			}
+
+			return
+		}
+
+		fv.frozen = true
+	}
+
+	fv.timer = time.AfterFunc(freeze.Timeout, func() {
+		if dc.thawVolume(fv, true) {
+			logrus.Warnf("Freeze timeout of volume %q passed before the snapshot was done", freeze.Volume)
+		}
+	})
+
+	freeze.State = config.FreezeFrozen
+}
+
+// thawForSnapshot thaws the volume once volsupervisor has taken the
+// snapshot, setting the state of the freeze to how it went.
+func (dc *DaemonConfig) thawForSnapshot(freeze *config.Freeze) {
+	freeze.State = config.FreezeThawed
+	freeze.Error = ""
+	freeze.HookError = ""
+
+	fv := dc.thaw(freeze.Volume)
+	if fv == nil {
+		freeze.Error = "Volume was not frozen"
+		return
+	}
+
+	fv.mutex.Lock()
+	defer fv.mutex.Unlock()
+
+	freeze.Error = fv.freeze.Error
+	freeze.HookError = fv.freeze.HookError
+
+	if fv.expired {
+		freeze.Error = "Freeze timeout passed before the snapshot was done"
+	}
+}
+
+// thaw thaws the volume if it is frozen. It returns the frozen volume, if
+// any.
+func (dc *DaemonConfig) thaw(volume string) *frozenVolume {
+	frozenMutex.Lock()
+	fv, ok := frozen[volume]
+	frozenMutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	dc.thawVolume(fv, false)
+	return fv
+}
+
+// thawVolume thaws the filesystem of the volume if it is frozen and runs the
+// post-snapshot hook, once. It returns whether it did so this time.
+func (dc *DaemonConfig) thawVolume(fv *frozenVolume, expired bool) bool {
+	fv.mutex.Lock()
+	defer fv.mutex.Unlock()
+
+	if fv.thawed {
+		return false
+	}
+
+	fv.thawed = true
+	fv.expired = expired
+	fv.freeze.Error = ""
+	fv.freeze.HookError = ""
+
+	if fv.timer != nil {
+		fv.timer.Stop()
+	}
+
+	volume := fv.freeze.Volume
+
+	if fv.frozen {
+		logrus.Infof("Thawing volume %q at %q", volume, fv.path)
+
+		if err := storage.ThawFilesystem(fv.path, dc.Global.Timeout); err != nil {
+			logrus.Errorf("Could not thaw volume %q: %v", volume, err)
+			fv.freeze.Error = err.Error()
+		}
+	}
+
+	if fv.freeze.PostHook != "" {
+		logrus.Infof("Running post-snapshot hook of volume %q", volume)
+
+		if err := dc.runHook(volume, fv.freeze.PostHook, fv.freeze.HookTimeout); err != nil {
+			logrus.Errorf("Post-snapshot hook of volume %q failed: %v", volume, err)
+			fv.freeze.HookError = err.Error()
+		}
+	}
+
+	return true
+}
+
+// thawStale thaws the volumes mounted here which a previous run of volplugin
+// may have frozen and then lost track of.
+func (dc *DaemonConfig) thawStale() {
+	for _, mc := range dc.API.MountCollection.List() {
+		freeze, err := dc.Client.GetFreeze(mc.Volume.Name)
+		if err != nil || freeze.Hostname != dc.Hostname {
+			continue
+		}
+
+		logrus.Warnf("Thawing volume %q at %q, frozen before volplugin restarted", mc.Volume.Name, mc.Path)
+
+		if freeze.Filesystem {
+			if err := storage.ThawFilesystem(mc.Path, dc.Global.Timeout); err != nil {
+				logrus.Errorf("Could not thaw volume %q: %v", mc.Volume.Name, err)
+			}
+		}
+
+		if err := dc.Client.RemoveFreeze(mc.Volume.Name); err != nil {
+			logrus.Errorf("Could not remove the freeze of volume %q: %v", mc.Volume.Name, err)
+		}
+	}
+}
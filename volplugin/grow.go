@@ -0,0 +1,48 @@
+package volplugin
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/watch"
+)
+
+// watchGrows grows the filesystems of the volumes mounted on this host when
+// apiserver asks to, after it has resized them.
+func (dc *DaemonConfig) watchGrows() {
+	activity := make(chan *watch.Watch)
+	dc.Client.WatchGrows(activity)
+
+	for {
+		go dc.handleGrow(<-activity)
+	}
+}
+
+// handleGrow grows the filesystem of the volume as the request asks, and
+// publishes how it went.
+func (dc *DaemonConfig) handleGrow(growWatch *watch.Watch) {
+	grow, ok := growWatch.Config.(*config.Grow)
+	if !ok || grow.Hostname != dc.Hostname || grow.State != config.GrowRequested {
+		return
+	}
+
+	grow.State = config.GrowFailed
+
+	mc, err := dc.API.MountCollection.Get(grow.Volume)
+	if err != nil {
+		grow.Error = err.Error()
+	} else {
+		logrus.Infof("Growing filesystem of volume %q at %q", grow.Volume, mc.Path)
+
+		if err := storage.GrowFilesystem(grow.FileSystem, mc.Device, mc.Path, grow.Timeout); err != nil {
+			logrus.Errorf("Could not grow filesystem of volume %q: %v", grow.Volume, err)
+			grow.Error = err.Error()
+		} else {
+			grow.State = config.GrowDone
+		}
+	}
+
+	if err := dc.Client.PublishGrow(grow); err != nil {
+		logrus.Errorf("Could not publish the grow of volume %q: %v", grow.Volume, err)
+	}
+}
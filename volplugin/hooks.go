@@ -0,0 +1,134 @@
+package volplugin
+
+import (
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/docker/engine-api/client"
+	"github.com/docker/engine-api/types"
+)
+
+// hookOutputLimit is how much of the end of the output of a failed hook is
+// kept in its error.
+const hookOutputLimit = 512
+
+// runHook runs a snapshot hook with /bin/sh in each running container using
+// the volume, through the docker API. It fails if the hook fails in any of
+// them, or does not finish within the timeout.
+func (dc *DaemonConfig) runHook(volume, hook string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	dockerClient, err := client.NewEnvClient()
+	if err != nil {
+		return errors.SnapshotHook.Combine(errored.Errorf("Could not initiate docker client").Combine(err))
+	}
+
+	containers, err := dockerClient.ContainerList(ctx, types.ContainerListOptions{})
+	if err != nil {
+		return errors.SnapshotHook.Combine(errored.Errorf("Could not query docker").Combine(err))
+	}
+
+	for _, container := range containers {
+		if container.State != "running" || !dc.usesVolume(container, volume) {
+			continue
+		}
+
+		if err := execHook(ctx, dockerClient, container.ID, hook); err != nil {
+			return errors.SnapshotHook.Combine(errored.Errorf("Running %q in container %s", hook, shortID(container.ID)).Combine(err))
+		}
+	}
+
+	return nil
+}
+
+func (dc *DaemonConfig) usesVolume(container types.Container, volume string) bool {
+	for _, mount := range container.Mounts {
+		if mount.Driver == dc.PluginName && mount.Name == volume {
+			return true
+		}
+	}
+
+	return false
+}
+
+// execHook runs the hook in the container and waits for it to exit.
+func execHook(ctx context.Context, dockerClient *client.Client, id, hook string) error {
+	execConfig := types.ExecConfig{
+		Cmd:          []string{"/bin/sh", "-c", hook},
+		AttachStdout: true,
+		AttachStderr: true,
+		// with a TTY, stdout and stderr come as they are instead of multiplexed.
+		Tty: true,
+	}
+
+	exec, err := dockerClient.ContainerExecCreate(ctx, id, execConfig)
+	if err != nil {
+		return err
+	}
+
+	resp, err := dockerClient.ContainerExecAttach(ctx, exec.ID, execConfig)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	// the connection outlives the context unless it is closed.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			resp.Close()
+		case <-done:
+		}
+	}()
+
+	output, err := ioutil.ReadAll(resp.Reader)
+	if ctx.Err() != nil {
+		return errored.Errorf("Timed out")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for {
+		inspect, err := dockerClient.ContainerExecInspect(ctx, exec.ID)
+		if err != nil {
+			return err
+		}
+
+		if !inspect.Running {
+			if inspect.ExitCode != 0 {
+				return errored.Errorf("Exit status %d: %s", inspect.ExitCode, tail(string(output), hookOutputLimit))
+			}
+
+			return nil
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+
+	return id
+}
+
+func tail(output string, limit int) string {
+	output = strings.TrimSpace(output)
+	if len(output) > limit {
+		return "..." + output[len(output)-limit:]
+	}
+
+	return output
+}
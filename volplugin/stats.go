@@ -0,0 +1,46 @@
+package volplugin
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/storage"
+	"github.com/jbeda/go-wait"
+)
+
+// reportStats periodically publishes the filesystem usage of every volume in
+// the mount collection. The records expire after the global TTL, so they
+// vanish if this volplugin goes away.
+func (dc *DaemonConfig) reportStats() {
+	for {
+		time.Sleep(wait.Jitter(dc.Global.TTL/4, 0))
+
+		for _, mc := range dc.API.MountCollection.List() {
+			if err := dc.publishStats(mc); err != nil {
+				logrus.Errorf("Could not report stats for volume %q: %v", mc.Volume.Name, err)
+			}
+		}
+	}
+}
+
+func (dc *DaemonConfig) publishStats(mc *storage.Mount) error {
+	policy, volume, err := storage.SplitName(mc.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	fsStats, err := storage.FilesystemStats(mc.Path)
+	if err != nil {
+		return err
+	}
+
+	ms := &config.MountStats{
+		Hostname:   dc.Hostname,
+		Mountpoint: mc.Path,
+		Filesystem: *fsStats,
+		Updated:    time.Now(),
+	}
+
+	return dc.Client.PublishMountStats(&config.Volume{PolicyName: policy, VolumeName: volume}, ms, dc.Global.TTL)
+}
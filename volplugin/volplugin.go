@@ -13,8 +13,10 @@ import (
 	"github.com/codegangsta/cli"
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/api/impl/csi"
 	"github.com/contiv/volplugin/api/impl/docker"
 	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/db/store"
 	"github.com/contiv/volplugin/info"
 	"github.com/contiv/volplugin/watch"
 	"github.com/jbeda/go-wait"
@@ -25,19 +27,23 @@ const basePath = "/run/docker/plugins"
 // DaemonConfig is the top-level configuration for the daemon. It is used by
 // the cli package in volplugin/volplugin.
 type DaemonConfig struct {
-	Hostname   string
-	Global     *config.Global
-	Client     *config.Client
-	API        *api.API
-	PluginName string
+	Hostname    string
+	Global      *config.Global
+	Client      *config.Client
+	API         *api.API
+	PluginName  string
+	DebugListen string
+	// CSISocket is the unix socket the CSI services are served on, instead
+	// of the docker plugin API, if it is set.
+	CSISocket string
+	Version   string
 }
 
 // NewDaemonConfig creates a DaemonConfig from the master host and hostname
 // arguments.
 func NewDaemonConfig(ctx *cli.Context) *DaemonConfig {
-
 retry:
-	client, err := config.NewClient(ctx.String("prefix"), ctx.StringSlice("etcd"))
+	client, err := store.NewConfigClient(ctx.String("store"), ctx.String("prefix"), ctx.StringSlice("etcd"))
 	if err != nil {
 		logrus.Warn("Could not establish client to etcd cluster: %v. Retrying.", err)
 		time.Sleep(wait.Jitter(time.Second, 0))
@@ -45,9 +51,12 @@ retry:
 	}
 
 	dc := &DaemonConfig{
-		Hostname:   ctx.String("host-label"),
-		Client:     client,
-		PluginName: ctx.String("plugin-name"),
+		Hostname:    ctx.String("host-label"),
+		Client:      client,
+		PluginName:  ctx.String("plugin-name"),
+		DebugListen: ctx.String("debug-listen"),
+		CSISocket:   ctx.String("csi-socket"),
+		Version:     ctx.App.Version,
 	}
 
 	if dc.PluginName == "" || strings.Contains(dc.PluginName, "/") {
@@ -74,6 +83,7 @@ func (dc *DaemonConfig) Daemon() error {
 	}
 
 	go info.HandleDebugSignal()
+	go info.ServeDebug(dc.DebugListen)
 
 	activity := make(chan *watch.Watch)
 	dc.Client.WatchGlobal(activity)
@@ -93,11 +103,18 @@ func (dc *DaemonConfig) Daemon() error {
 
 	dc.API = api.NewAPI(docker.NewVolplugin(), dc.Hostname, dc.Client, &dc.Global)
 
+	if dc.CSISocket != "" {
+		return dc.serveCSI()
+	}
+
 	if err := dc.updateMounts(); err != nil {
 		return err
 	}
 
 	go dc.pollRuntime()
+	go dc.reportStats()
+	go dc.watchFreezes()
+	go dc.watchGrows()
 
 	driverPath := path.Join(basePath, fmt.Sprintf("%s.sock", dc.PluginName))
 	if err := os.Remove(driverPath); err != nil && !os.IsNotExist(err) {
@@ -120,3 +137,21 @@ func (dc *DaemonConfig) Daemon() error {
 	l.Close()
 	return os.Remove(driverPath)
 }
+
+// serveCSI serves the CSI services instead of the docker plugin API. The
+// volumes staged by the CSI node service are reported, frozen and grown like
+// docker mounts; docker's runtime is not polled.
+func (dc *DaemonConfig) serveCSI() error {
+	if err := os.MkdirAll(path.Dir(dc.CSISocket), 0700); err != nil {
+		return err
+	}
+
+	srv := csi.NewServer(dc.Hostname, dc.Version, dc.Client, &dc.Global)
+	srv.MountCollection = dc.API.MountCollection
+
+	go dc.reportStats()
+	go dc.watchFreezes()
+	go dc.watchGrows()
+
+	return srv.Serve(dc.CSISocket)
+}
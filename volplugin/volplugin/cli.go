@@ -41,12 +41,27 @@ func main() {
 			Usage: "URL for etcd",
 			Value: &cli.StringSlice{"http://localhost:2379"},
 		},
+		cli.StringFlag{
+			Name:   "store",
+			Usage:  "URL of the data store, e.g. consul://localhost:8500; overrides --etcd",
+			EnvVar: "STORE",
+		},
 		cli.StringFlag{
 			Name:   "host-label",
 			Usage:  "Set the internal hostname",
 			EnvVar: "HOSTLABEL",
 			Value:  host,
 		},
+		cli.StringFlag{
+			Name:   "csi-socket",
+			Usage:  "unix socket to serve the CSI services on, instead of the docker plugin API",
+			EnvVar: "CSI_SOCKET",
+		},
+		cli.StringFlag{
+			Name:   "debug-listen",
+			Usage:  "listen address for the debug endpoint serving /metrics; disabled if empty",
+			EnvVar: "DEBUG_LISTEN",
+		},
 	}
 	app.Action = run
 
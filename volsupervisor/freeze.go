@@ -0,0 +1,127 @@
+package volsupervisor
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+)
+
+// freezePoll is how often the state of a freeze is checked while waiting for
+// volplugin.
+const freezePoll = 100 * time.Millisecond
+
+// freeze asks the volplugin mounting the volume to run its pre-snapshot hook
+// and freeze its filesystem, and waits until it has. The returned function
+// thaws the volume again, running the post-snapshot hook, and returns what
+// went wrong doing so; it is never nil, even on errors. A failed pre-snapshot
+// hook is an errors.SnapshotHook. Volumes which are not mounted need no
+// freezing.
+func (dc *DaemonConfig) freeze(val *config.Volume) (func() []string, error) {
+	noop := func() []string { return nil }
+	sc := val.RuntimeOptions.Snapshot
+
+	timeout, err := sc.ParseFreezeTimeout()
+	if err != nil {
+		return noop, err
+	}
+
+	hookTimeout, err := sc.ParseHookTimeout()
+	if err != nil {
+		return noop, err
+	}
+
+	mount := &config.UseMount{}
+	if err := dc.Config.GetUse(mount, val); err != nil {
+		if er, ok := err.(*errored.Error); ok && er.Contains(errors.NotExists) {
+			return noop, nil
+		}
+
+		return noop, err
+	}
+
+	freeze := &config.Freeze{
+		Volume:      val.String(),
+		Hostname:    mount.Hostname,
+		Timeout:     timeout,
+		Filesystem:  sc.Consistent,
+		PreHook:     sc.PreHook,
+		PostHook:    sc.PostHook,
+		HookTimeout: hookTimeout,
+	}
+
+	if err := dc.Config.RequestFreeze(freeze); err != nil {
+		return noop, err
+	}
+
+	// removing the freeze makes volplugin thaw the volume too, but without
+	// telling how it went.
+	remove := func() []string {
+		if err := dc.Config.RemoveFreeze(val.String()); err != nil {
+			logrus.Errorf("Could not remove the freeze of volume %q: %v", val, err)
+		}
+
+		return nil
+	}
+
+	thaw := func() []string {
+		defer remove()
+
+		freeze.State = config.FreezeThaw
+		if err := dc.Config.PublishFreeze(freeze); err != nil {
+			return []string{errored.Errorf("Could not thaw the volume").Combine(err).Error()}
+		}
+
+		thawed, err := dc.waitFreeze(val.String(), hookTimeout+timeout, config.FreezeThawed)
+		if err != nil {
+			return []string{errored.Errorf("volplugin on host %q did not thaw the volume", mount.Hostname).Combine(err).Error()}
+		}
+
+		warnings := []string{}
+		if thawed.Error != "" {
+			warnings = append(warnings, "Thawing the volume: "+thawed.Error)
+		}
+
+		if thawed.HookError != "" {
+			warnings = append(warnings, "Post-snapshot hook: "+thawed.HookError)
+		}
+
+		return warnings
+	}
+
+	frozen, err := dc.waitFreeze(val.String(), hookTimeout+timeout, config.FreezeFrozen, config.FreezeFailed)
+	switch {
+	case err != nil:
+		return remove, errored.Errorf("volplugin on host %q did not freeze the volume", mount.Hostname).Combine(err)
+	case frozen.HookError != "":
+		return thaw, errors.SnapshotHook.Combine(errored.Errorf("Pre-snapshot hook on host %q: %s", mount.Hostname, frozen.HookError))
+	case frozen.State == config.FreezeFailed:
+		return thaw, errored.Errorf("volplugin on host %q could not freeze the volume: %s", mount.Hostname, frozen.Error)
+	}
+
+	return thaw, nil
+}
+
+// waitFreeze waits until volplugin sets the freeze of the volume to one of
+// the states, at most for the timeout.
+func (dc *DaemonConfig) waitFreeze(volume string, timeout time.Duration, states ...string) (*config.Freeze, error) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(freezePoll)
+
+		freeze, err := dc.Config.GetFreeze(volume)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, state := range states {
+			if freeze.State == state {
+				return freeze, nil
+			}
+		}
+	}
+
+	return nil, errored.Errorf("Timed out after %v", timeout)
+}
@@ -0,0 +1,202 @@
+package volsupervisor
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	wait "github.com/jbeda/go-wait"
+
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/metrics"
+)
+
+// leaderPoll is how often a resigning volsupervisor checks whether its lock
+// has been released.
+const leaderPoll = 100 * time.Millisecond
+
+var leaderGauge = metrics.NewGaugeVec("volplugin_volsupervisor_leader", "1 if this volsupervisor leads and takes snapshots, 0 if it stands by.")
+
+// lead blocks until this volsupervisor holds the volsupervisor lock, standing
+// by while another one does. Standbys retry every quarter of the TTL, so they
+// take over within about the TTL once the leader stops refreshing the lock.
+// Afterwards, it keeps checking that it still holds the lock and steps down
+// to stand by again if it does not.
+func (dc *DaemonConfig) lead() {
+	dc.use = &config.UseVolsupervisor{Hostname: dc.Hostname, Started: time.Now().UTC()}
+	leaderGauge.Set(0)
+
+	dc.acquireLeadership()
+	go dc.keepLeadership()
+}
+
+// acquireLeadership blocks until this volsupervisor acquires the
+// volsupervisor lock or resigns.
+func (dc *DaemonConfig) acquireLeadership() {
+	standby := false
+
+	for {
+		dc.leaderMutex.Lock()
+		if dc.resigned {
+			dc.leaderMutex.Unlock()
+			return
+		}
+
+		stopChan, err := lock.NewDriver(dc.Config).AcquireWithTTLRefresh(dc.use, dc.Global.TTL, dc.Global.Timeout)
+		if err == nil {
+			// without leases, the lock is acquired without a TTL; put one on
+			// right away so it cannot outlive us if we die before the first
+			// refresh. With leases, it expires with its lease already, and
+			// publishing it again would move it to a lease nobody keeps alive.
+			if !dc.Config.SupportsLeases() {
+				if err := dc.Config.PublishUseWithTTL(dc.use, dc.Global.TTL); err != nil {
+					logrus.Errorf("Could not set the TTL of the volsupervisor lock: %v", err)
+				}
+			}
+
+			dc.stopChan = stopChan
+			dc.leading = true
+			dc.leaderMutex.Unlock()
+
+			leaderGauge.Set(1)
+			logrus.Infof("Acquired the volsupervisor lock; leading on host %q", dc.Hostname)
+			return
+		}
+		dc.leaderMutex.Unlock()
+
+		if !standby {
+			standby = true
+			if leader, err := dc.Config.GetVolsupervisorUse(); err == nil {
+				logrus.Infof("volsupervisor on host %q leads since %v; standing by", leader.Hostname, leader.Started)
+			} else {
+				logrus.Infof("Could not acquire the volsupervisor lock; standing by")
+			}
+		}
+
+		time.Sleep(wait.Jitter(dc.Global.TTL/4, 0))
+	}
+}
+
+// keepLeadership steps down if another volsupervisor took the lock over, or
+// if this one could not confirm it holds the lock for longer than the TTL,
+// e.g. because it lost its connection to etcd. It then stands by again.
+func (dc *DaemonConfig) keepLeadership() {
+	confirmed := time.Now()
+
+	for {
+		time.Sleep(wait.Jitter(dc.Global.TTL/4, 0))
+
+		if !dc.leads() {
+			return
+		}
+
+		leader, err := dc.Config.GetVolsupervisorUse()
+		switch {
+		case err == nil && dc.owns(leader):
+			confirmed = time.Now()
+			continue
+		case err == nil:
+			logrus.Errorf("volsupervisor on host %q took the volsupervisor lock over; standing by", leader.Hostname)
+		case time.Since(confirmed) > dc.Global.TTL:
+			logrus.Errorf("Could not confirm holding the volsupervisor lock for %v: %v; standing by", dc.Global.TTL, err)
+		default:
+			logrus.Warnf("Could not check the volsupervisor lock: %v", err)
+			continue
+		}
+
+		dc.stepDown()
+		dc.acquireLeadership()
+		confirmed = time.Now()
+	}
+}
+
+// stepDown stops taking snapshots and refreshing the volsupervisor lock,
+// which is removed if this volsupervisor still holds it.
+func (dc *DaemonConfig) stepDown() {
+	dc.leaderMutex.Lock()
+	defer dc.leaderMutex.Unlock()
+
+	if !dc.leading {
+		return
+	}
+
+	dc.leading = false
+	dc.stopChan <- struct{}{}
+	leaderGauge.Set(0)
+}
+
+// resign hands the volsupervisor lock off: it stops starting snapshot
+// operations, waits for the running ones, and releases the lock so a standby
+// takes over right away instead of once the lock expires. Each wait takes at
+// most the global timeout.
+func (dc *DaemonConfig) resign() {
+	dc.leaderMutex.Lock()
+	dc.resigned = true
+	leading := dc.leading
+	dc.leaderMutex.Unlock()
+
+	if !leading {
+		return
+	}
+
+	// snapshots started before are still covered by the lock until they finish.
+	done := make(chan struct{})
+	go func() {
+		dc.operations.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(dc.Global.Timeout):
+		logrus.Warnf("Snapshot operations still running after %v; handing the volsupervisor lock off anyway", dc.Global.Timeout)
+	}
+
+	dc.stepDown()
+
+	deadline := time.Now().Add(dc.Global.Timeout)
+	for time.Now().Before(deadline) {
+		leader, err := dc.Config.GetVolsupervisorUse()
+		if err != nil || !dc.owns(leader) {
+			logrus.Info("Released the volsupervisor lock")
+			return
+		}
+
+		time.Sleep(leaderPoll)
+	}
+
+	logrus.Warnf("Could not release the volsupervisor lock within %v; standbys take over once it expires", dc.Global.Timeout)
+}
+
+// leads returns whether this volsupervisor holds the volsupervisor lock.
+func (dc *DaemonConfig) leads() bool {
+	dc.leaderMutex.Lock()
+	defer dc.leaderMutex.Unlock()
+
+	return dc.leading && !dc.resigned
+}
+
+// owns returns whether the volsupervisor lock is the one of this
+// volsupervisor.
+func (dc *DaemonConfig) owns(leader *config.UseVolsupervisor) bool {
+	return leader.Hostname == dc.use.Hostname && leader.Started.Equal(dc.use.Started)
+}
+
+// operate runs f in a goroutine if this volsupervisor leads, so resign can
+// wait for it. It returns whether it did.
+func (dc *DaemonConfig) operate(f func()) bool {
+	dc.leaderMutex.Lock()
+	defer dc.leaderMutex.Unlock()
+
+	if !dc.leading || dc.resigned {
+		return false
+	}
+
+	dc.operations.Add(1)
+	go func() {
+		defer dc.operations.Done()
+		f()
+	}()
+
+	return true
+}
@@ -0,0 +1,67 @@
+package volsupervisor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/db/impl/etcd3"
+
+	. "gopkg.in/check.v1"
+)
+
+// leaderSuite leads with a lease, which requires etcd 3.4 or later. It is
+// skipped unless ETCD3_HOSTS points at one, e.g.
+// ETCD3_HOSTS=http://127.0.0.1:2379.
+type leaderSuite struct {
+	kv     *etcd3.KV
+	client *config.Client
+}
+
+var _ = Suite(&leaderSuite{})
+
+func (s *leaderSuite) SetUpSuite(c *C) {
+	if os.Getenv("ETCD3_HOSTS") == "" {
+		c.Skip("ETCD3_HOSTS is not set")
+	}
+
+	hosts := strings.Split(os.Getenv("ETCD3_HOSTS"), ",")
+	keysAPI, err := etcd3.NewKeysAPI(hosts)
+	if err != nil {
+		c.Skip(fmt.Sprintf("etcd v3 is unreachable at %v: %v", hosts, err))
+	}
+
+	s.kv = etcd3.NewKV(hosts)
+	s.client = config.NewClientFromKeysAPI("/volplugin-leader-test", keysAPI)
+	c.Assert(s.client.SupportsLeases(), Equals, true)
+}
+
+func (s *leaderSuite) SetUpTest(c *C) {
+	c.Assert(s.kv.Delete("/volplugin-leader-test", true), IsNil)
+}
+
+func (s *leaderSuite) TestLeaseOutlivesTTL(c *C) {
+	global := config.NewGlobalConfig()
+	global.TTL = time.Second
+	global.Timeout = 5 * time.Second
+
+	dc := &DaemonConfig{Global: global, Config: s.client, Hostname: "leader"}
+	dc.lead()
+	c.Assert(dc.leads(), Equals, true)
+
+	// the lock must not expire, not even briefly, while it is kept alive.
+	for deadline := time.Now().Add(3 * global.TTL); time.Now().Before(deadline); time.Sleep(global.TTL / 10) {
+		leader, err := s.client.GetVolsupervisorUse()
+		c.Assert(err, IsNil)
+		c.Assert(dc.owns(leader), Equals, true)
+	}
+
+	c.Assert(dc.leads(), Equals, true)
+
+	// releasing the lease removes the lock.
+	dc.resign()
+	_, err := s.client.GetVolsupervisorUse()
+	c.Assert(err, NotNil)
+}
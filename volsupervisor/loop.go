@@ -6,9 +6,11 @@ import (
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/config"
 	"github.com/contiv/volplugin/errors"
 	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/metrics"
 	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/storage/backend"
 )
@@ -16,8 +18,26 @@ import (
 var (
 	volumes     = map[string]*config.Volume{}
 	volumeMutex = &sync.Mutex{}
+
+	snapshotOps = metrics.NewCounterVec("volplugin_volsupervisor_snapshot_operations_total", "Scheduled snapshot creations and prunes, by result.", "operation", "result")
+)
+
+const (
+	opCreate = "create"
+	opPrune  = "prune"
 )
 
+// recordSnapshotOp counts a snapshot operation as a failure if err is not
+// nil, and a success otherwise.
+func recordSnapshotOp(operation string, err error) {
+	if err != nil {
+		snapshotOps.Inc(operation, "failure")
+		return
+	}
+
+	snapshotOps.Inc(operation, "success")
+}
+
 func (dc *DaemonConfig) updateVolumes() {
 	myVolumes, err := dc.Config.ListAllVolumes()
 	if err != nil {
@@ -58,6 +78,9 @@ func (dc *DaemonConfig) pruneSnapshots(val *config.Volume) {
 		Reason: lock.ReasonSnapshotPrune,
 	}
 
+	var err error
+	defer func() { recordSnapshotOp(opPrune, err) }()
+
 	stopChan, err := lock.NewDriver(dc.Config).AcquireWithTTLRefresh(uc, dc.Global.TTL, dc.Global.Timeout)
 	if err != nil {
 		logrus.Error(errors.LockFailed.Combine(err))
@@ -72,38 +95,58 @@ func (dc *DaemonConfig) pruneSnapshots(val *config.Volume) {
 		return
 	}
 
-	driverOpts := storage.DriverOptions{
+	driverOpts := snapshotDriverOptions(val, dc.Global.Timeout)
+
+	err = applyRetention(val, driver, driverOpts, time.Now())
+}
+
+// snapshotDriverOptions returns the driver options scheduled snapshots and
+// prunes of the volume use. The drivers find the volume through all of its
+// driver options, e.g. the lvm group and pool or the loopback path.
+func snapshotDriverOptions(val *config.Volume, timeout time.Duration) storage.DriverOptions {
+	return storage.DriverOptions{
 		Volume: storage.Volume{
-			Name: val.String(),
-			Params: storage.Params{
-				"pool": val.DriverOptions["pool"],
-			},
+			Name:   val.String(),
+			Params: val.DriverOptions,
 		},
-		Timeout: dc.Global.Timeout,
+		Timeout: timeout,
 	}
+}
 
+// applyRetention removes the snapshots of the volume its retention does not
+// keep at now.
+func applyRetention(val *config.Volume, driver storage.SnapshotDriver, driverOpts storage.DriverOptions, now time.Time) error {
 	list, err := driver.ListSnapshots(driverOpts)
 	if err != nil {
 		logrus.Errorf("Could not list snapshots for volume %q: %v", val.VolumeName, err)
-		return
+		return err
 	}
 
-	logrus.Debugf("Volume %q: keeping %d snapshots", val, val.RuntimeOptions.Snapshot.Keep)
-
-	toDeleteCount := len(list) - int(val.RuntimeOptions.Snapshot.Keep)
-	if toDeleteCount < 0 {
-		return
+	verdicts, err := val.RuntimeOptions.Snapshot.Retain(list, now)
+	if err != nil {
+		logrus.Errorf("Could not apply the snapshot retention of volume %q: %v", val.VolumeName, err)
+		return err
 	}
 
-	for i := 0; i < toDeleteCount; i++ {
-		logrus.Infof("Removing snapshot %q for volume %q", list[i], val.VolumeName)
-		if err := driver.RemoveSnapshot(list[i], driverOpts); err != nil {
-			logrus.Errorf("Removing snapshot %q for volume %q failed: %v", list[i], val.VolumeName, err)
+	for _, verdict := range verdicts {
+		if verdict.Keep {
+			logrus.Debugf("Keeping snapshot %q for volume %q: %v", verdict.Name, val.VolumeName, verdict.Reasons)
+			continue
+		}
+
+		logrus.Infof("Removing snapshot %q for volume %q", verdict.Name, val.VolumeName)
+		if rmErr := driver.RemoveSnapshot(verdict.Name, driverOpts); rmErr != nil {
+			logrus.Errorf("Removing snapshot %q for volume %q failed: %v", verdict.Name, val.VolumeName, rmErr)
+			err = rmErr
 		}
 	}
+
+	return err
 }
 
-func (dc *DaemonConfig) createSnapshot(val *config.Volume) {
+// createSnapshot snapshots the volume and records the outcome. It returns an
+// error if no snapshot was taken.
+func (dc *DaemonConfig) createSnapshot(val *config.Volume) (err error) {
 	logrus.Infof("Snapshotting %q.", val)
 
 	uc := &config.UseSnapshot{
@@ -111,10 +154,16 @@ func (dc *DaemonConfig) createSnapshot(val *config.Volume) {
 		Reason: lock.ReasonSnapshot,
 	}
 
+	result := &config.SnapshotResult{Time: time.Now()}
+	defer func() {
+		recordSnapshotOp(opCreate, err)
+		dc.publishSnapshotResult(val, result, err)
+	}()
+
 	stopChan, err := lock.NewDriver(dc.Config).AcquireWithTTLRefresh(uc, dc.Global.TTL, dc.Global.Timeout)
 	if err != nil {
 		logrus.Error(err)
-		return
+		return err
 	}
 
 	defer func() { stopChan <- struct{}{} }()
@@ -122,28 +171,97 @@ func (dc *DaemonConfig) createSnapshot(val *config.Volume) {
 	driver, err := backend.NewSnapshotDriver(val.Backends.Snapshot)
 	if err != nil {
 		logrus.Errorf("Error establishing driver backend %q; cannot snapshot", val.Backends.Snapshot)
-		return
+		return err
 	}
 
-	driverOpts := storage.DriverOptions{
-		Volume: storage.Volume{
-			Name: val.String(),
-			Params: storage.Params{
-				"pool": val.DriverOptions["pool"],
-			},
-		},
-		Timeout: dc.Global.Timeout,
+	driverOpts := snapshotDriverOptions(val, dc.Global.Timeout)
+
+	if err = dc.checkSnapshotQuota(val, driver, driverOpts); err != nil {
+		logrus.Errorf("Not snapshotting volume %q: %v", val, err)
+		return err
 	}
 
-	if err := driver.CreateSnapshot(time.Now().String(), driverOpts); err != nil {
+	sc := val.RuntimeOptions.Snapshot
+	if sc.Consistent || sc.PreHook != "" || sc.PostHook != "" {
+		thaw, freezeErr := dc.freeze(val)
+		defer func() { result.Warnings = append(result.Warnings, thaw()...) }()
+
+		if freezeErr != nil {
+			if er, ok := freezeErr.(*errored.Error); ok && er.Contains(errors.SnapshotHook) {
+				err = freezeErr
+				logrus.Errorf("Not snapshotting volume %q: %v", val, err)
+				return err
+			}
+
+			logrus.Errorf("Could not freeze volume %q, taking a crash-consistent snapshot instead: %v", val, freezeErr)
+			result.Warnings = append(result.Warnings, "Crash-consistent snapshot: "+freezeErr.Error())
+		}
+	}
+
+	result.Snapshot, err = takeSnapshot(val, driver, driverOpts, time.Now())
+	return err
+}
+
+// takeSnapshot takes a snapshot of the volume named after now, and returns
+// its name.
+func takeSnapshot(val *config.Volume, driver storage.SnapshotDriver, driverOpts storage.DriverOptions, now time.Time) (string, error) {
+	name := config.SnapshotName(now)
+	if err := driver.CreateSnapshot(name, driverOpts); err != nil {
 		logrus.Errorf("Error creating snapshot for volume %q: %v", val, err)
+		return "", err
+	}
+
+	return name, nil
+}
+
+// publishSnapshotResult records the outcome of a snapshot, so failed hooks
+// and the like do not go unnoticed.
+func (dc *DaemonConfig) publishSnapshotResult(val *config.Volume, result *config.SnapshotResult, err error) {
+	result.Success = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	for _, warning := range result.Warnings {
+		logrus.Warnf("Snapshot of volume %q: %s", val, warning)
+	}
+
+	if err := dc.Config.PublishSnapshotResult(val.PolicyName, val.VolumeName, result); err != nil {
+		logrus.Errorf("Could not record the snapshot result of volume %q: %v", val, err)
 	}
 }
 
+// checkSnapshotQuota returns errors.QuotaExceeded if the volume has as many
+// snapshots as the quota of its policy allows.
+func (dc *DaemonConfig) checkSnapshotQuota(val *config.Volume, driver storage.SnapshotDriver, driverOpts storage.DriverOptions) error {
+	policy, err := dc.Config.GetPolicy(val.PolicyName)
+	if err != nil {
+		return err
+	}
+
+	if policy.Quota == nil || policy.Quota.Snapshots == 0 {
+		return nil
+	}
+
+	list, err := driver.ListSnapshots(driverOpts)
+	if err != nil {
+		return err
+	}
+
+	return policy.Quota.CheckSnapshot(len(list))
+}
+
 func (dc *DaemonConfig) loop() {
 	for {
 		time.Sleep(time.Second)
 
+		// only the leader takes snapshots. The leader records its runs, so the
+		// schedules are worked out afresh from them once leading again.
+		if !dc.leads() {
+			schedules = map[string]*snapshotSchedule{}
+			continue
+		}
+
 		// XXX this copy is so we can free the mutex quickly for more additions
 		volumeCopy := map[string]*config.Volume{}
 
@@ -155,27 +273,39 @@ func (dc *DaemonConfig) loop() {
 		}
 		volumeMutex.Unlock()
 
+		now := time.Now()
+
+		for volume := range schedules {
+			if val, ok := volumeCopy[volume]; !ok || !val.RuntimeOptions.UseSnapshots {
+				delete(schedules, volume)
+			}
+		}
+
 		for volume, val := range volumeCopy {
 			if val.RuntimeOptions.UseSnapshots {
-				freq, err := time.ParseDuration(val.RuntimeOptions.Snapshot.Frequency)
+				due, err := dc.snapshotDue(volume, val, now)
 				if err != nil {
-					logrus.Errorf("Volume %q has an invalid frequency. Skipping snapshot.", volume)
+					logrus.Errorf("Cannot schedule snapshots of volume %q: %v. Skipping snapshot.", volume, err)
+					continue
 				}
 
-				if time.Now().Unix()%int64(freq.Seconds()) == 0 {
+				if due {
 					var isUsed bool
 					var err error
 					if isUsed, err = dc.Config.IsVolumeInUse(val, dc.Global); err != nil {
 						logrus.Errorf("etcd error: %s", errors.EtcdToErrored(err)) // some issue with "etcd GET"; we should not hit this case
 					}
 
-					go func(val *config.Volume, isUsed bool) {
+					val, run := val, now
+					dc.operate(func() {
 						// XXX we still want to prune snapshots even if the volume is not in use.
 						if isUsed {
-							dc.createSnapshot(val)
+							if err := dc.createSnapshot(val); err == nil {
+								dc.recordSnapshotRun(val, run)
+							}
 						}
 						dc.pruneSnapshots(val)
-					}(val, isUsed)
+					})
 				}
 			}
 		}
@@ -0,0 +1,82 @@
+package volsupervisor
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
+
+	. "gopkg.in/check.v1"
+)
+
+type loopSuite struct{}
+
+var _ = Suite(&loopSuite{})
+
+// testScheduledSnapshots takes and prunes snapshots of a volume of the
+// backend the way scheduled snapshots do: with only what the volume itself
+// carries.
+func (s *loopSuite) testScheduledSnapshots(c *C, backendName string, val *config.Volume) {
+	crudDrv, err := backend.NewCRUDDriver(backendName)
+	c.Assert(err, IsNil)
+	snapDrv, err := backend.NewSnapshotDriver(backendName)
+	c.Assert(err, IsNil)
+
+	createOpts := storage.DriverOptions{
+		Volume:    storage.Volume{Name: val.String(), Size: 10, Params: val.DriverOptions},
+		FSOptions: storage.FSOptions{Type: "ext4", CreateCommand: "mkfs.ext4 -m0 %"},
+		Timeout:   5 * time.Second,
+	}
+
+	c.Assert(crudDrv.Create(createOpts), IsNil)
+	defer crudDrv.Destroy(createOpts)
+
+	driverOpts := snapshotDriverOptions(val, 5*time.Second)
+	now := time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	first, err := takeSnapshot(val, snapDrv, driverOpts, now)
+	c.Assert(err, IsNil)
+	second, err := takeSnapshot(val, snapDrv, driverOpts, now.Add(time.Hour))
+	c.Assert(err, IsNil)
+
+	list, err := snapDrv.ListSnapshots(driverOpts)
+	c.Assert(err, IsNil)
+	sort.Strings(list)
+	c.Assert(list, DeepEquals, []string{first, second})
+
+	val.RuntimeOptions.Snapshot.Keep = 1
+	c.Assert(applyRetention(val, snapDrv, driverOpts, now.Add(2*time.Hour)), IsNil)
+
+	list, err = snapDrv.ListSnapshots(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []string{second})
+}
+
+func (s *loopSuite) TestSnapshotDriverOptions(c *C) {
+	val := &config.Volume{
+		PolicyName:    "test",
+		VolumeName:    "scheduled",
+		DriverOptions: map[string]string{"group": "volplugin", "pool": "thinpool"},
+	}
+
+	do := snapshotDriverOptions(val, 5*time.Second)
+	c.Assert(do.Volume.Name, Equals, "test/scheduled")
+	c.Assert(do.Volume.Params, DeepEquals, storage.Params{"group": "volplugin", "pool": "thinpool"})
+	c.Assert(do.Timeout, Equals, 5*time.Second)
+}
+
+func (s *loopSuite) TestScheduledSnapshotsLoopback(c *C) {
+	path, err := ioutil.TempDir("", "volsupervisor-loopback")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(path)
+
+	s.testScheduledSnapshots(c, "loopback", &config.Volume{
+		PolicyName:    "test",
+		VolumeName:    "scheduled",
+		DriverOptions: map[string]string{"path": path},
+	})
+}
@@ -0,0 +1,106 @@
+package volsupervisor
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/volplugin/config"
+)
+
+// snapshotSchedule is when the next scheduled snapshot of a volume is due.
+type snapshotSchedule struct {
+	// config is the snapshot configuration next was worked out from.
+	config config.SnapshotConfig
+	next   time.Time
+}
+
+// schedules are the snapshot schedules of the volumes, by name. Only loop
+// uses them.
+var schedules = map[string]*snapshotSchedule{}
+
+// volumeJitter returns how long the snapshots of the volume are delayed: a
+// part of max which only depends on the name of the volume, so its snapshots
+// stay evenly spaced.
+func volumeJitter(volume string, max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(volume))
+	return time.Duration(hash.Sum64() % uint64(max))
+}
+
+// nextSnapshot returns when the first scheduled snapshot of the volume after
+// lastRun is due.
+func nextSnapshot(volume string, sc *config.SnapshotConfig, lastRun time.Time) (time.Time, error) {
+	schedule, err := sc.ParseSchedule()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	max, err := sc.MaxJitter(schedule, lastRun)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// a delay of half the interval or more could skip or double snapshots.
+	next := schedule.Next(lastRun)
+	if interval := schedule.Next(next).Sub(next); max > interval/2 {
+		max = interval / 2
+	}
+
+	jitter := volumeJitter(volume, max)
+
+	// lastRun was delayed by the jitter too, so the slot it ran for is
+	// jitter before it.
+	return schedule.Next(lastRun.Add(-jitter)).Add(jitter), nil
+}
+
+// snapshotDue returns true if the scheduled snapshot of the volume is due at
+// now. The schedule moves on to the next slot either way, but the run is only
+// recorded with recordSnapshotRun once the snapshot was taken. A run which was
+// missed, failed or cut off by a crash or a change of leader is caught up,
+// once, as soon as a volsupervisor leads again.
+func (dc *DaemonConfig) snapshotDue(volume string, val *config.Volume, now time.Time) (bool, error) {
+	sched, ok := schedules[volume]
+	if !ok || sched.config != val.RuntimeOptions.Snapshot {
+		lastRun, err := dc.Config.GetSnapshotRun(val.PolicyName, val.VolumeName)
+		if err != nil {
+			return false, err
+		}
+
+		// volumes which never had a scheduled snapshot start from now.
+		if lastRun.IsZero() {
+			lastRun = now
+		}
+
+		next, err := nextSnapshot(volume, &val.RuntimeOptions.Snapshot, lastRun)
+		if err != nil {
+			return false, err
+		}
+
+		sched = &snapshotSchedule{config: val.RuntimeOptions.Snapshot, next: next}
+		schedules[volume] = sched
+	}
+
+	if now.Before(sched.next) {
+		return false, nil
+	}
+
+	next, err := nextSnapshot(volume, &sched.config, now)
+	if err != nil {
+		return false, err
+	}
+
+	sched.next = next
+	return true, nil
+}
+
+// recordSnapshotRun records that the scheduled snapshot due at run was taken.
+func (dc *DaemonConfig) recordSnapshotRun(val *config.Volume, run time.Time) {
+	if err := dc.Config.PublishSnapshotRun(val.PolicyName, val.VolumeName, run); err != nil {
+		logrus.Errorf("Could not record the snapshot run of volume %q: %v", val, err)
+	}
+}
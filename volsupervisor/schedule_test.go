@@ -0,0 +1,111 @@
+package volsupervisor
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/db/impl/memory"
+
+	. "gopkg.in/check.v1"
+)
+
+type scheduleSuite struct{}
+
+var _ = Suite(&scheduleSuite{})
+
+func TestSchedule(t *T) { TestingT(t) }
+
+func (s *scheduleSuite) TestVolumeJitter(c *C) {
+	c.Assert(volumeJitter("policy1/test", 0), Equals, time.Duration(0))
+
+	jitter := volumeJitter("policy1/test", time.Minute)
+	c.Assert(jitter >= 0 && jitter < time.Minute, Equals, true)
+	c.Assert(volumeJitter("policy1/test", time.Minute), Equals, jitter)
+
+	// volumes are spread out.
+	spread := map[time.Duration]bool{}
+	for _, volume := range []string{"policy1/a", "policy1/b", "policy1/c", "policy2/a"} {
+		spread[volumeJitter(volume, time.Minute)] = true
+	}
+	c.Assert(len(spread) > 1, Equals, true)
+}
+
+func (s *scheduleSuite) TestNextSnapshot(c *C) {
+	day := func(hour, min int) time.Time {
+		return time.Date(2016, 5, 1, hour, min, 0, 0, time.Local)
+	}
+
+	sc := &config.SnapshotConfig{Schedule: "0 2 * * *", Jitter: "10m"}
+	jitter := volumeJitter("policy1/test", 10*time.Minute)
+
+	next, err := nextSnapshot("policy1/test", sc, day(1, 0))
+	c.Assert(err, IsNil)
+	c.Assert(next, Equals, day(2, 0).Add(jitter))
+
+	// the run at the delayed time is for the slot it was delayed from.
+	next, err = nextSnapshot("policy1/test", sc, next)
+	c.Assert(err, IsNil)
+	c.Assert(next, Equals, day(2, 0).Add(24*time.Hour+jitter))
+
+	// runs missed while down are due at once.
+	next, err = nextSnapshot("policy1/test", sc, day(2, 0).Add(jitter).Add(-48*time.Hour))
+	c.Assert(err, IsNil)
+	c.Assert(next.Before(day(1, 0)), Equals, true)
+
+	// jitter is at most half the interval.
+	sc = &config.SnapshotConfig{Frequency: "2s", Jitter: "1h"}
+	next, err = nextSnapshot("policy1/test", sc, day(1, 0))
+	c.Assert(err, IsNil)
+	c.Assert(next.After(day(1, 0)), Equals, true)
+	c.Assert(next.Sub(day(1, 0)) <= 3*time.Second, Equals, true)
+
+	_, err = nextSnapshot("policy1/test", &config.SnapshotConfig{Frequency: "garbage"}, day(1, 0))
+	c.Assert(err, NotNil)
+}
+
+func (s *scheduleSuite) TestSnapshotDue(c *C) {
+	schedules = map[string]*snapshotSchedule{}
+	defer func() { schedules = map[string]*snapshotSchedule{} }()
+
+	dc := &DaemonConfig{Config: config.NewClientFromKeysAPI("/volplugin", memory.NewClient("/volplugin").KeysAPI())}
+	val := &config.Volume{
+		PolicyName: "policy1",
+		VolumeName: "test",
+		RuntimeOptions: config.RuntimeOptions{
+			UseSnapshots: true,
+			Snapshot:     config.SnapshotConfig{Frequency: "1h"},
+		},
+	}
+
+	start := time.Date(2016, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	due, err := dc.snapshotDue(val.String(), val, start)
+	c.Assert(err, IsNil)
+	c.Assert(due, Equals, false)
+
+	due, err = dc.snapshotDue(val.String(), val, start.Add(time.Hour))
+	c.Assert(err, IsNil)
+	c.Assert(due, Equals, true)
+
+	// a due run is only recorded once the snapshot was taken.
+	lastRun, err := dc.Config.GetSnapshotRun("policy1", "test")
+	c.Assert(err, IsNil)
+	c.Assert(lastRun.IsZero(), Equals, true)
+
+	dc.recordSnapshotRun(val, start.Add(time.Hour))
+	lastRun, err = dc.Config.GetSnapshotRun("policy1", "test")
+	c.Assert(err, IsNil)
+	c.Assert(lastRun.Equal(start.Add(time.Hour)), Equals, true)
+
+	// the run at start+2h failed and is not recorded; after a restart it is
+	// caught up, once.
+	schedules = map[string]*snapshotSchedule{}
+	due, err = dc.snapshotDue(val.String(), val, start.Add(3*time.Hour+time.Minute))
+	c.Assert(err, IsNil)
+	c.Assert(due, Equals, true)
+
+	due, err = dc.snapshotDue(val.String(), val, start.Add(3*time.Hour+2*time.Minute))
+	c.Assert(err, IsNil)
+	c.Assert(due, Equals, false)
+}
@@ -3,6 +3,7 @@ package volsupervisor
 import (
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -11,8 +12,8 @@ import (
 	wait "github.com/jbeda/go-wait"
 
 	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/db/store"
 	"github.com/contiv/volplugin/info"
-	"github.com/contiv/volplugin/lock"
 	"github.com/contiv/volplugin/watch"
 )
 
@@ -22,11 +23,23 @@ type DaemonConfig struct {
 	Global   *config.Global
 	Config   *config.Client
 	Hostname string
+
+	// use is the volsupervisor lock this volsupervisor leads with.
+	use *config.UseVolsupervisor
+	// leaderMutex guards the fields below. leading is set while this
+	// volsupervisor holds the lock, and resigned once it is shutting down;
+	// stopChan stops refreshing the lock. operations are the snapshot
+	// operations started while leading.
+	leaderMutex sync.Mutex
+	leading     bool
+	resigned    bool
+	stopChan    chan struct{}
+	operations  sync.WaitGroup
 }
 
 // Daemon is the top-level entrypoint for the volsupervisor from the CLI.
 func Daemon(ctx *cli.Context) {
-	cfg, err := config.NewClient(ctx.String("prefix"), ctx.StringSlice("etcd"))
+	cfg, err := store.NewConfigClient(ctx.String("store"), ctx.String("prefix"), ctx.StringSlice("etcd"))
 	if err != nil {
 		logrus.Fatal(err)
 	}
@@ -46,24 +59,21 @@ retry:
 	dc.Config.WatchGlobal(globalChan)
 	go dc.watchAndSetGlobal(globalChan)
 	go info.HandleDebugSignal()
-
-	stopChan, err := lock.NewDriver(dc.Config).AcquireWithTTLRefresh(&config.UseVolsupervisor{Hostname: dc.Hostname}, dc.Global.TTL, dc.Global.Timeout)
-	if err != nil {
-		logrus.Fatal("Could not start volsupervisor: already in use")
-	}
+	go info.ServeDebug(ctx.String("debug-listen"))
 
 	sigChan := make(chan os.Signal, 1)
 
 	go func() {
 		<-sigChan
-		logrus.Infof("Removing volsupervisor global lock; waiting %v for lock to clear", dc.Global.TTL)
-		stopChan <- struct{}{}
-		time.Sleep(wait.Jitter(dc.Global.TTL+time.Second, 0)) // give us enough time to try to clear the lock
+		logrus.Info("Shutting down; handing the volsupervisor lock off")
+		dc.resign()
 		os.Exit(0)
 	}()
 
 	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
 
+	dc.lead()
+
 	dc.signalSnapshot()
 	dc.updateVolumes()
 	// doing it here ensures the goroutine is created when the first poll completes.
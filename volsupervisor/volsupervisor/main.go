@@ -37,12 +37,22 @@ func main() {
 			Usage: "URL for etcd",
 			Value: &cli.StringSlice{"http://localhost:2379"},
 		},
+		cli.StringFlag{
+			Name:   "store",
+			Usage:  "URL of the data store, e.g. consul://localhost:8500; overrides --etcd",
+			EnvVar: "STORE",
+		},
 		cli.StringFlag{
 			Name:   "host-label",
 			Usage:  "Set the internal hostname",
 			EnvVar: "HOSTLABEL",
 			Value:  host,
 		},
+		cli.StringFlag{
+			Name:   "debug-listen",
+			Usage:  "listen address for the debug endpoint serving /metrics; disabled if empty",
+			EnvVar: "DEBUG_LISTEN",
+		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -13,6 +13,11 @@ func (dc *DaemonConfig) signalSnapshot() {
 
 	go func() {
 		for snapshot := range snapshotChan {
+			// the leader takes the snapshot and removes the signal.
+			if !dc.leads() {
+				continue
+			}
+
 			parts := strings.SplitN(snapshot.Key, "/", 2)
 			if len(parts) != 2 {
 				logrus.Errorf("Invalid volume name %q; please remove this signal manually.", snapshot.Key)
@@ -24,7 +29,10 @@ func (dc *DaemonConfig) signalSnapshot() {
 				continue
 			}
 
-			go dc.createSnapshot(vol)
+			if !dc.operate(func() { dc.createSnapshot(vol) }) {
+				continue
+			}
+
 			if err := dc.Config.RemoveTakeSnapshot(vol.String()); err != nil {
 				logrus.Errorf("Error removing snapshot reference: %v", err)
 				continue
@@ -38,6 +38,11 @@ type Watcher struct {
 	ErrorChannel chan error
 	StopOnError  bool
 	Recursive    bool
+	// AfterIndex, if set, starts the watch after this etcd index instead of
+	// at the current one, so events since then are not missed.
+	AfterIndex uint64
+
+	done chan struct{}
 }
 
 var etcdClient client.KeysAPI
@@ -65,9 +70,17 @@ func NewWatcher(channel chan *Watch, path string, fun WatcherFunc) *Watcher {
 		StopChannel:  make(chan struct{}, 1),
 		ErrorChannel: make(chan error, 1),
 		Recursive:    true,
+		done:         make(chan struct{}),
 	}
 }
 
+// Done returns a channel which is closed once the watch stops. WatcherFuncs
+// may select on it, so they do not block sending to a Channel which is no
+// longer read.
+func (w *Watcher) Done() <-chan struct{} {
+	return w.done
+}
+
 // Create a watch. Given a watcher, creates a watch and runs it in a goroutine,
 // then registers it with the watch registry.
 func Create(w *Watcher) {
@@ -80,12 +93,15 @@ func Create(w *Watcher) {
 	defer watcherMutex.Unlock()
 
 	go func(w *Watcher) {
-		watcher := etcdClient.Watcher(w.Path, &client.WatcherOptions{Recursive: w.Recursive})
+		watcher := etcdClient.Watcher(w.Path, &client.WatcherOptions{Recursive: w.Recursive, AfterIndex: w.AfterIndex})
 
 		ctx, cancel := context.WithCancel(context.Background())
 		go func() {
 			<-w.StopChannel
 			cancel()
+			if w.done != nil {
+				close(w.done)
+			}
 		}()
 
 		for {
@@ -132,3 +148,22 @@ func Stop(path string) {
 
 	delete(watchers, path)
 }
+
+// StopWatcher stops a single watch, leaving the other watches of its path
+// alone.
+func StopWatcher(w *Watcher) {
+	watcherMutex.Lock()
+	defer watcherMutex.Unlock()
+
+	for i, watcher := range watchers[w.Path] {
+		if watcher == w {
+			w.StopChannel <- struct{}{}
+			watchers[w.Path] = append(watchers[w.Path][:i], watchers[w.Path][i+1:]...)
+			break
+		}
+	}
+
+	if len(watchers[w.Path]) == 0 {
+		delete(watchers, w.Path)
+	}
+}
@@ -79,3 +79,36 @@ func (s *watchSuite) TestBasic(c *C) {
 
 	c.Assert(x, Equals, 0)
 }
+
+func (s *watchSuite) TestStopWatcherAndAfterIndex(c *C) {
+	resp, err := etcdClient.Set(context.Background(), "/watch/before", "", nil)
+	c.Assert(err, IsNil)
+
+	fun := func(resp *client.Response, w *Watcher) {
+		select {
+		case w.Channel <- &Watch{Key: resp.Node.Key}:
+		case <-w.Done():
+		}
+	}
+
+	// resuming from the index before the key was set sees it.
+	w := NewWatcher(make(chan *Watch), "/watch", fun)
+	w.AfterIndex = resp.Node.ModifiedIndex - 1
+	Create(w)
+	c.Assert((<-w.Channel).Key, Equals, "/watch/before")
+
+	other := NewWatcher(make(chan *Watch), "/watch", fun)
+	Create(other)
+
+	StopWatcher(w)
+	<-w.Done()
+	c.Assert(watchers["/watch"], DeepEquals, []*Watcher{other})
+
+	setKey("/watch/after", "")
+	c.Assert((<-other.Channel).Key, Equals, "/watch/after")
+
+	StopWatcher(other)
+	<-other.Done()
+	_, ok := watchers["/watch"]
+	c.Assert(ok, Equals, false)
+}